@@ -11,6 +11,8 @@ import (
 
 	"code.google.com/p/go-uuid/uuid"
 
+	"github.com/cjc25/ae_money/handlers"
+	"github.com/cjc25/ae_money/storage"
 	"github.com/cjc25/ae_money/transaction"
 
 	"appengine"
@@ -40,7 +42,7 @@ func expectListAccountsResponse(t *testing.T, w *httptest.ResponseRecorder, k []
 		t.Fatalf("BAD TEST: Expected keys %v and accounts %v not same length", k, a)
 	}
 
-	var got []DatastoreAccount
+	var got []handlers.Account
 	d := json.NewDecoder(w.Body)
 	err := d.Decode(&got)
 	if err != nil {
@@ -122,7 +124,7 @@ func TestShowAccount_Success(t *testing.T) {
 
 	expectCode(t, http.StatusOK, w)
 
-	result := DatastoreAccountAndSplits{}
+	result := handlers.AccountAndSplits{}
 	d := json.NewDecoder(w.Body)
 	if err := d.Decode(&result); err != nil {
 		t.Fatal(err)
@@ -131,8 +133,8 @@ func TestShowAccount_Success(t *testing.T) {
 	if result.IntID != k[0].IntID() {
 		t.Errorf("Expected result id to be %v, got %v", k[0].IntID(), result.IntID)
 	}
-	if result.Account.Name != a[0].Name {
-		t.Errorf("Expected result name to be %v, got %v", a[0].Name, result.Account.Name)
+	if result.Account.Account.Name != a[0].Name {
+		t.Errorf("Expected result name to be %v, got %v", a[0].Name, result.Account.Account.Name)
 	}
 	if len(result.Splits) != 1 {
 		t.Fatalf("Expected 1 split in result. Got %v", len(result.Splits))
@@ -193,7 +195,7 @@ func TestNewAccount_Success(t *testing.T) {
 	}
 
 	// Check that the keys are the same by checking the strings are the same
-	result := DatastoreAccount{}
+	result := handlers.Account{}
 	d := json.NewDecoder(w.Body)
 	err = d.Decode(&result)
 	if err != nil {
@@ -206,6 +208,57 @@ func TestNewAccount_Success(t *testing.T) {
 	}
 }
 
+func TestNewAccount_SuccessWithParent(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, r, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := insertAccountsOrDie(t, c, []transaction.Account{{Name: "Food", Type: transaction.Expense}}, u)
+	r.Body = ioutil.NopCloser(bytes.NewBufferString(
+		fmt.Sprintf(`{"name":"Groceries","type":"expense","parent":%v}`, k[0].IntID())))
+
+	NewAccount(&requestParams{w: w, r: r, c: c, u: u})
+
+	expectCode(t, http.StatusOK, w)
+	var result struct {
+		Account struct {
+			Parent int64 `json:"parent"`
+		} `json:"account"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Account.Parent != k[0].IntID() {
+		t.Errorf("Expected parent %v, got %v", k[0].IntID(), result.Account.Parent)
+	}
+}
+
+func TestNewAccount_FailureParentOtherType(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, r, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := insertAccountsOrDie(t, c, []transaction.Account{{Name: "Checking", Type: transaction.Asset}}, u)
+	r.Body = ioutil.NopCloser(bytes.NewBufferString(
+		fmt.Sprintf(`{"name":"Groceries","type":"expense","parent":%v}`, k[0].IntID())))
+
+	NewAccount(&requestParams{w: w, r: r, c: c, u: u})
+
+	expectCode(t, http.StatusBadRequest, w)
+	expectNumAccounts(t, c, u, 1)
+}
+
+func TestNewAccount_FailureNoSuchParent(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, r, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	r.Body = ioutil.NopCloser(bytes.NewBufferString(`{"name":"Groceries","type":"expense","parent":12345}`))
+	NewAccount(&requestParams{w: w, r: r, c: c, u: u})
+
+	expectBadNewAccountResponse(t, c, u, w)
+}
+
 // Expectation function for responses to failed NewAccount requests.
 func expectBadNewAccountResponse(t *testing.T, c appengine.Context, u *user.User, w *httptest.ResponseRecorder) {
 	q := datastore.NewQuery("Account").Ancestor(userKey(c, u)).KeysOnly()
@@ -319,3 +372,40 @@ func TestDeleteAccount_Success(t *testing.T) {
 	expectCode(t, http.StatusOK, w)
 	expectNumAccounts(t, c, u, 0)
 }
+
+func TestAccountHandlers_MemoryStore(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	s := storage.NewMemoryStore()
+
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("POST", "", bytes.NewBufferString(`{"name":"a1"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	NewAccount(&requestParams{w: w, r: r, u: u, s: s})
+	expectCode(t, http.StatusOK, w)
+	var created handlers.Account
+	if err := json.NewDecoder(w.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+
+	w = httptest.NewRecorder()
+	ListAccounts(&requestParams{w: w, u: u, s: s})
+	expectBody(t, fmt.Sprintf(`[{"account":{"name":"a1","total":0},"key":%v}]`, created.IntID), w)
+
+	other := httptest.NewRecorder()
+	ListAccounts(&requestParams{w: other, u: &user.User{Email: "other@example.com"}, s: s})
+	expectBody(t, "[]", other)
+
+	w = httptest.NewRecorder()
+	v := map[string]string{"key": fmt.Sprint(created.IntID)}
+	ShowAccount(&requestParams{w: w, u: u, v: v, s: s})
+	expectCode(t, http.StatusOK, w)
+	var shown handlers.AccountAndSplits
+	if err := json.NewDecoder(w.Body).Decode(&shown); err != nil {
+		t.Fatal(err)
+	}
+	if shown.IntID != created.IntID || shown.Account.Account.Name != "a1" || len(shown.Splits) != 0 {
+		t.Errorf("Expected a1 with no splits, got %+v", shown)
+	}
+}
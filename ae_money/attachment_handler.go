@@ -0,0 +1,286 @@
+package ae_money
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"time"
+
+	"appengine"
+	"appengine/datastore"
+)
+
+// maxAttachmentSize is the largest attachment that can be uploaded, in bytes.
+const maxAttachmentSize = 10 << 20
+
+// attachmentContentTypes are the content types attachments can have: photos
+// of receipts, and PDF invoices.
+var attachmentContentTypes = map[string]bool{
+	"application/pdf": true,
+	"image/gif":       true,
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/webp":      true,
+}
+
+// An Attachment is a document, like a receipt, attached to a transaction.
+// Attachments are children of their user, and their contents are kept in the
+// AttachmentStore under Ref.
+type Attachment struct {
+	Transaction string    `json:"transaction"`
+	Name        string    `json:"name"`
+	ContentType string    `json:"contentType"`
+	Size        int64     `json:"size"`
+	Ref         string    `json:"-"`
+	Created     time.Time `json:"created"`
+}
+
+// A VoidedTransaction marks that the user's transaction with its key's name
+// was voided. Voiding deletes a transaction's Attachments, and this stops new
+// ones being uploaded after.
+type VoidedTransaction struct {
+	Voided time.Time
+}
+
+// errVoidedTransaction is returned when attaching to a voided transaction.
+var errVoidedTransaction = errors.New("Can't attach to a voided transaction.")
+
+func voidedTransactionKey(c appengine.Context, userKey *datastore.Key, transactionID string) *datastore.Key {
+	return datastore.NewKey(c, "VoidedTransaction", transactionID, 0, userKey)
+}
+
+// DatastoreAttachment wraps an Attachment for JSON responses that include a
+// datastore key.
+type DatastoreAttachment struct {
+	Attachment *Attachment `json:"attachment"`
+	IntID      int64       `json:"key"`
+}
+
+// getAttachment gets the user's Attachment identified by the gorilla/mux
+// vars, along with its key. It returns datastore.ErrNoSuchEntity if the
+// Attachment doesn't exist or belongs to a different transaction.
+func getAttachment(c appengine.Context, userKey *datastore.Key, v map[string]string) (*datastore.Key, *Attachment, error) {
+	var intID int64
+	if _, err := fmt.Sscan(v["key"], &intID); err != nil {
+		return nil, nil, datastore.ErrNoSuchEntity
+	}
+
+	k := datastore.NewKey(c, "Attachment", "", intID, userKey)
+	var a Attachment
+	if err := datastore.Get(c, k, &a); err != nil {
+		return nil, nil, err
+	}
+	if a.Transaction != v["id"] {
+		return nil, nil, datastore.ErrNoSuchEntity
+	}
+	return k, &a, nil
+}
+
+// deleteAttachments deletes Attachments and their contents.
+func deleteAttachments(c appengine.Context, keys []*datastore.Key, a []Attachment) error {
+	if err := datastore.DeleteMulti(c, keys); err != nil {
+		return err
+	}
+	deleteAttachmentContents(c, keys, a)
+	return nil
+}
+
+// deleteAttachmentContents deletes the contents of Attachments that are
+// already deleted. Contents that can't be deleted are only logged: they're
+// unreachable once the Attachment is gone.
+func deleteAttachmentContents(c appengine.Context, keys []*datastore.Key, a []Attachment) {
+	for i := range a {
+		if err := attachments.Delete(c, a[i].Ref); err != nil {
+			c.Errorf("Failed to delete contents of attachment %v: %v", keys[i], err)
+		}
+	}
+}
+
+// voidAttachments deletes the Attachments of the user's transaction with id
+// transactionID, and marks it voided so no more can be uploaded. It must be
+// called in the datastore transaction that voids it. The contents aren't in
+// datastore, so the caller deletes them with deleteAttachmentContents once
+// the void commits.
+func voidAttachments(c appengine.Context, userKey *datastore.Key, transactionID string) ([]*datastore.Key, []Attachment, error) {
+	var a []Attachment
+	keys, err := datastore.NewQuery("Attachment").Ancestor(userKey).
+		Filter("Transaction =", transactionID).GetAll(c, &a)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := datastore.DeleteMulti(c, keys); err != nil {
+		return nil, nil, err
+	}
+	_, err = datastore.Put(c, voidedTransactionKey(c, userKey, transactionID), &VoidedTransaction{time.Now()})
+	return keys, a, err
+}
+
+// UploadAttachment attaches the request body to the transaction identified by
+// the gorilla/mux vars, and prints the new Attachment. Its name is the "name"
+// form value. The content type is sniffed from the body rather than trusted
+// from the request, and must be one of attachmentContentTypes. Voided
+// transactions can't have attachments.
+func UploadAttachment(p *requestParams) {
+	w, r, c, u, v := p.w, p.r, p.c, p.u, p.v
+
+	userKey := userKey(c, u)
+	_, splits, err := getTransactionSplits(c, userKey, v["id"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(splits) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(r.Body, maxAttachmentSize+1))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(data) > maxAttachmentSize {
+		http.Error(w, fmt.Sprintf("Attachments can't be over %v bytes", maxAttachmentSize),
+			http.StatusRequestEntityTooLarge)
+		return
+	}
+	contentType, _, err := mime.ParseMediaType(http.DetectContentType(data))
+	if err != nil || !attachmentContentTypes[contentType] {
+		http.Error(w, fmt.Sprintf("Can't attach files of type %v", contentType),
+			http.StatusUnsupportedMediaType)
+		return
+	}
+
+	a := &Attachment{
+		Transaction: v["id"],
+		Name:        r.FormValue("name"),
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		Created:     time.Now(),
+	}
+	if a.Name == "" {
+		a.Name = "attachment"
+	}
+	a.Ref, err = attachments.Put(c, contentType, data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Check the transaction again in the datastore transaction that saves the
+	// Attachment, so it can't be attached after a concurrent void.
+	var k *datastore.Key
+	err = datastore.RunInTransaction(c, func(c appengine.Context) error {
+		_, splits, err := getTransactionSplits(c, userKey, v["id"])
+		if err != nil {
+			return err
+		}
+		if len(splits) == 0 {
+			return datastore.ErrNoSuchEntity
+		}
+		err = datastore.Get(c, voidedTransactionKey(c, userKey, v["id"]), &VoidedTransaction{})
+		if err == nil {
+			return errVoidedTransaction
+		}
+		if err != datastore.ErrNoSuchEntity {
+			return err
+		}
+
+		k, err = datastore.Put(c, datastore.NewIncompleteKey(c, "Attachment", userKey), a)
+		return err
+	}, nil)
+	if err != nil {
+		if err := attachments.Delete(c, a.Ref); err != nil {
+			c.Errorf("Failed to delete contents of unsaved attachment: %v", err)
+		}
+		switch err {
+		case datastore.ErrNoSuchEntity:
+			w.WriteHeader(http.StatusNotFound)
+		case errVoidedTransaction:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	e := json.NewEncoder(w)
+	if err := e.Encode(&DatastoreAttachment{a, k.IntID()}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// ListAttachments prints the Attachments of the transaction identified by the
+// gorilla/mux vars, oldest first.
+func ListAttachments(p *requestParams) {
+	w, c, u, v := p.w, p.c, p.u, p.v
+
+	q := datastore.NewQuery("Attachment").Ancestor(userKey(c, u)).
+		Filter("Transaction =", v["id"]).Order("Created")
+	// We make an empty slice so we can return [] if there are no attachments.
+	a := make([]Attachment, 0)
+	keys, err := q.GetAll(c, &a)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	result := make([]DatastoreAttachment, len(a))
+	for i := range keys {
+		result[i] = DatastoreAttachment{&a[i], keys[i].IntID()}
+	}
+
+	e := json.NewEncoder(w)
+	if err := e.Encode(result); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// DownloadAttachment writes the contents of the Attachment identified by the
+// gorilla/mux vars.
+func DownloadAttachment(p *requestParams) {
+	w, c, u, v := p.w, p.c, p.u, p.v
+
+	_, a, err := getAttachment(c, userKey(c, u), v)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	contents, err := attachments.Open(c, a.Ref)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer contents.Close()
+
+	w.Header().Set("Content-Type", a.ContentType)
+	w.Header().Set("Content-Length", fmt.Sprint(a.Size))
+	w.Header().Set("Content-Disposition",
+		mime.FormatMediaType("attachment", map[string]string{"filename": a.Name}))
+	if _, err := io.Copy(w, contents); err != nil {
+		c.Errorf("Failed to write attachment %v: %v", v["key"], err)
+	}
+}
+
+// DeleteAttachment deletes the Attachment identified by the gorilla/mux vars.
+func DeleteAttachment(p *requestParams) {
+	w, c, u, v := p.w, p.c, p.u, p.v
+
+	k, a, err := getAttachment(c, userKey(c, u), v)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if err := deleteAttachments(c, []*datastore.Key{k}, []Attachment{*a}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,284 @@
+package ae_money
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/cjc25/ae_money/transaction"
+
+	"appengine"
+	"appengine/datastore"
+	"appengine/user"
+)
+
+const testPDF = "%PDF-1.4\nreceipt"
+
+// useTestAttachmentStore points attachments at an empty local store. The
+// returned function restores the old store and removes the new one.
+func useTestAttachmentStore(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "attachments")
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := attachments
+	attachments = &localAttachmentStore{dir}
+	return func() {
+		attachments = old
+		os.RemoveAll(dir)
+	}
+}
+
+// Setup method which commits a transaction for u and returns its id.
+func setUpTestAttachmentTransactionOrDie(t *testing.T, c appengine.Context, u *user.User) string {
+	k := insertAccountsOrDie(t, c, []transaction.Account{{Name: "a1"}, {Name: "a2"}}, u)
+	return newTestTransactionOrDie(t, c, u, []transaction.AmountType{-123, 123},
+		[]int64{k[0].IntID(), k[1].IntID()}, "Receipt", "2014-11-01")
+}
+
+// uploadTestAttachment uploads data to the transaction with id, as u.
+func uploadTestAttachment(t *testing.T, c appengine.Context, u *user.User, id, data string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("POST", "/?name=receipt.pdf", bytes.NewBufferString(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	UploadAttachment(&requestParams{w: w, r: r, c: c, u: u, v: map[string]string{"id": id}})
+	return w
+}
+
+// Setup method which uploads a test PDF and returns its key.
+func uploadTestAttachmentOrDie(t *testing.T, c appengine.Context, u *user.User, id string) int64 {
+	w := uploadTestAttachment(t, c, u, id, testPDF)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Failed to upload test attachment: %v", w.Body.String())
+	}
+	var a DatastoreAttachment
+	if err := json.NewDecoder(w.Body).Decode(&a); err != nil {
+		t.Fatal(err)
+	}
+	return a.IntID
+}
+
+// Expectation function for the number of attachments a user has.
+func expectNumAttachments(t *testing.T, c appengine.Context, u *user.User, expected int) {
+	count, err := datastore.NewQuery("Attachment").Ancestor(userKey(c, u)).Count(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != expected {
+		t.Errorf("Expected %v attachments, got %v", expected, count)
+	}
+}
+
+func TestUploadAttachment(t *testing.T) {
+	defer useTestAttachmentStore(t)()
+	u := &user.User{Email: "test@example.com"}
+	_, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	id := setUpTestAttachmentTransactionOrDie(t, c, u)
+	w := uploadTestAttachment(t, c, u, id, testPDF)
+
+	expectCode(t, http.StatusOK, w)
+	var a DatastoreAttachment
+	if err := json.NewDecoder(w.Body).Decode(&a); err != nil {
+		t.Fatal(err)
+	}
+	if a.Attachment.Transaction != id || a.Attachment.Name != "receipt.pdf" ||
+		a.Attachment.ContentType != "application/pdf" || a.Attachment.Size != int64(len(testPDF)) {
+		t.Errorf("Unexpected attachment %+v", a.Attachment)
+	}
+	expectNumAttachments(t, c, u, 1)
+}
+
+func TestUploadAttachment_FailureNoTransaction(t *testing.T) {
+	defer useTestAttachmentStore(t)()
+	u := &user.User{Email: "test@example.com"}
+	_, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	insertAccountsOrDie(t, c, []transaction.Account{{Name: "a1"}}, u)
+	w := uploadTestAttachment(t, c, u, "abc-123", testPDF)
+
+	expectCode(t, http.StatusNotFound, w)
+	expectNumAttachments(t, c, u, 0)
+}
+
+func TestUploadAttachment_FailureBadContentType(t *testing.T) {
+	defer useTestAttachmentStore(t)()
+	u := &user.User{Email: "test@example.com"}
+	_, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	id := setUpTestAttachmentTransactionOrDie(t, c, u)
+	w := uploadTestAttachment(t, c, u, id, "#!/bin/sh\nrm -rf /")
+
+	expectCode(t, http.StatusUnsupportedMediaType, w)
+	expectNumAttachments(t, c, u, 0)
+}
+
+func TestUploadAttachment_FailureTooLarge(t *testing.T) {
+	defer useTestAttachmentStore(t)()
+	u := &user.User{Email: "test@example.com"}
+	_, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	id := setUpTestAttachmentTransactionOrDie(t, c, u)
+	w := uploadTestAttachment(t, c, u, id, testPDF+string(make([]byte, maxAttachmentSize)))
+
+	expectCode(t, http.StatusRequestEntityTooLarge, w)
+	expectNumAttachments(t, c, u, 0)
+}
+
+func TestListAttachments(t *testing.T) {
+	defer useTestAttachmentStore(t)()
+	u := &user.User{Email: "test@example.com"}
+	w, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	id := setUpTestAttachmentTransactionOrDie(t, c, u)
+	k := uploadTestAttachmentOrDie(t, c, u, id)
+
+	ListAttachments(&requestParams{w: w, c: c, u: u, v: map[string]string{"id": id}})
+
+	var result []DatastoreAttachment
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 1 || result[0].IntID != k {
+		t.Errorf("Expected attachment %v, got %+v", k, result)
+	}
+}
+
+func TestDownloadAttachment(t *testing.T) {
+	defer useTestAttachmentStore(t)()
+	u := &user.User{Email: "test@example.com"}
+	w, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	id := setUpTestAttachmentTransactionOrDie(t, c, u)
+	k := uploadTestAttachmentOrDie(t, c, u, id)
+
+	DownloadAttachment(&requestParams{w: w, c: c, u: u,
+		v: map[string]string{"id": id, "key": fmt.Sprint(k)}})
+
+	expectCode(t, http.StatusOK, w)
+	expectBody(t, testPDF, w)
+	if got := w.Header().Get("Content-Type"); got != "application/pdf" {
+		t.Errorf("Expected content type application/pdf, got %v", got)
+	}
+}
+
+func TestDownloadAttachment_FailureWrongTransaction(t *testing.T) {
+	defer useTestAttachmentStore(t)()
+	u := &user.User{Email: "test@example.com"}
+	w, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	id := setUpTestAttachmentTransactionOrDie(t, c, u)
+	k := uploadTestAttachmentOrDie(t, c, u, id)
+
+	DownloadAttachment(&requestParams{w: w, c: c, u: u,
+		v: map[string]string{"id": "abc-123", "key": fmt.Sprint(k)}})
+
+	expectCode(t, http.StatusNotFound, w)
+}
+
+func TestDeleteAttachment(t *testing.T) {
+	defer useTestAttachmentStore(t)()
+	u := &user.User{Email: "test@example.com"}
+	w, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	id := setUpTestAttachmentTransactionOrDie(t, c, u)
+	k := uploadTestAttachmentOrDie(t, c, u, id)
+
+	DeleteAttachment(&requestParams{w: w, c: c, u: u,
+		v: map[string]string{"id": id, "key": fmt.Sprint(k)}})
+
+	expectCode(t, http.StatusOK, w)
+	expectNumAttachments(t, c, u, 0)
+	files, err := ioutil.ReadDir(attachments.(*localAttachmentStore).dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Errorf("Expected attachment contents to be deleted, got %v files", len(files))
+	}
+}
+
+func TestRepairLedger_KeepsAttachments(t *testing.T) {
+	defer useTestAttachmentStore(t)()
+	u := &user.User{Email: "test@example.com"}
+	w, r, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	id := setUpTestAttachmentTransactionOrDie(t, c, u)
+	uploadTestAttachmentOrDie(t, c, u, id)
+	orphan := &Attachment{Transaction: "abc-123", Ref: "missing"}
+	if _, err := datastore.Put(c, datastore.NewIncompleteKey(c, "Attachment", userKey(c, u)), orphan); err != nil {
+		t.Fatal(err)
+	}
+
+	// Even an Attachment without a transaction is left alone, since one may be
+	// uploaded for a transaction committed after the repair read its Splits.
+	RepairLedger(&requestParams{w: w, r: r, c: c})
+
+	expectCode(t, http.StatusOK, w)
+	expectNumAttachments(t, c, u, 2)
+}
+
+func TestVoidTransaction_DeletesAttachments(t *testing.T) {
+	defer useTestAttachmentStore(t)()
+	u := &user.User{Email: "test@example.com"}
+	w, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	id := setUpTestAttachmentTransactionOrDie(t, c, u)
+	uploadTestAttachmentOrDie(t, c, u, id)
+	k := insertAccountsOrDie(t, c, []transaction.Account{{Name: "a3"}, {Name: "a4"}}, u)
+	other := newTestTransactionOrDie(t, c, u, []transaction.AmountType{-5, 5},
+		[]int64{k[0].IntID(), k[1].IntID()}, "Other receipt", "2014-11-02")
+	uploadTestAttachmentOrDie(t, c, u, other)
+
+	VoidTransaction(&requestParams{w: w, c: c, u: u, v: map[string]string{"id": id}})
+
+	expectCode(t, http.StatusOK, w)
+	expectNumAttachments(t, c, u, 1)
+	files, err := ioutil.ReadDir(attachments.(*localAttachmentStore).dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Errorf("Expected only the other attachment's contents to be kept, got %v files", len(files))
+	}
+
+	w = uploadTestAttachment(t, c, u, id, testPDF)
+	expectCode(t, http.StatusBadRequest, w)
+	expectNumAttachments(t, c, u, 1)
+	if files, err := ioutil.ReadDir(attachments.(*localAttachmentStore).dir); err != nil || len(files) != 1 {
+		t.Errorf("Expected rejected attachment's contents to be deleted, got %v files: %v", len(files), err)
+	}
+}
+
+func TestReverseTransaction_KeepsAttachments(t *testing.T) {
+	defer useTestAttachmentStore(t)()
+	u := &user.User{Email: "test@example.com"}
+	w, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	id := setUpTestAttachmentTransactionOrDie(t, c, u)
+	uploadTestAttachmentOrDie(t, c, u, id)
+
+	ReverseTransaction(&requestParams{w: w, c: c, u: u, v: map[string]string{"id": id}})
+
+	expectCode(t, http.StatusOK, w)
+	expectNumAttachments(t, c, u, 1)
+	uploadTestAttachmentOrDie(t, c, u, id)
+}
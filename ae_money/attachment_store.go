@@ -0,0 +1,100 @@
+package ae_money
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"code.google.com/p/go-uuid/uuid"
+
+	"appengine"
+	"appengine/blobstore"
+)
+
+// An AttachmentStore holds the contents of Attachments, which are too big for
+// datastore entities. Contents are identified by an opaque ref chosen by the
+// store. None of the methods are transactional.
+type AttachmentStore interface {
+	// Put stores data, and returns its ref.
+	Put(c appengine.Context, contentType string, data []byte) (string, error)
+	// Open returns a reader for the contents with ref.
+	Open(c appengine.Context, ref string) (io.ReadCloser, error)
+	// Delete removes the contents with ref. Deleting contents that don't exist
+	// isn't an error.
+	Delete(c appengine.Context, ref string) error
+}
+
+// attachments is the AttachmentStore used by the handlers: the blobstore in
+// production, and the local filesystem on the dev server.
+var attachments AttachmentStore
+
+func init() {
+	if appengine.IsDevAppServer() {
+		attachments = &localAttachmentStore{filepath.Join(os.TempDir(), "ae_money_attachments")}
+	} else {
+		attachments = blobstoreAttachmentStore{}
+	}
+}
+
+// blobstoreAttachmentStore is an AttachmentStore backed by the appengine
+// blobstore. Refs are blob keys.
+type blobstoreAttachmentStore struct{}
+
+func (blobstoreAttachmentStore) Put(c appengine.Context, contentType string, data []byte) (string, error) {
+	w, err := blobstore.Create(c, contentType)
+	if err != nil {
+		return "", err
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	k, err := w.Key()
+	return string(k), err
+}
+
+func (blobstoreAttachmentStore) Open(c appengine.Context, ref string) (io.ReadCloser, error) {
+	return ioutil.NopCloser(blobstore.NewReader(c, appengine.BlobKey(ref))), nil
+}
+
+func (blobstoreAttachmentStore) Delete(c appengine.Context, ref string) error {
+	return blobstore.Delete(c, appengine.BlobKey(ref))
+}
+
+// localAttachmentStore is an AttachmentStore which keeps each attachment in a
+// file under dir, for the dev server and tests. Refs are file names.
+type localAttachmentStore struct {
+	dir string
+}
+
+func (s *localAttachmentStore) Put(c appengine.Context, contentType string, data []byte) (string, error) {
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return "", err
+	}
+	ref := uuid.NewRandom().String()
+	f, err := os.OpenFile(filepath.Join(s.dir, ref), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return "", err
+	}
+	return ref, f.Close()
+}
+
+func (s *localAttachmentStore) Open(c appengine.Context, ref string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(s.dir, filepath.Base(ref)))
+}
+
+func (s *localAttachmentStore) Delete(c appengine.Context, ref string) error {
+	err := os.Remove(filepath.Join(s.dir, filepath.Base(ref)))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
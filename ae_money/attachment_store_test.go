@@ -0,0 +1,81 @@
+package ae_money
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestLocalAttachmentStore(t *testing.T) {
+	_, _, c := initTestRequestParams(t, nil)
+	defer c.Close()
+	dir, err := ioutil.TempDir("", "attachments")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s := &localAttachmentStore{dir}
+
+	ref, err := s.Put(c, "application/pdf", []byte(testPDF))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := s.Open(c, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(f)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != testPDF {
+		t.Errorf("Expected contents %q, got %q", testPDF, data)
+	}
+
+	if err := s.Delete(c, ref); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Open(c, ref); !os.IsNotExist(err) {
+		t.Errorf("Expected deleted contents to be gone, got %v", err)
+	}
+	if err := s.Delete(c, ref); err != nil {
+		t.Errorf("Expected deleting twice to succeed, got %v", err)
+	}
+}
+
+func TestLocalAttachmentStore_RefsStayInDir(t *testing.T) {
+	_, _, c := initTestRequestParams(t, nil)
+	defer c.Close()
+	s := &localAttachmentStore{"/nonexistent"}
+
+	if _, err := s.Open(c, "../etc/passwd"); !os.IsNotExist(err) {
+		t.Errorf("Expected refs to be confined to the store, got %v", err)
+	}
+}
+
+func TestBlobstoreAttachmentStore(t *testing.T) {
+	_, _, c := initTestRequestParams(t, nil)
+	defer c.Close()
+	s := blobstoreAttachmentStore{}
+
+	ref, err := s.Put(c, "application/pdf", []byte(testPDF))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := s.Open(c, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != testPDF {
+		t.Errorf("Expected contents %q, got %q", testPDF, data)
+	}
+	if err := s.Delete(c, ref); err != nil {
+		t.Fatal(err)
+	}
+}
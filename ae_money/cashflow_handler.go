@@ -0,0 +1,110 @@
+package ae_money
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/cjc25/ae_money/transaction"
+
+	"appengine"
+	"appengine/datastore"
+)
+
+// CashFlowClass overrides the transaction.DefaultActivity of an Account in
+// cash flow statements.
+type CashFlowClass struct {
+	Activity transaction.Activity `json:"activity"`
+}
+
+// cashFlowClassKey provides the datastore key for the CashFlowClass of an
+// Account. An Account has at most one.
+func cashFlowClassKey(c appengine.Context, accountKey *datastore.Key) *datastore.Key {
+	return datastore.NewKey(c, "CashFlowClass", "class", 0, accountKey)
+}
+
+// SetCashFlowClass classifies an Account for cash flow statements, with a
+// CashFlowClass read as JSON from the request body. An empty Activity goes
+// back to the Account's default. The Account is extracted from the
+// gorilla/mux vars.
+func SetCashFlowClass(p *requestParams) {
+	w, r, c, u, v := p.w, p.r, p.c, p.u, p.v
+
+	var accountIntID int64
+	if _, err := fmt.Sscan(v["key"], &accountIntID); err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	var class CashFlowClass
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&class); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if class.Activity != "" {
+		if err := class.Activity.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	accountKey := datastore.NewKey(c, "Account", "", accountIntID, userKey(c, u))
+	err := datastore.RunInTransaction(c, func(c appengine.Context) error {
+		var a transaction.Account
+		if err := datastore.Get(c, accountKey, &a); err != nil {
+			return err
+		}
+		if class.Activity == "" {
+			return datastore.Delete(c, cashFlowClassKey(c, accountKey))
+		}
+		_, err := datastore.Put(c, cashFlowClassKey(c, accountKey), &class)
+		return err
+	}, nil)
+	if err != nil {
+		// TODO(cjc25): This might not be a 400: if e.g. datastore failed it should
+		// be a 500. Interpret err and return the right thing.
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+}
+
+// ShowCashFlow prints the logged in user's transaction.CashFlowStatement for
+// the range given by the request, see reportDates. If the "format" form value
+// is "csv", it's printed as CSV, otherwise as JSON.
+func ShowCashFlow(p *requestParams) {
+	w, r, c, u := p.w, p.r, p.c, p.u
+
+	userKey := userKey(c, u)
+	settings, err := getSettings(c, userKey)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	from, to, err := reportDates(r, settings)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	accounts, splits, ids, err := userAccountsAndSplits(newDatastoreLedger(c, userKey))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var classes []CashFlowClass
+	classKeys, err := datastore.NewQuery("CashFlowClass").Ancestor(userKey).GetAll(c, &classes)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	activities := make(map[int64]transaction.Activity)
+	for i := range classKeys {
+		activities[classKeys[i].Parent().IntID()] = classes[i].Activity
+	}
+
+	period := transaction.DateRange{From: from, To: to}
+	printReport(w, r, transaction.NewCashFlowStatement(accounts, activities, splits, ids, period))
+}
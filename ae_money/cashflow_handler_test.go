@@ -0,0 +1,95 @@
+package ae_money
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/cjc25/ae_money/transaction"
+
+	"appengine"
+	"appengine/datastore"
+	"appengine/user"
+)
+
+// setTestCashFlowClass classifies the Account with key k.
+func setTestCashFlowClass(t *testing.T, c appengine.Context, u *user.User, k *datastore.Key, activity string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r := &http.Request{Body: ioutil.NopCloser(bytes.NewBufferString(fmt.Sprintf(`{"activity":%q}`, activity)))}
+	SetCashFlowClass(&requestParams{w: w, r: r, c: c, u: u, v: map[string]string{"key": fmt.Sprint(k.IntID())}})
+	return w
+}
+
+// Convenience function to get the logged in user's CashFlowStatement for
+// November 2014.
+func showTestCashFlowOrDie(t *testing.T, c appengine.Context, u *user.User) *transaction.CashFlowStatement {
+	w := httptest.NewRecorder()
+	r := newTestReportRequest(url.Values{"from": {"2014-11-01"}, "to": {"2014-11-30"}})
+	ShowCashFlow(&requestParams{w: w, r: r, c: c, u: u})
+
+	expectCode(t, http.StatusOK, w)
+	var result transaction.CashFlowStatement
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	return &result
+}
+
+func TestShowCashFlow(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	_, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := setUpTestReportOrDie(t, c, u)
+
+	result := showTestCashFlowOrDie(t, c, u)
+
+	if result.Opening != 300000 || result.Closing != 260000 || result.TotalFinancing != -40000 ||
+		result.TotalOperating != 0 || len(result.Financing) != 1 || result.Financing[0].Account != k[1].IntID() {
+		t.Errorf("Unexpected cash flow %+v", result)
+	}
+}
+
+func TestSetCashFlowClass(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	_, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := setUpTestReportOrDie(t, c, u)
+
+	expectCode(t, http.StatusOK, setTestCashFlowClass(t, c, u, k[1], "operating"))
+	if result := showTestCashFlowOrDie(t, c, u); result.TotalOperating != -40000 || result.TotalFinancing != 0 {
+		t.Errorf("Expected card payment to be operating, got %+v", result)
+	}
+
+	expectCode(t, http.StatusOK, setTestCashFlowClass(t, c, u, k[1], ""))
+	if result := showTestCashFlowOrDie(t, c, u); result.TotalFinancing != -40000 {
+		t.Errorf("Expected card payment to be financing again, got %+v", result)
+	}
+}
+
+func TestSetCashFlowClass_FailureBadActivity(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	_, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := insertAccountsOrDie(t, c, []transaction.Account{{Name: "Checking", Type: transaction.Asset}}, u)
+
+	expectCode(t, http.StatusBadRequest, setTestCashFlowClass(t, c, u, k[0], "bogus"))
+}
+
+func TestSetCashFlowClass_FailureOtherUsersAccount(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	_, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := insertAccountsOrDie(t, c, []transaction.Account{{Name: "Checking", Type: transaction.Asset}},
+		&user.User{Email: "other@example.com"})
+
+	expectCode(t, http.StatusBadRequest, setTestCashFlowClass(t, c, u, k[0], "investing"))
+}
@@ -0,0 +1,150 @@
+package ae_money
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/cjc25/ae_money/handlers"
+	"github.com/cjc25/ae_money/transaction"
+
+	"appengine"
+	"appengine/datastore"
+)
+
+// maxSuggestions is the number of counter accounts SuggestCounterAccount
+// prints.
+const maxSuggestions = 3
+
+// categorizerCountsKey provides the datastore key for what the user's
+// Categorizer has learned about counter. Each counter account's counts are
+// their own entity, so none grows with the whole ledger.
+func categorizerCountsKey(c appengine.Context, userKey *datastore.Key, counter int64) *datastore.Key {
+	return datastore.NewKey(c, "CategorizerCounts", "", counter, userKey)
+}
+
+// getCategorizer gets the user's Categorizer, adding up the counts of every
+// counter account. It's a new one if they don't have one yet.
+func getCategorizer(c appengine.Context, userKey *datastore.Key) (*transaction.Categorizer, error) {
+	k := transaction.NewCategorizer()
+	var counts []transaction.CategorizerCounts
+	keys, err := datastore.NewQuery("CategorizerCounts").Ancestor(userKey).GetAll(c, &counts)
+	if err != nil {
+		return nil, err
+	}
+	for i := range keys {
+		k.AddCounts(keys[i].IntID(), &counts[i])
+	}
+	return k, nil
+}
+
+// RetrainCategorizer replaces the logged in user's Categorizer with one
+// trained on all of their existing transactions, and prints the number of
+// transactions it learned from. Transactions committed since the Categorizer
+// was added are learned as they happen, so this is only needed once.
+func RetrainCategorizer(p *requestParams) {
+	w, c, u := p.w, p.c, p.u
+
+	userKey := userKey(c, u)
+	learned := 0
+	err := datastore.RunInTransaction(c, func(c appengine.Context) error {
+		splits := make([]transaction.Split, 0)
+		keys, err := datastore.NewQuery("Split").Ancestor(userKey).GetAll(c, &splits)
+		if err != nil {
+			return err
+		}
+		byTransaction := make(map[string][]*transaction.Split)
+		for i := range splits {
+			id := keys[i].StringID()
+			byTransaction[id] = append(byTransaction[id], &splits[i])
+		}
+
+		k := transaction.NewCategorizer()
+		learned = 0
+		for _, x := range byTransaction {
+			if len(x) == 2 && handlers.Learnable(x) {
+				k.TrainTransaction(x)
+				learned++
+			}
+		}
+		// Replace every counter account's counts, including accounts that no
+		// longer have any.
+		oldKeys, err := datastore.NewQuery("CategorizerCounts").Ancestor(userKey).KeysOnly().GetAll(c, nil)
+		if err != nil {
+			return err
+		}
+		accounts := k.Accounts()
+		keep := make(map[int64]bool)
+		countKeys := make([]*datastore.Key, len(accounts))
+		counts := make([]*transaction.CategorizerCounts, len(accounts))
+		for i, account := range accounts {
+			countKeys[i] = categorizerCountsKey(c, userKey, account)
+			counts[i] = k.Counts(account)
+			keep[account] = true
+		}
+		stale := make([]*datastore.Key, 0)
+		for _, old := range oldKeys {
+			if !keep[old.IntID()] {
+				stale = append(stale, old)
+			}
+		}
+		if err := datastore.DeleteMulti(c, stale); err != nil {
+			return err
+		}
+		_, err = datastore.PutMulti(c, countKeys, counts)
+		return err
+	}, nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	e := json.NewEncoder(w)
+	if err := e.Encode(map[string]int{"transactions": learned}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// SuggestCounterAccount prints the counter accounts the logged in user most
+// likely wants for a new Split, as transaction.Suggestions. The Split is
+// described by the "account", "amount", "memo" and "date" form values. Date
+// defaults to today.
+func SuggestCounterAccount(p *requestParams) {
+	w, r, c, u := p.w, p.r, p.c, p.u
+
+	settings, err := getSettings(c, userKey(c, u))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s := &transaction.Split{Memo: r.FormValue("memo"), Date: today(settings)}
+	if _, err := fmt.Sscan(r.FormValue("account"), &s.Account); err != nil {
+		http.Error(w, "Bad account: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, err := fmt.Sscan(r.FormValue("amount"), &s.Amount); err != nil {
+		http.Error(w, "Bad amount: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if date := r.FormValue("date"); date != "" {
+		s.Date, err = transaction.ParseDate(date)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	k, err := getCategorizer(c, userKey(c, u))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	e := json.NewEncoder(w)
+	if err := e.Encode(k.Suggest(s, maxSuggestions)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
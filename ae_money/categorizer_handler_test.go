@@ -0,0 +1,143 @@
+package ae_money
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cjc25/ae_money/handlers"
+	"github.com/cjc25/ae_money/transaction"
+
+	"appengine"
+	"appengine/datastore"
+	"appengine/user"
+)
+
+// suggestTestCounterAccount asks for suggestions for a Split from account.
+func suggestTestCounterAccount(t *testing.T, c appengine.Context, u *user.User, account int64, amount transaction.AmountType, memo string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("GET", fmt.Sprintf("/?account=%v&amount=%v&memo=%v&date=2014-12-01",
+		account, amount, memo), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SuggestCounterAccount(&requestParams{w: w, r: r, c: c, u: u})
+	return w
+}
+
+// Expectation function for the best suggestion printed by
+// SuggestCounterAccount.
+func expectSuggestion(t *testing.T, w *httptest.ResponseRecorder, expected int64) {
+	expectCode(t, http.StatusOK, w)
+	var got []transaction.Suggestion
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) == 0 || got[0].Account != expected {
+		t.Errorf("Expected suggestion of %v, got %+v", expected, got)
+	}
+}
+
+func TestSuggestCounterAccount_LearnsFromNewTransactions(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	_, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := insertAccountsOrDie(t, c,
+		[]transaction.Account{{Name: "Checking"}, {Name: "Groceries"}, {Name: "Rent"}}, u)
+	for i := 0; i < 3; i++ {
+		newTestTransactionOrDie(t, c, u, []transaction.AmountType{-5000, 5000},
+			[]int64{k[0].IntID(), k[1].IntID()}, fmt.Sprintf("Trader Joe's %v", i), fmt.Sprintf("2014-11-%02d", 5+7*i))
+	}
+	newTestTransactionOrDie(t, c, u, []transaction.AmountType{-150000, 150000},
+		[]int64{k[0].IntID(), k[2].IntID()}, "Rent", "2014-11-01")
+
+	w := suggestTestCounterAccount(t, c, u, k[0].IntID(), -4000, "trader+joe's")
+	expectSuggestion(t, w, k[1].IntID())
+
+	w = suggestTestCounterAccount(t, c, u, k[0].IntID(), -150000, "rent")
+	expectSuggestion(t, w, k[2].IntID())
+}
+
+func TestSuggestCounterAccount_Untrained(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	_, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	w := suggestTestCounterAccount(t, c, u, 1, -4000, "anything")
+
+	expectCode(t, http.StatusOK, w)
+	expectBody(t, "[]", w)
+}
+
+func TestSuggestCounterAccount_FailureBadAmount(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, r, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	r.Form = map[string][]string{"account": {"1"}, "amount": {"lots"}}
+	SuggestCounterAccount(&requestParams{w: w, r: r, c: c, u: u})
+
+	expectCode(t, http.StatusBadRequest, w)
+}
+
+func TestRetrainCategorizer(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := insertAccountsOrDie(t, c, []transaction.Account{{Name: "Checking"}, {Name: "Groceries"}}, u)
+	insertTransactionSplitsOrDie(t, c, "x1", []*transaction.Split{
+		{Amount: -5000, Account: k[0].IntID(), Memo: "Trader Joe's"},
+		{Amount: 5000, Account: k[1].IntID(), Memo: "Trader Joe's"},
+	}, k)
+	insertTransactionSplitsOrDie(t, c, "x2", []*transaction.Split{
+		{Amount: 5000, Account: k[0].IntID(), Memo: handlers.VoidMemoPrefix + "Trader Joe's"},
+		{Amount: -5000, Account: k[1].IntID(), Memo: handlers.VoidMemoPrefix + "Trader Joe's"},
+	}, k)
+	if n, err := datastore.NewQuery("CategorizerCounts").Ancestor(userKey(c, u)).Count(c); err != nil || n != 0 {
+		t.Fatalf("Expected no categorizer before training, got %v: %v", n, err)
+	}
+
+	RetrainCategorizer(&requestParams{w: w, c: c, u: u})
+
+	expectCode(t, http.StatusOK, w)
+	expectBody(t, `{"transactions":1}`, w)
+	w = suggestTestCounterAccount(t, c, u, k[0].IntID(), -4000, "trader+joe's")
+	expectSuggestion(t, w, k[1].IntID())
+}
+
+func TestRetrainCategorizer_ReplacesStaleCounts(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := insertAccountsOrDie(t, c, []transaction.Account{{Name: "Checking"}, {Name: "Groceries"}}, u)
+	// Counts for transactions that are gone are used until retraining.
+	stale := transaction.NewCategorizer()
+	stale.TrainTransaction([]*transaction.Split{
+		{Amount: -5000, Account: k[0].IntID(), Memo: "Trader Joe's"},
+		{Amount: 5000, Account: k[1].IntID(), Memo: "Trader Joe's"},
+	})
+	for _, account := range stale.Accounts() {
+		if _, err := datastore.Put(c, categorizerCountsKey(c, userKey(c, u), account), stale.Counts(account)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w = suggestTestCounterAccount(t, c, u, k[0].IntID(), -4000, "trader+joe's")
+	expectSuggestion(t, w, k[1].IntID())
+
+	w = httptest.NewRecorder()
+	RetrainCategorizer(&requestParams{w: w, c: c, u: u})
+
+	expectCode(t, http.StatusOK, w)
+	expectBody(t, `{"transactions":0}`, w)
+	if n, err := datastore.NewQuery("CategorizerCounts").Ancestor(userKey(c, u)).Count(c); err != nil || n != 0 {
+		t.Errorf("Expected stale counts to be deleted, got %v: %v", n, err)
+	}
+	w = suggestTestCounterAccount(t, c, u, k[0].IntID(), -4000, "trader+joe's")
+	expectCode(t, http.StatusOK, w)
+	expectBody(t, "[]", w)
+}
@@ -0,0 +1,20 @@
+package ae_money
+
+import (
+	"github.com/cjc25/ae_money/handlers"
+
+	"appengine"
+	"appengine/datastore"
+)
+
+// chainHeadKey is the key of the user's hash chain head. There's only ever one
+// per user.
+func chainHeadKey(c appengine.Context, userKey *datastore.Key) *datastore.Key {
+	return datastore.NewKey(c, "ChainHead", "head", 0, userKey)
+}
+
+// VerifyChain walks the logged in user's hash chain, recomputing each link
+// from the stored Splits. See handlers.VerifyChain.
+func VerifyChain(p *requestParams) {
+	handlers.VerifyChain(p.params())
+}
@@ -0,0 +1,84 @@
+package ae_money
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cjc25/ae_money/transaction"
+
+	"appengine/datastore"
+	"appengine/user"
+)
+
+// Expectation function which decodes a VerifyChain response.
+func expectChainReport(t *testing.T, w *httptest.ResponseRecorder) *transaction.ChainReport {
+	expectCode(t, http.StatusOK, w)
+	var report transaction.ChainReport
+	if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	return &report
+}
+
+func TestVerifyChain_Empty(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	VerifyChain(&requestParams{w: w, c: c, u: u})
+
+	report := expectChainReport(t, w)
+	if report.Length != 0 || report.Break != nil {
+		t.Errorf("Expected empty valid chain, got %+v", report)
+	}
+}
+
+func TestVerifyChain_Valid(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := insertAccountsOrDie(t, c, []transaction.Account{{Name: "a1"}, {Name: "a2"}}, u)
+	accounts := []int64{k[0].IntID(), k[1].IntID()}
+	id := newTestTransactionOrDie(t, c, u, []transaction.AmountType{-123, 123}, accounts, "First", "2014-11-01")
+	newTestTransactionOrDie(t, c, u, []transaction.AmountType{-5, 5}, accounts, "Second", "2014-11-02")
+	VoidTransaction(&requestParams{w: httptest.NewRecorder(), c: c, u: u, v: map[string]string{"id": id}})
+
+	VerifyChain(&requestParams{w: w, c: c, u: u})
+
+	report := expectChainReport(t, w)
+	if report.Length != 3 || report.Break != nil {
+		t.Errorf("Expected valid chain of 3, got %+v", report)
+	}
+}
+
+func TestVerifyChain_Tampered(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := insertAccountsOrDie(t, c, []transaction.Account{{Name: "a1"}, {Name: "a2"}}, u)
+	accounts := []int64{k[0].IntID(), k[1].IntID()}
+	newTestTransactionOrDie(t, c, u, []transaction.AmountType{-123, 123}, accounts, "First", "2014-11-01")
+	id := newTestTransactionOrDie(t, c, u, []transaction.AmountType{-5, 5}, accounts, "Second", "2014-11-02")
+
+	// Quietly rewrite the memo of the second transaction.
+	splitKey := datastore.NewKey(c, "Split", id, 0, k[0])
+	var s transaction.Split
+	if err := datastore.Get(c, splitKey, &s); err != nil {
+		t.Fatal(err)
+	}
+	s.Memo = "Rewritten"
+	if _, err := datastore.Put(c, splitKey, &s); err != nil {
+		t.Fatal(err)
+	}
+
+	VerifyChain(&requestParams{w: w, c: c, u: u})
+
+	report := expectChainReport(t, w)
+	if report.Break == nil || report.Break.Seq != 2 || report.Break.Transaction != id {
+		t.Errorf("Expected break at seq 2, got %+v", report.Break)
+	}
+}
@@ -0,0 +1,134 @@
+package ae_money
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/cjc25/ae_money/transaction"
+
+	"appengine"
+	"appengine/datastore"
+)
+
+// checkUserLedger recomputes the Account totals of the user whose key is
+// userKey from their Splits, and checks that every transaction still balances.
+// If repair is true, Accounts with the wrong total are rewritten. Nothing else
+// is changed, so a repair never deletes the user's data.
+//
+// The returned report describes the ledger before any repair.
+func checkUserLedger(c appengine.Context, userKey *datastore.Key, repair bool) (*transaction.CheckReport, error) {
+	var report *transaction.CheckReport
+
+	// Run in a transaction so the totals and splits are a consistent snapshot,
+	// and so a repair can't race with NewTransaction.
+	err := datastore.RunInTransaction(c, func(c appengine.Context) error {
+		accounts := make([]transaction.Account, 0)
+		accountKeys, err := datastore.NewQuery("Account").Ancestor(userKey).GetAll(c, &accounts)
+		if err != nil {
+			return err
+		}
+		splits := make([]transaction.Split, 0)
+		splitKeys, err := datastore.NewQuery("Split").Ancestor(userKey).GetAll(c, &splits)
+		if err != nil {
+			return err
+		}
+
+		k := transaction.NewChecker()
+		accountIndex := make(map[int64]int)
+		for i := range accounts {
+			k.AddAccount(&accounts[i], accountKeys[i].IntID())
+			accountIndex[accountKeys[i].IntID()] = i
+		}
+		for i := range splits {
+			k.AddSplit(splitKeys[i].StringID(), splitKeys[i].Parent().IntID(), &splits[i])
+		}
+
+		report = k.Check()
+		if !repair {
+			return nil
+		}
+
+		changed := k.Repair()
+		changedKeys := make([]*datastore.Key, len(changed))
+		changedAccounts := make([]*transaction.Account, len(changed))
+		for i, id := range changed {
+			changedKeys[i] = accountKeys[accountIndex[id]]
+			changedAccounts[i] = &accounts[accountIndex[id]]
+		}
+		_, err = datastore.PutMulti(c, changedKeys, changedAccounts)
+		return err
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// allUserKeys finds the key of every user who owns at least one Account.
+func allUserKeys(c appengine.Context) ([]*datastore.Key, error) {
+	accountKeys, err := datastore.NewQuery("Account").KeysOnly().GetAll(c, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	result := make([]*datastore.Key, 0)
+	for _, k := range accountKeys {
+		if !seen[k.Parent().StringID()] {
+			seen[k.Parent().StringID()] = true
+			result = append(result, k.Parent())
+		}
+	}
+	return result, nil
+}
+
+// checkLedgers checks the ledger of the user named by the "user" form value,
+// or of every user if there isn't one, and prints a JSON object of reports
+// keyed by user. Users are named as in the reports, by their ledger's key
+// rather than their email address, which can differ from it.
+func checkLedgers(p *requestParams, repair bool) {
+	w, r, c := p.w, p.r, p.c
+
+	var userKeys []*datastore.Key
+	if name := r.FormValue("user"); name != "" {
+		userKeys = []*datastore.Key{datastoreUserKey(c, name)}
+	} else {
+		var err error
+		userKeys, err = allUserKeys(c)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	result := make(map[string]*transaction.CheckReport)
+	for _, k := range userKeys {
+		report, err := checkUserLedger(c, k, repair)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !report.Consistent() {
+			c.Warningf("Ledger for %v is inconsistent (repair: %v): %+v", k.StringID(), repair, report)
+		}
+		result[k.StringID()] = report
+	}
+
+	e := json.NewEncoder(w)
+	if err := e.Encode(result); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// CheckLedger reports discrepancies between stored Account totals and Splits,
+// without changing anything. It's run by cron, see cron.yaml.
+func CheckLedger(p *requestParams) {
+	checkLedgers(p, false)
+}
+
+// RepairLedger reports discrepancies like CheckLedger, and rewrites any wrong
+// Account totals.
+func RepairLedger(p *requestParams) {
+	checkLedgers(p, true)
+}
@@ -0,0 +1,151 @@
+package ae_money
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cjc25/ae_money/transaction"
+
+	"appengine"
+	"appengine/datastore"
+	"appengine/user"
+)
+
+// Convenience function to add the Splits of one transaction to the test
+// datastore, bypassing NewTransaction so Account totals aren't updated.
+func insertTransactionSplitsOrDie(t *testing.T, c appengine.Context, transactionID string, s []*transaction.Split, accountKeys []*datastore.Key) {
+	splitKeys := make([]*datastore.Key, len(s))
+	for i := range s {
+		splitKeys[i] = datastore.NewKey(c, "Split", transactionID, 0, accountKeys[i])
+		s[i].Account = accountKeys[i].IntID()
+	}
+	if _, err := datastore.PutMulti(c, splitKeys, s); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Expectation function which decodes a CheckLedger response and returns the
+// report for u.
+func expectCheckReport(t *testing.T, w *httptest.ResponseRecorder, u *user.User) *transaction.CheckReport {
+	result := make(map[string]*transaction.CheckReport)
+	d := json.NewDecoder(w.Body)
+	if err := d.Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	report, ok := result[u.String()]
+	if !ok {
+		t.Fatalf("Expected a report for %v, got %v", u, result)
+	}
+	return report
+}
+
+func TestCheckLedger_Consistent(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, r, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := insertAccountsOrDie(t, c, []transaction.Account{{Name: "a1"}, {Name: "a2"}}, u)
+	r.Body = buildTestTransactionRequest(t, []transaction.AmountType{-123, 123},
+		[]int64{k[0].IntID(), k[1].IntID()}, "Test transaction", "2014-11-01")
+	NewTransaction(&requestParams{w: w, r: r, c: c, u: u})
+	expectCode(t, http.StatusOK, w)
+
+	w = httptest.NewRecorder()
+	CheckLedger(&requestParams{w: w, r: r, c: c})
+
+	report := expectCheckReport(t, w, u)
+	if !report.Consistent() {
+		t.Errorf("Expected consistent ledger, got %+v", report)
+	}
+}
+
+func TestCheckLedger_Inconsistent(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, r, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := insertAccountsOrDie(t, c, []transaction.Account{{Name: "a1"}, {Name: "a2"}}, u)
+	insertTransactionSplitsOrDie(t, c, "x1",
+		[]*transaction.Split{{Amount: -123}, {Amount: 100}}, k)
+
+	CheckLedger(&requestParams{w: w, r: r, c: c})
+
+	report := expectCheckReport(t, w, u)
+	if len(report.Accounts) != 2 {
+		t.Errorf("Expected 2 account discrepancies, got %+v", report.Accounts)
+	}
+	if len(report.Transactions) != 1 || report.Transactions[0].ID != "x1" {
+		t.Errorf("Expected a discrepancy for transaction x1, got %+v", report.Transactions)
+	}
+
+	// Checking must not change anything.
+	w = httptest.NewRecorder()
+	CheckLedger(&requestParams{w: w, r: r, c: c})
+	if report := expectCheckReport(t, w, u); len(report.Accounts) != 2 {
+		t.Errorf("Expected 2 account discrepancies after check, got %+v", report.Accounts)
+	}
+}
+
+func TestCheckLedger_SingleUser(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	other := &user.User{Email: "other@example.com"}
+	w, r, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	insertAccountsOrDie(t, c, []transaction.Account{{Name: "a1"}}, u)
+	insertAccountsOrDie(t, c, []transaction.Account{{Name: "a2"}}, other)
+
+	r.Form = map[string][]string{"user": {other.String()}}
+	CheckLedger(&requestParams{w: w, r: r, c: c})
+
+	result := make(map[string]*transaction.CheckReport)
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := result[other.String()]; !ok || len(result) != 1 {
+		t.Errorf("Expected only a report for %v, got %v", other, result)
+	}
+}
+
+// Users are named by their ledger's key, which isn't always their email.
+func TestCheckLedger_SingleUserWithoutEmail(t *testing.T) {
+	u := &user.User{FederatedIdentity: "https://id.example.com/test"}
+	w, r, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := insertAccountsOrDie(t, c, []transaction.Account{{Name: "a1"}}, u)
+	insertTransactionSplitsOrDie(t, c, "x1", []*transaction.Split{{Amount: 100}}, k)
+
+	r.Form = map[string][]string{"user": {u.String()}}
+	CheckLedger(&requestParams{w: w, r: r, c: c})
+
+	report := expectCheckReport(t, w, u)
+	if len(report.Transactions) != 1 {
+		t.Errorf("Expected the user's ledger to be checked, got %+v", report)
+	}
+}
+
+func TestRepairLedger(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, r, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := insertAccountsOrDie(t, c, []transaction.Account{{Name: "a1"}, {Name: "a2"}}, u)
+	insertTransactionSplitsOrDie(t, c, "x1",
+		[]*transaction.Split{{Amount: -123}, {Amount: 123}}, k)
+
+	RepairLedger(&requestParams{w: w, r: r, c: c})
+
+	report := expectCheckReport(t, w, u)
+	if len(report.Accounts) != 2 {
+		t.Errorf("Expected repair to report 2 account discrepancies, got %+v", report.Accounts)
+	}
+
+	w = httptest.NewRecorder()
+	CheckLedger(&requestParams{w: w, r: r, c: c})
+	if report := expectCheckReport(t, w, u); !report.Consistent() {
+		t.Errorf("Expected consistent ledger after repair, got %+v", report)
+	}
+}
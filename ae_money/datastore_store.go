@@ -0,0 +1,303 @@
+package ae_money
+
+import (
+	"github.com/cjc25/ae_money/storage"
+	"github.com/cjc25/ae_money/transaction"
+
+	"appengine"
+	"appengine/datastore"
+)
+
+// datastoreStore is a storage.Store in the App Engine datastore. Accounts are
+// children of their user's key, see userKey, and Splits are children of their
+// Accounts, keyed by their transaction's id.
+type datastoreStore struct {
+	c appengine.Context
+}
+
+// newDatastoreStore is a storage.Store for requests in c.
+func newDatastoreStore(c appengine.Context) storage.Store {
+	return &datastoreStore{c}
+}
+
+// datastoreUserKey is the key of user, who's identified like userKey does.
+func datastoreUserKey(c appengine.Context, user string) *datastore.Key {
+	return datastore.NewKey(c, "User", user, 0, nil)
+}
+
+func (s *datastoreStore) Ledger(user string) storage.Ledger {
+	return newDatastoreLedger(s.c, datastoreUserKey(s.c, user))
+}
+
+func (s *datastoreStore) RunInTransaction(user string, f func(l storage.Ledger) error) error {
+	return datastore.RunInTransaction(s.c, func(c appengine.Context) error {
+		return f(newDatastoreLedger(c, datastoreUserKey(c, user)))
+	}, nil)
+}
+
+// datastoreLedger is the storage.Ledger of the user with userKey. If c is in
+// a datastore transaction, so is the Ledger, so handlers that are already in
+// one can use it alongside their other entities.
+//
+// A datastore transaction doesn't see its own writes, so the Ledger remembers
+// the Accounts, chain head and categorizer counts it put, and reads them back
+// from there. That lets one datastore transaction take several
+// handlers.PutTransaction calls.
+type datastoreLedger struct {
+	c       appengine.Context
+	userKey *datastore.Key
+
+	accounts map[int64]transaction.Account
+	head     *transaction.ChainHead
+	counts   map[int64]transaction.CategorizerCounts
+}
+
+func newDatastoreLedger(c appengine.Context, userKey *datastore.Key) *datastoreLedger {
+	return &datastoreLedger{
+		c:        c,
+		userKey:  userKey,
+		accounts: make(map[int64]transaction.Account),
+		counts:   make(map[int64]transaction.CategorizerCounts),
+	}
+}
+
+func (l *datastoreLedger) accountKey(id int64) *datastore.Key {
+	return datastore.NewKey(l.c, "Account", "", id, l.userKey)
+}
+
+func (l *datastoreLedger) Account(id int64) (*transaction.Account, error) {
+	if a, ok := l.accounts[id]; ok {
+		return &a, nil
+	}
+	var a transaction.Account
+	err := datastore.Get(l.c, l.accountKey(id), &a)
+	if err == datastore.ErrNoSuchEntity {
+		return nil, storage.ErrNoSuchEntity
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (l *datastoreLedger) Accounts() ([]int64, []transaction.Account, error) {
+	// We make an empty slice so callers can print [] if there are no accounts.
+	accounts := make([]transaction.Account, 0)
+	keys, err := datastore.NewQuery("Account").Ancestor(l.userKey).Order("Name").GetAll(l.c, &accounts)
+	if err != nil {
+		return nil, nil, err
+	}
+	ids := make([]int64, len(keys))
+	for i := range keys {
+		ids[i] = keys[i].IntID()
+	}
+	return ids, accounts, nil
+}
+
+func (l *datastoreLedger) AddAccount(a *transaction.Account) (int64, error) {
+	k, err := datastore.Put(l.c, datastore.NewIncompleteKey(l.c, "Account", l.userKey), a)
+	if err != nil {
+		return 0, err
+	}
+	return k.IntID(), nil
+}
+
+func (l *datastoreLedger) PutAccounts(ids []int64, accounts []*transaction.Account) error {
+	keys := make([]*datastore.Key, len(ids))
+	for i := range ids {
+		keys[i] = l.accountKey(ids[i])
+	}
+	if _, err := datastore.PutMulti(l.c, keys, accounts); err != nil {
+		return err
+	}
+	for i := range ids {
+		l.accounts[ids[i]] = *accounts[i]
+	}
+	return nil
+}
+
+func (l *datastoreLedger) DeleteAccount(id int64) error {
+	accountKey := l.accountKey(id)
+	keys, err := datastore.NewQuery("Split").Ancestor(accountKey).KeysOnly().Limit(1).GetAll(l.c, nil)
+	if err != nil {
+		return err
+	}
+	if len(keys) != 0 {
+		return storage.ErrAccountHasSplits
+	}
+	return datastore.Delete(l.c, accountKey)
+}
+
+// getSplits gets the Splits that q finds, along with their transactions' ids.
+func (l *datastoreLedger) getSplits(q *datastore.Query) ([]string, []transaction.Split, error) {
+	// We make an empty slice so callers can print [] if there are no splits.
+	splits := make([]transaction.Split, 0)
+	keys, err := q.GetAll(l.c, &splits)
+	if err != nil {
+		return nil, nil, err
+	}
+	ids := make([]string, len(keys))
+	for i := range keys {
+		ids[i] = keys[i].StringID()
+	}
+	return ids, splits, nil
+}
+
+func (l *datastoreLedger) AccountSplits(id int64) ([]string, []transaction.Split, error) {
+	return l.getSplits(datastore.NewQuery("Split").Ancestor(l.accountKey(id)).Order("Date").Order("-Amount"))
+}
+
+func (l *datastoreLedger) AccountSplitsBetween(id int64, from, through transaction.Date) ([]string, []transaction.Split, error) {
+	return l.getSplits(datastore.NewQuery("Split").Ancestor(l.accountKey(id)).
+		Filter("Date >=", transaction.SplitDateQueryValue(from)).
+		Filter("Date <=", transaction.SplitDateQueryValue(through)).
+		Order("Date").Order("-Amount"))
+}
+
+func (l *datastoreLedger) Splits() ([]string, []transaction.Split, error) {
+	return l.getSplits(datastore.NewQuery("Split").Ancestor(l.userKey))
+}
+
+func (l *datastoreLedger) TransactionSplits(transactionID string) ([]*transaction.Split, error) {
+	_, splits, err := getTransactionSplits(l.c, l.userKey, transactionID)
+	return splits, err
+}
+
+func (l *datastoreLedger) PutSplits(transactionID string, splits []*transaction.Split) error {
+	keys := make([]*datastore.Key, len(splits))
+	for i := range splits {
+		keys[i] = datastore.NewKey(l.c, "Split", transactionID, 0, l.accountKey(splits[i].Account))
+	}
+	_, err := datastore.PutMulti(l.c, keys, splits)
+	return err
+}
+
+func (l *datastoreLedger) AccountSplitsWithExternalID(id int64, externalID string) ([]string, []transaction.Split, error) {
+	return l.getSplits(datastore.NewQuery("Split").Ancestor(l.accountKey(id)).Filter("ExternalID =", externalID))
+}
+
+func (l *datastoreLedger) Payee(id int64) (*transaction.Payee, error) {
+	var p transaction.Payee
+	err := datastore.Get(l.c, payeeKey(l.c, l.userKey, id), &p)
+	if err == datastore.ErrNoSuchEntity {
+		return nil, storage.ErrNoSuchEntity
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (l *datastoreLedger) Payees() ([]int64, []transaction.Payee, error) {
+	keys, payees, err := userPayees(l.c, l.userKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	ids := make([]int64, len(keys))
+	for i := range keys {
+		ids[i] = keys[i].IntID()
+	}
+	return ids, payees, nil
+}
+
+func (l *datastoreLedger) AddPayee(p *transaction.Payee) (int64, error) {
+	k, err := datastore.Put(l.c, datastore.NewIncompleteKey(l.c, "Payee", l.userKey), p)
+	if err != nil {
+		return 0, err
+	}
+	return k.IntID(), nil
+}
+
+func (l *datastoreLedger) PutPayee(id int64, p *transaction.Payee) error {
+	_, err := datastore.Put(l.c, payeeKey(l.c, l.userKey, id), p)
+	return err
+}
+
+func (l *datastoreLedger) Rules() ([]int64, []transaction.Rule, error) {
+	keys, rules, err := userRules(l.c, l.userKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	ids := make([]int64, len(keys))
+	for i := range keys {
+		ids[i] = keys[i].IntID()
+	}
+	return ids, rules, nil
+}
+
+func (l *datastoreLedger) AddRule(r *transaction.Rule) (int64, error) {
+	k, err := datastore.Put(l.c, datastore.NewIncompleteKey(l.c, "Rule", l.userKey), r)
+	if err != nil {
+		return 0, err
+	}
+	return k.IntID(), nil
+}
+
+func (l *datastoreLedger) ChainHead() (*transaction.ChainHead, error) {
+	if l.head != nil {
+		head := *l.head
+		return &head, nil
+	}
+	var head transaction.ChainHead
+	if err := datastore.Get(l.c, chainHeadKey(l.c, l.userKey), &head); err != nil && err != datastore.ErrNoSuchEntity {
+		return nil, err
+	}
+	return &head, nil
+}
+
+func (l *datastoreLedger) ChainLinks() ([]transaction.ChainLink, error) {
+	links := make([]transaction.ChainLink, 0)
+	_, err := datastore.NewQuery("ChainLink").Ancestor(l.userKey).Order("Seq").GetAll(l.c, &links)
+	return links, err
+}
+
+func (l *datastoreLedger) PutChainLink(head *transaction.ChainHead, link *transaction.ChainLink) error {
+	linkKey := datastore.NewKey(l.c, "ChainLink", "", link.Seq, l.userKey)
+	if _, err := datastore.Put(l.c, linkKey, link); err != nil {
+		return err
+	}
+	if _, err := datastore.Put(l.c, chainHeadKey(l.c, l.userKey), head); err != nil {
+		return err
+	}
+	put := *head
+	l.head = &put
+	return nil
+}
+
+func (l *datastoreLedger) CategorizerCounts(counters []int64) ([]transaction.CategorizerCounts, error) {
+	keys := make([]*datastore.Key, len(counters))
+	for i, counter := range counters {
+		keys[i] = categorizerCountsKey(l.c, l.userKey, counter)
+	}
+	counts := make([]transaction.CategorizerCounts, len(keys))
+	err := datastore.GetMulti(l.c, keys, counts)
+	if merr, ok := err.(appengine.MultiError); ok {
+		for _, err := range merr {
+			if err != nil && err != datastore.ErrNoSuchEntity {
+				return nil, err
+			}
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	for i, counter := range counters {
+		if put, ok := l.counts[counter]; ok {
+			counts[i] = put
+		}
+	}
+	return counts, nil
+}
+
+func (l *datastoreLedger) PutCategorizerCounts(counters []int64, counts []*transaction.CategorizerCounts) error {
+	keys := make([]*datastore.Key, len(counters))
+	for i, counter := range counters {
+		keys[i] = categorizerCountsKey(l.c, l.userKey, counter)
+	}
+	if _, err := datastore.PutMulti(l.c, keys, counts); err != nil {
+		return err
+	}
+	for i, counter := range counters {
+		l.counts[counter] = *counts[i]
+	}
+	return nil
+}
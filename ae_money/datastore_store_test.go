@@ -0,0 +1,19 @@
+package ae_money
+
+import (
+	"testing"
+
+	"github.com/cjc25/ae_money/storage/storagetest"
+
+	"appengine/aetest"
+)
+
+func TestDatastoreStore(t *testing.T) {
+	c, err := aetest.NewContext(&aetest.Options{StronglyConsistentDatastore: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	storagetest.TestStore(t, newDatastoreStore(c))
+}
@@ -0,0 +1,233 @@
+package ae_money
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/cjc25/ae_money/transaction"
+
+	"appengine"
+	"appengine/datastore"
+)
+
+// Bounds on the number of days ForecastBalances projects.
+const (
+	defaultForecastDays = 30
+	maxForecastDays     = 731
+)
+
+// ForecastChangeRequest is a one-off change to an Account's balance, for
+// trying out a purchase or payment in a forecast without committing it. Date
+// defaults to today.
+type ForecastChangeRequest struct {
+	Account int64                  `json:"account"`
+	Amount  transaction.AmountType `json:"amount"`
+	Date    string                 `json:"date"`
+	Memo    string                 `json:"memo"`
+}
+
+// ForecastRecurringRequest is a change to an Account's balance that repeats
+// every Months months and Days days, like a paycheck or a bill. Date is the
+// first one, and defaults to today.
+type ForecastRecurringRequest struct {
+	ForecastChangeRequest
+	Months int `json:"months"`
+	Days   int `json:"days"`
+}
+
+// ForecastBudgetRequest is spending planned from an Account, Amount each
+// month, which is spread evenly over the month's days. Like the other
+// changes, spending from an Asset is a negative Amount.
+type ForecastBudgetRequest struct {
+	Account int64                  `json:"account"`
+	Amount  transaction.AmountType `json:"amount"`
+	Memo    string                 `json:"memo"`
+}
+
+// ForecastRequest is for JSON unmarshalling of ForecastBalances request
+// bodies. Days defaults to defaultForecastDays, and Accounts defaults to all
+// of the user's Asset and Liability Accounts. WhatIf, Recurring and Budgets
+// are optional.
+type ForecastRequest struct {
+	Days      int                        `json:"days"`
+	Accounts  []int64                    `json:"accounts"`
+	WhatIf    []ForecastChangeRequest    `json:"whatIf"`
+	Recurring []ForecastRecurringRequest `json:"recurring"`
+	Budgets   []ForecastBudgetRequest    `json:"budgets"`
+}
+
+// split is the Split that change makes, dated today if it has no date.
+func (change *ForecastChangeRequest) split(today transaction.Date) (transaction.Split, error) {
+	s := transaction.Split{Amount: change.Amount, Account: change.Account, Memo: change.Memo, Date: today}
+	if change.Date != "" {
+		var err error
+		if s.Date, err = transaction.ParseDate(change.Date); err != nil {
+			return s, err
+		}
+	}
+	return s, nil
+}
+
+// requestedSplits gets the Splits of request's WhatIf, Recurring and Budgets
+// changes from from through through.
+func (request *ForecastRequest) requestedSplits(from, through transaction.Date) ([]transaction.Split, error) {
+	result := make([]transaction.Split, 0)
+	for i := range request.WhatIf {
+		s, err := request.WhatIf[i].split(from)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, s)
+	}
+	for i := range request.Recurring {
+		s, err := request.Recurring[i].split(from)
+		if err != nil {
+			return nil, err
+		}
+		recurrence := transaction.Recurrence{Split: s, Months: request.Recurring[i].Months, Days: request.Recurring[i].Days}
+		if err := recurrence.Validate(); err != nil {
+			return nil, err
+		}
+		result = append(result, recurrence.Occurrences(from, through)...)
+	}
+	for _, b := range request.Budgets {
+		budget := transaction.Budget{Account: b.Account, Amount: b.Amount, Memo: b.Memo}
+		result = append(result, budget.Splits(from, through)...)
+	}
+	return result, nil
+}
+
+// forecastAccountKeys gets the keys of the Accounts to forecast: accounts if
+// there are any, or else every Asset and Liability Account the user has.
+func forecastAccountKeys(c appengine.Context, userKey *datastore.Key, accounts []int64) ([]*datastore.Key, error) {
+	if len(accounts) > 0 {
+		keys := make([]*datastore.Key, len(accounts))
+		for i := range accounts {
+			keys[i] = datastore.NewKey(c, "Account", "", accounts[i], userKey)
+		}
+		return keys, nil
+	}
+
+	all := make([]transaction.Account, 0)
+	allKeys, err := datastore.NewQuery("Account").Ancestor(userKey).GetAll(c, &all)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]*datastore.Key, 0)
+	for i := range all {
+		if all[i].Type == transaction.Asset || all[i].Type == transaction.Liability {
+			keys = append(keys, allKeys[i])
+		}
+	}
+	return keys, nil
+}
+
+// scheduledLoanSplits gets the Splits of every loan payment the user has due
+// through the end of the forecast.
+func scheduledLoanSplits(c appengine.Context, userKey *datastore.Key, through transaction.Date) ([]transaction.Split, error) {
+	loans := make([]transaction.Loan, 0)
+	keys, err := datastore.NewQuery("Loan").Ancestor(userKey).GetAll(c, &loans)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]transaction.Split, 0)
+	for i := range loans {
+		l := &loans[i]
+		loanAccount := keys[i].Parent().IntID()
+		for _, p := range l.Schedule() {
+			date := p.Date
+			if date.After(through) {
+				break
+			}
+			memo := fmt.Sprintf("Loan payment %v", p.Number)
+			for _, s := range p.Splits(loanAccount, l.PaymentAccount, l.InterestAccount, memo, date) {
+				result = append(result, *s)
+			}
+		}
+	}
+	return result, nil
+}
+
+// ForecastBalances projects the daily balances of the logged in user's
+// Accounts, starting today, and prints them as transaction.Forecasts. The
+// ForecastRequest is read as JSON from the request body.
+//
+// Each Account starts from its balance before today. Splits dated in the
+// future are already committed, and are applied on their dates, along with
+// the loan payments that come due and the request's WhatIf, Recurring and
+// Budgets changes.
+func ForecastBalances(p *requestParams) {
+	w, r, c, u := p.w, p.r, p.c, p.u
+
+	var request ForecastRequest
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if request.Days == 0 {
+		request.Days = defaultForecastDays
+	}
+	if request.Days < 0 || request.Days > maxForecastDays {
+		http.Error(w, fmt.Sprintf("Forecasts must be 1 to %v days.", maxForecastDays), http.StatusBadRequest)
+		return
+	}
+
+	userKey := userKey(c, u)
+	settings, err := getSettings(c, userKey)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	from := today(settings)
+	through := from.AddDate(0, 0, request.Days-1)
+	scheduled, err := request.requestedSplits(from, through)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	accountKeys, err := forecastAccountKeys(c, userKey, request.Accounts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	accounts := make([]transaction.Account, len(accountKeys))
+	if err := datastore.GetMulti(c, accountKeys, accounts); err != nil {
+		// Most likely one of the requested Accounts doesn't exist.
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	start := make(map[int64]transaction.AmountType)
+	for i, k := range accountKeys {
+		future := make([]transaction.Split, 0)
+		_, err := datastore.NewQuery("Split").Ancestor(k).Filter("Date >=", transaction.SplitDateQueryValue(from)).GetAll(c, &future)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		start[k.IntID()] = accounts[i].Total()
+		for _, s := range future {
+			start[k.IntID()] -= s.Amount
+		}
+		scheduled = append(scheduled, future...)
+	}
+
+	loanSplits, err := scheduledLoanSplits(c, userKey, through)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	scheduled = append(scheduled, loanSplits...)
+
+	e := json.NewEncoder(w)
+	if err := e.Encode(transaction.ProjectBalances(start, scheduled, from, request.Days)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,158 @@
+package ae_money
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"code.google.com/p/go-uuid/uuid"
+
+	"github.com/cjc25/ae_money/transaction"
+
+	"appengine/datastore"
+	"appengine/user"
+)
+
+// Convenience function to decode the Forecasts printed by ForecastBalances.
+func expectForecasts(t *testing.T, w *httptest.ResponseRecorder) []transaction.Forecast {
+	var result []transaction.Forecast
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestForecastBalances(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, r, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := insertAccountsOrDie(t, c, []transaction.Account{
+		{Name: "Checking", Type: transaction.Asset},
+		{Name: "Mortgage", Type: transaction.Liability},
+		{Name: "Interest", Type: transaction.Expense},
+		{Name: "Salary", Type: transaction.Income},
+	}, u)
+	from := today(&transaction.Settings{})
+	for _, x := range []struct {
+		amount transaction.AmountType
+		days   int
+	}{{200000, -10}, {150000, 5}} {
+		err := commitTransaction(c, userKey(c, u), uuid.NewRandom().String(), []*transaction.Split{
+			{Amount: x.amount, Account: k[0].IntID(), Date: from.AddDate(0, 0, x.days)},
+			{Amount: -x.amount, Account: k[3].IntID(), Date: from.AddDate(0, 0, x.days)},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	l := &transaction.Loan{Principal: 100000, Term: 10, Start: from.AddDate(0, 0, 3),
+		InterestAccount: k[2].IntID(), PaymentAccount: k[0].IntID()}
+	l.Amortize()
+	if _, err := datastore.Put(c, loanKey(c, k[1]), l); err != nil {
+		t.Fatal(err)
+	}
+
+	r.Body = ioutil.NopCloser(bytes.NewBufferString(fmt.Sprintf(
+		`{"days":7,"whatIf":[{"account":%v,"amount":-250000,"date":"%v"}]}`,
+		k[0].IntID(), from.AddDate(0, 0, 1))))
+	ForecastBalances(&requestParams{w: w, r: r, c: c, u: u})
+
+	expectCode(t, http.StatusOK, w)
+	result := expectForecasts(t, w)
+	if len(result) != 2 {
+		t.Fatalf("Expected asset and liability forecasts, got %+v", result)
+	}
+	checking := result[0]
+	if checking.Account != k[0].IntID() {
+		checking = result[1]
+	}
+
+	expected := []transaction.AmountType{200000, -50000, -50000, -60000, -60000, 90000, 90000}
+	for i, b := range checking.Balances {
+		if b.Balance != expected[i] {
+			t.Errorf("Day %v: expected %v, got %v", i, expected[i], b.Balance)
+		}
+	}
+	if checking.Start != 200000 || checking.Low != -60000 || checking.LowDate != from.AddDate(0, 0, 3) {
+		t.Errorf("Expected low -60000 in 3 days, got %+v", checking)
+	}
+}
+
+func TestForecastBalances_FailureTooManyDays(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, r, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	r.Body = ioutil.NopCloser(bytes.NewBufferString(`{"days":5000}`))
+	ForecastBalances(&requestParams{w: w, r: r, c: c, u: u})
+
+	expectCode(t, http.StatusBadRequest, w)
+}
+
+func TestForecastBalances_FailureOtherUsersAccount(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, r, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := insertAccountsOrDie(t, c, []transaction.Account{{Name: "Checking", Type: transaction.Asset}},
+		&user.User{Email: "other@example.com"})
+
+	r.Body = ioutil.NopCloser(bytes.NewBufferString(fmt.Sprintf(`{"accounts":[%v]}`, k[0].IntID())))
+	ForecastBalances(&requestParams{w: w, r: r, c: c, u: u})
+
+	expectCode(t, http.StatusBadRequest, w)
+}
+
+func TestForecastBalances_RecurringAndBudgets(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, r, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := insertAccountsOrDie(t, c, []transaction.Account{{Name: "Checking", Type: transaction.Asset}}, u)
+	from := today(&transaction.Settings{})
+
+	// A bill every 3 days starting tomorrow, and a budget spread over each
+	// month's days.
+	r.Body = ioutil.NopCloser(bytes.NewBufferString(fmt.Sprintf(
+		`{"days":7,"recurring":[{"account":%v,"amount":-1000,"date":"%v","days":3}],"budgets":[{"account":%v,"amount":-31000}]}`,
+		k[0].IntID(), from.AddDate(0, 0, 1), k[0].IntID())))
+	ForecastBalances(&requestParams{w: w, r: r, c: c, u: u})
+
+	expectCode(t, http.StatusOK, w)
+	result := expectForecasts(t, w)
+	if len(result) != 1 || len(result[0].Balances) != 7 {
+		t.Fatalf("Expected a 7 day checking forecast, got %+v", result)
+	}
+
+	budget := transaction.Budget{Account: k[0].IntID(), Amount: -31000}
+	spent := budget.Splits(from, from.AddDate(0, 0, 6))
+	var expected transaction.AmountType
+	for i, b := range result[0].Balances {
+		expected += spent[i].Amount
+		if i%3 == 1 {
+			expected -= 1000
+		}
+		if b.Balance != expected {
+			t.Errorf("Day %v: expected %v, got %v", i, expected, b.Balance)
+		}
+	}
+}
+
+func TestForecastBalances_FailureNeverRecurs(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, r, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := insertAccountsOrDie(t, c, []transaction.Account{{Name: "Checking", Type: transaction.Asset}}, u)
+
+	r.Body = ioutil.NopCloser(bytes.NewBufferString(fmt.Sprintf(
+		`{"recurring":[{"account":%v,"amount":-1000}]}`, k[0].IntID())))
+	ForecastBalances(&requestParams{w: w, r: r, c: c, u: u})
+
+	expectCode(t, http.StatusBadRequest, w)
+}
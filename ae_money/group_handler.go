@@ -0,0 +1,641 @@
+package ae_money
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"code.google.com/p/go-uuid/uuid"
+
+	"github.com/cjc25/ae_money/transaction"
+
+	"appengine"
+	"appengine/datastore"
+	"appengine/user"
+)
+
+// A Group shares expenses between users. Members lists everyone invited, by
+// email, but only members who have joined have a GroupMember. A user's email
+// needn't name their ledger, so members are only found by email through their
+// GroupMember.
+//
+// Groups aren't owned by any user, so they're root entities.
+type Group struct {
+	Name    string   `json:"name"`
+	Members []string `json:"members"`
+}
+
+// A GroupMember is a user who has joined a Group. Account is an Account in
+// the member's own ledger, which holds what the group owes them: it's
+// positive when they're owed and negative when they owe. ExpenseAccount
+// receives the member's share of expenses, and PaymentAccount pays and
+// receives settlements. User is the name of the member's ledger, as
+// userKey gives it.
+type GroupMember struct {
+	User           string `json:"user"`
+	Account        int64  `json:"account"`
+	ExpenseAccount int64  `json:"expenseAccount"`
+	PaymentAccount int64  `json:"paymentAccount"`
+}
+
+// ledgerKey gets the key of the ledger of the member who joined as email.
+// Members who joined before User was recorded fall back to the key that
+// email named then.
+func (m *GroupMember) ledgerKey(c appengine.Context, email string) *datastore.Key {
+	if m.User == "" {
+		return datastoreUserKey(c, email)
+	}
+	return datastoreUserKey(c, m.User)
+}
+
+// GroupRequest is for JSON unmarshalling of NewGroup request bodies. The
+// logged in user is always a member, and joins with ExpenseAccount and
+// PaymentAccount.
+type GroupRequest struct {
+	Name           string   `json:"name"`
+	Members        []string `json:"members"`
+	ExpenseAccount int64    `json:"expenseAccount"`
+	PaymentAccount int64    `json:"paymentAccount"`
+}
+
+// JoinGroupRequest is for JSON unmarshalling of JoinGroup request bodies.
+type JoinGroupRequest struct {
+	ExpenseAccount int64 `json:"expenseAccount"`
+	PaymentAccount int64 `json:"paymentAccount"`
+}
+
+// SharedExpenseRequest is for JSON unmarshalling of NewSharedExpense request
+// bodies. The logged in user paid Amount from Account, which defaults to their
+// PaymentAccount. It's shared between Members, which defaults to every member
+// who has joined, in proportion to Weights, which defaults to equal shares.
+type SharedExpenseRequest struct {
+	Amount  transaction.AmountType `json:"amount"`
+	Account int64                  `json:"account"`
+	Members []string               `json:"members"`
+	Weights []int64                `json:"weights"`
+	Memo    string                 `json:"memo"`
+	Date    string                 `json:"date"`
+}
+
+// SettlementRequest is for JSON unmarshalling of ConfirmSettlement request
+// bodies. The logged in user confirms receiving Amount from From.
+type SettlementRequest struct {
+	From   string                 `json:"from"`
+	Amount transaction.AmountType `json:"amount"`
+	Date   string                 `json:"date"`
+}
+
+// GroupMemberBalance is for JSON responses describing a member's balance with
+// their Group. Joined is false for invited members who haven't joined yet.
+type GroupMemberBalance struct {
+	Email   string                 `json:"email"`
+	Joined  bool                   `json:"joined"`
+	Balance transaction.AmountType `json:"balance"`
+}
+
+// DatastoreGroup wraps a Group and its members' balances for JSON responses
+// that include a datastore key.
+type DatastoreGroup struct {
+	Group    *Group               `json:"group"`
+	IntID    int64                `json:"key"`
+	Balances []GroupMemberBalance `json:"balances"`
+}
+
+// GroupSettlement is a payment that helps settle a Group, for JSON responses.
+type GroupSettlement struct {
+	From   string                 `json:"from"`
+	To     string                 `json:"to"`
+	Amount transaction.AmountType `json:"amount"`
+}
+
+// groupTransactionOptions allow a datastore transaction to span the Group and
+// the ledger of every member. Groups are limited in size so that they fit.
+var groupTransactionOptions = &datastore.TransactionOptions{XG: true}
+
+// maxGroupMembers leaves room in a cross-group transaction for the Group's own
+// entity group, and keeps settling up fast.
+const maxGroupMembers = transaction.MaxSettleMembers
+
+func groupMemberKey(c appengine.Context, groupKey *datastore.Key, email string) *datastore.Key {
+	return datastore.NewKey(c, "GroupMember", email, 0, groupKey)
+}
+
+// getGroupForMember gets the Group with the id in the gorilla/mux vars, and
+// the logged in user's GroupMember. It fails with datastore.ErrNoSuchEntity if
+// the user hasn't joined the Group, so non-members can't learn anything.
+func getGroupForMember(c appengine.Context, v map[string]string, u *user.User) (*datastore.Key, *Group, *GroupMember, error) {
+	var groupIntID int64
+	if _, err := fmt.Sscan(v["key"], &groupIntID); err != nil {
+		return nil, nil, nil, datastore.ErrNoSuchEntity
+	}
+
+	groupKey := datastore.NewKey(c, "Group", "", groupIntID, nil)
+	var g Group
+	if err := datastore.Get(c, groupKey, &g); err != nil {
+		return nil, nil, nil, err
+	}
+	var m GroupMember
+	if err := datastore.Get(c, groupMemberKey(c, groupKey, u.Email), &m); err != nil {
+		return nil, nil, nil, err
+	}
+	return groupKey, &g, &m, nil
+}
+
+// groupBalances gets the balance of every member of g, sorted by email.
+func groupBalances(c appengine.Context, groupKey *datastore.Key, g *Group) ([]GroupMemberBalance, error) {
+	emails := make([]string, len(g.Members))
+	copy(emails, g.Members)
+	sort.Strings(emails)
+
+	memberKeys := make([]*datastore.Key, len(emails))
+	for i, email := range emails {
+		memberKeys[i] = groupMemberKey(c, groupKey, email)
+	}
+	members := make([]GroupMember, len(emails))
+	err := datastore.GetMulti(c, memberKeys, members)
+	merr, isMultiError := err.(appengine.MultiError)
+	if err != nil && !isMultiError {
+		return nil, err
+	}
+
+	result := make([]GroupMemberBalance, len(emails))
+	for i, email := range emails {
+		result[i].Email = email
+		if isMultiError && merr[i] == datastore.ErrNoSuchEntity {
+			continue
+		}
+		if isMultiError && merr[i] != nil {
+			return nil, merr[i]
+		}
+		result[i].Joined = true
+		a, err := newDatastoreLedger(c, members[i].ledgerKey(c, email)).Account(members[i].Account)
+		if err != nil {
+			return nil, err
+		}
+		result[i].Balance = a.Total()
+	}
+	return result, nil
+}
+
+// joinGroup creates the logged in user's balance Account for a Group and
+// records them as a member, if they were invited by their email. It must be
+// called in a datastore transaction.
+func joinGroup(c appengine.Context, groupKey *datastore.Key, g *Group, u *user.User, expenseAccount, paymentAccount int64) error {
+	invited := false
+	for _, email := range g.Members {
+		invited = invited || (u.Email != "" && email == u.Email)
+	}
+	if !invited {
+		return datastore.ErrNoSuchEntity
+	}
+
+	userKey := userKey(c, u)
+	l := newDatastoreLedger(c, userKey)
+	for _, id := range []int64{expenseAccount, paymentAccount} {
+		if _, err := l.Account(id); err != nil {
+			return err
+		}
+	}
+
+	a := &transaction.Account{Name: "Shared: " + g.Name, Type: transaction.Asset}
+	if err := a.Validate(); err != nil {
+		return err
+	}
+	accountID, err := l.AddAccount(a)
+	if err != nil {
+		return err
+	}
+
+	m := &GroupMember{
+		User:           userKey.StringID(),
+		Account:        accountID,
+		ExpenseAccount: expenseAccount,
+		PaymentAccount: paymentAccount,
+	}
+	_, err = datastore.Put(c, groupMemberKey(c, groupKey, u.Email), m)
+	return err
+}
+
+// writeGroup prints a Group and its balances as JSON.
+func writeGroup(w http.ResponseWriter, c appengine.Context, groupKey *datastore.Key, g *Group) {
+	balances, err := groupBalances(c, groupKey, g)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	e := json.NewEncoder(w)
+	if err := e.Encode(&DatastoreGroup{g, groupKey.IntID(), balances}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// NewGroup creates a Group read as JSON from the request body, and joins the
+// logged in user to it.
+func NewGroup(p *requestParams) {
+	w, r, c, u := p.w, p.r, p.c, p.u
+
+	var request GroupRequest
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if u.Email == "" {
+		http.Error(w, "Groups invite members by email, and you have none.", http.StatusBadRequest)
+		return
+	}
+	g := &Group{Name: strings.TrimSpace(request.Name), Members: []string{u.Email}}
+	if g.Name == "" {
+		http.Error(w, "Empty group name.", http.StatusBadRequest)
+		return
+	}
+	for _, email := range request.Members {
+		email = strings.TrimSpace(email)
+		duplicate := false
+		for _, existing := range g.Members {
+			duplicate = duplicate || existing == email
+		}
+		if email != "" && !duplicate {
+			g.Members = append(g.Members, email)
+		}
+	}
+	if len(g.Members) > maxGroupMembers {
+		http.Error(w, fmt.Sprintf("Groups can have at most %v members.", maxGroupMembers), http.StatusBadRequest)
+		return
+	}
+
+	// Allocate the key up front, so the transaction can be retried without
+	// creating a second Group.
+	low, _, err := datastore.AllocateIDs(c, "Group", nil, 1)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	groupKey := datastore.NewKey(c, "Group", "", low, nil)
+	err = datastore.RunInTransaction(c, func(c appengine.Context) error {
+		if _, err := datastore.Put(c, groupKey, g); err != nil {
+			return err
+		}
+		return joinGroup(c, groupKey, g, u, request.ExpenseAccount, request.PaymentAccount)
+	}, groupTransactionOptions)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeGroup(w, c, groupKey, g)
+}
+
+// JoinGroup adds the logged in user to a Group they were invited to. The
+// Group is extracted from the gorilla/mux vars.
+func JoinGroup(p *requestParams) {
+	w, r, c, u, v := p.w, p.r, p.c, p.u, p.v
+
+	var groupIntID int64
+	_, err := fmt.Sscan(v["key"], &groupIntID)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	var request JoinGroupRequest
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	groupKey := datastore.NewKey(c, "Group", "", groupIntID, nil)
+	var g Group
+	err = datastore.RunInTransaction(c, func(c appengine.Context) error {
+		if err := datastore.Get(c, groupKey, &g); err != nil {
+			return err
+		}
+		err := datastore.Get(c, groupMemberKey(c, groupKey, u.Email), &GroupMember{})
+		if err == nil {
+			return errors.New("Already a member of this group.")
+		}
+		if err != datastore.ErrNoSuchEntity {
+			return err
+		}
+		return joinGroup(c, groupKey, &g, u, request.ExpenseAccount, request.PaymentAccount)
+	}, groupTransactionOptions)
+	if err == datastore.ErrNoSuchEntity {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeGroup(w, c, groupKey, &g)
+}
+
+// ListGroups prints every Group the logged in user was invited to by email.
+func ListGroups(p *requestParams) {
+	w, c, u := p.w, p.c, p.u
+
+	q := datastore.NewQuery("Group").Filter("Members =", u.Email).Order("Name")
+	// We make an empty slice so we can return [] if there are no groups.
+	groups := make([]Group, 0)
+	keys, err := q.GetAll(c, &groups)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	result := make([]DatastoreGroup, len(groups))
+	for i := range keys {
+		result[i].Group = &groups[i]
+		result[i].IntID = keys[i].IntID()
+		result[i].Balances = make([]GroupMemberBalance, 0)
+	}
+
+	e := json.NewEncoder(w)
+	if err := e.Encode(result); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// ShowGroup prints a Group and every member's balance. The Group is extracted
+// from the gorilla/mux vars, and only members can see it.
+func ShowGroup(p *requestParams) {
+	w, c, u, v := p.w, p.c, p.u, p.v
+
+	groupKey, g, _, err := getGroupForMember(c, v, u)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	writeGroup(w, c, groupKey, g)
+}
+
+// checkExpenseMembers fails unless every one of members is invited to g, and
+// none is listed twice, so no member gets two shares of an expense.
+func checkExpenseMembers(g *Group, members []string) error {
+	invited := make(map[string]bool)
+	for _, email := range g.Members {
+		invited[email] = true
+	}
+	seen := make(map[string]bool)
+	for _, email := range members {
+		if !invited[email] {
+			return fmt.Errorf("%v isn't a member of %v", email, g.Name)
+		}
+		if seen[email] {
+			return fmt.Errorf("%v is listed more than once", email)
+		}
+		seen[email] = true
+	}
+	return nil
+}
+
+// NewSharedExpense records an expense that the logged in user paid for a
+// Group. The payer's ledger gets the payment, their own share and a
+// receivable for everyone else's shares, and every other member's ledger gets
+// their share and a matching payable. The expense is read as JSON from the
+// request body, and the Group is extracted from the gorilla/mux vars.
+func NewSharedExpense(p *requestParams) {
+	w, r, c, u, v := p.w, p.r, p.c, p.u, p.v
+
+	var request SharedExpenseRequest
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	date, err := transaction.ParseDate(request.Date)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if request.Amount <= 0 {
+		http.Error(w, "Shared expenses must be positive.", http.StatusBadRequest)
+		return
+	}
+
+	groupKey, g, payer, err := getGroupForMember(c, v, u)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	members := request.Members
+	if err := checkExpenseMembers(g, members); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(members) == 0 {
+		balances, err := groupBalances(c, groupKey, g)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, b := range balances {
+			if b.Joined {
+				members = append(members, b.Email)
+			}
+		}
+	}
+	weights := request.Weights
+	if len(weights) == 0 {
+		weights = make([]int64, len(members))
+		for i := range weights {
+			weights[i] = 1
+		}
+	}
+	if len(weights) != len(members) {
+		http.Error(w, "Members and weights of different lengths", http.StatusBadRequest)
+		return
+	}
+	shares, err := transaction.Allocate(request.Amount, weights)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	funding := payer.PaymentAccount
+	if request.Account != 0 {
+		funding = request.Account
+	}
+
+	transactionID := uuid.NewRandom().String()
+	err = datastore.RunInTransaction(c, func(c appengine.Context) error {
+		memberKeys := make([]*datastore.Key, len(members))
+		for i, email := range members {
+			memberKeys[i] = groupMemberKey(c, groupKey, email)
+		}
+		gm := make([]GroupMember, len(members))
+		if err := datastore.GetMulti(c, memberKeys, gm); err != nil {
+			return fmt.Errorf("Not every member has joined the group: %v", err)
+		}
+
+		payerSplits := []*transaction.Split{{Amount: -request.Amount, Account: funding}}
+		var receivable transaction.AmountType = request.Amount
+		for i, email := range members {
+			if shares[i] == 0 {
+				continue
+			}
+			share := &transaction.Split{Amount: shares[i], Account: gm[i].ExpenseAccount}
+			if email == u.Email {
+				payerSplits = append(payerSplits, share)
+				receivable -= shares[i]
+				continue
+			}
+
+			payable := &transaction.Split{Amount: -shares[i], Account: gm[i].Account}
+			memberSplits := []*transaction.Split{share, payable}
+			for _, s := range memberSplits {
+				s.Memo, s.Date = request.Memo, date
+			}
+			if err := putTransaction(c, gm[i].ledgerKey(c, email), transactionID, memberSplits); err != nil {
+				return err
+			}
+		}
+		if receivable != 0 {
+			payerSplits = append(payerSplits, &transaction.Split{Amount: receivable, Account: payer.Account})
+		}
+		for _, s := range payerSplits {
+			s.Memo, s.Date = request.Memo, date
+		}
+		return putTransaction(c, userKey(c, u), transactionID, payerSplits)
+	}, groupTransactionOptions)
+	if err != nil {
+		// TODO(cjc25): This might not be a 400: if e.g. datastore failed it should
+		// be a 500. Interpret err and return the right thing.
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeGroup(w, c, groupKey, g)
+}
+
+// SettleGroup prints the fewest payments between members that would clear
+// every balance in a Group. Nothing is posted until each payment is
+// confirmed with ConfirmSettlement. The Group is extracted from the
+// gorilla/mux vars.
+func SettleGroup(p *requestParams) {
+	w, c, u, v := p.w, p.c, p.u, p.v
+
+	groupKey, g, _, err := getGroupForMember(c, v, u)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	balances, err := groupBalances(c, groupKey, g)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	amounts := make([]transaction.AmountType, len(balances))
+	for i := range balances {
+		amounts[i] = balances[i].Balance
+	}
+	settlements, err := transaction.Settle(amounts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	result := make([]GroupSettlement, len(settlements))
+	for i, s := range settlements {
+		result[i] = GroupSettlement{balances[s.From].Email, balances[s.To].Email, s.Amount}
+	}
+
+	e := json.NewEncoder(w)
+	if err := e.Encode(result); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// ConfirmSettlement posts a settlement payment that the logged in user
+// received from another member. The payer's ledger moves the amount from
+// their PaymentAccount to their Group Account, and the recipient's does the
+// reverse. The amount can't be more than the payer owes the Group, or than the
+// Group owes the recipient, so a typo can't turn into an overpayment. The
+// payment is read as JSON from the request body, and the Group is extracted
+// from the gorilla/mux vars.
+func ConfirmSettlement(p *requestParams) {
+	w, r, c, u, v := p.w, p.r, p.c, p.u, p.v
+
+	var request SettlementRequest
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	date, err := transaction.ParseDate(request.Date)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if request.Amount <= 0 {
+		http.Error(w, "Settlements must be positive.", http.StatusBadRequest)
+		return
+	}
+	if request.From == u.Email {
+		http.Error(w, "Can't settle with yourself.", http.StatusBadRequest)
+		return
+	}
+
+	groupKey, g, recipient, err := getGroupForMember(c, v, u)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	transactionID := uuid.NewRandom().String()
+	err = datastore.RunInTransaction(c, func(c appengine.Context) error {
+		var payer GroupMember
+		if err := datastore.Get(c, groupMemberKey(c, groupKey, request.From), &payer); err != nil {
+			return err
+		}
+
+		// Read both balances before either ledger is written, since a datastore
+		// transaction doesn't see its own writes.
+		payerBalance, err := newDatastoreLedger(c, payer.ledgerKey(c, request.From)).Account(payer.Account)
+		if err != nil {
+			return err
+		}
+		recipientBalance, err := newDatastoreLedger(c, userKey(c, u)).Account(recipient.Account)
+		if err != nil {
+			return err
+		}
+		if request.Amount > -payerBalance.Total() || request.Amount > recipientBalance.Total() {
+			return fmt.Errorf("%v only owes %v, and you're only owed %v",
+				request.From, -payerBalance.Total(), recipientBalance.Total())
+		}
+
+		memo := fmt.Sprintf("Settle %v: %v to %v", g.Name, request.From, u.Email)
+		payerSplits := []*transaction.Split{
+			{Amount: -request.Amount, Account: payer.PaymentAccount, Memo: memo, Date: date},
+			{Amount: request.Amount, Account: payer.Account, Memo: memo, Date: date},
+		}
+		if err := putTransaction(c, payer.ledgerKey(c, request.From), transactionID, payerSplits); err != nil {
+			return err
+		}
+
+		recipientSplits := []*transaction.Split{
+			{Amount: request.Amount, Account: recipient.PaymentAccount, Memo: memo, Date: date},
+			{Amount: -request.Amount, Account: recipient.Account, Memo: memo, Date: date},
+		}
+		return putTransaction(c, userKey(c, u), transactionID, recipientSplits)
+	}, groupTransactionOptions)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeGroup(w, c, groupKey, g)
+}
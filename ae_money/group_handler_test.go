@@ -0,0 +1,379 @@
+package ae_money
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cjc25/ae_money/transaction"
+
+	"appengine"
+	"appengine/datastore"
+	"appengine/user"
+)
+
+// testMember is a user in a test Group, with their own expense and checking
+// Accounts.
+type testMember struct {
+	u        *user.User
+	expense  *datastore.Key
+	checking *datastore.Key
+}
+
+// Setup method which creates accounts for each user, has the first create a
+// Group inviting the rest, and has the rest join.
+func setUpTestGroupOrDie(t *testing.T, c appengine.Context, emails ...string) (int64, []testMember) {
+	users := make([]*user.User, len(emails))
+	for i, email := range emails {
+		users[i] = &user.User{Email: email}
+	}
+	return setUpTestGroupForUsersOrDie(t, c, users...)
+}
+
+// Like setUpTestGroupOrDie, for users whose ledgers needn't be named by their
+// emails.
+func setUpTestGroupForUsersOrDie(t *testing.T, c appengine.Context, users ...*user.User) (int64, []testMember) {
+	members := make([]testMember, len(users))
+	emails := make([]string, len(users))
+	for i, u := range users {
+		emails[i] = u.Email
+		k := insertAccountsOrDie(t, c, []transaction.Account{
+			{Name: "Groceries", Type: transaction.Expense},
+			{Name: "Checking", Type: transaction.Asset},
+		}, u)
+		members[i] = testMember{u, k[0], k[1]}
+	}
+
+	request := &GroupRequest{
+		Name:           "Roommates",
+		Members:        emails[1:],
+		ExpenseAccount: members[0].expense.IntID(),
+		PaymentAccount: members[0].checking.IntID(),
+	}
+	b, err := json.Marshal(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	r := &http.Request{Body: ioutil.NopCloser(bytes.NewBuffer(b))}
+	NewGroup(&requestParams{w: w, r: r, c: c, u: members[0].u})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Failed to create test group: %v", w.Body.String())
+	}
+	var g DatastoreGroup
+	if err := json.NewDecoder(w.Body).Decode(&g); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, m := range members[1:] {
+		w := httptest.NewRecorder()
+		r := &http.Request{Body: ioutil.NopCloser(bytes.NewBufferString(fmt.Sprintf(
+			`{"expenseAccount":%v,"paymentAccount":%v}`, m.expense.IntID(), m.checking.IntID())))}
+		JoinGroup(&requestParams{w: w, r: r, c: c, u: m.u, v: map[string]string{"key": fmt.Sprint(g.IntID)}})
+		if w.Code != http.StatusOK {
+			t.Fatalf("Failed to join test group: %v", w.Body.String())
+		}
+	}
+	return g.IntID, members
+}
+
+// Expectation function for the balances in a group response.
+func expectGroupBalances(t *testing.T, w *httptest.ResponseRecorder, expected map[string]transaction.AmountType) {
+	expectCode(t, http.StatusOK, w)
+	var g DatastoreGroup
+	if err := json.NewDecoder(w.Body).Decode(&g); err != nil {
+		t.Fatal(err)
+	}
+	if len(g.Balances) != len(expected) {
+		t.Fatalf("Expected %v balances, got %+v", len(expected), g.Balances)
+	}
+	for _, b := range g.Balances {
+		if b.Balance != expected[b.Email] {
+			t.Errorf("Expected %v balance %v, got %v", b.Email, expected[b.Email], b.Balance)
+		}
+	}
+}
+
+func TestNewGroup_InvitedNotJoined(t *testing.T) {
+	u := &user.User{Email: "a@example.com"}
+	w, r, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := insertAccountsOrDie(t, c, []transaction.Account{{Name: "Groceries"}, {Name: "Checking"}}, u)
+	r.Body = ioutil.NopCloser(bytes.NewBufferString(fmt.Sprintf(
+		`{"name":"Roommates","members":["b@example.com"],"expenseAccount":%v,"paymentAccount":%v}`,
+		k[0].IntID(), k[1].IntID())))
+
+	NewGroup(&requestParams{w: w, r: r, c: c, u: u})
+
+	expectCode(t, http.StatusOK, w)
+	var g DatastoreGroup
+	if err := json.NewDecoder(w.Body).Decode(&g); err != nil {
+		t.Fatal(err)
+	}
+	if len(g.Balances) != 2 || !g.Balances[0].Joined || g.Balances[1].Joined {
+		t.Errorf("Expected only the creator to have joined, got %+v", g.Balances)
+	}
+	expectNumAccounts(t, c, u, 3)
+}
+
+func TestNewGroup_FailureBadAccount(t *testing.T) {
+	u := &user.User{Email: "a@example.com"}
+	w, r, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	r.Body = ioutil.NopCloser(bytes.NewBufferString(`{"name":"Roommates","expenseAccount":1,"paymentAccount":2}`))
+
+	NewGroup(&requestParams{w: w, r: r, c: c, u: u})
+
+	expectCode(t, http.StatusBadRequest, w)
+	expectNumAccounts(t, c, u, 0)
+}
+
+func TestJoinGroup_FailureNotInvited(t *testing.T) {
+	_, _, c := initTestRequestParams(t, nil)
+	defer c.Close()
+
+	id, _ := setUpTestGroupOrDie(t, c, "a@example.com", "b@example.com")
+	u := &user.User{Email: "c@example.com"}
+	k := insertAccountsOrDie(t, c, []transaction.Account{{Name: "Groceries"}, {Name: "Checking"}}, u)
+
+	w := httptest.NewRecorder()
+	r := &http.Request{Body: ioutil.NopCloser(bytes.NewBufferString(fmt.Sprintf(
+		`{"expenseAccount":%v,"paymentAccount":%v}`, k[0].IntID(), k[1].IntID())))}
+	JoinGroup(&requestParams{w: w, r: r, c: c, u: u, v: map[string]string{"key": fmt.Sprint(id)}})
+
+	expectCode(t, http.StatusNotFound, w)
+	expectNumAccounts(t, c, u, 2)
+}
+
+func TestShowGroup_FailureNotMember(t *testing.T) {
+	_, _, c := initTestRequestParams(t, nil)
+	defer c.Close()
+
+	id, _ := setUpTestGroupOrDie(t, c, "a@example.com", "b@example.com")
+
+	w := httptest.NewRecorder()
+	ShowGroup(&requestParams{w: w, c: c, u: &user.User{Email: "c@example.com"},
+		v: map[string]string{"key": fmt.Sprint(id)}})
+
+	expectCode(t, http.StatusNotFound, w)
+}
+
+func TestListGroups(t *testing.T) {
+	_, _, c := initTestRequestParams(t, nil)
+	defer c.Close()
+
+	setUpTestGroupOrDie(t, c, "a@example.com", "b@example.com")
+
+	w := httptest.NewRecorder()
+	ListGroups(&requestParams{w: w, c: c, u: &user.User{Email: "b@example.com"}})
+
+	var result []DatastoreGroup
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 1 || result[0].Group.Name != "Roommates" {
+		t.Errorf("Expected b to see Roommates, got %+v", result)
+	}
+
+	w = httptest.NewRecorder()
+	ListGroups(&requestParams{w: w, c: c, u: &user.User{Email: "c@example.com"}})
+	expectBody(t, "[]", w)
+}
+
+func TestNewSharedExpense(t *testing.T) {
+	_, _, c := initTestRequestParams(t, nil)
+	defer c.Close()
+
+	id, m := setUpTestGroupOrDie(t, c, "a@example.com", "b@example.com", "c@example.com")
+
+	w := httptest.NewRecorder()
+	r := &http.Request{Body: ioutil.NopCloser(bytes.NewBufferString(
+		`{"amount":9001,"memo":"Groceries","date":"2014-11-01"}`))}
+	NewSharedExpense(&requestParams{w: w, r: r, c: c, u: m[0].u, v: map[string]string{"key": fmt.Sprint(id)}})
+
+	expectGroupBalances(t, w, map[string]transaction.AmountType{
+		"a@example.com": 6000, "b@example.com": -3000, "c@example.com": -3000,
+	})
+	if total := accountTotalOrDie(t, c, m[0].checking); total != -9001 {
+		t.Errorf("Expected payer checking total -9001, got %v", total)
+	}
+	if total := accountTotalOrDie(t, c, m[0].expense); total != 3001 {
+		t.Errorf("Expected payer expense total 3001, got %v", total)
+	}
+	if total := accountTotalOrDie(t, c, m[1].expense); total != 3000 {
+		t.Errorf("Expected member expense total 3000, got %v", total)
+	}
+}
+
+func TestNewSharedExpense_Weights(t *testing.T) {
+	_, _, c := initTestRequestParams(t, nil)
+	defer c.Close()
+
+	id, m := setUpTestGroupOrDie(t, c, "a@example.com", "b@example.com")
+
+	w := httptest.NewRecorder()
+	r := &http.Request{Body: ioutil.NopCloser(bytes.NewBufferString(
+		`{"amount":1000,"members":["b@example.com"],"weights":[1],"memo":"For b","date":"2014-11-01"}`))}
+	NewSharedExpense(&requestParams{w: w, r: r, c: c, u: m[0].u, v: map[string]string{"key": fmt.Sprint(id)}})
+
+	expectGroupBalances(t, w, map[string]transaction.AmountType{
+		"a@example.com": 1000, "b@example.com": -1000,
+	})
+}
+
+func TestNewSharedExpense_FailureBadMembers(t *testing.T) {
+	_, _, c := initTestRequestParams(t, nil)
+	defer c.Close()
+
+	id, m := setUpTestGroupOrDie(t, c, "a@example.com", "b@example.com")
+
+	for _, members := range []string{
+		`["b@example.com","b@example.com"]`,
+		`["b@example.com","c@example.com"]`,
+	} {
+		w := httptest.NewRecorder()
+		r := &http.Request{Body: ioutil.NopCloser(bytes.NewBufferString(
+			`{"amount":1000,"members":` + members + `,"weights":[1,1],"memo":"Dinner","date":"2014-11-01"}`))}
+		NewSharedExpense(&requestParams{w: w, r: r, c: c, u: m[0].u, v: map[string]string{"key": fmt.Sprint(id)}})
+
+		expectCode(t, http.StatusBadRequest, w)
+	}
+	if total := accountTotalOrDie(t, c, m[1].expense); total != 0 {
+		t.Errorf("Expected nothing to be shared, got b expense total %v", total)
+	}
+}
+
+func TestSettleGroup(t *testing.T) {
+	_, _, c := initTestRequestParams(t, nil)
+	defer c.Close()
+
+	id, m := setUpTestGroupOrDie(t, c, "a@example.com", "b@example.com", "c@example.com")
+	w := httptest.NewRecorder()
+	r := &http.Request{Body: ioutil.NopCloser(bytes.NewBufferString(
+		`{"amount":9000,"memo":"Groceries","date":"2014-11-01"}`))}
+	NewSharedExpense(&requestParams{w: w, r: r, c: c, u: m[0].u, v: map[string]string{"key": fmt.Sprint(id)}})
+
+	w = httptest.NewRecorder()
+	SettleGroup(&requestParams{w: w, c: c, u: m[1].u, v: map[string]string{"key": fmt.Sprint(id)}})
+
+	expectCode(t, http.StatusOK, w)
+	var result []GroupSettlement
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 2 {
+		t.Fatalf("Expected 2 settlements, got %+v", result)
+	}
+	for _, s := range result {
+		if s.To != "a@example.com" || s.Amount != 3000 {
+			t.Errorf("Expected 3000 to be paid to a, got %+v", s)
+		}
+	}
+}
+
+func TestConfirmSettlement(t *testing.T) {
+	_, _, c := initTestRequestParams(t, nil)
+	defer c.Close()
+
+	id, m := setUpTestGroupOrDie(t, c, "a@example.com", "b@example.com")
+	w := httptest.NewRecorder()
+	r := &http.Request{Body: ioutil.NopCloser(bytes.NewBufferString(
+		`{"amount":1000,"memo":"Dinner","date":"2014-11-01"}`))}
+	NewSharedExpense(&requestParams{w: w, r: r, c: c, u: m[0].u, v: map[string]string{"key": fmt.Sprint(id)}})
+
+	w = httptest.NewRecorder()
+	r = &http.Request{Body: ioutil.NopCloser(bytes.NewBufferString(
+		`{"from":"b@example.com","amount":500,"date":"2014-11-02"}`))}
+	ConfirmSettlement(&requestParams{w: w, r: r, c: c, u: m[0].u, v: map[string]string{"key": fmt.Sprint(id)}})
+
+	expectGroupBalances(t, w, map[string]transaction.AmountType{
+		"a@example.com": 0, "b@example.com": 0,
+	})
+	if total := accountTotalOrDie(t, c, m[1].checking); total != -500 {
+		t.Errorf("Expected b checking total -500, got %v", total)
+	}
+	if total := accountTotalOrDie(t, c, m[0].checking); total != -500 {
+		t.Errorf("Expected a checking total -500, got %v", total)
+	}
+}
+
+func TestConfirmSettlement_FailureOverpayment(t *testing.T) {
+	_, _, c := initTestRequestParams(t, nil)
+	defer c.Close()
+
+	id, m := setUpTestGroupOrDie(t, c, "a@example.com", "b@example.com")
+	w := httptest.NewRecorder()
+	r := &http.Request{Body: ioutil.NopCloser(bytes.NewBufferString(
+		`{"amount":1000,"memo":"Dinner","date":"2014-11-01"}`))}
+	NewSharedExpense(&requestParams{w: w, r: r, c: c, u: m[0].u, v: map[string]string{"key": fmt.Sprint(id)}})
+
+	// b owes a 500, so a can't have received 5000, and b can't have received
+	// anything.
+	for _, x := range []struct {
+		recipient testMember
+		body      string
+	}{
+		{m[0], `{"from":"b@example.com","amount":5000,"date":"2014-11-02"}`},
+		{m[1], `{"from":"a@example.com","amount":100,"date":"2014-11-02"}`},
+	} {
+		w = httptest.NewRecorder()
+		r = &http.Request{Body: ioutil.NopCloser(bytes.NewBufferString(x.body))}
+		ConfirmSettlement(&requestParams{w: w, r: r, c: c, u: x.recipient.u, v: map[string]string{"key": fmt.Sprint(id)}})
+
+		expectCode(t, http.StatusBadRequest, w)
+	}
+	if total := accountTotalOrDie(t, c, m[1].checking); total != 0 {
+		t.Errorf("Expected b checking total 0, got %v", total)
+	}
+}
+
+func TestGroup_LedgersNotNamedByEmail(t *testing.T) {
+	_, _, c := initTestRequestParams(t, nil)
+	defer c.Close()
+
+	// In their own domain, users' keys are named without it.
+	id, m := setUpTestGroupForUsersOrDie(t, c,
+		&user.User{Email: "a@example.com", AuthDomain: "example.com"},
+		&user.User{Email: "b@example.com", AuthDomain: "example.com"})
+	if m[1].checking.Parent().StringID() != "b" {
+		t.Fatalf("Expected b's ledger to be named b, got %v", m[1].checking.Parent())
+	}
+
+	w := httptest.NewRecorder()
+	r := &http.Request{Body: ioutil.NopCloser(bytes.NewBufferString(
+		`{"amount":1000,"memo":"Dinner","date":"2014-11-01"}`))}
+	NewSharedExpense(&requestParams{w: w, r: r, c: c, u: m[0].u, v: map[string]string{"key": fmt.Sprint(id)}})
+	expectGroupBalances(t, w, map[string]transaction.AmountType{
+		"a@example.com": 500, "b@example.com": -500,
+	})
+	if total := accountTotalOrDie(t, c, m[1].expense); total != 500 {
+		t.Errorf("Expected b expense total 500, got %v", total)
+	}
+
+	w = httptest.NewRecorder()
+	r = &http.Request{Body: ioutil.NopCloser(bytes.NewBufferString(
+		`{"from":"b@example.com","amount":500,"date":"2014-11-02"}`))}
+	ConfirmSettlement(&requestParams{w: w, r: r, c: c, u: m[0].u, v: map[string]string{"key": fmt.Sprint(id)}})
+	expectGroupBalances(t, w, map[string]transaction.AmountType{
+		"a@example.com": 0, "b@example.com": 0,
+	})
+	if total := accountTotalOrDie(t, c, m[1].checking); total != -500 {
+		t.Errorf("Expected b checking total -500, got %v", total)
+	}
+}
+
+func TestNewGroup_NoEmail(t *testing.T) {
+	_, _, c := initTestRequestParams(t, nil)
+	defer c.Close()
+
+	w := httptest.NewRecorder()
+	r := &http.Request{Body: ioutil.NopCloser(bytes.NewBufferString(`{"name":"Roommates"}`))}
+	NewGroup(&requestParams{w: w, r: r, c: c, u: &user.User{FederatedIdentity: "https://example.com/a"}})
+	expectCode(t, http.StatusBadRequest, w)
+}
@@ -7,6 +7,9 @@ import (
 
 	"github.com/gorilla/mux"
 
+	"github.com/cjc25/ae_money/handlers"
+	"github.com/cjc25/ae_money/storage"
+
 	"appengine"
 	"appengine/datastore"
 	"appengine/user"
@@ -26,6 +29,27 @@ type requestParams struct {
 	c appengine.Context
 	u *user.User
 	v map[string]string
+	// s is where ledgers are kept. It's the datastore unless a test sets it.
+	s storage.Store
+}
+
+// store gets the storage.Store for the request.
+func (p *requestParams) store() storage.Store {
+	if p.s == nil {
+		p.s = newDatastoreStore(p.c)
+	}
+	return p.s
+}
+
+// ledger gets the logged in user's storage.Ledger.
+func (p *requestParams) ledger() storage.Ledger {
+	return p.store().Ledger(p.u.String())
+}
+
+// params gets the handlers.Params of the request, for the handlers shared
+// with package server.
+func (p *requestParams) params() *handlers.Params {
+	return &handlers.Params{W: p.w, R: p.r, V: p.v, S: p.store(), User: p.u.String()}
 }
 
 // baseWrapper is used to convert a normal golang mux http handler function
@@ -52,6 +76,32 @@ func loginWrapper(f func(*requestParams)) func(*requestParams) {
 	}
 }
 
+// adminWrapper is a requestParams function wrapper which enforces that an
+// appengine request is from an administrator or from the cron service. The
+// user is extracted into the requestParams if there is one, but cron requests
+// have none.
+func adminWrapper(f func(*requestParams)) func(*requestParams) {
+	return func(p *requestParams) {
+		// Appengine strips this header from requests that don't come from cron.
+		if p.r.Header.Get("X-Appengine-Cron") == "true" {
+			f(p)
+			return
+		}
+
+		p.u = user.Current(p.c)
+		if p.u == nil {
+			p.w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if !user.IsAdmin(p.c) {
+			p.w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		f(p)
+	}
+}
+
 // Register handlers and get ready to serve.
 func init() {
 	r := mux.NewRouter()
@@ -64,11 +114,120 @@ func init() {
 		Methods("GET")
 	api.HandleFunc("/accounts/{key:[0-9]+}", baseWrapper(loginWrapper(DeleteAccount))).
 		Methods("DELETE")
+	api.HandleFunc("/accounts/{key:[0-9]+}/loan", baseWrapper(loginWrapper(SetLoan))).
+		Methods("PUT")
+	api.HandleFunc("/accounts/{key:[0-9]+}/loan", baseWrapper(loginWrapper(ShowLoan))).
+		Methods("GET")
+	api.HandleFunc("/accounts/{key:[0-9]+}/loan/payments", baseWrapper(loginWrapper(PayLoan))).
+		Methods("POST")
+	api.HandleFunc("/accounts/{key:[0-9]+}/interest", baseWrapper(loginWrapper(SetInterest))).
+		Methods("PUT")
+	api.HandleFunc("/accounts/{key:[0-9]+}/interest/preview", baseWrapper(loginWrapper(PreviewInterest))).
+		Methods("GET")
+	api.HandleFunc("/accounts/{key:[0-9]+}/cashflow", baseWrapper(loginWrapper(SetCashFlowClass))).
+		Methods("PUT")
+	api.HandleFunc("/accounts/{key:[0-9]+}/tax", baseWrapper(loginWrapper(SetTaxCategory))).
+		Methods("PUT")
 	api.HandleFunc("/accounts", baseWrapper(loginWrapper(ListAccounts))).
 		Methods("GET")
 
 	api.HandleFunc("/transactions/new", baseWrapper(loginWrapper(NewTransaction))).
 		Methods("POST")
+	api.HandleFunc("/transactions/{id:[0-9a-f-]+}/reverse", baseWrapper(loginWrapper(ReverseTransaction))).
+		Methods("POST")
+	api.HandleFunc("/transactions/{id:[0-9a-f-]+}/void", baseWrapper(loginWrapper(VoidTransaction))).
+		Methods("POST")
+	api.HandleFunc("/transactions/{id:[0-9a-f-]+}/attachments", baseWrapper(loginWrapper(UploadAttachment))).
+		Methods("POST")
+	api.HandleFunc("/transactions/{id:[0-9a-f-]+}/attachments", baseWrapper(loginWrapper(ListAttachments))).
+		Methods("GET")
+	api.HandleFunc("/transactions/{id:[0-9a-f-]+}/attachments/{key:[0-9]+}", baseWrapper(loginWrapper(DownloadAttachment))).
+		Methods("GET")
+	api.HandleFunc("/transactions/{id:[0-9a-f-]+}/attachments/{key:[0-9]+}", baseWrapper(loginWrapper(DeleteAttachment))).
+		Methods("DELETE")
+
+	api.HandleFunc("/transfers/new", baseWrapper(loginWrapper(AddTransferHalf))).
+		Methods("POST")
+	api.HandleFunc("/transfers/{key:[0-9]+}/resolve", baseWrapper(loginWrapper(ResolveTransferHalf))).
+		Methods("POST")
+	api.HandleFunc("/transfers/{key:[0-9]+}", baseWrapper(loginWrapper(DeleteTransferHalf))).
+		Methods("DELETE")
+	api.HandleFunc("/transfers", baseWrapper(loginWrapper(ListTransferHalves))).
+		Methods("GET")
+
+	api.HandleFunc("/payees/new", baseWrapper(loginWrapper(NewPayee))).
+		Methods("POST")
+	api.HandleFunc("/payees/{key:[0-9]+}", baseWrapper(loginWrapper(UpdatePayee))).
+		Methods("PUT")
+	api.HandleFunc("/payees/{key:[0-9]+}/merge", baseWrapper(loginWrapper(MergePayee))).
+		Methods("POST")
+	api.HandleFunc("/payees", baseWrapper(loginWrapper(ListPayees))).
+		Methods("GET")
+
+	api.HandleFunc("/rules/new", baseWrapper(loginWrapper(NewRule))).
+		Methods("POST")
+	api.HandleFunc("/rules/{key:[0-9]+}", baseWrapper(loginWrapper(UpdateRule))).
+		Methods("PUT")
+	api.HandleFunc("/rules/{key:[0-9]+}", baseWrapper(loginWrapper(DeleteRule))).
+		Methods("DELETE")
+	api.HandleFunc("/rules/{key:[0-9]+}/preview", baseWrapper(loginWrapper(PreviewRule))).
+		Methods("GET")
+	api.HandleFunc("/rules/{key:[0-9]+}/apply", baseWrapper(loginWrapper(ApplyRule))).
+		Methods("POST")
+	api.HandleFunc("/rules", baseWrapper(loginWrapper(ListRules))).
+		Methods("GET")
+
+	api.HandleFunc("/categorizer/suggest", baseWrapper(loginWrapper(SuggestCounterAccount))).
+		Methods("GET")
+	api.HandleFunc("/categorizer/train", baseWrapper(loginWrapper(RetrainCategorizer))).
+		Methods("POST")
+
+	api.HandleFunc("/reports/networth", baseWrapper(loginWrapper(ShowNetWorth))).
+		Methods("GET")
+	api.HandleFunc("/reports/income-statement", baseWrapper(loginWrapper(ShowIncomeStatement))).
+		Methods("GET")
+	api.HandleFunc("/reports/balance-sheet", baseWrapper(loginWrapper(ShowBalanceSheet))).
+		Methods("GET")
+	api.HandleFunc("/reports/cash-flow", baseWrapper(loginWrapper(ShowCashFlow))).
+		Methods("GET")
+	api.HandleFunc("/reports/spending", baseWrapper(loginWrapper(ShowSpendingPivot))).
+		Methods("GET")
+	api.HandleFunc("/reports/tax", baseWrapper(loginWrapper(ShowTaxReport))).
+		Methods("GET")
+	api.HandleFunc("/forecast", baseWrapper(loginWrapper(ForecastBalances))).
+		Methods("POST")
+
+	api.HandleFunc("/groups/new", baseWrapper(loginWrapper(NewGroup))).
+		Methods("POST")
+	api.HandleFunc("/groups/{key:[0-9]+}", baseWrapper(loginWrapper(ShowGroup))).
+		Methods("GET")
+	api.HandleFunc("/groups/{key:[0-9]+}/join", baseWrapper(loginWrapper(JoinGroup))).
+		Methods("POST")
+	api.HandleFunc("/groups/{key:[0-9]+}/expenses", baseWrapper(loginWrapper(NewSharedExpense))).
+		Methods("POST")
+	api.HandleFunc("/groups/{key:[0-9]+}/settle", baseWrapper(loginWrapper(SettleGroup))).
+		Methods("GET")
+	api.HandleFunc("/groups/{key:[0-9]+}/settle", baseWrapper(loginWrapper(ConfirmSettlement))).
+		Methods("POST")
+	api.HandleFunc("/groups", baseWrapper(loginWrapper(ListGroups))).
+		Methods("GET")
+
+	api.HandleFunc("/settings", baseWrapper(loginWrapper(ShowSettings))).
+		Methods("GET")
+	api.HandleFunc("/settings", baseWrapper(loginWrapper(UpdateSettings))).
+		Methods("PUT")
+
+	api.HandleFunc("/chain/verify", baseWrapper(loginWrapper(VerifyChain))).
+		Methods("GET")
+
+	api.HandleFunc("/admin/ledger/check", baseWrapper(adminWrapper(CheckLedger))).
+		Methods("GET")
+	api.HandleFunc("/admin/ledger/repair", baseWrapper(adminWrapper(RepairLedger))).
+		Methods("POST")
+	api.HandleFunc("/admin/interest/post", baseWrapper(adminWrapper(PostInterest))).
+		Methods("GET")
+	api.HandleFunc("/admin/migrate", baseWrapper(adminWrapper(MigrateEntities))).
+		Methods("POST")
 
 	http.Handle("/", r)
 }
@@ -36,3 +36,54 @@ func TestLoginWrapper_LoggedIn(t *testing.T) {
 	expectCode(t, http.StatusOK, w)
 	expectBody(t, "test@example.com", w)
 }
+
+// dummyAdminHandler is wrapped by adminWrapper, and prints "ok" to the
+// ResponseWriter.
+var dummyAdminHandler = adminWrapper(func(p *requestParams) {
+	fmt.Fprint(p.w, "ok")
+})
+
+// Verify that a logged out user's admin request returns an unauthorized error.
+func TestAdminWrapper_LoggedOut(t *testing.T) {
+	w, r, c := initTestRequestParams(t, nil)
+	defer c.Close()
+
+	dummyAdminHandler(&requestParams{w: w, r: r, c: c})
+
+	expectCode(t, http.StatusUnauthorized, w)
+	expectBody(t, "", w)
+}
+
+// Verify that a non-admin user's admin request returns a forbidden error.
+func TestAdminWrapper_NotAdmin(t *testing.T) {
+	w, r, c := initTestRequestParams(t, &user.User{Email: "test@example.com"})
+	defer c.Close()
+
+	dummyAdminHandler(&requestParams{w: w, r: r, c: c})
+
+	expectCode(t, http.StatusForbidden, w)
+	expectBody(t, "", w)
+}
+
+// Verify that an admin user's request succeeds.
+func TestAdminWrapper_Admin(t *testing.T) {
+	w, r, c := initTestRequestParams(t, &user.User{Email: "test@example.com", Admin: true})
+	defer c.Close()
+
+	dummyAdminHandler(&requestParams{w: w, r: r, c: c})
+
+	expectCode(t, http.StatusOK, w)
+	expectBody(t, "ok", w)
+}
+
+// Verify that a cron request succeeds without a logged in user.
+func TestAdminWrapper_Cron(t *testing.T) {
+	w, r, c := initTestRequestParams(t, nil)
+	defer c.Close()
+	r.Header.Set("X-Appengine-Cron", "true")
+
+	dummyAdminHandler(&requestParams{w: w, r: r, c: c})
+
+	expectCode(t, http.StatusOK, w)
+	expectBody(t, "ok", w)
+}
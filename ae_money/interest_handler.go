@@ -0,0 +1,219 @@
+package ae_money
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"code.google.com/p/go-uuid/uuid"
+
+	"github.com/cjc25/ae_money/transaction"
+
+	"appengine"
+	"appengine/datastore"
+)
+
+// InterestRequest is for JSON unmarshalling of SetInterest request bodies.
+// Since defaults to today.
+type InterestRequest struct {
+	Rate        float64                 `json:"rate"`
+	RateType    transaction.RateType    `json:"rateType"`
+	Compounding transaction.Compounding `json:"compounding"`
+	DayCount    transaction.DayCount    `json:"dayCount"`
+	Account     int64                   `json:"account"`
+	Since       string                  `json:"since"`
+}
+
+// interestKey provides the datastore key for the Interest on an Account. An
+// Account has at most one Interest.
+func interestKey(c appengine.Context, accountKey *datastore.Key) *datastore.Key {
+	return datastore.NewKey(c, "Interest", "interest", 0, accountKey)
+}
+
+// accountSplits gets every Split in an Account's history.
+func accountSplits(c appengine.Context, accountKey *datastore.Key) ([]transaction.Split, error) {
+	_, splits, err := newDatastoreLedger(c, accountKey.Parent()).AccountSplits(accountKey.IntID())
+	return splits, err
+}
+
+// SetInterest starts accruing interest on an Account, replacing any previous
+// configuration. The configuration is read as JSON from the request body, and
+// the Account is extracted from the gorilla/mux vars.
+func SetInterest(p *requestParams) {
+	w, r, c, u, v := p.w, p.r, p.c, p.u, p.v
+
+	var accountIntID int64
+	_, err := fmt.Sscan(v["key"], &accountIntID)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	var request InterestRequest
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	userKey := userKey(c, u)
+	settings, err := getSettings(c, userKey)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	since := today(settings)
+	if request.Since != "" {
+		since, err = transaction.ParseDate(request.Since)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	i := &transaction.Interest{
+		Rate:        request.Rate,
+		RateType:    request.RateType,
+		Compounding: request.Compounding,
+		DayCount:    request.DayCount,
+		Account:     request.Account,
+		Since:       since,
+		Through:     since,
+	}
+	if err := i.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	accountKey := datastore.NewKey(c, "Account", "", accountIntID, userKey)
+	err = datastore.RunInTransaction(c, func(c appengine.Context) error {
+		l := newDatastoreLedger(c, userKey)
+		for _, id := range []int64{accountIntID, i.Account} {
+			if _, err := l.Account(id); err != nil {
+				return err
+			}
+		}
+
+		_, err := datastore.Put(c, interestKey(c, accountKey), i)
+		return err
+	}, nil)
+	if err != nil {
+		// TODO(cjc25): This might not be a 400: if e.g. datastore failed it should
+		// be a 500. Interpret err and return the right thing.
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	e := json.NewEncoder(w)
+	if err := e.Encode(i); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// PreviewInterest prints the next interest posting for an Account, as it
+// would be posted if no more Splits were added. The Account is extracted from
+// the gorilla/mux vars.
+func PreviewInterest(p *requestParams) {
+	w, c, u, v := p.w, p.c, p.u, p.v
+
+	var accountIntID int64
+	_, err := fmt.Sscan(v["key"], &accountIntID)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	accountKey := datastore.NewKey(c, "Account", "", accountIntID, userKey(c, u))
+	var i transaction.Interest
+	if err := datastore.Get(c, interestKey(c, accountKey), &i); err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	splits, err := accountSplits(c, accountKey)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	e := json.NewEncoder(w)
+	if err := e.Encode(i.Next(splits)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// postDueInterest posts each compounding period of the Interest with key k
+// that ended on or before date, one datastore transaction per period. It
+// returns the number of periods posted.
+func postDueInterest(c appengine.Context, k *datastore.Key, date transaction.Date) (int, error) {
+	accountKey := k.Parent()
+	userKey := accountKey.Parent()
+
+	for posted := 0; ; posted++ {
+		done := false
+		err := datastore.RunInTransaction(c, func(c appengine.Context) error {
+			var i transaction.Interest
+			if err := datastore.Get(c, k, &i); err != nil {
+				return err
+			}
+			if i.NextPeriodEnd().After(date) {
+				done = true
+				return nil
+			}
+
+			splits, err := accountSplits(c, accountKey)
+			if err != nil {
+				return err
+			}
+			next := i.Next(splits)
+			if next.Amount != 0 {
+				memo := fmt.Sprintf("Interest from %v", next.From)
+				err := putTransaction(c, userKey, uuid.NewRandom().String(),
+					next.Splits(accountKey.IntID(), i.Account, memo))
+				if err != nil {
+					return err
+				}
+			}
+			i.Post(next)
+
+			_, err = datastore.Put(c, k, &i)
+			return err
+		}, nil)
+		if err != nil || done {
+			return posted, err
+		}
+	}
+}
+
+// PostInterest posts all interest that has come due for every user, as of
+// today in their time zone. It's run by cron, see cron.yaml.
+func PostInterest(p *requestParams) {
+	w, c := p.w, p.c
+
+	keys, err := datastore.NewQuery("Interest").KeysOnly().GetAll(c, nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	result := make(map[string]int)
+	for _, k := range keys {
+		settings, err := getSettings(c, k.Parent().Parent())
+		if err != nil {
+			c.Errorf("Failed to get settings for %v: %v", k, err)
+			continue
+		}
+		posted, err := postDueInterest(c, k, today(settings))
+		if err != nil {
+			// Keep going, so one broken Account doesn't stop everyone's interest.
+			c.Errorf("Failed to post interest for %v: %v", k, err)
+		}
+		result[k.Parent().Encode()] = posted
+	}
+
+	e := json.NewEncoder(w)
+	if err := e.Encode(result); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
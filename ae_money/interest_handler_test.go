@@ -0,0 +1,148 @@
+package ae_money
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cjc25/ae_money/transaction"
+
+	"appengine"
+	"appengine/datastore"
+	"appengine/user"
+)
+
+// Setup method which adds a savings and interest income Account, deposits
+// 100000 in savings on 2014-10-01 and starts accruing interest on 2014-11-01.
+func setUpTestInterestOrDie(t *testing.T, c appengine.Context, u *user.User) []*datastore.Key {
+	k := insertAccountsOrDie(t, c, []transaction.Account{
+		{Name: "Savings", Type: transaction.Asset},
+		{Name: "Interest", Type: transaction.Income},
+		{Name: "Salary", Type: transaction.Income},
+	}, u)
+	newTestTransactionOrDie(t, c, u, []transaction.AmountType{100000, -100000},
+		[]int64{k[0].IntID(), k[2].IntID()}, "Deposit", "2014-10-01")
+
+	w := httptest.NewRecorder()
+	r := &http.Request{Body: ioutil.NopCloser(bytes.NewBufferString(fmt.Sprintf(
+		`{"rate":0.0365,"rateType":"apr","compounding":"monthly","dayCount":"actual/365","account":%v,"since":"2014-11-01"}`,
+		k[1].IntID())))}
+	SetInterest(&requestParams{w: w, r: r, c: c, u: u, v: map[string]string{"key": fmt.Sprint(k[0].IntID())}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Failed to set up test interest: %v", w.Body.String())
+	}
+	return k
+}
+
+func TestSetInterest_FailureInvalid(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, r, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := insertAccountsOrDie(t, c, []transaction.Account{{Name: "Savings"}}, u)
+	r.Body = ioutil.NopCloser(bytes.NewBufferString(`{"rate":0.0365,"rateType":"apr"}`))
+
+	SetInterest(&requestParams{w: w, r: r, c: c, u: u, v: map[string]string{"key": fmt.Sprint(k[0].IntID())}})
+
+	expectCode(t, http.StatusBadRequest, w)
+}
+
+func TestSetInterest_FailureNoSuchAccount(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, r, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := insertAccountsOrDie(t, c, []transaction.Account{{Name: "Savings"}}, u)
+	r.Body = ioutil.NopCloser(bytes.NewBufferString(fmt.Sprintf(
+		`{"rate":0.0365,"rateType":"apr","compounding":"monthly","dayCount":"actual/365","account":%v}`,
+		k[0].IntID()+1)))
+
+	SetInterest(&requestParams{w: w, r: r, c: c, u: u, v: map[string]string{"key": fmt.Sprint(k[0].IntID())}})
+
+	expectCode(t, http.StatusBadRequest, w)
+}
+
+func TestPreviewInterest(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := setUpTestInterestOrDie(t, c, u)
+
+	PreviewInterest(&requestParams{w: w, c: c, u: u, v: map[string]string{"key": fmt.Sprint(k[0].IntID())}})
+
+	expectCode(t, http.StatusOK, w)
+	var result transaction.InterestPosting
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Amount != 300 || result.Date.String() != "2014-12-01" {
+		t.Errorf("Expected 300 posted on 2014-12-01, got %+v", result)
+	}
+
+	// Previewing doesn't post anything.
+	if total := accountTotalOrDie(t, c, k[1]); total != 0 {
+		t.Errorf("Expected interest total 0 after preview, got %v", total)
+	}
+}
+
+func TestPostDueInterest(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	_, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := setUpTestInterestOrDie(t, c, u)
+	date := transaction.Date{Year: 2015, Month: 1, Day: 15}
+
+	posted, err := postDueInterest(c, interestKey(c, k[0]), date)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if posted != 2 {
+		t.Errorf("Expected 2 postings, got %v", posted)
+	}
+
+	// November earns 300, and December earns 31 days on 100300.
+	if total := accountTotalOrDie(t, c, k[1]); total != -611 {
+		t.Errorf("Expected interest total -611, got %v", total)
+	}
+	if total := accountTotalOrDie(t, c, k[0]); total != 100611 {
+		t.Errorf("Expected savings total 100611, got %v", total)
+	}
+
+	// Posting again on the same day does nothing.
+	if posted, err := postDueInterest(c, interestKey(c, k[0]), date); err != nil || posted != 0 {
+		t.Errorf("Expected no more postings, got %v, %v", posted, err)
+	}
+}
+
+func TestPostDueInterest_BackDatedSplit(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	_, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := setUpTestInterestOrDie(t, c, u)
+	if _, err := postDueInterest(c, interestKey(c, k[0]), transaction.Date{Year: 2014, Month: 12, Day: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A deposit dated in November, after November's interest was posted.
+	newTestTransactionOrDie(t, c, u, []transaction.AmountType{100000, -100000},
+		[]int64{k[0].IntID(), k[2].IntID()}, "Late deposit", "2014-11-21")
+
+	w := httptest.NewRecorder()
+	PreviewInterest(&requestParams{w: w, c: c, u: u, v: map[string]string{"key": fmt.Sprint(k[0].IntID())}})
+
+	var result transaction.InterestPosting
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	// 10 missed days in November, and 31 days on 200300 in December.
+	if result.Amount != 721 {
+		t.Errorf("Expected December posting of 721, got %+v", result)
+	}
+}
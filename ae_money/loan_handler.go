@@ -0,0 +1,229 @@
+package ae_money
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"code.google.com/p/go-uuid/uuid"
+
+	"github.com/cjc25/ae_money/transaction"
+
+	"appengine"
+	"appengine/datastore"
+)
+
+// LoanRequest is for JSON unmarshalling of SetLoan request bodies.
+type LoanRequest struct {
+	Principal       transaction.AmountType `json:"principal"`
+	Rate            float64                `json:"rate"`
+	Term            int64                  `json:"term"`
+	Start           string                 `json:"start"`
+	InterestAccount int64                  `json:"interestAccount"`
+	PaymentAccount  int64                  `json:"paymentAccount"`
+}
+
+// LoanAndSchedule wraps a transaction.Loan and its remaining amortization
+// table for JSON responses.
+type LoanAndSchedule struct {
+	Loan     *transaction.Loan         `json:"loan"`
+	Schedule []transaction.LoanPayment `json:"schedule"`
+}
+
+// LoanPaymentRequest is for JSON unmarshalling of PayLoan request bodies. If
+// ExtraOnly is false, Extra is added to the next scheduled payment. Date
+// defaults to the scheduled payment's due date, and Account defaults to the
+// loan's PaymentAccount.
+type LoanPaymentRequest struct {
+	Date      string                 `json:"date"`
+	Extra     transaction.AmountType `json:"extra"`
+	ExtraOnly bool                   `json:"extraOnly"`
+	Account   int64                  `json:"account"`
+}
+
+// loanKey provides the datastore key for the Loan on an Account. An Account
+// has at most one Loan.
+func loanKey(c appengine.Context, accountKey *datastore.Key) *datastore.Key {
+	return datastore.NewKey(c, "Loan", "loan", 0, accountKey)
+}
+
+// SetLoan amortizes a Liability Account with the loan terms read as JSON from
+// the request body, replacing any previous loan. The Account is extracted from
+// the gorilla/mux vars.
+func SetLoan(p *requestParams) {
+	w, r, c, u, v := p.w, p.r, p.c, p.u, p.v
+
+	var accountIntID int64
+	_, err := fmt.Sscan(v["key"], &accountIntID)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	var request LoanRequest
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	start, err := transaction.ParseDate(request.Start)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	l := &transaction.Loan{
+		Principal:       request.Principal,
+		Rate:            request.Rate,
+		Term:            request.Term,
+		Start:           start,
+		InterestAccount: request.InterestAccount,
+		PaymentAccount:  request.PaymentAccount,
+	}
+	if err := l.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	l.Amortize()
+
+	userKey := userKey(c, u)
+	accountKey := datastore.NewKey(c, "Account", "", accountIntID, userKey)
+	err = datastore.RunInTransaction(c, func(c appengine.Context) error {
+		ledger := newDatastoreLedger(c, userKey)
+		for _, id := range []int64{l.InterestAccount, l.PaymentAccount} {
+			if _, err := ledger.Account(id); err != nil {
+				return err
+			}
+		}
+		a, err := ledger.Account(accountIntID)
+		if err != nil {
+			return err
+		}
+		if a.Type != transaction.Liability {
+			return errors.New("Loans can only be set on liability accounts.")
+		}
+
+		_, err = datastore.Put(c, loanKey(c, accountKey), l)
+		return err
+	}, nil)
+	if err != nil {
+		// TODO(cjc25): This might not be a 400: if e.g. datastore failed it should
+		// be a 500. Interpret err and return the right thing.
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	e := json.NewEncoder(w)
+	if err := e.Encode(&LoanAndSchedule{l, l.Schedule()}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// ShowLoan prints an Account's Loan and its remaining amortization table. The
+// Account is extracted from the gorilla/mux vars.
+func ShowLoan(p *requestParams) {
+	w, c, u, v := p.w, p.c, p.u, p.v
+
+	var accountIntID int64
+	_, err := fmt.Sscan(v["key"], &accountIntID)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	accountKey := datastore.NewKey(c, "Account", "", accountIntID, userKey(c, u))
+	var l transaction.Loan
+	if err := datastore.Get(c, loanKey(c, accountKey), &l); err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	e := json.NewEncoder(w)
+	if err := e.Encode(&LoanAndSchedule{&l, l.Schedule()}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// PayLoan posts a loan payment as a transaction which splits principal and
+// interest, and prints the payment as JSON. The payment is read as JSON from
+// the request body, and the loan's Account is extracted from the gorilla/mux
+// vars.
+func PayLoan(p *requestParams) {
+	w, r, c, u, v := p.w, p.r, p.c, p.u, p.v
+
+	var accountIntID int64
+	_, err := fmt.Sscan(v["key"], &accountIntID)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	var request LoanPaymentRequest
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var requestDate transaction.Date
+	if request.Date != "" || request.ExtraOnly {
+		requestDate, err = transaction.ParseDate(request.Date)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	userKey := userKey(c, u)
+	accountKey := datastore.NewKey(c, "Account", "", accountIntID, userKey)
+	var payment *transaction.LoanPayment
+	err = datastore.RunInTransaction(c, func(c appengine.Context) error {
+		var l transaction.Loan
+		if err := datastore.Get(c, loanKey(c, accountKey), &l); err != nil {
+			return err
+		}
+
+		var err error
+		payment, err = l.Pay(request.Extra, !request.ExtraOnly)
+		if err != nil {
+			return err
+		}
+
+		memo := fmt.Sprintf("Loan payment %v", payment.Number)
+		if request.ExtraOnly {
+			memo = "Loan extra principal"
+		}
+		// The datastore may retry this, so don't change requestDate.
+		date := requestDate
+		if date.IsZero() {
+			date = payment.Date
+		}
+		funding := l.PaymentAccount
+		if request.Account != 0 {
+			funding = request.Account
+		}
+
+		splits := payment.Splits(accountIntID, funding, l.InterestAccount, memo, date)
+		if err := putTransaction(c, userKey, uuid.NewRandom().String(), splits); err != nil {
+			return err
+		}
+		_, err = datastore.Put(c, loanKey(c, accountKey), &l)
+		return err
+	}, nil)
+	if err == datastore.ErrNoSuchEntity {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	e := json.NewEncoder(w)
+	if err := e.Encode(payment); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
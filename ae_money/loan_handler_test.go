@@ -0,0 +1,185 @@
+package ae_money
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cjc25/ae_money/transaction"
+
+	"appengine"
+	"appengine/datastore"
+	"appengine/user"
+)
+
+// Convenience function to read an Account's total, which is only exposed
+// through its JSON representation.
+func accountTotalOrDie(t *testing.T, c appengine.Context, accountKey *datastore.Key) transaction.AmountType {
+	var a transaction.Account
+	if err := datastore.Get(c, accountKey, &a); err != nil {
+		t.Fatal(err)
+	}
+	b, err := a.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result struct {
+		Total transaction.AmountType `json:"total"`
+	}
+	if err := json.Unmarshal(b, &result); err != nil {
+		t.Fatal(err)
+	}
+	return result.Total
+}
+
+// Setup method which adds a mortgage, interest and checking Account, and sets
+// a loan on the mortgage.
+func setUpTestLoanOrDie(t *testing.T, c appengine.Context, u *user.User) []*datastore.Key {
+	k := insertAccountsOrDie(t, c, []transaction.Account{
+		{Name: "Mortgage", Type: transaction.Liability},
+		{Name: "Interest", Type: transaction.Expense},
+		{Name: "Checking", Type: transaction.Asset},
+	}, u)
+
+	w := httptest.NewRecorder()
+	r := &http.Request{Body: ioutil.NopCloser(bytes.NewBufferString(fmt.Sprintf(
+		`{"principal":100000,"rate":0.12,"term":12,"start":"2014-11-01","interestAccount":%v,"paymentAccount":%v}`,
+		k[1].IntID(), k[2].IntID())))}
+	SetLoan(&requestParams{w: w, r: r, c: c, u: u, v: map[string]string{"key": fmt.Sprint(k[0].IntID())}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Failed to set up test loan: %v", w.Body.String())
+	}
+	return k
+}
+
+func TestSetLoan_Success(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := setUpTestLoanOrDie(t, c, u)
+
+	ShowLoan(&requestParams{w: w, c: c, u: u, v: map[string]string{"key": fmt.Sprint(k[0].IntID())}})
+
+	expectCode(t, http.StatusOK, w)
+	var result LoanAndSchedule
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Loan.Payment != 8885 {
+		t.Errorf("Expected payment 8885, got %v", result.Loan.Payment)
+	}
+	if len(result.Schedule) != 12 {
+		t.Errorf("Expected 12 scheduled payments, got %v", len(result.Schedule))
+	}
+}
+
+func TestSetLoan_FailureNotLiability(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, r, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := insertAccountsOrDie(t, c, []transaction.Account{
+		{Name: "Checking", Type: transaction.Asset},
+		{Name: "Interest", Type: transaction.Expense},
+	}, u)
+	r.Body = ioutil.NopCloser(bytes.NewBufferString(fmt.Sprintf(
+		`{"principal":100000,"rate":0.12,"term":12,"start":"2014-11-01","interestAccount":%v,"paymentAccount":%v}`,
+		k[1].IntID(), k[0].IntID())))
+
+	SetLoan(&requestParams{w: w, r: r, c: c, u: u, v: map[string]string{"key": fmt.Sprint(k[0].IntID())}})
+
+	expectCode(t, http.StatusBadRequest, w)
+}
+
+func TestSetLoan_FailureBadTerms(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, r, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := insertAccountsOrDie(t, c, []transaction.Account{{Name: "Mortgage", Type: transaction.Liability}}, u)
+	r.Body = ioutil.NopCloser(bytes.NewBufferString(`{"principal":100000,"start":"2014-11-01"}`))
+
+	SetLoan(&requestParams{w: w, r: r, c: c, u: u, v: map[string]string{"key": fmt.Sprint(k[0].IntID())}})
+
+	expectCode(t, http.StatusBadRequest, w)
+}
+
+func TestShowLoan_FailureNoLoan(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := insertAccountsOrDie(t, c, []transaction.Account{{Name: "Mortgage", Type: transaction.Liability}}, u)
+
+	ShowLoan(&requestParams{w: w, c: c, u: u, v: map[string]string{"key": fmt.Sprint(k[0].IntID())}})
+
+	expectCode(t, http.StatusNotFound, w)
+}
+
+func TestPayLoan_Scheduled(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, r, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := setUpTestLoanOrDie(t, c, u)
+	r.Body = ioutil.NopCloser(bytes.NewBufferString(`{}`))
+
+	PayLoan(&requestParams{w: w, r: r, c: c, u: u, v: map[string]string{"key": fmt.Sprint(k[0].IntID())}})
+
+	expectCode(t, http.StatusOK, w)
+	if total := accountTotalOrDie(t, c, k[0]); total != 7885 {
+		t.Errorf("Expected mortgage total 7885, got %v", total)
+	}
+	if total := accountTotalOrDie(t, c, k[1]); total != 1000 {
+		t.Errorf("Expected interest total 1000, got %v", total)
+	}
+	if total := accountTotalOrDie(t, c, k[2]); total != -8885 {
+		t.Errorf("Expected checking total -8885, got %v", total)
+	}
+}
+
+func TestPayLoan_ExtraOnly(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, r, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := setUpTestLoanOrDie(t, c, u)
+	r.Body = ioutil.NopCloser(bytes.NewBufferString(`{"date":"2014-11-15","extra":30000,"extraOnly":true}`))
+
+	PayLoan(&requestParams{w: w, r: r, c: c, u: u, v: map[string]string{"key": fmt.Sprint(k[0].IntID())}})
+
+	expectCode(t, http.StatusOK, w)
+	if total := accountTotalOrDie(t, c, k[0]); total != 30000 {
+		t.Errorf("Expected mortgage total 30000, got %v", total)
+	}
+
+	var l transaction.Loan
+	if err := datastore.Get(c, loanKey(c, k[0]), &l); err != nil {
+		t.Fatal(err)
+	}
+	if l.Paid != 0 || l.Balance != 70000 {
+		t.Errorf("Expected no scheduled payments and balance 70000, got %+v", l)
+	}
+	if s := l.Schedule(); len(s) >= 12 {
+		t.Errorf("Expected a shorter schedule after extra principal, got %v payments", len(s))
+	}
+}
+
+func TestPayLoan_FailureNoLoan(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, r, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := insertAccountsOrDie(t, c, []transaction.Account{{Name: "Mortgage", Type: transaction.Liability}}, u)
+	r.Body = ioutil.NopCloser(bytes.NewBufferString(`{}`))
+
+	PayLoan(&requestParams{w: w, r: r, c: c, u: u, v: map[string]string{"key": fmt.Sprint(k[0].IntID())}})
+
+	expectCode(t, http.StatusNotFound, w)
+	expectSplits(t, c, u, nil, nil, "")
+}
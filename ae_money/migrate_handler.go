@@ -0,0 +1,200 @@
+package ae_money
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/cjc25/ae_money/transaction"
+
+	"appengine"
+	"appengine/datastore"
+)
+
+// MigrationReport counts the entities of a user that were upgraded to their
+// current schema version.
+type MigrationReport struct {
+	Accounts int `json:"accounts"`
+	Splits   int `json:"splits"`
+}
+
+// migrationBatchSize is the number of entities read in each page of keys, and
+// upgraded in each datastore transaction, to stay under datastore's limits on
+// query results and writes per transaction.
+const migrationBatchSize = 200
+
+// forEachKeyPage runs the keys-only query q a page of migrationBatchSize keys
+// at a time, continuing each page from the last one's cursor, and calls f
+// with each page.
+func forEachKeyPage(c appengine.Context, q *datastore.Query, f func(keys []*datastore.Key) error) error {
+	q = q.KeysOnly().Limit(migrationBatchSize)
+	for {
+		t := q.Run(c)
+		keys := make([]*datastore.Key, 0, migrationBatchSize)
+		for {
+			k, err := t.Next(nil)
+			if err == datastore.Done {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			keys = append(keys, k)
+		}
+		if len(keys) == 0 {
+			return nil
+		}
+		if err := f(keys); err != nil {
+			return err
+		}
+		if len(keys) < migrationBatchSize {
+			return nil
+		}
+
+		cursor, err := t.Cursor()
+		if err != nil {
+			return err
+		}
+		q = q.Start(cursor)
+	}
+}
+
+// currentKeys finds the keys of the entities of kind under userKey whose
+// schema is version or newer. Only the schema version's index is read, not the
+// entities. Entities saved before versioning aren't in it, so they're never
+// current.
+func currentKeys(c appengine.Context, userKey *datastore.Key, kind string, version int64) (map[string]bool, error) {
+	current := make(map[string]bool)
+	q := datastore.NewQuery(kind).Ancestor(userKey).Filter(transaction.SchemaVersionProperty+" >=", version)
+	err := forEachKeyPage(c, q, func(keys []*datastore.Key) error {
+		for _, k := range keys {
+			current[k.Encode()] = true
+		}
+		return nil
+	})
+	return current, err
+}
+
+// migrateKind upgrades the entities of kind under userKey to version, a
+// batch at a time, and returns the number upgraded before any error. Loading
+// an entity upgrades it, so they only need to be saved again. newEntity makes
+// an entity of kind to load into.
+//
+// Each batch is its own datastore transaction, so an upgrade can't overwrite a
+// concurrent change, like a new Account total, without the whole user's
+// entities having to fit in one. Entities deleted since they were found are
+// skipped.
+func migrateKind(c appengine.Context, userKey *datastore.Key, kind string, version int64, newEntity func() datastore.PropertyLoadSaver) (int, error) {
+	current, err := currentKeys(c, userKey, kind, version)
+	if err != nil {
+		return 0, err
+	}
+
+	migrated := 0
+	q := datastore.NewQuery(kind).Ancestor(userKey)
+	err = forEachKeyPage(c, q, func(keys []*datastore.Key) error {
+		outdated := make([]*datastore.Key, 0, len(keys))
+		for _, k := range keys {
+			if !current[k.Encode()] {
+				outdated = append(outdated, k)
+			}
+		}
+		if len(outdated) == 0 {
+			return nil
+		}
+
+		// The datastore may retry the transaction, so only count what the one
+		// that commits put.
+		put := 0
+		err := datastore.RunInTransaction(c, func(c appengine.Context) error {
+			entities := make([]datastore.PropertyLoadSaver, len(outdated))
+			for i := range entities {
+				entities[i] = newEntity()
+			}
+			found, foundEntities := outdated, entities
+			if err := datastore.GetMulti(c, outdated, entities); err != nil {
+				merr, ok := err.(appengine.MultiError)
+				if !ok {
+					return err
+				}
+				found, foundEntities = nil, nil
+				for i, err := range merr {
+					if err == nil {
+						found = append(found, outdated[i])
+						foundEntities = append(foundEntities, entities[i])
+					} else if err != datastore.ErrNoSuchEntity {
+						return err
+					}
+				}
+			}
+
+			if _, err := datastore.PutMulti(c, found, foundEntities); err != nil {
+				return err
+			}
+			put = len(found)
+			return nil
+		}, nil)
+		if err != nil {
+			return err
+		}
+		migrated += put
+		return nil
+	})
+	return migrated, err
+}
+
+// migrateUserEntities upgrades the Accounts and Splits of the user whose key
+// is userKey to their current schema versions. If it fails, report counts the
+// entities upgraded before it did.
+func migrateUserEntities(c appengine.Context, userKey *datastore.Key) (report *MigrationReport, err error) {
+	report = &MigrationReport{}
+	report.Accounts, err = migrateKind(c, userKey, "Account", transaction.AccountSchemaVersion,
+		func() datastore.PropertyLoadSaver { return &transaction.Account{} })
+	if err != nil {
+		return report, err
+	}
+	report.Splits, err = migrateKind(c, userKey, "Split", transaction.SplitSchemaVersion,
+		func() datastore.PropertyLoadSaver { return &transaction.Split{} })
+	return report, err
+}
+
+// MigrateEntities upgrades the stored Accounts and Splits of the user named by
+// the "user" form value, or of every user if there isn't one, to their current
+// schema versions, and prints a JSON object of MigrationReports keyed by user.
+//
+// Entities are upgraded as they're loaded anyway, but not stored until they're
+// next saved. Run this after adding a migration, before removing support for
+// the schema it upgrades from.
+func MigrateEntities(p *requestParams) {
+	w, r, c := p.w, p.r, p.c
+
+	var userKeys []*datastore.Key
+	if name := r.FormValue("user"); name != "" {
+		userKeys = []*datastore.Key{datastoreUserKey(c, name)}
+	} else {
+		var err error
+		userKeys, err = allUserKeys(c)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	result := make(map[string]*MigrationReport)
+	for _, k := range userKeys {
+		report, err := migrateUserEntities(c, k)
+		if err != nil {
+			// Earlier batches are committed, so say how far we got.
+			http.Error(w, fmt.Sprintf("Upgraded %+v of %v before failing: %v", *report, k.StringID(), err),
+				http.StatusInternalServerError)
+			return
+		}
+		result[k.StringID()] = report
+	}
+
+	e := json.NewEncoder(w)
+	if err := e.Encode(result); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
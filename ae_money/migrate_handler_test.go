@@ -0,0 +1,145 @@
+package ae_money
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cjc25/ae_money/transaction"
+
+	"appengine"
+	"appengine/datastore"
+	"appengine/user"
+)
+
+// Convenience function to store props at k, like an entity saved before its
+// schema was versioned.
+func putPropertiesOrDie(t *testing.T, c appengine.Context, k *datastore.Key, props ...datastore.Property) {
+	l := datastore.PropertyList(props)
+	if _, err := datastore.Put(c, k, &l); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Expectation function for the schema version stored at k.
+func expectStoredSchemaVersion(t *testing.T, c appengine.Context, k *datastore.Key, expected int64) {
+	var props datastore.PropertyList
+	if err := datastore.Get(c, k, &props); err != nil {
+		t.Fatal(err)
+	}
+	if v := transaction.StoredSchemaVersion(props); v != expected {
+		t.Errorf("Expected %v to be schema version %v, got %v", k, expected, v)
+	}
+}
+
+// Expectation function which decodes a MigrateEntities response and checks
+// the report for u.
+func expectMigrationReport(t *testing.T, w *httptest.ResponseRecorder, u *user.User, expected MigrationReport) {
+	result := make(map[string]*MigrationReport)
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	report, ok := result[u.String()]
+	if !ok {
+		t.Fatalf("Expected a report for %v, got %v", u, result)
+	}
+	if *report != expected {
+		t.Errorf("Expected report %+v, got %+v", expected, report)
+	}
+}
+
+func TestMigrateEntities(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, r, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	current := insertAccountsOrDie(t, c, []transaction.Account{{Name: "current"}}, u)[0]
+	old := datastore.NewKey(c, "Account", "", current.IntID()+1, userKey(c, u))
+	putPropertiesOrDie(t, c, old,
+		datastore.Property{Name: "Name", Value: "old"},
+		datastore.Property{Name: "Total", Value: int64(100)})
+	oldSplit := datastore.NewKey(c, "Split", "x1", 0, old)
+	putPropertiesOrDie(t, c, oldSplit,
+		datastore.Property{Name: "Amount", Value: int64(100)},
+		datastore.Property{Name: "Account", Value: old.IntID()})
+
+	MigrateEntities(&requestParams{w: w, r: r, c: c})
+	expectMigrationReport(t, w, u, MigrationReport{Accounts: 1, Splits: 1})
+
+	expectStoredSchemaVersion(t, c, old, transaction.AccountSchemaVersion)
+	expectStoredSchemaVersion(t, c, oldSplit, transaction.SplitSchemaVersion)
+	var a transaction.Account
+	if err := datastore.Get(c, old, &a); err != nil {
+		t.Fatal(err)
+	}
+	if a.Name != "old" || a.Total() != 100 {
+		t.Errorf("Expected the upgrade to keep the account, got %+v", a)
+	}
+
+	// Everything is up to date now.
+	w = httptest.NewRecorder()
+	MigrateEntities(&requestParams{w: w, r: r, c: c})
+	expectMigrationReport(t, w, u, MigrationReport{})
+}
+
+func TestMigrateEntities_SingleUser(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	other := &user.User{Email: "other@example.com"}
+	w, r, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	putPropertiesOrDie(t, c, datastore.NewKey(c, "Account", "", 1, userKey(c, u)),
+		datastore.Property{Name: "Name", Value: "a1"})
+	otherKey := datastore.NewKey(c, "Account", "", 2, userKey(c, other))
+	putPropertiesOrDie(t, c, otherKey, datastore.Property{Name: "Name", Value: "a2"})
+
+	r.Form = map[string][]string{"user": {other.Email}}
+	MigrateEntities(&requestParams{w: w, r: r, c: c})
+
+	result := make(map[string]*MigrationReport)
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if report, ok := result[other.String()]; !ok || len(result) != 1 || report.Accounts != 1 {
+		t.Errorf("Expected only a report for %v, got %v", other, result)
+	}
+	expectStoredSchemaVersion(t, c, otherKey, transaction.AccountSchemaVersion)
+	expectStoredSchemaVersion(t, c, datastore.NewKey(c, "Account", "", 1, userKey(c, u)), 0)
+}
+
+func TestMigrateEntities_ManyBatches(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, r, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	account := insertAccountsOrDie(t, c, []transaction.Account{{Name: "a1"}}, u)[0]
+	// Every other Split is current, so each page of keys has some of both.
+	n := 2*migrationBatchSize + 1
+	keys := make([]*datastore.Key, n)
+	for i := range keys {
+		keys[i] = datastore.NewKey(c, "Split", fmt.Sprintf("x%03d", i), 0, account)
+		props := []datastore.Property{
+			{Name: "Amount", Value: int64(i)},
+			{Name: "Account", Value: account.IntID()},
+		}
+		if i%2 == 1 {
+			props = append(props, datastore.Property{Name: transaction.SchemaVersionProperty, Value: int64(transaction.SplitSchemaVersion)})
+		}
+		putPropertiesOrDie(t, c, keys[i], props...)
+	}
+
+	MigrateEntities(&requestParams{w: w, r: r, c: c})
+	expectMigrationReport(t, w, u, MigrationReport{Splits: migrationBatchSize + 1})
+
+	for i, k := range keys {
+		expectStoredSchemaVersion(t, c, k, transaction.SplitSchemaVersion)
+		var s transaction.Split
+		if err := datastore.Get(c, k, &s); err != nil {
+			t.Fatal(err)
+		}
+		if s.Amount != transaction.AmountType(i) {
+			t.Errorf("Expected the upgrade to keep split %v, got %+v", i, s)
+		}
+	}
+}
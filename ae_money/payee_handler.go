@@ -0,0 +1,228 @@
+package ae_money
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/cjc25/ae_money/transaction"
+
+	"appengine"
+	"appengine/datastore"
+)
+
+// DatastorePayee wraps transaction.Payee for JSON responses that include a
+// datastore key.
+type DatastorePayee struct {
+	Payee *transaction.Payee `json:"payee"`
+	IntID int64              `json:"key"`
+}
+
+// MergePayeeRequest is for JSON unmarshalling of MergePayee request bodies.
+// The Payee From is merged into the Payee in the URL, and deleted.
+type MergePayeeRequest struct {
+	From int64 `json:"from"`
+}
+
+// payeeMergeBatchSize is the number of Splits, and of Rules, that MergePayee
+// repoints in each datastore transaction, to stay under datastore's limit on
+// writes per transaction.
+const payeeMergeBatchSize = 200
+
+// payeeKey provides the datastore key for one of the user's Payees.
+func payeeKey(c appengine.Context, userKey *datastore.Key, intID int64) *datastore.Key {
+	return datastore.NewKey(c, "Payee", "", intID, userKey)
+}
+
+// userPayees gets all of the user's Payees, ordered by name.
+func userPayees(c appengine.Context, userKey *datastore.Key) ([]*datastore.Key, []transaction.Payee, error) {
+	payees := make([]transaction.Payee, 0)
+	keys, err := datastore.NewQuery("Payee").Ancestor(userKey).Order("Name").GetAll(c, &payees)
+	return keys, payees, err
+}
+
+// putPayee validates a Payee read from the request body, and stores it under
+// k. Incomplete keys create a new Payee.
+func putPayee(p *requestParams, k *datastore.Key) {
+	w, r, c := p.w, p.r, p.c
+
+	var payee transaction.Payee
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&payee); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := payee.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err := datastore.RunInTransaction(c, func(c appengine.Context) error {
+		if !k.Incomplete() {
+			if err := datastore.Get(c, k, &transaction.Payee{}); err != nil {
+				return err
+			}
+		}
+		if payee.DefaultAccount != 0 {
+			if _, err := newDatastoreLedger(c, k.Parent()).Account(payee.DefaultAccount); err != nil {
+				return err
+			}
+		}
+
+		var err error
+		k, err = datastore.Put(c, k, &payee)
+		return err
+	}, nil)
+	if err != nil {
+		// TODO(cjc25): This might not be a 400: if e.g. datastore failed it should
+		// be a 500. Interpret err and return the right thing.
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	e := json.NewEncoder(w)
+	if err := e.Encode(&DatastorePayee{&payee, k.IntID()}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// NewPayee creates a new Payee. The Payee is read as JSON from the request
+// body.
+func NewPayee(p *requestParams) {
+	putPayee(p, datastore.NewIncompleteKey(p.c, "Payee", userKey(p.c, p.u)))
+}
+
+// UpdatePayee replaces a Payee with one read as JSON from the request body.
+// The Payee to replace is extracted from the gorilla/mux vars.
+func UpdatePayee(p *requestParams) {
+	var payeeIntID int64
+	if _, err := fmt.Sscan(p.v["key"], &payeeIntID); err != nil {
+		p.w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	putPayee(p, payeeKey(p.c, userKey(p.c, p.u), payeeIntID))
+}
+
+// ListPayees gets the logged in user's Payees from datastore.
+func ListPayees(p *requestParams) {
+	w, c, u := p.w, p.c, p.u
+
+	keys, payees, err := userPayees(c, userKey(c, u))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	result := make([]DatastorePayee, len(payees))
+	for i := range keys {
+		result[i] = DatastorePayee{&payees[i], keys[i].IntID()}
+	}
+
+	e := json.NewEncoder(w)
+	if err := e.Encode(result); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// repointPayee changes up to payeeMergeBatchSize of the user's Splits, and of
+// their Rules, from the Payee from to the Payee to. It returns true if there
+// were no more to change.
+func repointPayee(c appengine.Context, userKey *datastore.Key, from, to int64) (bool, error) {
+	var splits []transaction.Split
+	splitKeys, err := datastore.NewQuery("Split").Ancestor(userKey).
+		Filter("Payee =", from).Limit(payeeMergeBatchSize).GetAll(c, &splits)
+	if err != nil {
+		return false, err
+	}
+	for i := range splits {
+		splits[i].Payee = to
+	}
+	if _, err := datastore.PutMulti(c, splitKeys, splits); err != nil {
+		return false, err
+	}
+
+	var rules []transaction.Rule
+	ruleKeys, err := datastore.NewQuery("Rule").Ancestor(userKey).
+		Filter("Payee =", from).Limit(payeeMergeBatchSize).GetAll(c, &rules)
+	if err != nil {
+		return false, err
+	}
+	for i := range rules {
+		rules[i].Payee = to
+	}
+	if _, err := datastore.PutMulti(c, ruleKeys, rules); err != nil {
+		return false, err
+	}
+
+	return len(splitKeys) < payeeMergeBatchSize && len(ruleKeys) < payeeMergeBatchSize, nil
+}
+
+// MergePayee merges the Payee named in the request body into the Payee
+// extracted from the gorilla/mux vars, and deletes the former. Splits and
+// Rules with the former Payee are changed to the latter, a batch at a time,
+// and the former is only deleted with the last batch. The merged Payee is
+// printed.
+func MergePayee(p *requestParams) {
+	w, r, c, u, v := p.w, p.r, p.c, p.u, p.v
+
+	var payeeIntID int64
+	if _, err := fmt.Sscan(v["key"], &payeeIntID); err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	var request MergePayeeRequest
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if request.From == payeeIntID {
+		http.Error(w, "Can't merge a payee into itself", http.StatusBadRequest)
+		return
+	}
+
+	userKey := userKey(c, u)
+	k := payeeKey(c, userKey, payeeIntID)
+	fromKey := payeeKey(c, userKey, request.From)
+	var payee transaction.Payee
+	for done := false; !done; {
+		err := datastore.RunInTransaction(c, func(c appengine.Context) error {
+			var from transaction.Payee
+			payee = transaction.Payee{}
+			if err := datastore.Get(c, k, &payee); err != nil {
+				return err
+			}
+			if err := datastore.Get(c, fromKey, &from); err != nil {
+				return err
+			}
+
+			var err error
+			done, err = repointPayee(c, userKey, request.From, payeeIntID)
+			if err != nil || !done {
+				return err
+			}
+
+			payee.Merge(&from)
+			if _, err := datastore.Put(c, k, &payee); err != nil {
+				return err
+			}
+			return datastore.Delete(c, fromKey)
+		}, nil)
+		if err != nil {
+			// TODO(cjc25): This might not be a 400: if e.g. datastore failed it should
+			// be a 500. Interpret err and return the right thing.
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	e := json.NewEncoder(w)
+	if err := e.Encode(&DatastorePayee{&payee, payeeIntID}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,276 @@
+package ae_money
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/cjc25/ae_money/handlers"
+	"github.com/cjc25/ae_money/transaction"
+
+	"appengine"
+	"appengine/datastore"
+	"appengine/user"
+)
+
+// Setup method which inserts a Payee for u and returns its key.
+func insertPayeeOrDie(t *testing.T, c appengine.Context, u *user.User, payee *transaction.Payee) *datastore.Key {
+	k, err := datastore.Put(c, datastore.NewIncompleteKey(c, "Payee", userKey(c, u)), payee)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+// Expectation function for a stored Payee.
+func expectPayee(t *testing.T, c appengine.Context, k *datastore.Key, expected *transaction.Payee) {
+	var got transaction.Payee
+	if err := datastore.Get(c, k, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&got, expected) {
+		t.Errorf("Expected payee %+v, got %+v", expected, &got)
+	}
+}
+
+// Convenience function to commit a TransactionRequest for u.
+func newTestPayeeTransaction(t *testing.T, c appengine.Context, u *user.User, request *handlers.TransactionRequest) *httptest.ResponseRecorder {
+	b, err := json.Marshal(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	r := &http.Request{Body: ioutil.NopCloser(bytes.NewBuffer(b))}
+	NewTransaction(&requestParams{w: w, r: r, c: c, u: u})
+	return w
+}
+
+func TestNewPayee(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, r, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := insertAccountsOrDie(t, c, []transaction.Account{{Name: "Groceries"}}, u)
+	r.Body = ioutil.NopCloser(bytes.NewBufferString(fmt.Sprintf(
+		`{"name":"Trader Joe's","defaultAccount":%v}`, k[0].IntID())))
+
+	NewPayee(&requestParams{w: w, r: r, c: c, u: u})
+
+	expectCode(t, http.StatusOK, w)
+	var result DatastorePayee
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	expectPayee(t, c, payeeKey(c, userKey(c, u), result.IntID),
+		&transaction.Payee{Name: "Trader Joe's", DefaultAccount: k[0].IntID()})
+}
+
+func TestNewPayee_FailureBadAccount(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, r, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	r.Body = ioutil.NopCloser(bytes.NewBufferString(`{"name":"Trader Joe's","defaultAccount":5}`))
+
+	NewPayee(&requestParams{w: w, r: r, c: c, u: u})
+
+	expectCode(t, http.StatusBadRequest, w)
+}
+
+func TestUpdatePayee_FailureNoSuchPayee(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, r, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	r.Body = ioutil.NopCloser(bytes.NewBufferString(`{"name":"Trader Joe's"}`))
+
+	UpdatePayee(&requestParams{w: w, r: r, c: c, u: u, v: map[string]string{"key": "5"}})
+
+	expectCode(t, http.StatusBadRequest, w)
+}
+
+func TestListPayees(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, r, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	insertPayeeOrDie(t, c, u, &transaction.Payee{Name: "Whole Foods"})
+	k := insertPayeeOrDie(t, c, u, &transaction.Payee{Name: "Trader Joe's"})
+	insertPayeeOrDie(t, c, &user.User{Email: "other@example.com"}, &transaction.Payee{Name: "Safeway"})
+
+	ListPayees(&requestParams{w: w, r: r, c: c, u: u})
+
+	var result []DatastorePayee
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 2 || result[0].IntID != k.IntID() {
+		t.Errorf("Expected 2 payees starting with %v, got %+v", k.IntID(), result)
+	}
+}
+
+func TestMergePayee(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, r, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := insertPayeeOrDie(t, c, u, &transaction.Payee{Name: "Trader Joe's"})
+	from := insertPayeeOrDie(t, c, u, &transaction.Payee{Name: "TJ's", DefaultMemo: "Groceries"})
+	r.Body = ioutil.NopCloser(bytes.NewBufferString(fmt.Sprintf(`{"from":%v}`, from.IntID())))
+
+	MergePayee(&requestParams{w: w, r: r, c: c, u: u, v: map[string]string{"key": fmt.Sprint(k.IntID())}})
+
+	expectCode(t, http.StatusOK, w)
+	expectPayee(t, c, k, &transaction.Payee{
+		Name: "Trader Joe's", DefaultMemo: "Groceries", Aliases: []string{"TJ's"},
+	})
+	if err := datastore.Get(c, from, &transaction.Payee{}); err != datastore.ErrNoSuchEntity {
+		t.Errorf("Expected merged payee to be deleted, got %v", err)
+	}
+}
+
+func TestMergePayee_RepointsReferences(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, r, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := insertPayeeOrDie(t, c, u, &transaction.Payee{Name: "Trader Joe's"})
+	from := insertPayeeOrDie(t, c, u, &transaction.Payee{Name: "TJ's"})
+	other := insertPayeeOrDie(t, c, u, &transaction.Payee{Name: "Safeway"})
+	a := insertAccountsOrDie(t, c, []transaction.Account{{Name: "Checking"}, {Name: "Groceries"}}, u)
+	// More than a batch, so the merge takes several datastore transactions.
+	for i := 0; i <= payeeMergeBatchSize; i++ {
+		err := commitTransaction(c, userKey(c, u), fmt.Sprint("t", i), []*transaction.Split{
+			{Amount: -1, Account: a[0].IntID(), Payee: from.IntID()},
+			{Amount: 1, Account: a[1].IntID(), Payee: from.IntID()},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := commitTransaction(c, userKey(c, u), "other", []*transaction.Split{
+		{Amount: -1, Account: a[0].IntID(), Payee: other.IntID()},
+		{Amount: 1, Account: a[1].IntID(), Payee: other.IntID()},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	rule := insertRuleOrDie(t, c, u, &transaction.Rule{Name: "TJ", Memo: "TJ", Payee: from.IntID()})
+	r.Body = ioutil.NopCloser(bytes.NewBufferString(fmt.Sprintf(`{"from":%v}`, from.IntID())))
+
+	MergePayee(&requestParams{w: w, r: r, c: c, u: u, v: map[string]string{"key": fmt.Sprint(k.IntID())}})
+
+	expectCode(t, http.StatusOK, w)
+	for payee, expected := range map[*datastore.Key]int{from: 0, k: 2 * (payeeMergeBatchSize + 1), other: 2} {
+		n, err := datastore.NewQuery("Split").Ancestor(userKey(c, u)).Filter("Payee =", payee.IntID()).Count(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != expected {
+			t.Errorf("Expected %v splits with payee %v, got %v", expected, payee.IntID(), n)
+		}
+	}
+	var got transaction.Rule
+	if err := datastore.Get(c, rule, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Payee != k.IntID() {
+		t.Errorf("Expected rule to have payee %v, got %+v", k.IntID(), got)
+	}
+	if err := datastore.Get(c, from, &transaction.Payee{}); err != datastore.ErrNoSuchEntity {
+		t.Errorf("Expected merged payee to be deleted, got %v", err)
+	}
+}
+
+func TestMergePayee_FailureSelf(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, r, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := insertPayeeOrDie(t, c, u, &transaction.Payee{Name: "Trader Joe's"})
+	r.Body = ioutil.NopCloser(bytes.NewBufferString(fmt.Sprintf(`{"from":%v}`, k.IntID())))
+
+	MergePayee(&requestParams{w: w, r: r, c: c, u: u, v: map[string]string{"key": fmt.Sprint(k.IntID())}})
+
+	expectCode(t, http.StatusBadRequest, w)
+	expectPayee(t, c, k, &transaction.Payee{Name: "Trader Joe's"})
+}
+
+func TestNewTransaction_PayeeFillsCounterSplit(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	_, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := insertAccountsOrDie(t, c, []transaction.Account{{Name: "Checking"}, {Name: "Groceries"}}, u)
+	p := insertPayeeOrDie(t, c, u, &transaction.Payee{
+		Name: "Trader Joe's", DefaultAccount: k[1].IntID(), DefaultMemo: "Groceries",
+	})
+
+	w := newTestPayeeTransaction(t, c, u, &handlers.TransactionRequest{
+		Amounts:  []transaction.AmountType{-123},
+		Accounts: []int64{k[0].IntID()},
+		Payee:    p.IntID(),
+		Date:     "2014-11-01",
+	})
+
+	expectCode(t, http.StatusOK, w)
+	expectSplits(t, c, u, k, []transaction.AmountType{-123, 123}, "Groceries")
+	expectPayee(t, c, p, &transaction.Payee{
+		Name: "Trader Joe's", DefaultAccount: k[1].IntID(), DefaultMemo: "Groceries",
+	})
+}
+
+func TestNewTransaction_PayeeCollectsAlias(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	_, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := insertAccountsOrDie(t, c, []transaction.Account{{Name: "Checking"}, {Name: "Groceries"}}, u)
+	p := insertPayeeOrDie(t, c, u, &transaction.Payee{Name: "Trader Joe's", DefaultAccount: k[1].IntID()})
+
+	w := newTestPayeeTransaction(t, c, u, &handlers.TransactionRequest{
+		Amounts:  []transaction.AmountType{-123},
+		Accounts: []int64{k[0].IntID()},
+		Payee:    p.IntID(),
+		Memo:     "TRADER JOE'S #123",
+		Date:     "2014-11-01",
+	})
+
+	expectCode(t, http.StatusOK, w)
+	expectPayee(t, c, p, &transaction.Payee{
+		Name: "Trader Joe's", DefaultAccount: k[1].IntID(), Aliases: []string{"TRADER JOE'S #123"},
+	})
+
+	// The alias now matches without naming the payee.
+	w = newTestPayeeTransaction(t, c, u, &handlers.TransactionRequest{
+		Amounts:  []transaction.AmountType{-100},
+		Accounts: []int64{k[0].IntID()},
+		Memo:     "trader joe's #123",
+		Date:     "2014-11-02",
+	})
+	expectCode(t, http.StatusOK, w)
+	if total := accountTotalOrDie(t, c, k[1]); total != 223 {
+		t.Errorf("Expected matched payee's account total 223, got %v", total)
+	}
+}
+
+func TestNewTransaction_FailureNoSuchPayee(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	_, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := insertAccountsOrDie(t, c, []transaction.Account{{Name: "Checking"}}, u)
+
+	w := newTestPayeeTransaction(t, c, u, &handlers.TransactionRequest{
+		Amounts:  []transaction.AmountType{-123},
+		Accounts: []int64{k[0].IntID()},
+		Payee:    5,
+		Date:     "2014-11-01",
+	})
+
+	expectCode(t, http.StatusBadRequest, w)
+}
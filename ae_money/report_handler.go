@@ -0,0 +1,284 @@
+package ae_money
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/cjc25/ae_money/storage"
+	"github.com/cjc25/ae_money/transaction"
+)
+
+// reportDates reads the dates of a report request. If the "range" form value
+// names a range, like "last-month" or "fiscal-ytd", it's resolved by the
+// user's Calendar, see transaction.Calendar.Resolve. Otherwise, or if it's
+// "custom", they're read from the "from" and "to" form values. To defaults to
+// today, and from defaults to a year before to. Today is in the user's time
+// zone.
+func reportDates(r *http.Request, settings *transaction.Settings) (from, to transaction.Date, err error) {
+	if name := r.FormValue("range"); name != "" && name != "custom" {
+		var dates transaction.DateRange
+		dates, err = settings.Calendar().Resolve(name, today(settings))
+		return dates.From, dates.To, err
+	}
+
+	to = today(settings)
+	if s := r.FormValue("to"); s != "" {
+		if to, err = transaction.ParseDate(s); err != nil {
+			return
+		}
+	}
+	from = to.AddDate(-1, 0, 1)
+	if s := r.FormValue("from"); s != "" {
+		if from, err = transaction.ParseDate(s); err != nil {
+			return
+		}
+	}
+	if from.After(to) {
+		err = errors.New("Report starts after it ends.")
+	}
+	return
+}
+
+// reportRange reads the dates and "period" form value of a report request.
+// See reportDates for the dates. Period defaults to transaction.Month.
+func reportRange(r *http.Request, settings *transaction.Settings) (from, to transaction.Date, period transaction.Period, err error) {
+	if from, to, err = reportDates(r, settings); err != nil {
+		return
+	}
+
+	period = transaction.Month
+	if s := r.FormValue("period"); s != "" {
+		period = transaction.Period(s)
+	}
+	err = period.Validate()
+	return
+}
+
+// userAccounts gets all of the Accounts in l, by id.
+func userAccounts(l storage.Ledger) (map[int64]transaction.Account, error) {
+	ids, accounts, err := l.Accounts()
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[int64]transaction.Account)
+	for i := range ids {
+		byID[ids[i]] = accounts[i]
+	}
+	return byID, nil
+}
+
+// userAccountsAndSplits gets all of the Accounts in l, by id, along with all
+// of their Splits, and the transaction id of each Split.
+func userAccountsAndSplits(l storage.Ledger) (map[int64]transaction.Account, []transaction.Split, []string, error) {
+	byID, err := userAccounts(l)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	ids, splits, err := l.Splits()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return byID, splits, ids, nil
+}
+
+// ShowNetWorth prints the logged in user's transaction.NetWorth at the end of
+// each period in the range given by the request, see reportRange. Weeks,
+// quarters and years follow the user's Settings. If the "breakdown" form value
+// is "true", each includes the balance of every Asset and Liability Account.
+//
+// Balances are summed from the Accounts' Split history, so they're correct
+// for past dates, unlike the Accounts' current totals.
+func ShowNetWorth(p *requestParams) {
+	w, r, c, u := p.w, p.r, p.c, p.u
+
+	userKey := userKey(c, u)
+	settings, err := getSettings(c, userKey)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	from, to, period, err := reportRange(r, settings)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	accounts, splits, _, err := userAccountsAndSplits(newDatastoreLedger(c, userKey))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	result := transaction.NetWorthReport(accounts, splits, settings.Calendar().PeriodEnds(period, from, to),
+		r.FormValue("breakdown") == "true")
+	e := json.NewEncoder(w)
+	if err := e.Encode(result); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// ShowIncomeStatement prints the user's transaction.IncomeStatement for the
+// request's range, see reportDates, its previous period and a year before.
+func ShowIncomeStatement(p *requestParams) {
+	w, r, c, u := p.w, p.r, p.c, p.u
+
+	userKey := userKey(c, u)
+	settings, err := getSettings(c, userKey)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	from, to, err := reportDates(r, settings)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	current := transaction.DateRange{From: from, To: to}
+	columns := []transaction.DateRange{current, current.Previous(), current.LastYear()}
+
+	accounts, splits, _, err := userAccountsAndSplits(newDatastoreLedger(c, userKey))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	printReport(w, r, transaction.NewIncomeStatement(accounts, splits, columns))
+}
+
+// ShowBalanceSheet prints the logged in user's transaction.BalanceSheet at the
+// end of the date given by the "date" form value, which defaults to today in
+// the user's time zone. If the "range" form value names a range, see
+// reportDates, the sheet is at its end instead, like the end of
+// "last-quarter". If the "format" form value is "csv", it's printed as CSV,
+// otherwise as JSON.
+//
+// If the sheet doesn't balance, the ledger is corrupt, so that's logged and
+// reported as a server error rather than printing a misleading sheet.
+func ShowBalanceSheet(p *requestParams) {
+	w, r, c, u := p.w, p.r, p.c, p.u
+
+	userKey := userKey(c, u)
+	settings, err := getSettings(c, userKey)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	date := today(settings)
+	if s := r.FormValue("date"); s != "" {
+		if date, err = transaction.ParseDate(s); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if name := r.FormValue("range"); name != "" && name != "custom" {
+		if _, date, err = reportDates(r, settings); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	accounts, splits, _, err := userAccountsAndSplits(newDatastoreLedger(c, userKey))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sheet, err := transaction.NewBalanceSheet(accounts, splits, date)
+	if err != nil {
+		c.Errorf("Balance sheet for %v failed: %v", u.Email, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	printReport(w, r, sheet)
+}
+
+// ShowSpendingPivot prints a transaction.SpendingPivot of the logged in
+// user's spending by month, over the range given by the request, see
+// reportDates. It's limited to Splits tagged with any "tag" form
+// value, and to the Accounts in the "account" form values, if there are any.
+// If the "format" form value is "csv", it's printed as CSV, otherwise as
+// JSON.
+//
+// Only Splits in the range are read, and only from the requested Accounts.
+func ShowSpendingPivot(p *requestParams) {
+	w, r, c, u := p.w, p.r, p.c, p.u
+
+	userKey := userKey(c, u)
+	settings, err := getSettings(c, userKey)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	from, to, err := reportDates(r, settings)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	l := newDatastoreLedger(c, userKey)
+	accounts, err := userAccounts(l)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var accountIDs []int64
+	for _, s := range r.Form["account"] {
+		var accountIntID int64
+		if _, err := fmt.Sscan(s, &accountIntID); err != nil {
+			http.Error(w, "Bad account: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		accountIDs = append(accountIDs, accountIntID)
+	}
+	if len(accountIDs) == 0 {
+		for id := range accounts {
+			accountIDs = append(accountIDs, id)
+		}
+	}
+
+	splits := make([]transaction.Split, 0)
+	for _, id := range accountIDs {
+		_, accountSplits, err := l.AccountSplitsBetween(id, from, to)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		splits = append(splits, accountSplits...)
+	}
+
+	columns := settings.Calendar().PeriodRanges(transaction.Month, from, to)
+	printReport(w, r, transaction.NewSpendingPivot(accounts, splits, columns, r.Form["tag"]))
+}
+
+// A csvReport can be printed as CSV as well as JSON.
+type csvReport interface {
+	WriteCSV(w io.Writer) error
+}
+
+// printReport prints report as CSV if the "format" form value is "csv",
+// otherwise as JSON.
+func printReport(w http.ResponseWriter, r *http.Request, report csvReport) {
+	if r.FormValue("format") == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		if err := report.WriteCSV(w); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	e := json.NewEncoder(w)
+	if err := e.Encode(report); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,337 @@
+package ae_money
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"code.google.com/p/go-uuid/uuid"
+
+	"github.com/cjc25/ae_money/transaction"
+
+	"appengine"
+	"appengine/datastore"
+	"appengine/user"
+)
+
+// Setup method which adds checking, credit card, salary and groceries
+// Accounts, and commits a few months of 2014 transactions between them.
+func setUpTestReportOrDie(t *testing.T, c appengine.Context, u *user.User) []*datastore.Key {
+	k := insertAccountsOrDie(t, c, []transaction.Account{
+		{Name: "Checking", Type: transaction.Asset},
+		{Name: "Credit Card", Type: transaction.Liability},
+		{Name: "Salary", Type: transaction.Income},
+		{Name: "Groceries", Type: transaction.Expense},
+	}, u)
+
+	for _, x := range []struct {
+		amount     transaction.AmountType
+		from, to   int
+		date, memo string
+	}{
+		{300000, 2, 0, "2014-09-30", "Salary"},
+		{40000, 1, 3, "2014-10-12", "Groceries"},
+		{40000, 0, 1, "2014-11-03", "Card payment"},
+		{25000, 1, 3, "2014-11-20", "Groceries"},
+	} {
+		s := []*transaction.Split{
+			{Amount: -x.amount, Account: k[x.from].IntID(), Memo: x.memo},
+			{Amount: x.amount, Account: k[x.to].IntID(), Memo: x.memo},
+		}
+		for i := range s {
+			s[i].Date = parseTestDateOrDie(t, x.date)
+		}
+		if err := commitTransaction(c, userKey(c, u), uuid.NewRandom().String(), s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return k
+}
+
+// Convenience function to parse a transaction.Date.
+func parseTestDateOrDie(t *testing.T, date string) transaction.Date {
+	result, err := transaction.ParseDate(date)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+// Convenience function to make a report request with form values.
+func newTestReportRequest(values url.Values) *http.Request {
+	return &http.Request{Form: values}
+}
+
+func TestShowNetWorth(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := setUpTestReportOrDie(t, c, u)
+
+	r := newTestReportRequest(url.Values{"from": {"2014-10-01"}, "to": {"2014-11-30"}, "breakdown": {"true"}})
+	ShowNetWorth(&requestParams{w: w, r: r, c: c, u: u})
+
+	expectCode(t, http.StatusOK, w)
+	var result []struct {
+		Assets      transaction.AmountType            `json:"assets"`
+		Liabilities transaction.AmountType            `json:"liabilities"`
+		NetWorth    transaction.AmountType            `json:"netWorth"`
+		Accounts    map[string]transaction.AmountType `json:"accounts"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 2 {
+		t.Fatalf("Expected two months, got %+v", result)
+	}
+	if result[0].Assets != 300000 || result[0].Liabilities != 40000 || result[0].NetWorth != 260000 {
+		t.Errorf("Unexpected October net worth %+v", result[0])
+	}
+	if result[1].Assets != 260000 || result[1].Liabilities != 25000 || result[1].NetWorth != 235000 {
+		t.Errorf("Unexpected November net worth %+v", result[1])
+	}
+	expected := map[string]transaction.AmountType{
+		fmt.Sprint(k[0].IntID()): 260000,
+		fmt.Sprint(k[1].IntID()): -25000,
+	}
+	if !reflect.DeepEqual(result[1].Accounts, expected) {
+		t.Errorf("Expected November breakdown %v, got %v", expected, result[1].Accounts)
+	}
+}
+
+func TestShowNetWorth_FiscalRange(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	settings := &transaction.Settings{FiscalYearStartMonth: time.July}
+	if _, err := datastore.Put(c, settingsKey(c, userKey(c, u)), settings); err != nil {
+		t.Fatal(err)
+	}
+
+	r := newTestReportRequest(url.Values{"range": {"last-fiscal-year"}, "period": {"quarter"}})
+	ShowNetWorth(&requestParams{w: w, r: r, c: c, u: u})
+
+	expectCode(t, http.StatusOK, w)
+	var result []transaction.NetWorth
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	lastYear := today(settings).AddDate(-1, 0, 0)
+	expected := settings.Calendar().PeriodEnds(transaction.Quarter,
+		settings.Calendar().Start(transaction.Year, lastYear),
+		settings.Calendar().End(transaction.Year, lastYear))
+	if len(result) != 4 || len(expected) != 4 {
+		t.Fatalf("Expected four quarters, got %+v", result)
+	}
+	for i := range expected {
+		if result[i].Date != expected[i] {
+			t.Errorf("Expected quarter %v to end %v, got %v", i, expected[i], result[i].Date)
+		}
+		if expected[i].Month%3 != 0 {
+			t.Errorf("Expected fiscal quarters to end in calendar quarter ends, got %v", expected[i])
+		}
+	}
+}
+
+func TestShowNetWorth_FailureBadRange(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	ShowNetWorth(&requestParams{w: w, r: newTestReportRequest(url.Values{"range": {"next-month"}}), c: c, u: u})
+
+	expectCode(t, http.StatusBadRequest, w)
+}
+
+func TestShowNetWorth_FailureBadPeriod(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	ShowNetWorth(&requestParams{w: w, r: newTestReportRequest(url.Values{"period": {"fortnight"}}), c: c, u: u})
+
+	expectCode(t, http.StatusBadRequest, w)
+}
+
+func TestShowNetWorth_FailureBackwardsRange(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	r := newTestReportRequest(url.Values{"from": {"2014-11-30"}, "to": {"2014-10-01"}})
+	ShowNetWorth(&requestParams{w: w, r: r, c: c, u: u})
+
+	expectCode(t, http.StatusBadRequest, w)
+}
+
+func TestShowIncomeStatement(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := setUpTestReportOrDie(t, c, u)
+
+	r := newTestReportRequest(url.Values{"from": {"2014-11-01"}, "to": {"2014-11-30"}})
+	ShowIncomeStatement(&requestParams{w: w, r: r, c: c, u: u})
+
+	expectCode(t, http.StatusOK, w)
+	var result transaction.IncomeStatement
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	expectedColumns := []transaction.DateRange{
+		{From: parseTestDateOrDie(t, "2014-11-01"), To: parseTestDateOrDie(t, "2014-11-30")},
+		{From: parseTestDateOrDie(t, "2014-10-01"), To: parseTestDateOrDie(t, "2014-10-31")},
+		{From: parseTestDateOrDie(t, "2013-11-01"), To: parseTestDateOrDie(t, "2013-11-30")},
+	}
+	if !reflect.DeepEqual(result.Columns, expectedColumns) {
+		t.Errorf("Expected columns %v, got %v", expectedColumns, result.Columns)
+	}
+	expectedExpenses := []transaction.ReportLine{{
+		Account: k[3].IntID(), Name: "Groceries", Amounts: []transaction.AmountType{25000, 40000, 0},
+	}}
+	if !reflect.DeepEqual(result.Expenses, expectedExpenses) {
+		t.Errorf("Expected expenses %+v, got %+v", expectedExpenses, result.Expenses)
+	}
+	if expected := []transaction.AmountType{-25000, -40000, 0}; !reflect.DeepEqual(result.NetIncome, expected) {
+		t.Errorf("Expected net income %v, got %v", expected, result.NetIncome)
+	}
+}
+
+func TestShowIncomeStatement_CSV(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	setUpTestReportOrDie(t, c, u)
+
+	r := newTestReportRequest(url.Values{"from": {"2014-09-01"}, "to": {"2014-09-30"}, "format": {"csv"}})
+	ShowIncomeStatement(&requestParams{w: w, r: r, c: c, u: u})
+
+	expectCode(t, http.StatusOK, w)
+	expectBody(t, `Account,2014-09-01 to 2014-09-30,2014-08-01 to 2014-08-31,2013-09-01 to 2013-09-30
+Income
+"  Salary",300000,0,0
+Total income,300000,0,0
+Expenses
+Total expenses,0,0,0
+Net income,300000,0,0`, w)
+	if ct := w.Header().Get("Content-Type"); ct != "text/csv" {
+		t.Errorf("Expected CSV content type, got %v", ct)
+	}
+}
+
+func TestShowBalanceSheet(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	setUpTestReportOrDie(t, c, u)
+
+	ShowBalanceSheet(&requestParams{w: w, r: newTestReportRequest(url.Values{"date": {"2014-10-31"}}), c: c, u: u})
+
+	expectCode(t, http.StatusOK, w)
+	var result transaction.BalanceSheet
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if result.TotalAssets != 300000 || result.TotalLiabilities != 40000 || result.RetainedEarnings != 260000 ||
+		result.TotalEquity != 260000 {
+		t.Errorf("Unexpected balance sheet %+v", result)
+	}
+}
+
+func TestShowBalanceSheet_Range(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	setUpTestReportOrDie(t, c, u)
+
+	// The range wins over the date, and the sheet is at the end of it.
+	r := newTestReportRequest(url.Values{"date": {"2014-10-31"}, "range": {"last-month"}})
+	ShowBalanceSheet(&requestParams{w: w, r: r, c: c, u: u})
+
+	expectCode(t, http.StatusOK, w)
+	var result transaction.BalanceSheet
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	now := today(&transaction.Settings{})
+	if expected := now.AddDate(0, 0, -now.Day); result.Date != expected {
+		t.Errorf("Expected sheet at %v, got %v", expected, result.Date)
+	}
+}
+
+func TestShowBalanceSheet_FailureCorruptLedger(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := setUpTestReportOrDie(t, c, u)
+	insertSplitsOrDie(t, c, []*transaction.Split{
+		{Amount: 100, Account: k[0].IntID(), Date: parseTestDateOrDie(t, "2014-10-01")},
+	}, k[0])
+
+	ShowBalanceSheet(&requestParams{w: w, r: newTestReportRequest(url.Values{"date": {"2014-10-31"}}), c: c, u: u})
+
+	expectCode(t, http.StatusInternalServerError, w)
+}
+
+func TestShowSpendingPivot(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := setUpTestReportOrDie(t, c, u)
+
+	r := newTestReportRequest(url.Values{"from": {"2014-10-01"}, "to": {"2014-11-30"}})
+	ShowSpendingPivot(&requestParams{w: w, r: r, c: c, u: u})
+
+	expectCode(t, http.StatusOK, w)
+	var result transaction.SpendingPivot
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Rows) != 1 || result.Rows[0].Account != k[3].IntID() {
+		t.Fatalf("Expected a groceries row, got %+v", result.Rows)
+	}
+	row := result.Rows[0]
+	if !reflect.DeepEqual(row.Amounts, []transaction.AmountType{40000, 25000}) || row.Average != 32500 ||
+		row.Changes[0] == nil || *row.Changes[0] != -37.5 {
+		t.Errorf("Unexpected groceries row %+v", row)
+	}
+}
+
+func TestShowSpendingPivot_FilterAccounts(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := setUpTestReportOrDie(t, c, u)
+
+	r := newTestReportRequest(url.Values{
+		"from": {"2014-10-01"}, "to": {"2014-11-30"}, "account": {fmt.Sprint(k[2].IntID())}, "format": {"csv"},
+	})
+	ShowSpendingPivot(&requestParams{w: w, r: r, c: c, u: u})
+
+	expectCode(t, http.StatusOK, w)
+	expectBody(t, `Account,2014-10-01 to 2014-10-31,2014-11-01 to 2014-11-30,Total,Average
+Total,0,0,0,0`, w)
+}
+
+func TestShowSpendingPivot_FailureBadAccount(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	ShowSpendingPivot(&requestParams{w: w, r: newTestReportRequest(url.Values{"account": {"checking"}}), c: c, u: u})
+
+	expectCode(t, http.StatusBadRequest, w)
+}
@@ -0,0 +1,395 @@
+package ae_money
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"code.google.com/p/go-uuid/uuid"
+
+	"github.com/cjc25/ae_money/handlers"
+	"github.com/cjc25/ae_money/transaction"
+
+	"appengine"
+	"appengine/datastore"
+)
+
+// DatastoreRule wraps transaction.Rule for JSON responses that include a
+// datastore key.
+type DatastoreRule struct {
+	Rule  *transaction.Rule `json:"rule"`
+	IntID int64             `json:"key"`
+}
+
+// A RuleChange is what applying a Rule does to one existing transaction. Split
+// is the Split the Rule matched. Tags and Payee are set on every Split in the
+// transaction if present. If ToAccount is present, the amount of Counter is
+// moved from its Account to ToAccount by a reclassifying transaction.
+type RuleChange struct {
+	Transaction string             `json:"transaction"`
+	Split       transaction.Split  `json:"split"`
+	Tags        []string           `json:"tags,omitempty"`
+	Payee       int64              `json:"payee,omitempty"`
+	Counter     *transaction.Split `json:"counter,omitempty"`
+	ToAccount   int64              `json:"toAccount,omitempty"`
+}
+
+// ruleKey provides the datastore key for one of the user's Rules.
+func ruleKey(c appengine.Context, userKey *datastore.Key, intID int64) *datastore.Key {
+	return datastore.NewKey(c, "Rule", "", intID, userKey)
+}
+
+// userRules gets all of the user's Rules, in the order they're applied.
+func userRules(c appengine.Context, userKey *datastore.Key) ([]*datastore.Key, []transaction.Rule, error) {
+	rules := make([]transaction.Rule, 0)
+	q := datastore.NewQuery("Rule").Ancestor(userKey).Order("Priority").Order("Name")
+	keys, err := q.GetAll(c, &rules)
+	return keys, rules, err
+}
+
+// ruleChanges finds what applying rule would change in the user's existing
+// transactions, ordered by date. A transaction is only reclassified once, and
+// only if it has exactly two Splits.
+func ruleChanges(c appengine.Context, userKey *datastore.Key, rule *transaction.Rule) ([]RuleChange, error) {
+	splitIDs, splits, err := newDatastoreLedger(c, userKey).Splits()
+	if err != nil {
+		return nil, err
+	}
+
+	byTransaction := make(map[string][]*transaction.Split)
+	ids := make([]string, 0)
+	for i := range splits {
+		id := splitIDs[i]
+		if byTransaction[id] == nil {
+			ids = append(ids, id)
+		}
+		byTransaction[id] = append(byTransaction[id], &splits[i])
+	}
+	sort.SliceStable(ids, func(i, j int) bool {
+		return byTransaction[ids[i]][0].Date.Before(byTransaction[ids[j]][0].Date)
+	})
+
+	changes := make([]RuleChange, 0)
+	for _, id := range ids {
+		x := byTransaction[id]
+		if strings.HasPrefix(x[0].Memo, handlers.ReclassifyMemoPrefix) {
+			continue
+		}
+		m := -1
+		for i := range x {
+			if rule.Matches(x[i]) {
+				m = i
+				break
+			}
+		}
+		if m < 0 {
+			continue
+		}
+
+		change := RuleChange{Transaction: id, Split: *x[m]}
+		changed := false
+		if tags := transaction.MergeTags(append([]string(nil), x[m].Tags...), rule.Tags); len(tags) != len(x[m].Tags) {
+			change.Tags = tags
+			changed = true
+		}
+		if rule.Payee != 0 && x[m].Payee != rule.Payee {
+			change.Payee = rule.Payee
+			changed = true
+		}
+		if rule.CounterAccount != 0 && len(x) == 2 && x[m].Reclassified == "" {
+			counter := x[1-m]
+			if counter.Account != rule.CounterAccount && x[m].Account != rule.CounterAccount {
+				change.Counter = counter
+				change.ToAccount = rule.CounterAccount
+				changed = true
+			}
+		}
+		if changed {
+			changes = append(changes, change)
+		}
+	}
+	return changes, nil
+}
+
+// reclassifyMoves gets the Splits of a transaction that moves change's
+// Counter to its ToAccount, dated like the original. splits are the original
+// transaction's, read again in the datastore transaction that moves them. It
+// returns nil if they've changed since change was found, or were already
+// reclassified.
+func reclassifyMoves(rule *transaction.Rule, change *RuleChange, splits []*transaction.Split) []*transaction.Split {
+	if len(splits) != 2 {
+		return nil
+	}
+	var counter *transaction.Split
+	for _, s := range splits {
+		if s.Reclassified != "" {
+			return nil
+		}
+		if s.Account == change.Counter.Account && s.Amount == change.Counter.Amount {
+			counter = s
+		}
+	}
+	if counter == nil {
+		return nil
+	}
+
+	memo := handlers.ReclassifyMemoPrefix + rule.Name
+	return []*transaction.Split{
+		{Amount: -counter.Amount, Account: counter.Account, Memo: memo, Date: counter.Date},
+		{Amount: counter.Amount, Account: change.ToAccount, Memo: memo, Date: counter.Date},
+	}
+}
+
+// ruleBatchSize is how many RuleChanges applyRuleChanges makes in one
+// datastore transaction, to stay under its limit on entities written.
+const ruleBatchSize = 25
+
+// applyRuleChanges makes changes in the user's ledger, ruleBatchSize at a time.
+// Each batch is one datastore transaction, which updates the Splits in place
+// and, for each counter account move, commits a reclassifying transaction.
+// Moves are checked again in the datastore transaction, so a transaction
+// reclassified since the changes were found isn't moved twice. It returns the
+// number of transactions changed by the batches committed before any error.
+func applyRuleChanges(c appengine.Context, userKey *datastore.Key, rule *transaction.Rule, changes []RuleChange) (int, error) {
+	changed := 0
+	for start := 0; start < len(changes); start += ruleBatchSize {
+		end := start + ruleBatchSize
+		if end > len(changes) {
+			end = len(changes)
+		}
+
+		applied := 0
+		err := datastore.RunInTransaction(c, func(c appengine.Context) error {
+			// Count from scratch, since the datastore may retry the transaction.
+			applied = 0
+			l := newDatastoreLedger(c, userKey)
+			for i := start; i < end; i++ {
+				change := &changes[i]
+				splits, err := l.TransactionSplits(change.Transaction)
+				if err != nil {
+					return err
+				}
+
+				var moves []*transaction.Split
+				if change.ToAccount != 0 {
+					moves = reclassifyMoves(rule, change, splits)
+				}
+				if moves == nil && change.Tags == nil && change.Payee == 0 {
+					continue
+				}
+
+				reclassifyID := uuid.NewRandom().String()
+				for _, s := range splits {
+					if change.Tags != nil {
+						s.Tags = change.Tags
+					}
+					if change.Payee != 0 {
+						s.Payee = change.Payee
+					}
+					if moves != nil {
+						s.Reclassified = reclassifyID
+					}
+				}
+				if err := l.PutSplits(change.Transaction, splits); err != nil {
+					return err
+				}
+				if moves != nil {
+					if err := handlers.PutTransaction(l, reclassifyID, moves); err != nil {
+						return err
+					}
+				}
+				applied++
+			}
+			return nil
+		}, nil)
+		if err != nil {
+			return changed, err
+		}
+		changed += applied
+	}
+	return changed, nil
+}
+
+// putRule validates a Rule read from the request body, and stores it under k.
+// Incomplete keys create a new Rule.
+func putRule(p *requestParams, k *datastore.Key) {
+	w, r, c := p.w, p.r, p.c
+
+	var rule transaction.Rule
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&rule); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := rule.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err := datastore.RunInTransaction(c, func(c appengine.Context) error {
+		if !k.Incomplete() {
+			if err := datastore.Get(c, k, &transaction.Rule{}); err != nil {
+				return err
+			}
+		}
+		l := newDatastoreLedger(c, k.Parent())
+		for _, id := range []int64{rule.Account, rule.CounterAccount} {
+			if id == 0 {
+				continue
+			}
+			if _, err := l.Account(id); err != nil {
+				return err
+			}
+		}
+		if rule.Payee != 0 {
+			if err := datastore.Get(c, payeeKey(c, k.Parent(), rule.Payee), &transaction.Payee{}); err != nil {
+				return err
+			}
+		}
+
+		var err error
+		k, err = datastore.Put(c, k, &rule)
+		return err
+	}, nil)
+	if err != nil {
+		// TODO(cjc25): This might not be a 400: if e.g. datastore failed it should
+		// be a 500. Interpret err and return the right thing.
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	e := json.NewEncoder(w)
+	if err := e.Encode(&DatastoreRule{&rule, k.IntID()}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// NewRule creates a new Rule. The Rule is read as JSON from the request body.
+func NewRule(p *requestParams) {
+	putRule(p, datastore.NewIncompleteKey(p.c, "Rule", userKey(p.c, p.u)))
+}
+
+// UpdateRule replaces a Rule with one read as JSON from the request body. The
+// Rule to replace is extracted from the gorilla/mux vars.
+func UpdateRule(p *requestParams) {
+	var ruleIntID int64
+	if _, err := fmt.Sscan(p.v["key"], &ruleIntID); err != nil {
+		p.w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	putRule(p, ruleKey(p.c, userKey(p.c, p.u), ruleIntID))
+}
+
+// ListRules gets the logged in user's Rules, in the order they're applied.
+func ListRules(p *requestParams) {
+	w, c, u := p.w, p.c, p.u
+
+	keys, rules, err := userRules(c, userKey(c, u))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	result := make([]DatastoreRule, len(rules))
+	for i := range keys {
+		result[i] = DatastoreRule{&rules[i], keys[i].IntID()}
+	}
+
+	e := json.NewEncoder(w)
+	if err := e.Encode(result); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// DeleteRule deletes a Rule owned by the logged in user. The Rule to delete is
+// extracted from the gorilla/mux vars. Splits it already changed are left
+// alone.
+func DeleteRule(p *requestParams) {
+	w, c, u, v := p.w, p.c, p.u, p.v
+
+	var ruleIntID int64
+	if _, err := fmt.Sscan(v["key"], &ruleIntID); err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if err := datastore.Delete(c, ruleKey(c, userKey(c, u), ruleIntID)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// getRule gets the Rule extracted from the gorilla/mux vars, and what it would
+// change in the user's existing transactions.
+func getRule(p *requestParams) (*transaction.Rule, []RuleChange, error) {
+	var ruleIntID int64
+	if _, err := fmt.Sscan(p.v["key"], &ruleIntID); err != nil {
+		return nil, nil, datastore.ErrNoSuchEntity
+	}
+
+	userKey := userKey(p.c, p.u)
+	var rule transaction.Rule
+	if err := datastore.Get(p.c, ruleKey(p.c, userKey, ruleIntID), &rule); err != nil {
+		return nil, nil, err
+	}
+	changes, err := ruleChanges(p.c, userKey, &rule)
+	return &rule, changes, err
+}
+
+// PreviewRule prints the RuleChanges that applying a Rule would make, without
+// changing anything. The Rule is extracted from the gorilla/mux vars.
+func PreviewRule(p *requestParams) {
+	w := p.w
+
+	_, changes, err := getRule(p)
+	if err == datastore.ErrNoSuchEntity {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	e := json.NewEncoder(w)
+	if err := e.Encode(changes); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// ApplyRule makes the RuleChanges that PreviewRule prints, and prints the
+// number of transactions changed. The Rule is extracted from the gorilla/mux
+// vars.
+func ApplyRule(p *requestParams) {
+	w, c, u := p.w, p.c, p.u
+
+	rule, changes, err := getRule(p)
+	if err == datastore.ErrNoSuchEntity {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	changed, err := applyRuleChanges(c, userKey(c, u), rule, changes)
+	if err != nil {
+		// Earlier changes are committed, so say how far we got.
+		http.Error(w, fmt.Sprintf("Changed %v transactions before failing: %v", changed, err),
+			http.StatusInternalServerError)
+		return
+	}
+
+	e := json.NewEncoder(w)
+	if err := e.Encode(map[string]int{"changed": changed}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
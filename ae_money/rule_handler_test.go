@@ -0,0 +1,314 @@
+package ae_money
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/cjc25/ae_money/handlers"
+	"github.com/cjc25/ae_money/transaction"
+
+	"appengine"
+	"appengine/datastore"
+	"appengine/user"
+)
+
+// Setup method which inserts a Rule for u and returns its key.
+func insertRuleOrDie(t *testing.T, c appengine.Context, u *user.User, rule *transaction.Rule) *datastore.Key {
+	k, err := datastore.Put(c, datastore.NewIncompleteKey(c, "Rule", userKey(c, u)), rule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+// Expectation function for the RuleChanges printed by PreviewRule.
+func expectRuleChanges(t *testing.T, w *httptest.ResponseRecorder, expected int) []RuleChange {
+	expectCode(t, http.StatusOK, w)
+	var changes []RuleChange
+	if err := json.NewDecoder(w.Body).Decode(&changes); err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != expected {
+		t.Errorf("Expected %v changes, got %+v", expected, changes)
+	}
+	return changes
+}
+
+func TestNewRule(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, r, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := insertAccountsOrDie(t, c, []transaction.Account{{Name: "Groceries"}}, u)
+	r.Body = ioutil.NopCloser(bytes.NewBufferString(fmt.Sprintf(
+		`{"name":"TJ","memo":"trader joe","counterAccount":%v,"tags":["food"]}`, k[0].IntID())))
+
+	NewRule(&requestParams{w: w, r: r, c: c, u: u})
+
+	expectCode(t, http.StatusOK, w)
+	var result DatastoreRule
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	var got transaction.Rule
+	if err := datastore.Get(c, ruleKey(c, userKey(c, u), result.IntID), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "TJ" || got.CounterAccount != k[0].IntID() || !reflect.DeepEqual(got.Tags, []string{"food"}) {
+		t.Errorf("Unexpected rule %+v", got)
+	}
+}
+
+func TestNewRule_FailureInvalid(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, r, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	r.Body = ioutil.NopCloser(bytes.NewBufferString(`{"name":"TJ","memo":"(","tags":["food"]}`))
+
+	NewRule(&requestParams{w: w, r: r, c: c, u: u})
+
+	expectCode(t, http.StatusBadRequest, w)
+}
+
+func TestNewRule_FailureBadAccount(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, r, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	r.Body = ioutil.NopCloser(bytes.NewBufferString(`{"name":"TJ","counterAccount":5}`))
+
+	NewRule(&requestParams{w: w, r: r, c: c, u: u})
+
+	expectCode(t, http.StatusBadRequest, w)
+}
+
+func TestListAndDeleteRules(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, r, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := insertRuleOrDie(t, c, u, &transaction.Rule{Name: "b", Priority: 1, Tags: []string{"x"}})
+	insertRuleOrDie(t, c, u, &transaction.Rule{Name: "a", Priority: 2, Tags: []string{"x"}})
+
+	ListRules(&requestParams{w: w, r: r, c: c, u: u})
+
+	var result []DatastoreRule
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 2 || result[0].IntID != k.IntID() {
+		t.Errorf("Expected rule %v first, got %+v", k.IntID(), result)
+	}
+
+	w = httptest.NewRecorder()
+	DeleteRule(&requestParams{w: w, c: c, u: u, v: map[string]string{"key": fmt.Sprint(k.IntID())}})
+	expectCode(t, http.StatusOK, w)
+	if err := datastore.Get(c, k, &transaction.Rule{}); err != datastore.ErrNoSuchEntity {
+		t.Errorf("Expected rule to be deleted, got %v", err)
+	}
+}
+
+func TestNewTransaction_RulesFillCounterSplitAndTags(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	_, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := insertAccountsOrDie(t, c, []transaction.Account{{Name: "Checking"}, {Name: "Groceries"}}, u)
+	insertRuleOrDie(t, c, u, &transaction.Rule{
+		Name: "TJ", Memo: "trader joe", CounterAccount: k[1].IntID(), Tags: []string{"food"},
+	})
+	insertRuleOrDie(t, c, u, &transaction.Rule{
+		Name: "Everything", Priority: 1, CounterAccount: k[0].IntID(), Tags: []string{"all"},
+	})
+
+	w := newTestPayeeTransaction(t, c, u, &handlers.TransactionRequest{
+		Amounts:  []transaction.AmountType{-123},
+		Accounts: []int64{k[0].IntID()},
+		Tags:     []string{"mine"},
+		Memo:     "Trader Joe's",
+		Date:     "2014-11-01",
+	})
+
+	expectCode(t, http.StatusOK, w)
+	expectSplits(t, c, u, k, []transaction.AmountType{-123, 123}, "Trader Joe's")
+	splits := make([]transaction.Split, 0)
+	if _, err := datastore.NewQuery("Split").Ancestor(userKey(c, u)).GetAll(c, &splits); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range splits {
+		if !reflect.DeepEqual(s.Tags, []string{"mine", "food", "all"}) {
+			t.Errorf("Unexpected tags %v", s.Tags)
+		}
+	}
+}
+
+func TestPreviewRule(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := insertAccountsOrDie(t, c,
+		[]transaction.Account{{Name: "Checking"}, {Name: "Misc"}, {Name: "Groceries"}}, u)
+	newTestTransactionOrDie(t, c, u, []transaction.AmountType{-123, 123},
+		[]int64{k[0].IntID(), k[1].IntID()}, "Trader Joe's", "2014-11-01")
+	newTestTransactionOrDie(t, c, u, []transaction.AmountType{-456, 456},
+		[]int64{k[0].IntID(), k[1].IntID()}, "Safeway", "2014-11-02")
+	rule := insertRuleOrDie(t, c, u, &transaction.Rule{
+		Name: "TJ", Memo: "trader joe", Account: k[0].IntID(), CounterAccount: k[2].IntID(),
+	})
+
+	PreviewRule(&requestParams{w: w, c: c, u: u, v: map[string]string{"key": fmt.Sprint(rule.IntID())}})
+
+	changes := expectRuleChanges(t, w, 1)
+	if len(changes) == 1 && (changes[0].Counter == nil || changes[0].Counter.Account != k[1].IntID() ||
+		changes[0].ToAccount != k[2].IntID()) {
+		t.Errorf("Expected a move from %v to %v, got %+v", k[1].IntID(), k[2].IntID(), changes[0])
+	}
+	if total := accountTotalOrDie(t, c, k[2]); total != 0 {
+		t.Errorf("Expected preview not to change anything, got total %v", total)
+	}
+}
+
+func TestPreviewRule_FailureNoSuchRule(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	PreviewRule(&requestParams{w: w, c: c, u: u, v: map[string]string{"key": "5"}})
+
+	expectCode(t, http.StatusNotFound, w)
+}
+
+func TestApplyRule(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := insertAccountsOrDie(t, c,
+		[]transaction.Account{{Name: "Checking"}, {Name: "Misc"}, {Name: "Groceries"}}, u)
+	newTestTransactionOrDie(t, c, u, []transaction.AmountType{-123, 123},
+		[]int64{k[0].IntID(), k[1].IntID()}, "Trader Joe's", "2014-11-01")
+	newTestTransactionOrDie(t, c, u, []transaction.AmountType{-100, 100},
+		[]int64{k[0].IntID(), k[1].IntID()}, "Trader Joe's #2", "2014-11-02")
+	rule := insertRuleOrDie(t, c, u, &transaction.Rule{
+		Name: "TJ", Memo: "trader joe", CounterAccount: k[2].IntID(), Tags: []string{"food"},
+	})
+	v := map[string]string{"key": fmt.Sprint(rule.IntID())}
+
+	ApplyRule(&requestParams{w: w, c: c, u: u, v: v})
+
+	expectCode(t, http.StatusOK, w)
+	expectBody(t, `{"changed":2}`, w)
+	if total := accountTotalOrDie(t, c, k[1]); total != 0 {
+		t.Errorf("Expected Misc total 0, got %v", total)
+	}
+	if total := accountTotalOrDie(t, c, k[2]); total != 223 {
+		t.Errorf("Expected Groceries total 223, got %v", total)
+	}
+
+	// Everything has been applied, so applying again does nothing.
+	w = httptest.NewRecorder()
+	PreviewRule(&requestParams{w: w, c: c, u: u, v: v})
+	expectRuleChanges(t, w, 0)
+
+	// Each transaction is reclassified on its own date.
+	var moves []transaction.Split
+	if _, err := datastore.NewQuery("Split").Ancestor(k[2]).Order("Date").GetAll(c, &moves); err != nil {
+		t.Fatal(err)
+	}
+	if len(moves) != 2 || moves[0].Amount != 123 || moves[0].Date != (transaction.Date{Year: 2014, Month: 11, Day: 1}) ||
+		moves[1].Amount != 100 || moves[1].Date != (transaction.Date{Year: 2014, Month: 11, Day: 2}) {
+		t.Errorf("Expected a reclassification dated like each original, got %+v", moves)
+	}
+
+	// The reclassifications are in the hash chain, and the ledger still checks.
+	w = httptest.NewRecorder()
+	VerifyChain(&requestParams{w: w, c: c, u: u})
+	if report := expectChainReport(t, w); report.Break != nil || report.Length != 4 {
+		t.Errorf("Expected intact chain of 4, got %+v", report)
+	}
+	w = httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/", nil)
+	CheckLedger(&requestParams{w: w, r: r, c: c})
+	if report := expectCheckReport(t, w, u); !report.Consistent() {
+		t.Errorf("Expected consistent ledger, got %+v", report)
+	}
+}
+
+func TestApplyRule_ChangesAlreadyApplied(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	_, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := insertAccountsOrDie(t, c,
+		[]transaction.Account{{Name: "Checking"}, {Name: "Misc"}, {Name: "Groceries"}}, u)
+	newTestTransactionOrDie(t, c, u, []transaction.AmountType{-123, 123},
+		[]int64{k[0].IntID(), k[1].IntID()}, "Trader Joe's", "2014-11-01")
+	rule := &transaction.Rule{Name: "TJ", Memo: "trader joe", CounterAccount: k[2].IntID()}
+	if err := rule.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	changes, err := ruleChanges(c, userKey(c, u), rule)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Applying the same changes twice, like two concurrent ApplyRules, only
+	// reclassifies once.
+	for _, expected := range []int{1, 0} {
+		changed, err := applyRuleChanges(c, userKey(c, u), rule, changes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if changed != expected {
+			t.Errorf("Expected %v changes, got %v", expected, changed)
+		}
+	}
+	if total := accountTotalOrDie(t, c, k[2]); total != 123 {
+		t.Errorf("Expected Groceries total 123, got %v", total)
+	}
+}
+
+func TestApplyRule_SeveralBatches(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := insertAccountsOrDie(t, c,
+		[]transaction.Account{{Name: "Checking"}, {Name: "Misc"}, {Name: "Groceries"}}, u)
+	// Amounts and dates differ, so none look like duplicates.
+	n := ruleBatchSize + 1
+	var expected transaction.AmountType
+	for i := 1; i <= n; i++ {
+		amount := transaction.AmountType(100 * i)
+		newTestTransactionOrDie(t, c, u, []transaction.AmountType{-amount, amount},
+			[]int64{k[0].IntID(), k[1].IntID()}, fmt.Sprintf("Trader Joe's #%v", i), fmt.Sprintf("2014-11-%02d", i))
+		expected += amount
+	}
+	rule := insertRuleOrDie(t, c, u, &transaction.Rule{
+		Name: "TJ", Memo: "trader joe", CounterAccount: k[2].IntID(),
+	})
+
+	ApplyRule(&requestParams{w: w, c: c, u: u, v: map[string]string{"key": fmt.Sprint(rule.IntID())}})
+
+	expectCode(t, http.StatusOK, w)
+	expectBody(t, fmt.Sprintf(`{"changed":%v}`, n), w)
+	if total := accountTotalOrDie(t, c, k[1]); total != 0 {
+		t.Errorf("Expected Misc total 0, got %v", total)
+	}
+	if total := accountTotalOrDie(t, c, k[2]); total != expected {
+		t.Errorf("Expected Groceries total %v, got %v", expected, total)
+	}
+	w = httptest.NewRecorder()
+	VerifyChain(&requestParams{w: w, c: c, u: u})
+	if report := expectChainReport(t, w); report.Break != nil || report.Length != int64(2*n) {
+		t.Errorf("Expected intact chain of %v, got %+v", 2*n, report)
+	}
+}
@@ -0,0 +1,73 @@
+package ae_money
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/cjc25/ae_money/transaction"
+
+	"appengine"
+	"appengine/datastore"
+)
+
+// settingsKey provides the datastore key for the user's transaction.Settings.
+// There's only ever one per user.
+func settingsKey(c appengine.Context, userKey *datastore.Key) *datastore.Key {
+	return datastore.NewKey(c, "Settings", "settings", 0, userKey)
+}
+
+// getSettings gets the user's Settings, or the defaults if they haven't
+// changed any.
+func getSettings(c appengine.Context, userKey *datastore.Key) (*transaction.Settings, error) {
+	var s transaction.Settings
+	err := datastore.Get(c, settingsKey(c, userKey), &s)
+	if err == datastore.ErrNoSuchEntity {
+		return &transaction.Settings{}, nil
+	}
+	return &s, err
+}
+
+// ShowSettings prints the logged in user's Settings.
+func ShowSettings(p *requestParams) {
+	w, c, u := p.w, p.c, p.u
+
+	s, err := getSettings(c, userKey(c, u))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	e := json.NewEncoder(w)
+	if err := e.Encode(s); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// UpdateSettings replaces the logged in user's Settings with those read as
+// JSON from the request body, and prints them.
+func UpdateSettings(p *requestParams) {
+	w, r, c, u := p.w, p.r, p.c, p.u
+
+	var s transaction.Settings
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&s); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if _, err := datastore.Put(c, settingsKey(c, userKey(c, u)), &s); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	e := json.NewEncoder(w)
+	if err := e.Encode(&s); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
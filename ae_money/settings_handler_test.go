@@ -0,0 +1,80 @@
+package ae_money
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"appengine/user"
+)
+
+func TestShowSettings_Default(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	ShowSettings(&requestParams{w: w, c: c, u: u})
+
+	expectCode(t, http.StatusOK, w)
+	expectBody(t, `{}`, w)
+}
+
+func TestUpdateSettings(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, r, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	r.Body = ioutil.NopCloser(bytes.NewBufferString(`{"taxYearStartMonth":4,"taxYearStartDay":6}`))
+	UpdateSettings(&requestParams{w: w, r: r, c: c, u: u})
+	expectCode(t, http.StatusOK, w)
+
+	s, err := getSettings(c, userKey(c, u))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.TaxYearStartMonth != 4 || s.TaxYearStartDay != 6 {
+		t.Errorf("Expected tax year to start April 6, got %+v", s)
+	}
+}
+
+func TestUpdateSettings_Calendar(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, r, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	r.Body = ioutil.NopCloser(bytes.NewBufferString(`{"fiscalYearStartMonth":7,"weekStart":"sunday"}`))
+	UpdateSettings(&requestParams{w: w, r: r, c: c, u: u})
+	expectCode(t, http.StatusOK, w)
+
+	s, err := getSettings(c, userKey(c, u))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cal := s.Calendar(); cal.FiscalYearStart != time.July || cal.WeekStart != time.Sunday {
+		t.Errorf("Expected July fiscal years and Sunday weeks, got %+v", cal)
+	}
+}
+
+func TestUpdateSettings_FailureInvalid(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, r, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	r.Body = ioutil.NopCloser(bytes.NewBufferString(`{"taxYearStartMonth":2,"taxYearStartDay":30}`))
+	UpdateSettings(&requestParams{w: w, r: r, c: c, u: u})
+
+	expectCode(t, http.StatusBadRequest, w)
+}
+
+func TestUpdateSettings_FailureUnknownTimeZone(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, r, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	r.Body = ioutil.NopCloser(bytes.NewBufferString(`{"timeZone":"Mars/Olympus_Mons"}`))
+	UpdateSettings(&requestParams{w: w, r: r, c: c, u: u})
+
+	expectCode(t, http.StatusBadRequest, w)
+}
@@ -104,7 +104,7 @@ function toAccountPage(clickEvent) {
           line = $("<li/>").addClass("entry");
           line.append($("<div/>")
             .addClass("date")
-            .text(v.date.split("T")[0])  // Take the date portion of the time.
+            .text(v.date)
           );
           line.append($("<div/>")
             .addClass("memo")
@@ -170,7 +170,8 @@ function setupAccountsLinks() {
     $.ajax(apiUrl("accounts", "new"), {
       type: "POST",
       data: JSON.stringify({
-        name: $("#account_creation #new_account_name").val()
+        name: $("#account_creation #new_account_name").val(),
+        type: $("#account_creation #new_account_type").val()
       }),
       contentType: "application/json",
       dataType: "json",
@@ -245,6 +246,10 @@ function submitNewTransaction() {
   request.memo = $("#new_transaction_memo").val();
   request.date = $("#new_transaction_date").val();
 
+  postNewTransaction(request, submit_button);
+}
+
+function postNewTransaction(request, submit_button) {
   $.ajax(apiUrl("transactions", "new"), {
     type: "POST",
     data: JSON.stringify(request),
@@ -252,6 +257,18 @@ function submitNewTransaction() {
 
     success: newTransactionToAccounts,
     error: function(jqXHR, textStatus) {
+      if (jqXHR.status == 409) {
+        // Likely duplicates need confirmation before they're committed.
+        duplicates = $.map(JSON.parse(jqXHR.responseText).duplicates, function(d) {
+          return d.split.date + " " + d.split.memo;
+        });
+        if (confirm("This might duplicate:\n" + duplicates.join("\n") +
+                    "\n\nCommit it anyway?")) {
+          request.confirm = true;
+          postNewTransaction(request, submit_button);
+        }
+        return;
+      }
       alert("Failed to commit transaction:\n" + jqXHR.responseText);
     },
     complete: function() {
@@ -0,0 +1,145 @@
+package ae_money
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/cjc25/ae_money/transaction"
+
+	"appengine"
+	"appengine/datastore"
+)
+
+// TaxCategory maps an Income or Expense Account to a tax category, so all of
+// its Splits are in the category unless they're tagged with another one.
+type TaxCategory struct {
+	Category string `json:"category"`
+}
+
+// taxCategoryKey provides the datastore key for the TaxCategory of an
+// Account. An Account has at most one.
+func taxCategoryKey(c appengine.Context, accountKey *datastore.Key) *datastore.Key {
+	return datastore.NewKey(c, "TaxCategory", "category", 0, accountKey)
+}
+
+// SetTaxCategory maps an Account to the tax category read as JSON from the
+// request body. An empty category removes the mapping. The Account is
+// extracted from the gorilla/mux vars.
+func SetTaxCategory(p *requestParams) {
+	w, r, c, u, v := p.w, p.r, p.c, p.u, p.v
+
+	var accountIntID int64
+	if _, err := fmt.Sscan(v["key"], &accountIntID); err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	var category TaxCategory
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&category); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	category.Category = transaction.NormalizeTaxCategory(category.Category)
+
+	accountKey := datastore.NewKey(c, "Account", "", accountIntID, userKey(c, u))
+	err := datastore.RunInTransaction(c, func(c appengine.Context) error {
+		var a transaction.Account
+		if err := datastore.Get(c, accountKey, &a); err != nil {
+			return err
+		}
+		if category.Category == "" {
+			return datastore.Delete(c, taxCategoryKey(c, accountKey))
+		}
+		if a.Type != transaction.Income && a.Type != transaction.Expense {
+			return errors.New("Only income and expense accounts have tax categories.")
+		}
+		_, err := datastore.Put(c, taxCategoryKey(c, accountKey), &category)
+		return err
+	}, nil)
+	if err != nil {
+		// TODO(cjc25): This might not be a 400: if e.g. datastore failed it should
+		// be a 500. Interpret err and return the right thing.
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+}
+
+// attachmentLinks maps each of the user's transactions to the paths their
+// Attachments can be downloaded from, under API version version.
+func attachmentLinks(c appengine.Context, userKey *datastore.Key, version string) (map[string][]string, error) {
+	var attachments []Attachment
+	keys, err := datastore.NewQuery("Attachment").Ancestor(userKey).GetAll(c, &attachments)
+	if err != nil {
+		return nil, err
+	}
+	links := make(map[string][]string)
+	for i := range keys {
+		id := attachments[i].Transaction
+		links[id] = append(links[id],
+			fmt.Sprintf("/api/v%v/transactions/%v/attachments/%v", version, id, keys[i].IntID()))
+	}
+	return links, nil
+}
+
+// ShowTaxReport prints the logged in user's transaction.TaxReport for the tax
+// year starting in the "year" form value, which defaults to the current tax
+// year. Tax years start on the day given by the user's Settings. Each item
+// links to its transaction's Attachments. If the "format" form value is
+// "csv", it's printed as CSV, otherwise as JSON.
+func ShowTaxReport(p *requestParams) {
+	w, r, c, u, v := p.w, p.r, p.c, p.u, p.v
+
+	userKey := userKey(c, u)
+	settings, err := getSettings(c, userKey)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	now := today(settings)
+	year := now.Year
+	if settings.TaxYear(year).From.After(now) {
+		year--
+	}
+	if s := r.FormValue("year"); s != "" {
+		if _, err := fmt.Sscan(s, &year); err != nil {
+			http.Error(w, "Bad year: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	accounts, splits, ids, err := userAccountsAndSplits(newDatastoreLedger(c, userKey))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var mapped []TaxCategory
+	keys, err := datastore.NewQuery("TaxCategory").Ancestor(userKey).GetAll(c, &mapped)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	categories := make(map[int64]string)
+	for i := range keys {
+		categories[keys[i].Parent().IntID()] = mapped[i].Category
+	}
+
+	version := v["version"]
+	if version == "" {
+		version = "0"
+	}
+	links, err := attachmentLinks(c, userKey, version)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	report := transaction.NewTaxReport(accounts, categories, splits, ids, settings.TaxYear(year))
+	for i := range report.Items {
+		report.Items[i].Attachments = links[report.Items[i].Transaction]
+	}
+	printReport(w, r, report)
+}
@@ -0,0 +1,89 @@
+package ae_money
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/cjc25/ae_money/transaction"
+
+	"appengine"
+	"appengine/datastore"
+	"appengine/user"
+)
+
+// setTestTaxCategory maps the Account with key k to category.
+func setTestTaxCategory(t *testing.T, c appengine.Context, u *user.User, k *datastore.Key, category string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r := &http.Request{Body: ioutil.NopCloser(bytes.NewBufferString(fmt.Sprintf(`{"category":%q}`, category)))}
+	SetTaxCategory(&requestParams{w: w, r: r, c: c, u: u, v: map[string]string{"key": fmt.Sprint(k.IntID())}})
+	return w
+}
+
+func TestShowTaxReport(t *testing.T) {
+	defer useTestAttachmentStore(t)()
+	u := &user.User{Email: "test@example.com"}
+	w, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := setUpTestReportOrDie(t, c, u)
+	id := newTestTransactionOrDie(t, c, u, []transaction.AmountType{-1234, 1234},
+		[]int64{k[0].IntID(), k[3].IntID()}, "Pharmacy", "2014-12-01")
+	attachment := uploadTestAttachmentOrDie(t, c, u, id)
+	expectCode(t, http.StatusOK, setTestTaxCategory(t, c, u, k[3], " Medical "))
+
+	ShowTaxReport(&requestParams{w: w, r: newTestReportRequest(url.Values{"year": {"2014"}}), c: c, u: u,
+		v: map[string]string{"version": "0"}})
+
+	expectCode(t, http.StatusOK, w)
+	var result transaction.TaxReport
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	expectedTotals := []transaction.TaxCategoryTotal{{Category: "medical", Total: 66234}}
+	if !reflect.DeepEqual(result.Totals, expectedTotals) {
+		t.Errorf("Expected totals %+v, got %+v", expectedTotals, result.Totals)
+	}
+	if len(result.Items) != 3 {
+		t.Fatalf("Expected 3 items, got %+v", result.Items)
+	}
+	expectedLinks := []string{fmt.Sprintf("/api/v0/transactions/%v/attachments/%v", id, attachment)}
+	if pharmacy := result.Items[2]; pharmacy.Memo != "Pharmacy" || !reflect.DeepEqual(pharmacy.Attachments, expectedLinks) {
+		t.Errorf("Expected pharmacy item with links %v, got %+v", expectedLinks, pharmacy)
+	}
+}
+
+func TestShowTaxReport_TaxYearSettings(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := setUpTestReportOrDie(t, c, u)
+	setTestTaxCategory(t, c, u, k[3], "medical")
+	if _, err := datastore.Put(c, settingsKey(c, userKey(c, u)), &transaction.Settings{TaxYearStartMonth: 11}); err != nil {
+		t.Fatal(err)
+	}
+
+	ShowTaxReport(&requestParams{w: w, r: newTestReportRequest(url.Values{"year": {"2014"}, "format": {"csv"}}), c: c, u: u})
+
+	expectCode(t, http.StatusOK, w)
+	expectBody(t, `Category,Date,Account,Memo,Amount,Attachments
+medical,2014-11-20,Groceries,Groceries,25000,
+Total medical,25000`, w)
+}
+
+func TestSetTaxCategory_FailureNotIncomeOrExpense(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	_, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := setUpTestReportOrDie(t, c, u)
+
+	expectCode(t, http.StatusBadRequest, setTestTaxCategory(t, c, u, k[0], "medical"))
+}
@@ -1,111 +1,109 @@
 package ae_money
 
 import (
-	"encoding/json"
 	"net/http"
 	"time"
 
-	"code.google.com/p/go-uuid/uuid"
-
+	"github.com/cjc25/ae_money/handlers"
+	"github.com/cjc25/ae_money/storage"
 	"github.com/cjc25/ae_money/transaction"
 
 	"appengine"
 	"appengine/datastore"
 )
 
-const dateStringFormat = "2006-01-02"
-
-// TransactionRequest is for JSON marshalling and unmarshalling of
-// NewTransaction request bodies.
-type TransactionRequest struct {
-	Amounts  []transaction.AmountType `json:"amounts"`
-	Accounts []int64                  `json:"accounts"`
-	Memo     string                   `json:"memo"`
-	Date     string                   `json:"date"`
+// today is the current date in the user's time zone, from their Settings.
+func today(s *transaction.Settings) transaction.Date {
+	return s.Today(time.Now())
 }
 
 // NewTransaction verifies that a transaction is valid, and if so commits all
-// or none of the Splits to the relevant Accounts.
+// or none of the Splits to the relevant Accounts. See
+// handlers.NewTransaction.
 func NewTransaction(p *requestParams) {
-	w, r, c, u := p.w, p.r, p.c, p.u
+	handlers.NewTransaction(p.params())
+}
 
-	d := json.NewDecoder(r.Body)
-	var request TransactionRequest
-	if err := d.Decode(&request); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
+// commitTransaction verifies that splits are a valid transaction, and if so
+// commits all or none of them to their Accounts under transactionID.
+func commitTransaction(c appengine.Context, userKey *datastore.Key, transactionID string, splits []*transaction.Split) error {
+	return datastore.RunInTransaction(c, func(c appengine.Context) error {
+		return putTransaction(c, userKey, transactionID, splits)
+	}, nil)
+}
 
-	if len(request.Amounts) != len(request.Accounts) {
-		http.Error(w, "Amounts and accounts of different lengths", http.StatusBadRequest)
-		return
-	}
+// putTransaction is commitTransaction for callers that are already in a
+// datastore transaction, so they can update other entities atomically with
+// the Splits. See handlers.PutTransaction.
+func putTransaction(c appengine.Context, userKey *datastore.Key, transactionID string, splits []*transaction.Split) error {
+	return handlers.PutTransaction(newDatastoreLedger(c, userKey), transactionID, splits)
+}
 
-	date, err := time.Parse(dateStringFormat, request.Date)
+// getTransactionSplits gets the Splits of the user's transaction with id
+// transactionID, along with their keys. Splits are children of their Accounts,
+// so this looks for a Split under each of the user's Accounts.
+func getTransactionSplits(c appengine.Context, userKey *datastore.Key, transactionID string) ([]*datastore.Key, []*transaction.Split, error) {
+	accountKeys, err := datastore.NewQuery("Account").Ancestor(userKey).KeysOnly().GetAll(c, nil)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
+		return nil, nil, err
 	}
 
-	userKey := userKey(c, u)
-	transactionId := uuid.NewRandom().String()
-	accountKeys := make([]*datastore.Key, len(request.Accounts))
-	splitKeys := make([]*datastore.Key, len(request.Accounts))
-	splits := make([]*transaction.Split, len(request.Accounts))
-
-	for i := range request.Accounts {
-		accountKeys[i] = datastore.NewKey(c, "Account", "", request.Accounts[i], userKey)
-		splitKeys[i] = datastore.NewKey(c, "Split", transactionId, 0, accountKeys[i])
-		splits[i] = &transaction.Split{
-			Amount:  request.Amounts[i],
-			Account: request.Accounts[i],
-			Memo:    request.Memo,
-			Date:    date,
-		}
+	candidateKeys := make([]*datastore.Key, len(accountKeys))
+	for i := range accountKeys {
+		candidateKeys[i] = datastore.NewKey(c, "Split", transactionID, 0, accountKeys[i])
 	}
-
-	x := transaction.NewTransaction()
-	x.AddSplits(splits)
-
-	if err := x.ValidateAmount(); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
+	candidates := make([]transaction.Split, len(candidateKeys))
+	err = datastore.GetMulti(c, candidateKeys, candidates)
+	merr, isMultiError := err.(appengine.MultiError)
+	if err != nil && !isMultiError {
+		return nil, nil, err
 	}
 
-	err = datastore.RunInTransaction(c, func(c appengine.Context) error {
-		accounts := make([]transaction.Account, len(accountKeys))
-		if err := datastore.GetMulti(c, accountKeys, accounts); err != nil {
-			return err
+	splitKeys := make([]*datastore.Key, 0)
+	splits := make([]*transaction.Split, 0)
+	for i := range candidateKeys {
+		if isMultiError && merr[i] == datastore.ErrNoSuchEntity {
+			continue
 		}
-		for i := range accounts {
-			x.AddAccount(&accounts[i], accountKeys[i].IntID())
-		}
-
-		if err := x.Commit(); err != nil {
-			return err
+		if isMultiError && merr[i] != nil {
+			return nil, nil, merr[i]
 		}
+		splitKeys = append(splitKeys, candidateKeys[i])
+		splits = append(splits, &candidates[i])
+	}
+	return splitKeys, splits, nil
+}
 
-		putStatus := make(chan error)
+// ReverseTransaction undoes a transaction with a new one dated today in the
+// user's time zone, for mistakes that are discovered after the fact. See
+// handlers.ReverseTransaction.
+func ReverseTransaction(p *requestParams) {
+	settings, err := getSettings(p.c, userKey(p.c, p.u))
+	if err != nil {
+		http.Error(p.w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
-		go func() {
-			_, err := datastore.PutMulti(c, accountKeys, accounts)
-			putStatus <- err
-		}()
-		go func() {
-			_, err := datastore.PutMulti(c, splitKeys, splits)
-			putStatus <- err
-		}()
+	handlers.ReverseTransaction(p.params(), today(settings))
+}
 
-		err := <-putStatus
-		if err != nil {
-			return err
+// VoidTransaction undoes a transaction with a new one on the same date, as if
+// the original never happened, and deletes its Attachments. See
+// handlers.VoidTransaction.
+func VoidTransaction(p *requestParams) {
+	var keys []*datastore.Key
+	var attachments []Attachment
+	voided := handlers.VoidTransaction(p.params(), func(l storage.Ledger, transactionID string) error {
+		// Only the datastore keeps Attachments.
+		dl, ok := l.(*datastoreLedger)
+		if !ok {
+			return nil
 		}
-		return <-putStatus
-	}, nil)
-	if err != nil {
-		// TODO(cjc25): This might not be a 400: if e.g. datastore failed it should
-		// be a 500. Interpret err and return the right thing.
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
+		var err error
+		keys, attachments, err = voidAttachments(dl.c, dl.userKey, transactionID)
+		return err
+	})
+	if voided {
+		deleteAttachmentContents(p.c, keys, attachments)
 	}
 }
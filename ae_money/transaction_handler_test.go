@@ -3,11 +3,15 @@ package ae_money
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/cjc25/ae_money/handlers"
 	"github.com/cjc25/ae_money/transaction"
 
 	"appengine"
@@ -18,7 +22,7 @@ import (
 // Convenience function to wrap the TransactionRequest in a format that an HTTP
 // Handler expects.
 func buildTestTransactionRequest(t *testing.T, amounts []transaction.AmountType, accounts []int64, memo, date string) io.ReadCloser {
-	request := &TransactionRequest{Amounts: amounts, Accounts: accounts, Memo: memo, Date: date}
+	request := &handlers.TransactionRequest{Amounts: amounts, Accounts: accounts, Memo: memo, Date: date}
 	b := bytes.Buffer{}
 	e := json.NewEncoder(&b)
 	if err := e.Encode(request); err != nil {
@@ -86,6 +90,38 @@ func TestTransactionSuccess(t *testing.T) {
 	expectSplits(t, c, u, accountKeys, []transaction.AmountType{-123, 123}, "Test transaction")
 }
 
+func TestTransactionDateAndCreated(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, r, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	accountKeys := insertAccountsOrDie(t, c,
+		[]transaction.Account{{Name: "a1"}, {Name: "a2"}}, u)
+	r.Body = buildTestTransactionRequest(t,
+		[]transaction.AmountType{-123, 123},
+		[]int64{accountKeys[0].IntID(), accountKeys[1].IntID()},
+		"Test transaction",
+		"2014-11-01",
+	)
+
+	before := time.Now()
+	NewTransaction(&requestParams{w: w, r: r, c: c, u: u})
+	expectCode(t, http.StatusOK, w)
+
+	splits := make([]transaction.Split, 0)
+	if _, err := datastore.NewQuery("Split").Ancestor(userKey(c, u)).GetAll(c, &splits); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range splits {
+		if s.Date.String() != "2014-11-01" {
+			t.Errorf("Expected split on 2014-11-01, got %v", s.Date)
+		}
+		if s.Created.Before(before) {
+			t.Errorf("Expected split created after %v, got %v", before, s.Created)
+		}
+	}
+}
+
 func TestTransactionNoDate(t *testing.T) {
 	u := &user.User{Email: "test@example.com"}
 	w, r, c := initTestRequestParams(t, u)
@@ -159,6 +195,20 @@ func TestTransactionNoSplits(t *testing.T) {
 	expectSplits(t, c, u, nil, nil, "")
 }
 
+func TestTransactionNoAccounts(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, r, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	r.Body = ioutil.NopCloser(bytes.NewBufferString(
+		`{"amounts":[],"accounts":[],"memo":"Groceries","date":"2014-11-01","externalId":"bank-1"}`))
+
+	NewTransaction(&requestParams{w: w, r: r, c: c, u: u})
+
+	expectCode(t, http.StatusBadRequest, w)
+	expectSplits(t, c, u, nil, nil, "")
+}
+
 func TestTransactionNonZero(t *testing.T) {
 	u := &user.User{Email: "test@example.com"}
 	w, r, c := initTestRequestParams(t, u)
@@ -219,3 +269,278 @@ func TestTransactionOtherUserAccount(t *testing.T) {
 	expectCode(t, http.StatusBadRequest, w)
 	expectSplits(t, c, u, nil, nil, "")
 }
+
+// Convenience function to commit a transaction through NewTransaction and
+// return its id.
+func newTestTransactionOrDie(t *testing.T, c appengine.Context, u *user.User, amounts []transaction.AmountType, accounts []int64, memo, date string) string {
+	w := httptest.NewRecorder()
+	r := &http.Request{Body: buildTestTransactionRequest(t, amounts, accounts, memo, date)}
+
+	NewTransaction(&requestParams{w: w, r: r, c: c, u: u})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Failed to commit test transaction: %v", w.Body.String())
+	}
+
+	// NewTransaction doesn't return the id, so find a split with this memo.
+	q := datastore.NewQuery("Split").Ancestor(userKey(c, u)).Filter("Memo =", memo).KeysOnly()
+	keys, err := q.GetAll(c, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) == 0 {
+		t.Fatalf("No splits found for test transaction %v", memo)
+	}
+	return keys[0].StringID()
+}
+
+func TestReverseTransaction(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	accountKeys := insertAccountsOrDie(t, c,
+		[]transaction.Account{{Name: "a1"}, {Name: "a2"}}, u)
+	id := newTestTransactionOrDie(t, c, u,
+		[]transaction.AmountType{-123, 123},
+		[]int64{accountKeys[0].IntID(), accountKeys[1].IntID()},
+		"Test transaction", "2014-11-01")
+
+	ReverseTransaction(&requestParams{w: w, c: c, u: u, v: map[string]string{"id": id}})
+
+	expectCode(t, http.StatusOK, w)
+	var result map[string]string
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	_, splits, err := getTransactionSplits(c, userKey(c, u), result["id"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(splits) != 2 {
+		t.Fatalf("Expected 2 reversal splits, got %v", len(splits))
+	}
+	for _, s := range splits {
+		if s.Memo != "Reversal: Test transaction" {
+			t.Errorf("Expected reversal memo, got %v", s.Memo)
+		}
+		if s.Account == accountKeys[0].IntID() && s.Amount != 123 {
+			t.Errorf("Expected a1 reversal amount 123, got %v", s.Amount)
+		}
+	}
+}
+
+func TestReverseTransaction_UserTimeZone(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	// Kiritimati is 14 hours ahead of UTC, so it's usually a different day.
+	settings := &transaction.Settings{TimeZone: "Pacific/Kiritimati"}
+	if _, err := datastore.Put(c, settingsKey(c, userKey(c, u)), settings); err != nil {
+		t.Fatal(err)
+	}
+	accountKeys := insertAccountsOrDie(t, c,
+		[]transaction.Account{{Name: "a1"}, {Name: "a2"}}, u)
+	id := newTestTransactionOrDie(t, c, u,
+		[]transaction.AmountType{-123, 123},
+		[]int64{accountKeys[0].IntID(), accountKeys[1].IntID()},
+		"Test transaction", "2014-11-01")
+
+	ReverseTransaction(&requestParams{w: w, c: c, u: u, v: map[string]string{"id": id}})
+
+	expectCode(t, http.StatusOK, w)
+	var result map[string]string
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	_, splits, err := getTransactionSplits(c, userKey(c, u), result["id"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := today(settings); len(splits) != 2 || splits[0].Date != expected {
+		t.Errorf("Expected reversal dated %v in Kiritimati, got %+v", expected, splits)
+	}
+}
+
+func TestVoidTransaction(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	accountKeys := insertAccountsOrDie(t, c,
+		[]transaction.Account{{Name: "a1"}, {Name: "a2"}}, u)
+	id := newTestTransactionOrDie(t, c, u,
+		[]transaction.AmountType{-123, 123},
+		[]int64{accountKeys[0].IntID(), accountKeys[1].IntID()},
+		"Test transaction", "2014-11-01")
+
+	VoidTransaction(&requestParams{w: w, c: c, u: u, v: map[string]string{"id": id}})
+
+	expectCode(t, http.StatusOK, w)
+	var result map[string]string
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	_, splits, err := getTransactionSplits(c, userKey(c, u), result["id"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(splits) != 2 {
+		t.Fatalf("Expected 2 void splits, got %v", len(splits))
+	}
+	if splits[0].Date.String() != "2014-11-01" {
+		t.Errorf("Expected void on the original date, got %v", splits[0].Date)
+	}
+}
+
+func TestReverseTransaction_NoSuchTransaction(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	insertAccountsOrDie(t, c, []transaction.Account{{Name: "a1"}}, u)
+
+	ReverseTransaction(&requestParams{w: w, c: c, u: u, v: map[string]string{"id": "abc"}})
+
+	expectCode(t, http.StatusNotFound, w)
+	expectSplits(t, c, u, nil, nil, "")
+}
+
+func TestTransactionWeights(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, r, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	accountKeys := insertAccountsOrDie(t, c,
+		[]transaction.Account{{Name: "a1"}, {Name: "a2"}, {Name: "a3"}, {Name: "a4"}}, u)
+	request := &handlers.TransactionRequest{
+		Amounts:  []transaction.AmountType{0, 0, 0, -10001},
+		Accounts: []int64{accountKeys[0].IntID(), accountKeys[1].IntID(), accountKeys[2].IntID(), accountKeys[3].IntID()},
+		Weights:  []int64{1, 1, 1, 0},
+		Memo:     "Split three ways",
+		Date:     "2014-11-01",
+	}
+	b := bytes.Buffer{}
+	if err := json.NewEncoder(&b).Encode(request); err != nil {
+		t.Fatal(err)
+	}
+	r.Body = ioutil.NopCloser(&b)
+
+	NewTransaction(&requestParams{w: w, r: r, c: c, u: u})
+
+	expectCode(t, http.StatusOK, w)
+	expectSplits(t, c, u,
+		[]*datastore.Key{accountKeys[3], accountKeys[2], accountKeys[0], accountKeys[1]},
+		[]transaction.AmountType{-10001, 3333, 3334, 3334}, "Split three ways")
+}
+
+func TestTransactionWeightsAndAmount(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, r, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	accountKeys := insertAccountsOrDie(t, c,
+		[]transaction.Account{{Name: "a1"}, {Name: "a2"}}, u)
+	r.Body = ioutil.NopCloser(bytes.NewBufferString(fmt.Sprintf(
+		`{"amounts":[-100,100],"accounts":[%v,%v],"weights":[0,1],"date":"2014-11-01"}`,
+		accountKeys[0].IntID(), accountKeys[1].IntID())))
+
+	NewTransaction(&requestParams{w: w, r: r, c: c, u: u})
+
+	expectCode(t, http.StatusBadRequest, w)
+	expectSplits(t, c, u, nil, nil, "")
+}
+
+// Expectation function for the DuplicateReport printed by NewTransaction.
+func expectDuplicateReport(t *testing.T, w *httptest.ResponseRecorder, code int, skipped bool, duplicates int) {
+	expectCode(t, code, w)
+	var report handlers.DuplicateReport
+	if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Skipped != skipped || len(report.Duplicates) != duplicates {
+		t.Errorf("Expected skipped %v with %v duplicates, got %+v", skipped, duplicates, report)
+	}
+}
+
+func TestNewTransaction_FailureLikelyDuplicate(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	_, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := insertAccountsOrDie(t, c, []transaction.Account{{Name: "Checking"}, {Name: "Groceries"}}, u)
+	newTestTransactionOrDie(t, c, u, []transaction.AmountType{-5000, 5000},
+		[]int64{k[0].IntID(), k[1].IntID()}, "Trader Joe's", "2014-11-05")
+
+	request := &handlers.TransactionRequest{
+		Amounts:  []transaction.AmountType{-5000, 5000},
+		Accounts: []int64{k[0].IntID(), k[1].IntID()},
+		Memo:     "TRADER JOE'S #123",
+		Date:     "2014-11-06",
+	}
+	w := newTestPayeeTransaction(t, c, u, request)
+
+	expectDuplicateReport(t, w, http.StatusConflict, false, 1)
+	if total := accountTotalOrDie(t, c, k[1]); total != 5000 {
+		t.Errorf("Expected duplicate not to be committed, got total %v", total)
+	}
+
+	request.Confirm = true
+	w = newTestPayeeTransaction(t, c, u, request)
+
+	expectCode(t, http.StatusOK, w)
+	if total := accountTotalOrDie(t, c, k[1]); total != 10000 {
+		t.Errorf("Expected confirmed duplicate to be committed, got total %v", total)
+	}
+}
+
+func TestNewTransaction_NotDuplicate(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	_, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := insertAccountsOrDie(t, c, []transaction.Account{{Name: "Checking"}, {Name: "Groceries"}}, u)
+	newTestTransactionOrDie(t, c, u, []transaction.AmountType{-5000, 5000},
+		[]int64{k[0].IntID(), k[1].IntID()}, "Trader Joe's", "2014-11-05")
+
+	w := newTestPayeeTransaction(t, c, u, &handlers.TransactionRequest{
+		Amounts:  []transaction.AmountType{-5000, 5000},
+		Accounts: []int64{k[0].IntID(), k[1].IntID()},
+		Memo:     "Safeway",
+		Date:     "2014-11-05",
+	})
+
+	expectCode(t, http.StatusOK, w)
+	expectBody(t, "", w)
+}
+
+func TestNewTransaction_SkipsExternalIDDuplicate(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	_, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := insertAccountsOrDie(t, c, []transaction.Account{{Name: "Checking"}, {Name: "Groceries"}}, u)
+	request := &handlers.TransactionRequest{
+		Amounts:    []transaction.AmountType{-5000, 5000},
+		Accounts:   []int64{k[0].IntID(), k[1].IntID()},
+		Memo:       "TRADER JOE'S #123",
+		Date:       "2014-11-05",
+		ExternalID: "bank-1",
+	}
+	w := newTestPayeeTransaction(t, c, u, request)
+	expectCode(t, http.StatusOK, w)
+
+	// The bank dated it differently in the next export, but it's the same.
+	request.Date = "2014-11-20"
+	request.Confirm = true
+	w = newTestPayeeTransaction(t, c, u, request)
+
+	expectDuplicateReport(t, w, http.StatusOK, true, 1)
+	count, err := datastore.NewQuery("Split").Ancestor(userKey(c, u)).Count(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("Expected only the first import's 2 splits, got %v", count)
+	}
+}
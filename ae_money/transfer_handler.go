@@ -0,0 +1,245 @@
+package ae_money
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"code.google.com/p/go-uuid/uuid"
+
+	"github.com/cjc25/ae_money/handlers"
+	"github.com/cjc25/ae_money/transaction"
+
+	"appengine"
+	"appengine/datastore"
+)
+
+// TransferHalfRequest is for JSON unmarshalling of AddTransferHalf request
+// bodies.
+type TransferHalfRequest struct {
+	Account    int64                  `json:"account"`
+	Amount     transaction.AmountType `json:"amount"`
+	Date       string                 `json:"date"`
+	Memo       string                 `json:"memo"`
+	ExternalID string                 `json:"externalId"`
+}
+
+// ResolveTransferRequest is for JSON unmarshalling of ResolveTransferHalf
+// request bodies. Account is the counter account for the half.
+type ResolveTransferRequest struct {
+	Account int64 `json:"account"`
+}
+
+// TransferResult is for JSON responses from AddTransferHalf. Exactly one of
+// Transaction, the id of the merged transfer, or Queued, the key of the
+// queued half, is set. Skipped is set instead if the half was already
+// imported.
+type TransferResult struct {
+	Transaction string `json:"transaction,omitempty"`
+	Queued      int64  `json:"queued,omitempty"`
+	Skipped     bool   `json:"skipped,omitempty"`
+}
+
+// DatastoreTransferHalf wraps transaction.TransferHalf for JSON responses that
+// include a datastore key.
+type DatastoreTransferHalf struct {
+	TransferHalf *transaction.TransferHalf `json:"transferHalf"`
+	IntID        int64                     `json:"key"`
+}
+
+// transferQueue gets the user's unmatched TransferHalfs, oldest first.
+func transferQueue(c appengine.Context, userKey *datastore.Key) ([]*datastore.Key, []transaction.TransferHalf, error) {
+	halves := make([]transaction.TransferHalf, 0)
+	keys, err := datastore.NewQuery("TransferHalf").Ancestor(userKey).Order("Date").GetAll(c, &halves)
+	return keys, halves, err
+}
+
+// AddTransferHalf matches one half of a transfer, read as JSON from the
+// request body, with the other half in the user's transfer queue. If there's
+// a match, the two are committed as one transaction. If not, the half is
+// queued to wait for its match, or for review. A TransferResult is printed.
+func AddTransferHalf(p *requestParams) {
+	w, r, c, u := p.w, p.r, p.c, p.u
+
+	var request TransferHalfRequest
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	date, err := transaction.ParseDate(request.Date)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h := &transaction.TransferHalf{
+		Account:    request.Account,
+		Amount:     request.Amount,
+		Date:       date,
+		Memo:       request.Memo,
+		ExternalID: request.ExternalID,
+	}
+	if err := h.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userKey := userKey(c, u)
+	var result TransferResult
+	err = datastore.RunInTransaction(c, func(c appengine.Context) error {
+		result = TransferResult{}
+
+		var a transaction.Account
+		if err := datastore.Get(c, datastore.NewKey(c, "Account", "", h.Account, userKey), &a); err != nil {
+			return err
+		}
+		if a.Type != transaction.Asset && a.Type != transaction.Liability {
+			return fmt.Errorf("Transfers must be between asset and liability accounts, not %v", a.Type)
+		}
+
+		keys, queue, err := transferQueue(c, userKey)
+		if err != nil {
+			return err
+		}
+		if h.ExternalID != "" {
+			for i := range queue {
+				if queue[i].Account == h.Account && queue[i].ExternalID == h.ExternalID {
+					result.Skipped = true
+					return nil
+				}
+			}
+			report, err := handlers.FindDuplicates(newDatastoreLedger(c, userKey), []*transaction.Split{h.Split()})
+			if err != nil {
+				return err
+			}
+			if report.Skipped {
+				result.Skipped = true
+				return nil
+			}
+		}
+
+		i := transaction.MatchTransfer(h, queue)
+		if i < 0 {
+			k, err := datastore.Put(c, datastore.NewIncompleteKey(c, "TransferHalf", userKey), h)
+			if err != nil {
+				return err
+			}
+			result.Queued = k.IntID()
+			return nil
+		}
+
+		result.Transaction = uuid.NewRandom().String()
+		if err := putTransaction(c, userKey, result.Transaction, transaction.MergeTransfer(h, &queue[i])); err != nil {
+			return err
+		}
+		return datastore.Delete(c, keys[i])
+	}, nil)
+	if err != nil {
+		// TODO(cjc25): This might not be a 400: if e.g. datastore failed it should
+		// be a 500. Interpret err and return the right thing.
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	e := json.NewEncoder(w)
+	if err := e.Encode(&result); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// ListTransferHalves prints the logged in user's transfer queue: the halves
+// which haven't been matched, oldest first.
+func ListTransferHalves(p *requestParams) {
+	w, c, u := p.w, p.c, p.u
+
+	keys, queue, err := transferQueue(c, userKey(c, u))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	result := make([]DatastoreTransferHalf, len(queue))
+	for i := range keys {
+		result[i] = DatastoreTransferHalf{&queue[i], keys[i].IntID()}
+	}
+
+	e := json.NewEncoder(w)
+	if err := e.Encode(result); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// ResolveTransferHalf commits a queued half against a counter account read as
+// JSON from the request body, for halves which turn out not to be transfers,
+// or whose other half will never be imported. The half is extracted from the
+// gorilla/mux vars, and the id of the new transaction is printed as JSON.
+func ResolveTransferHalf(p *requestParams) {
+	w, r, c, u, v := p.w, p.r, p.c, p.u, p.v
+
+	var halfIntID int64
+	if _, err := fmt.Sscan(v["key"], &halfIntID); err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	var request ResolveTransferRequest
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userKey := userKey(c, u)
+	k := datastore.NewKey(c, "TransferHalf", "", halfIntID, userKey)
+	transactionID := uuid.NewRandom().String()
+	err := datastore.RunInTransaction(c, func(c appengine.Context) error {
+		var h transaction.TransferHalf
+		if err := datastore.Get(c, k, &h); err != nil {
+			return err
+		}
+
+		split := h.Split()
+		splits := []*transaction.Split{split, &transaction.Split{
+			Amount:  -split.Amount,
+			Account: request.Account,
+			Memo:    split.Memo,
+			Date:    split.Date,
+		}}
+		if err := putTransaction(c, userKey, transactionID, splits); err != nil {
+			return err
+		}
+		return datastore.Delete(c, k)
+	}, nil)
+	if err != nil {
+		// TODO(cjc25): This might not be a 400: if e.g. datastore failed it should
+		// be a 500. Interpret err and return the right thing.
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	e := json.NewEncoder(w)
+	if err := e.Encode(map[string]string{"id": transactionID}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// DeleteTransferHalf removes a half from the transfer queue without
+// committing anything. The half is extracted from the gorilla/mux vars.
+func DeleteTransferHalf(p *requestParams) {
+	w, c, u, v := p.w, p.c, p.u, p.v
+
+	var halfIntID int64
+	if _, err := fmt.Sscan(v["key"], &halfIntID); err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	k := datastore.NewKey(c, "TransferHalf", "", halfIntID, userKey(c, u))
+	if err := datastore.Delete(c, k); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
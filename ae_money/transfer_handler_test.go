@@ -0,0 +1,182 @@
+package ae_money
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cjc25/ae_money/transaction"
+
+	"appengine"
+	"appengine/datastore"
+	"appengine/user"
+)
+
+// Setup method which creates checking, credit card and expense accounts.
+func setUpTestTransferAccountsOrDie(t *testing.T, c appengine.Context, u *user.User) []*datastore.Key {
+	return insertAccountsOrDie(t, c, []transaction.Account{
+		{Name: "Checking", Type: transaction.Asset},
+		{Name: "Credit Card", Type: transaction.Liability},
+		{Name: "Fees", Type: transaction.Expense},
+	}, u)
+}
+
+// addTestTransferHalf imports a transfer half for u.
+func addTestTransferHalf(t *testing.T, c appengine.Context, u *user.User, request *TransferHalfRequest) *httptest.ResponseRecorder {
+	b, err := json.Marshal(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	r := &http.Request{Body: ioutil.NopCloser(bytes.NewBuffer(b))}
+	AddTransferHalf(&requestParams{w: w, r: r, c: c, u: u})
+	return w
+}
+
+// Expectation function for the TransferResult printed by AddTransferHalf.
+func expectTransferResult(t *testing.T, w *httptest.ResponseRecorder) *TransferResult {
+	expectCode(t, http.StatusOK, w)
+	var result TransferResult
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	return &result
+}
+
+// Expectation function for the length of a user's transfer queue.
+func expectTransferQueueLength(t *testing.T, c appengine.Context, u *user.User, expected int) {
+	_, queue, err := transferQueue(c, userKey(c, u))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queue) != expected {
+		t.Errorf("Expected %v queued halves, got %+v", expected, queue)
+	}
+}
+
+func TestAddTransferHalf_Matches(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	_, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := setUpTestTransferAccountsOrDie(t, c, u)
+
+	w := addTestTransferHalf(t, c, u, &TransferHalfRequest{
+		Account: k[0].IntID(), Amount: -50000, Date: "2014-11-05", Memo: "CARD PAYMENT", ExternalID: "bank-1",
+	})
+	if result := expectTransferResult(t, w); result.Queued == 0 {
+		t.Errorf("Expected first half to be queued, got %+v", result)
+	}
+	expectTransferQueueLength(t, c, u, 1)
+
+	w = addTestTransferHalf(t, c, u, &TransferHalfRequest{
+		Account: k[1].IntID(), Amount: 50000, Date: "2014-11-07", Memo: "PAYMENT THANK YOU", ExternalID: "card-1",
+	})
+	if result := expectTransferResult(t, w); result.Transaction == "" {
+		t.Errorf("Expected halves to be merged, got %+v", result)
+	}
+
+	expectTransferQueueLength(t, c, u, 0)
+	if total := accountTotalOrDie(t, c, k[0]); total != -50000 {
+		t.Errorf("Expected checking total -50000, got %v", total)
+	}
+	if total := accountTotalOrDie(t, c, k[1]); total != 50000 {
+		t.Errorf("Expected credit card total 50000, got %v", total)
+	}
+
+	// Importing either bank's file again skips the transfer.
+	w = addTestTransferHalf(t, c, u, &TransferHalfRequest{
+		Account: k[1].IntID(), Amount: 50000, Date: "2014-11-07", Memo: "PAYMENT THANK YOU", ExternalID: "card-1",
+	})
+	if result := expectTransferResult(t, w); !result.Skipped {
+		t.Errorf("Expected reimport to be skipped, got %+v", result)
+	}
+	expectTransferQueueLength(t, c, u, 0)
+}
+
+func TestAddTransferHalf_NoMatchOutsideWindow(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	_, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := setUpTestTransferAccountsOrDie(t, c, u)
+	addTestTransferHalf(t, c, u, &TransferHalfRequest{Account: k[0].IntID(), Amount: -50000, Date: "2014-11-05"})
+
+	w := addTestTransferHalf(t, c, u, &TransferHalfRequest{Account: k[1].IntID(), Amount: 50000, Date: "2014-11-15"})
+
+	if result := expectTransferResult(t, w); result.Queued == 0 {
+		t.Errorf("Expected second half to be queued, got %+v", result)
+	}
+	expectTransferQueueLength(t, c, u, 2)
+}
+
+func TestAddTransferHalf_FailureNotAssetOrLiability(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	_, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := setUpTestTransferAccountsOrDie(t, c, u)
+
+	w := addTestTransferHalf(t, c, u, &TransferHalfRequest{Account: k[2].IntID(), Amount: -50000, Date: "2014-11-05"})
+
+	expectCode(t, http.StatusBadRequest, w)
+	expectTransferQueueLength(t, c, u, 0)
+}
+
+func TestListTransferHalves(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := setUpTestTransferAccountsOrDie(t, c, u)
+	addTestTransferHalf(t, c, u, &TransferHalfRequest{Account: k[0].IntID(), Amount: -50000, Date: "2014-11-05"})
+
+	ListTransferHalves(&requestParams{w: w, c: c, u: u})
+
+	var result []DatastoreTransferHalf
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 1 || result[0].TransferHalf.Amount != -50000 {
+		t.Errorf("Expected one queued half, got %+v", result)
+	}
+}
+
+func TestResolveTransferHalf(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, r, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := setUpTestTransferAccountsOrDie(t, c, u)
+	result := expectTransferResult(t, addTestTransferHalf(t, c, u,
+		&TransferHalfRequest{Account: k[0].IntID(), Amount: -300, Date: "2014-11-05", Memo: "Fee"}))
+	r.Body = ioutil.NopCloser(bytes.NewBufferString(fmt.Sprintf(`{"account":%v}`, k[2].IntID())))
+
+	ResolveTransferHalf(&requestParams{w: w, r: r, c: c, u: u,
+		v: map[string]string{"key": fmt.Sprint(result.Queued)}})
+
+	expectCode(t, http.StatusOK, w)
+	expectTransferQueueLength(t, c, u, 0)
+	if total := accountTotalOrDie(t, c, k[2]); total != 300 {
+		t.Errorf("Expected fees total 300, got %v", total)
+	}
+}
+
+func TestDeleteTransferHalf(t *testing.T) {
+	u := &user.User{Email: "test@example.com"}
+	w, _, c := initTestRequestParams(t, u)
+	defer c.Close()
+
+	k := setUpTestTransferAccountsOrDie(t, c, u)
+	result := expectTransferResult(t, addTestTransferHalf(t, c, u,
+		&TransferHalfRequest{Account: k[0].IntID(), Amount: -300, Date: "2014-11-05"}))
+
+	DeleteTransferHalf(&requestParams{w: w, c: c, u: u, v: map[string]string{"key": fmt.Sprint(result.Queued)}})
+
+	expectCode(t, http.StatusOK, w)
+	expectTransferQueueLength(t, c, u, 0)
+}
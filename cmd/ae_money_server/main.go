@@ -0,0 +1,105 @@
+// Command ae_money_server serves ae_money's core ledger API with plain
+// net/http, for running outside of App Engine. It doesn't serve the web app.
+// See package server for which of the API it serves.
+//
+// For example, to keep ledgers in ledger.db, for users logged in by a proxy
+// that passes their email address in X-Forwarded-Email:
+//
+//	ae_money_server -listen=localhost:8080 -storage=sqlite -sqlite=ledger.db \
+//		-auth=header -auth-header=X-Forwarded-Email
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/cjc25/ae_money/server"
+	"github.com/cjc25/ae_money/storage"
+	"github.com/cjc25/ae_money/storage/sqlite"
+)
+
+var (
+	listen     = flag.String("listen", "localhost:8080", "Address to serve HTTP on.")
+	backend    = flag.String("storage", "sqlite", `Where to keep ledgers: "sqlite", or "memory" to lose them on exit.`)
+	sqlitePath = flag.String("sqlite", "ae_money.db", "SQLite database file, for -storage=sqlite.")
+	auth       = flag.String("auth", "single", `How users log in: "single" for one user who is always logged in, or "header" for a proxy that logs them in.`)
+	singleUser = flag.String("user", "local", "The user, for -auth=single.")
+	authHeader = flag.String("auth-header", "X-Forwarded-User", "Header the proxy passes the user's name in, for -auth=header.")
+	grace      = flag.Duration("shutdown-timeout", 30*time.Second, "How long to let requests finish when shutting down.")
+)
+
+// openStore opens the storage backend named by the flags, and returns a
+// function to close it once the server has shut down.
+func openStore() (storage.Store, func() error, error) {
+	switch *backend {
+	case "memory":
+		return storage.NewMemoryStore(), func() error { return nil }, nil
+	case "sqlite":
+		db, err := sqlite.Open(*sqlitePath)
+		if err != nil {
+			return nil, nil, err
+		}
+		return db, db.Close, nil
+	}
+	return nil, nil, fmt.Errorf("Unknown storage %q", *backend)
+}
+
+// authenticator gets the server.Authenticator named by the flags.
+func authenticator() (server.Authenticator, error) {
+	switch *auth {
+	case "single":
+		return server.SingleUser(*singleUser), nil
+	case "header":
+		return server.HeaderUser(*authHeader), nil
+	}
+	return nil, fmt.Errorf("Unknown auth %q", *auth)
+}
+
+func main() {
+	flag.Parse()
+
+	a, err := authenticator()
+	if err != nil {
+		log.Fatal(err)
+	}
+	s, closeStore, err := openStore()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	srv := &http.Server{Addr: *listen, Handler: server.NewHandler(s, a)}
+
+	// On SIGINT or SIGTERM, stop accepting requests and let the ones in flight
+	// finish, so no transaction is cut off partway through a response.
+	stopped := make(chan struct{})
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		<-signals
+		log.Print("Shutting down")
+
+		ctx, cancel := context.WithTimeout(context.Background(), *grace)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Printf("Shutting down: %v", err)
+		}
+		close(stopped)
+	}()
+
+	log.Printf("Serving on %v", *listen)
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	<-stopped
+
+	if err := closeStore(); err != nil {
+		log.Fatal(err)
+	}
+}
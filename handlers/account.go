@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/cjc25/ae_money/storage"
+	"github.com/cjc25/ae_money/transaction"
+)
+
+// Account wraps transaction.Account for JSON responses that include its id.
+type Account struct {
+	Account *transaction.Account `json:"account"`
+	IntID   int64                `json:"key"`
+}
+
+// AccountAndSplits wraps an Account and a slice of transaction.Split for JSON
+// responses.
+type AccountAndSplits struct {
+	Account
+	Splits []transaction.Split `json:"splits"`
+}
+
+// ListAccounts gets the logged in user's accounts.
+func ListAccounts(p *Params) {
+	w := p.W
+
+	ids, accounts, err := p.Ledger().Accounts()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	result := make([]Account, len(accounts))
+	for i := range ids {
+		result[i].Account = &accounts[i]
+		result[i].IntID = ids[i]
+	}
+
+	e := json.NewEncoder(w)
+	if err := e.Encode(result); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// ShowAccount prints a specific Account's details, including Splits. The
+// Account to print is extracted from the gorilla/mux vars.
+func ShowAccount(p *Params) {
+	w, v := p.W, p.V
+
+	var accountIntID int64
+	if _, err := fmt.Sscan(v["key"], &accountIntID); err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	// Read both in one transaction, so the total matches the Splits.
+	var result *AccountAndSplits
+	err := p.S.RunInTransaction(p.User, func(l storage.Ledger) error {
+		a, err := l.Account(accountIntID)
+		if err != nil {
+			return err
+		}
+		_, splits, err := l.AccountSplits(accountIntID)
+		if err != nil {
+			return err
+		}
+		result = &AccountAndSplits{Account{a, accountIntID}, splits}
+		return nil
+	})
+	if err == storage.ErrNoSuchEntity {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	e := json.NewEncoder(w)
+	if err := e.Encode(result); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// NewAccount creates a new Account. The Account is read as JSON from the
+// request body. If it has a Parent, that must be another of the user's
+// Accounts, of the same Type.
+func NewAccount(p *Params) {
+	w, r := p.W, p.R
+
+	// We specifically want to decode into a transaction.Account so we don't pick
+	// up an id.
+	var a transaction.Account
+	d := json.NewDecoder(r.Body)
+	if err := d.Decode(&a); err != nil {
+		// TODO(cjc25): Could this reveal too much?
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := a.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var id int64
+	err := p.S.RunInTransaction(p.User, func(l storage.Ledger) error {
+		if a.Parent != 0 {
+			parent, err := l.Account(a.Parent)
+			if err != nil {
+				return fmt.Errorf("Bad parent account: %v", err)
+			}
+			if parent.Type != a.Type {
+				return fmt.Errorf("Parent account is %q, not %q", parent.Type, a.Type)
+			}
+		}
+
+		var err error
+		id, err = l.AddAccount(&a)
+		return err
+	})
+	if err != nil {
+		// TODO(cjc25): This might not be a 400: if e.g. the database failed it
+		// should be a 500. Interpret err and return the right thing.
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	e := json.NewEncoder(w)
+	if err := e.Encode(&Account{&a, id}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// DeleteAccount deletes an Account owned by the logged in user, if it has no
+// Splits. The Account to delete is extracted from the gorilla/mux vars. It's
+// fine to delete an Account that doesn't exist: nothing happens.
+//
+// If also isn't nil, it's called with the Account's id in the same
+// transaction, to delete whatever the caller keeps alongside the Account.
+func DeleteAccount(p *Params, also func(l storage.Ledger, id int64) error) {
+	w, v := p.W, p.V
+
+	var accountIntID int64
+	if _, err := fmt.Sscan(v["key"], &accountIntID); err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	err := p.S.RunInTransaction(p.User, func(l storage.Ledger) error {
+		if err := l.DeleteAccount(accountIntID); err != nil {
+			return err
+		}
+		if also == nil {
+			return nil
+		}
+		return also(l, accountIntID)
+	})
+	if err != nil {
+		// TODO(cjc25): This might not be a 400: if e.g. the database failed it
+		// should be a 500. Interpret err and return the right thing.
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/cjc25/ae_money/storage"
+	"github.com/cjc25/ae_money/transaction"
+)
+
+func TestListAccounts(t *testing.T) {
+	s := storage.NewMemoryStore()
+	ids := addAccountsOrDie(t, s, transaction.Account{Name: "a1"})
+
+	p, w := newTestParams(s, "", nil)
+	ListAccounts(p)
+
+	expectCode(t, http.StatusOK, w)
+	var result []Account
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 1 || result[0].IntID != ids[0] || result[0].Account.Name != "a1" {
+		t.Errorf("Expected just a1, got %+v", result)
+	}
+}
+
+func TestShowAccount_FailureNoSuchAccount(t *testing.T) {
+	s := storage.NewMemoryStore()
+
+	p, w := newTestParams(s, "", map[string]string{"key": "1"})
+	ShowAccount(p)
+
+	expectCode(t, http.StatusNotFound, w)
+}
+
+func TestNewAccount_Success(t *testing.T) {
+	s := storage.NewMemoryStore()
+
+	p, w := newTestParams(s, `{"name":"a1","type":"asset"}`, nil)
+	NewAccount(p)
+
+	expectCode(t, http.StatusOK, w)
+	var result Account
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	a, err := s.Ledger(testUser).Account(result.IntID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Name != "a1" {
+		t.Errorf("Expected a1 to be stored, got %+v", a)
+	}
+}
+
+func TestDeleteAccount_CallsAlso(t *testing.T) {
+	s := storage.NewMemoryStore()
+	ids := addAccountsOrDie(t, s, transaction.Account{Name: "a1"})
+
+	var deleted int64
+	p, w := newTestParams(s, "", map[string]string{"key": fmt.Sprint(ids[0])})
+	DeleteAccount(p, func(l storage.Ledger, id int64) error {
+		deleted = id
+		return nil
+	})
+
+	expectCode(t, http.StatusOK, w)
+	if deleted != ids[0] {
+		t.Errorf("Expected also to be called with %v, got %v", ids[0], deleted)
+	}
+	if _, err := s.Ledger(testUser).Account(ids[0]); err != storage.ErrNoSuchEntity {
+		t.Errorf("Expected account to be deleted, got %v", err)
+	}
+}
+
+func TestDeleteAccount_FailureAlso(t *testing.T) {
+	s := storage.NewMemoryStore()
+	ids := addAccountsOrDie(t, s, transaction.Account{Name: "a1"})
+
+	p, w := newTestParams(s, "", map[string]string{"key": fmt.Sprint(ids[0])})
+	DeleteAccount(p, func(storage.Ledger, int64) error {
+		return errors.New("also failed")
+	})
+
+	if w.Code == http.StatusOK {
+		t.Errorf("Expected an error")
+	}
+	if _, err := s.Ledger(testUser).Account(ids[0]); err != nil {
+		t.Errorf("Expected account to be kept when also fails, got %v", err)
+	}
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/cjc25/ae_money/storage"
+	"github.com/cjc25/ae_money/transaction"
+)
+
+// Learnable is false for transactions that undo or move other transactions,
+// which say nothing about how the user categorizes.
+func Learnable(splits []*transaction.Split) bool {
+	for _, prefix := range []string{ReversalMemoPrefix, VoidMemoPrefix, ReclassifyMemoPrefix} {
+		if len(splits) > 0 && strings.HasPrefix(splits[0].Memo, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// trainCategorizer teaches the user's Categorizer in l a newly committed
+// transaction. It must be called in the transaction that commits splits, so
+// no transaction is learned twice or missed. Only the counts of the
+// transaction's two accounts are read and written.
+func trainCategorizer(l storage.Ledger, splits []*transaction.Split) error {
+	if len(splits) != 2 || !Learnable(splits) || splits[0].Account == splits[1].Account {
+		return nil
+	}
+
+	accounts := []int64{splits[0].Account, splits[1].Account}
+	counts, err := l.CategorizerCounts(accounts)
+	if err != nil {
+		return err
+	}
+
+	k := transaction.NewCategorizer()
+	for i, account := range accounts {
+		k.AddCounts(account, &counts[i])
+	}
+	k.TrainTransaction(splits)
+	trained := make([]*transaction.CategorizerCounts, len(accounts))
+	for i, account := range accounts {
+		trained[i] = k.Counts(account)
+	}
+	return l.PutCategorizerCounts(accounts, trained)
+}
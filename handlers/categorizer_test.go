@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/cjc25/ae_money/storage"
+	"github.com/cjc25/ae_money/transaction"
+)
+
+// examplesOrDie gets the number of examples testUser's Categorizer in s has
+// learned for each of counters.
+func examplesOrDie(t *testing.T, s storage.Store, counters ...int64) []int64 {
+	counts, err := s.Ledger(testUser).CategorizerCounts(counters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	examples := make([]int64, len(counts))
+	for i := range counts {
+		examples[i] = counts[i].Examples
+	}
+	return examples
+}
+
+func TestLearnable(t *testing.T) {
+	for _, x := range []struct {
+		memo      string
+		learnable bool
+	}{
+		{"Trader Joe's", true},
+		{ReversalMemoPrefix + "Trader Joe's", false},
+		{VoidMemoPrefix + "Trader Joe's", false},
+		{ReclassifyMemoPrefix + "Groceries", false},
+	} {
+		if got := Learnable([]*transaction.Split{{Memo: x.memo}}); got != x.learnable {
+			t.Errorf("Expected %q learnable to be %v, got %v", x.memo, x.learnable, got)
+		}
+	}
+}
+
+func TestPutTransaction_TrainsCategorizer(t *testing.T) {
+	s := storage.NewMemoryStore()
+	ids := addAccountsOrDie(t, s, transaction.Account{Name: "Checking"}, transaction.Account{Name: "Groceries"})
+
+	if err := CommitTransaction(s, testUser, "t1", []*transaction.Split{
+		{Amount: -5000, Account: ids[0], Memo: "Trader Joe's"},
+		{Amount: 5000, Account: ids[1], Memo: "Trader Joe's"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if got := examplesOrDie(t, s, ids...); got[0] != 1 || got[1] != 1 {
+		t.Errorf("Expected 1 example for each account, got %v", got)
+	}
+
+	if err := CommitTransaction(s, testUser, "t2", []*transaction.Split{
+		{Amount: 5000, Account: ids[0], Memo: VoidMemoPrefix + "Trader Joe's"},
+		{Amount: -5000, Account: ids[1], Memo: VoidMemoPrefix + "Trader Joe's"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if got := examplesOrDie(t, s, ids...); got[0] != 1 || got[1] != 1 {
+		t.Errorf("Expected voids not to be learned, got %v", got)
+	}
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/cjc25/ae_money/storage"
+	"github.com/cjc25/ae_money/transaction"
+)
+
+// appendChainLink adds the transaction with id transactionID to the user's
+// hash chain in l. It must be called in the transaction that commits splits,
+// so the chain can't fork.
+func appendChainLink(l storage.Ledger, transactionID string, splits []*transaction.Split) error {
+	head, err := l.ChainHead()
+	if err != nil {
+		return err
+	}
+	link := head.Next(transactionID, splits)
+	return l.PutChainLink(head, link)
+}
+
+// VerifyChain walks the logged in user's hash chain, recomputing each link
+// from the stored Splits, and prints a transaction.ChainReport with the first
+// break, if any.
+func VerifyChain(p *Params) {
+	w := p.W
+
+	// Read everything in one transaction so a concurrent commit can't look like
+	// a break.
+	var report *transaction.ChainReport
+	err := p.S.RunInTransaction(p.User, func(l storage.Ledger) error {
+		head, err := l.ChainHead()
+		if err != nil {
+			return err
+		}
+		links, err := l.ChainLinks()
+		if err != nil {
+			return err
+		}
+		ids, splits, err := l.Splits()
+		if err != nil {
+			return err
+		}
+		byTransaction := make(map[string][]*transaction.Split)
+		for i := range splits {
+			byTransaction[ids[i]] = append(byTransaction[ids[i]], &splits[i])
+		}
+
+		report = transaction.VerifyChain(*head, links, byTransaction)
+		return nil
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	e := json.NewEncoder(w)
+	if err := e.Encode(report); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
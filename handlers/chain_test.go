@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/cjc25/ae_money/storage"
+	"github.com/cjc25/ae_money/transaction"
+)
+
+// verifyTestChainOrDie runs VerifyChain for testUser in s.
+func verifyTestChainOrDie(t *testing.T, s storage.Store) *transaction.ChainReport {
+	p, w := newTestParams(s, "", nil)
+	VerifyChain(p)
+
+	expectCode(t, http.StatusOK, w)
+	var report transaction.ChainReport
+	if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	return &report
+}
+
+func TestVerifyChain_Empty(t *testing.T) {
+	s := storage.NewMemoryStore()
+
+	report := verifyTestChainOrDie(t, s)
+	if report.Length != 0 || report.Break != nil || len(report.Unchained) != 0 {
+		t.Errorf("Expected an empty chain, got %+v", report)
+	}
+}
+
+func TestVerifyChain_Success(t *testing.T) {
+	s := storage.NewMemoryStore()
+	ids := addAccountsOrDie(t, s, transaction.Account{Name: "a1"}, transaction.Account{Name: "a2"})
+	for _, id := range []string{"t1", "t2"} {
+		if err := CommitTransaction(s, testUser, id, []*transaction.Split{
+			{Amount: -123, Account: ids[0]},
+			{Amount: 123, Account: ids[1]},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report := verifyTestChainOrDie(t, s)
+	if report.Length != 2 || report.Break != nil || len(report.Unchained) != 0 {
+		t.Errorf("Expected an unbroken chain of 2, got %+v", report)
+	}
+}
+
+func TestVerifyChain_FailureChangedSplit(t *testing.T) {
+	s := storage.NewMemoryStore()
+	ids := addAccountsOrDie(t, s, transaction.Account{Name: "a1"}, transaction.Account{Name: "a2"})
+	if err := CommitTransaction(s, testUser, "t1", []*transaction.Split{
+		{Amount: -123, Account: ids[0], Memo: "Test"},
+		{Amount: 123, Account: ids[1], Memo: "Test"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	l := s.Ledger(testUser)
+	splits, err := l.TransactionSplits("t1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	splits[0].Memo = "Changed"
+	if err := l.PutSplits("t1", splits); err != nil {
+		t.Fatal(err)
+	}
+
+	report := verifyTestChainOrDie(t, s)
+	if report.Break == nil || report.Break.Transaction != "t1" {
+		t.Errorf("Expected a break at t1, got %+v", report)
+	}
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"sort"
+	"time"
+
+	"github.com/cjc25/ae_money/storage"
+	"github.com/cjc25/ae_money/transaction"
+)
+
+// duplicateWindowDays is transaction.DuplicateWindow in whole days.
+const duplicateWindowDays = int(transaction.DuplicateWindow / (24 * time.Hour))
+
+// A DuplicateReport lists the existing transactions that a new one might
+// duplicate. If Skipped is true, one of them has the same ExternalID, so the
+// new one wasn't committed.
+type DuplicateReport struct {
+	Skipped    bool                    `json:"skipped"`
+	Duplicates []transaction.Duplicate `json:"duplicates"`
+}
+
+// FindDuplicates looks for existing transactions in l that are likely
+// duplicates of a new one made of splits, by comparing each of splits with the
+// existing Splits in its Account within transaction.DuplicateWindow. Each
+// transaction is reported once, with its best score.
+func FindDuplicates(l storage.Ledger, splits []*transaction.Split) (*DuplicateReport, error) {
+	report := &DuplicateReport{Duplicates: make([]transaction.Duplicate, 0)}
+	best := make(map[string]int)
+	for _, s := range splits {
+		existing := make([]transaction.Split, 0)
+		ids := make([]string, 0)
+		seen := make(map[string]bool)
+		add := func(foundIDs []string, found []transaction.Split) {
+			for i := range foundIDs {
+				if !seen[foundIDs[i]] {
+					seen[foundIDs[i]] = true
+					existing = append(existing, found[i])
+					ids = append(ids, foundIDs[i])
+				}
+			}
+		}
+
+		foundIDs, found, err := l.AccountSplitsBetween(s.Account,
+			s.Date.AddDate(0, 0, -duplicateWindowDays), s.Date.AddDate(0, 0, duplicateWindowDays))
+		if err != nil {
+			return nil, err
+		}
+		add(foundIDs, found)
+		// Banks can date the same transaction differently in each export.
+		if s.ExternalID != "" {
+			foundIDs, found, err := l.AccountSplitsWithExternalID(s.Account, s.ExternalID)
+			if err != nil {
+				return nil, err
+			}
+			add(foundIDs, found)
+		}
+
+		for _, d := range transaction.FindDuplicates(s, existing, ids) {
+			if s.ExternalID != "" && d.Split.ExternalID == s.ExternalID {
+				report.Skipped = true
+			}
+			if i, ok := best[d.Transaction]; ok {
+				if d.Score > report.Duplicates[i].Score {
+					report.Duplicates[i] = d
+				}
+				continue
+			}
+			best[d.Transaction] = len(report.Duplicates)
+			report.Duplicates = append(report.Duplicates, d)
+		}
+	}
+
+	sort.SliceStable(report.Duplicates, func(i, j int) bool {
+		return report.Duplicates[i].Score > report.Duplicates[j].Score
+	})
+	return report, nil
+}
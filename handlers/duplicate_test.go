@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cjc25/ae_money/storage"
+	"github.com/cjc25/ae_money/transaction"
+)
+
+// Expectation function for the DuplicateReport printed by NewTransaction.
+func expectDuplicateReport(t *testing.T, w *httptest.ResponseRecorder, code int, skipped bool, duplicates int) {
+	expectCode(t, code, w)
+	var report DuplicateReport
+	if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Skipped != skipped || len(report.Duplicates) != duplicates {
+		t.Errorf("Expected skipped %v with %v duplicates, got %+v", skipped, duplicates, report)
+	}
+}
+
+func TestFindDuplicates(t *testing.T) {
+	s := storage.NewMemoryStore()
+	ids := addAccountsOrDie(t, s, transaction.Account{Name: "Checking"}, transaction.Account{Name: "Groceries"})
+	date := transaction.Date{Year: 2014, Month: 11, Day: 5}
+	if err := CommitTransaction(s, testUser, "t1", []*transaction.Split{
+		{Amount: -5000, Account: ids[0], Memo: "Trader Joe's", Date: date},
+		{Amount: 5000, Account: ids[1], Memo: "Trader Joe's", Date: date},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := FindDuplicates(s.Ledger(testUser), []*transaction.Split{
+		{Amount: -5000, Account: ids[0], Memo: "TRADER JOE'S #123", Date: date.AddDate(0, 0, 1)},
+		{Amount: 5000, Account: ids[1], Memo: "TRADER JOE'S #123", Date: date.AddDate(0, 0, 1)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Skipped || len(report.Duplicates) != 1 || report.Duplicates[0].Transaction != "t1" {
+		t.Errorf("Expected t1 to be reported once, got %+v", report)
+	}
+}
+
+func TestNewTransaction_FailureLikelyDuplicate(t *testing.T) {
+	s := storage.NewMemoryStore()
+	ids := addAccountsOrDie(t, s, transaction.Account{Name: "Checking"}, transaction.Account{Name: "Groceries"})
+	newTestTransaction(t, s, &TransactionRequest{
+		Amounts:  []transaction.AmountType{-5000, 5000},
+		Accounts: ids,
+		Memo:     "Trader Joe's",
+		Date:     "2014-11-05",
+	})
+
+	request := &TransactionRequest{
+		Amounts:  []transaction.AmountType{-5000, 5000},
+		Accounts: ids,
+		Memo:     "TRADER JOE'S #123",
+		Date:     "2014-11-06",
+	}
+	w := newTestTransaction(t, s, request)
+
+	expectDuplicateReport(t, w, http.StatusConflict, false, 1)
+	if got := transactionsOrDie(t, s); len(got) != 1 {
+		t.Errorf("Expected duplicate not to be committed, got %v", got)
+	}
+
+	request.Confirm = true
+	w = newTestTransaction(t, s, request)
+
+	expectCode(t, http.StatusOK, w)
+	if got := transactionsOrDie(t, s); len(got) != 2 {
+		t.Errorf("Expected confirmed duplicate to be committed, got %v", got)
+	}
+}
+
+func TestNewTransaction_SkipsExternalIDDuplicate(t *testing.T) {
+	s := storage.NewMemoryStore()
+	ids := addAccountsOrDie(t, s, transaction.Account{Name: "Checking"}, transaction.Account{Name: "Groceries"})
+	request := &TransactionRequest{
+		Amounts:    []transaction.AmountType{-5000, 5000},
+		Accounts:   ids,
+		Memo:       "TRADER JOE'S #123",
+		Date:       "2014-11-05",
+		ExternalID: "bank-1",
+	}
+	w := newTestTransaction(t, s, request)
+	expectCode(t, http.StatusOK, w)
+
+	// The bank dated it differently in the next export, but it's the same.
+	request.Date = "2014-11-20"
+	request.Confirm = true
+	w = newTestTransaction(t, s, request)
+
+	expectDuplicateReport(t, w, http.StatusOK, true, 1)
+	if got := transactionsOrDie(t, s); len(got) != 1 {
+		t.Errorf("Expected only the first import, got %v", got)
+	}
+}
@@ -0,0 +1,31 @@
+// Package handlers serves the ae_money API on any storage.Store, so the App
+// Engine app and package server share one implementation. Each handler takes
+// Params, which its caller fills in from the request however it identifies
+// users and keeps ledgers.
+//
+// Some handlers take a function to call in the same transaction as their own
+// changes, so callers can keep their own entities in step with the Ledger.
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/cjc25/ae_money/storage"
+)
+
+// Params is used to pass gorilla/mux components, the logged in user and where
+// their ledger is kept to a request handler.
+type Params struct {
+	W http.ResponseWriter
+	R *http.Request
+	// V are the gorilla/mux vars.
+	V map[string]string
+	// S is where ledgers are kept, and User identifies the logged in user's.
+	S    storage.Store
+	User string
+}
+
+// Ledger gets the logged in user's storage.Ledger.
+func (p *Params) Ledger() storage.Ledger {
+	return p.S.Ledger(p.User)
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cjc25/ae_money/storage"
+	"github.com/cjc25/ae_money/transaction"
+)
+
+const testUser = "test@example.com"
+
+// newTestParams makes Params for testUser's ledger in s, with body as the
+// request body and v as the gorilla/mux vars.
+func newTestParams(s storage.Store, body string, v map[string]string) (*Params, *httptest.ResponseRecorder) {
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("POST", "/", bytes.NewBufferString(body))
+	return &Params{W: w, R: r, V: v, S: s, User: testUser}, w
+}
+
+// addAccountsOrDie adds accounts to testUser's Ledger in s, and returns their
+// ids.
+func addAccountsOrDie(t *testing.T, s storage.Store, accounts ...transaction.Account) []int64 {
+	ids := make([]int64, len(accounts))
+	for i := range accounts {
+		id, err := s.Ledger(testUser).AddAccount(&accounts[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[i] = id
+	}
+	return ids
+}
+
+// newTestTransaction runs NewTransaction on request for testUser in s.
+func newTestTransaction(t *testing.T, s storage.Store, request *TransactionRequest) *httptest.ResponseRecorder {
+	body, err := json.Marshal(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, w := newTestParams(s, string(body), nil)
+	NewTransaction(p)
+	return w
+}
+
+// Expectation function for HTTP response codes.
+func expectCode(t *testing.T, expected int, w *httptest.ResponseRecorder) {
+	if expected != w.Code {
+		t.Errorf("Expected code %v, got %v: %v", expected, w.Code, w.Body.String())
+	}
+}
+
+// Expectation function for HTTP response bodies.
+func expectBody(t *testing.T, expected string, w *httptest.ResponseRecorder) {
+	got := strings.TrimSpace(w.Body.String())
+	if expected != got {
+		t.Errorf("Expected body \"%v\", got \"%v\"", expected, got)
+	}
+}
+
+func TestParamsLedger(t *testing.T) {
+	s := storage.NewMemoryStore()
+	ids := addAccountsOrDie(t, s, transaction.Account{Name: "a1"})
+
+	p, _ := newTestParams(s, "", nil)
+	if _, err := p.Ledger().Account(ids[0]); err != nil {
+		t.Errorf("Expected testUser's account, got %v", err)
+	}
+	p.User = "other@example.com"
+	if _, err := p.Ledger().Account(ids[0]); err != storage.ErrNoSuchEntity {
+		t.Errorf("Expected ErrNoSuchEntity for another user, got %v", err)
+	}
+}
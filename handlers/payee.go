@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"fmt"
+
+	"github.com/cjc25/ae_money/storage"
+	"github.com/cjc25/ae_money/transaction"
+)
+
+// applyPayee fills in request from its Payee in l, which is matched from the
+// memo if request doesn't name one. See TransactionRequest.
+//
+// If request named its Payee, it returns true, so the memo can be added as an
+// alias when the transaction is committed. Matched Payees already have the
+// memo, and are set in request.Payee.
+func applyPayee(l storage.Ledger, request *TransactionRequest) (bool, error) {
+	named := request.Payee != 0
+	var payee *transaction.Payee
+	if named {
+		var err error
+		if payee, err = l.Payee(request.Payee); err != nil {
+			return false, fmt.Errorf("Can't find payee %v: %v", request.Payee, err)
+		}
+	} else {
+		ids, payees, err := l.Payees()
+		if err != nil {
+			return false, err
+		}
+		i := transaction.MatchPayee(payees, request.Memo)
+		if i < 0 {
+			return false, nil
+		}
+		payee = &payees[i]
+		request.Payee = ids[i]
+	}
+
+	if request.Memo == "" {
+		request.Memo = payee.DefaultMemo
+	}
+	if request.Memo == "" {
+		request.Memo = payee.Name
+	}
+	if len(request.Accounts) == 1 && request.Weights == nil && payee.DefaultAccount != 0 {
+		request.Accounts = append(request.Accounts, payee.DefaultAccount)
+		request.Amounts = append(request.Amounts, -request.Amounts[0])
+	}
+	return named, nil
+}
+
+// addPayeeAlias adds memo to the aliases of the Payee with id in l, if it
+// isn't one already.
+func addPayeeAlias(l storage.Ledger, id int64, memo string) error {
+	payee, err := l.Payee(id)
+	if err != nil {
+		return err
+	}
+	if !payee.AddAlias(memo) {
+		return nil
+	}
+	return l.PutPayee(id, payee)
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/cjc25/ae_money/storage"
+	"github.com/cjc25/ae_money/transaction"
+)
+
+func TestNewTransaction_MatchesPayee(t *testing.T) {
+	s := storage.NewMemoryStore()
+	ids := addAccountsOrDie(t, s, transaction.Account{Name: "Checking"}, transaction.Account{Name: "Groceries"})
+	payee, err := s.Ledger(testUser).AddPayee(&transaction.Payee{
+		Name:           "Trader Joe's",
+		DefaultAccount: ids[1],
+		Aliases:        []string{"TRADER JOE'S #123"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := newTestTransaction(t, s, &TransactionRequest{
+		Amounts:  []transaction.AmountType{-5000},
+		Accounts: ids[:1],
+		Memo:     "TRADER JOE'S #123",
+		Date:     "2014-11-05",
+	})
+
+	expectCode(t, http.StatusOK, w)
+	// Splits come back in no particular order, so look for the counter split.
+	for _, x := range transactionsOrDie(t, s) {
+		counter := -1
+		for i := range x {
+			if x[i].Account == ids[1] {
+				counter = i
+			}
+		}
+		if len(x) != 2 || counter < 0 || x[counter].Amount != 5000 || x[0].Payee != payee || x[1].Payee != payee {
+			t.Errorf("Expected a split to the default account with the payee, got %+v", x)
+		}
+	}
+}
+
+func TestNewTransaction_AddsPayeeAlias(t *testing.T) {
+	s := storage.NewMemoryStore()
+	ids := addAccountsOrDie(t, s, transaction.Account{Name: "Checking"}, transaction.Account{Name: "Groceries"})
+	l := s.Ledger(testUser)
+	payee, err := l.AddPayee(&transaction.Payee{Name: "Trader Joe's"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := newTestTransaction(t, s, &TransactionRequest{
+		Amounts:  []transaction.AmountType{-5000, 5000},
+		Accounts: ids,
+		Payee:    payee,
+		Memo:     "TRADER JOE'S #123",
+		Date:     "2014-11-05",
+	})
+
+	expectCode(t, http.StatusOK, w)
+	p, err := l.Payee(payee)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Aliases) != 1 || p.Aliases[0] != "TRADER JOE'S #123" {
+		t.Errorf("Expected the memo to be added as an alias, got %v", p.Aliases)
+	}
+}
+
+func TestNewTransaction_FailureNoSuchPayee(t *testing.T) {
+	s := storage.NewMemoryStore()
+	ids := addAccountsOrDie(t, s, transaction.Account{Name: "Checking"}, transaction.Account{Name: "Groceries"})
+
+	w := newTestTransaction(t, s, &TransactionRequest{
+		Amounts:  []transaction.AmountType{-5000, 5000},
+		Accounts: ids,
+		Payee:    1234,
+		Date:     "2014-11-05",
+	})
+
+	expectCode(t, http.StatusBadRequest, w)
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"github.com/cjc25/ae_money/storage"
+	"github.com/cjc25/ae_money/transaction"
+)
+
+// ReclassifyMemoPrefix starts the memo of transactions which move existing
+// transactions to a Rule's counter account. Rules never match them.
+const ReclassifyMemoPrefix = "Reclassify: "
+
+// ApplyRules fills in request from the user's Rules in l. They're matched
+// against the first split, which funds the transaction. The counter account is
+// only used if the request has just the funding split, and the payee only if
+// the request doesn't have one. Tags are added to the request's.
+//
+// New transactions from anywhere, like imports, should go through this so
+// they're categorized the same way.
+func ApplyRules(l storage.Ledger, request *TransactionRequest) error {
+	if len(request.Accounts) == 0 {
+		return nil
+	}
+	_, rules, err := l.Rules()
+	if err != nil {
+		return err
+	}
+
+	result := transaction.ApplyRules(rules, &transaction.Split{
+		Amount:  request.Amounts[0],
+		Account: request.Accounts[0],
+		Memo:    request.Memo,
+	})
+	if result == nil {
+		return nil
+	}
+
+	if len(request.Accounts) == 1 && request.Weights == nil && result.CounterAccount != 0 {
+		request.Accounts = append(request.Accounts, result.CounterAccount)
+		request.Amounts = append(request.Amounts, -request.Amounts[0])
+	}
+	if request.Payee == 0 {
+		request.Payee = result.Payee
+	}
+	request.Tags = transaction.MergeTags(request.Tags, result.Tags)
+	return nil
+}
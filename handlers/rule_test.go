@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/cjc25/ae_money/storage"
+	"github.com/cjc25/ae_money/transaction"
+)
+
+func TestApplyRules(t *testing.T) {
+	s := storage.NewMemoryStore()
+	ids := addAccountsOrDie(t, s, transaction.Account{Name: "Checking"}, transaction.Account{Name: "Coffee"})
+	l := s.Ledger(testUser)
+	for _, r := range []transaction.Rule{
+		{Name: "b", Priority: 1, Memo: "coffee", CounterAccount: ids[1], Tags: []string{"b"}},
+		{Name: "a", Priority: 1, Memo: "coffee", Tags: []string{"a"}},
+	} {
+		if _, err := l.AddRule(&r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	request := &TransactionRequest{
+		Amounts:  []transaction.AmountType{-400},
+		Accounts: ids[:1],
+		Memo:     "Blue Bottle Coffee",
+		Tags:     []string{"mine"},
+	}
+	if err := ApplyRules(l, request); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(request.Accounts) != 2 || request.Accounts[1] != ids[1] || request.Amounts[1] != 400 {
+		t.Errorf("Expected a counter split to Coffee, got %v %v", request.Accounts, request.Amounts)
+	}
+	if len(request.Tags) != 3 {
+		t.Errorf("Expected both rules' tags to be merged, got %v", request.Tags)
+	}
+}
+
+func TestApplyRules_KeepsRequestedCounterAccount(t *testing.T) {
+	s := storage.NewMemoryStore()
+	ids := addAccountsOrDie(t, s, transaction.Account{Name: "Checking"}, transaction.Account{Name: "Coffee"},
+		transaction.Account{Name: "Gifts"})
+	l := s.Ledger(testUser)
+	if _, err := l.AddRule(&transaction.Rule{Name: "a", Memo: "coffee", CounterAccount: ids[1]}); err != nil {
+		t.Fatal(err)
+	}
+
+	request := &TransactionRequest{
+		Amounts:  []transaction.AmountType{-400, 400},
+		Accounts: []int64{ids[0], ids[2]},
+		Memo:     "Blue Bottle Coffee",
+	}
+	if err := ApplyRules(l, request); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(request.Accounts) != 2 || request.Accounts[1] != ids[2] {
+		t.Errorf("Expected the requested counter account to be kept, got %v", request.Accounts)
+	}
+}
@@ -0,0 +1,302 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"code.google.com/p/go-uuid/uuid"
+
+	"github.com/cjc25/ae_money/storage"
+	"github.com/cjc25/ae_money/transaction"
+)
+
+// Memo prefixes of the transactions made by ReverseTransaction and
+// VoidTransaction.
+const (
+	ReversalMemoPrefix = "Reversal: "
+	VoidMemoPrefix     = "Void: "
+)
+
+// TransactionRequest is for JSON marshalling and unmarshalling of
+// NewTransaction request bodies.
+//
+// Weights is optional. If present, it parallels Accounts, and the Accounts
+// with a nonzero weight share whatever balances the other Amounts in
+// proportion to their weights, like percentages. See
+// transaction.AllocateBalance.
+//
+// Payee is also optional, and is matched from Memo if it's missing. The
+// Payee's DefaultMemo fills in a missing Memo, and if only the funding Account
+// is given, a counter-split to the Payee's DefaultAccount is added.
+//
+// The user's Rules are then applied to the funding split, filling in whatever
+// the Payee didn't. See ApplyRules.
+//
+// ExternalID is the bank's id for the funding split, for imports. A request
+// that looks like a duplicate of an existing transaction isn't committed
+// unless Confirm is set, but one with the same ExternalID never is. See
+// FindDuplicates.
+type TransactionRequest struct {
+	Amounts    []transaction.AmountType `json:"amounts"`
+	Accounts   []int64                  `json:"accounts"`
+	Weights    []int64                  `json:"weights,omitempty"`
+	Payee      int64                    `json:"payee,omitempty"`
+	Tags       []string                 `json:"tags,omitempty"`
+	Memo       string                   `json:"memo"`
+	Date       string                   `json:"date"`
+	ExternalID string                   `json:"externalId,omitempty"`
+	Confirm    bool                     `json:"confirm,omitempty"`
+}
+
+// NewTransaction verifies that a transaction is valid, and if so commits all
+// or none of the Splits to the relevant Accounts.
+//
+// If the transaction might be a duplicate, nothing is committed, and a
+// DuplicateReport is printed instead: with a 409 if the request can be
+// confirmed, or as skipped if it has the same ExternalID as an existing
+// transaction.
+func NewTransaction(p *Params) {
+	w, r := p.W, p.R
+
+	d := json.NewDecoder(r.Body)
+	var request TransactionRequest
+	if err := d.Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if len(request.Amounts) != len(request.Accounts) {
+		http.Error(w, "Amounts and accounts of different lengths", http.StatusBadRequest)
+		return
+	}
+	if len(request.Accounts) == 0 {
+		http.Error(w, "No accounts", http.StatusBadRequest)
+		return
+	}
+
+	l := p.Ledger()
+	memo := request.Memo
+	named, err := applyPayee(l, &request)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := ApplyRules(l, &request); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if request.Weights != nil {
+		amounts, err := transaction.AllocateBalance(request.Amounts, request.Weights)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		request.Amounts = amounts
+	}
+
+	date, err := transaction.ParseDate(request.Date)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	transactionID := uuid.NewRandom().String()
+	splits := make([]*transaction.Split, len(request.Accounts))
+	for i := range request.Accounts {
+		splits[i] = &transaction.Split{
+			Amount:  request.Amounts[i],
+			Account: request.Accounts[i],
+			Memo:    request.Memo,
+			Date:    date,
+			Payee:   request.Payee,
+			Tags:    request.Tags,
+		}
+	}
+	splits[0].ExternalID = request.ExternalID
+
+	// Look for duplicates in the transaction that commits, so two imports of
+	// the same ExternalID can't both miss each other.
+	var report *DuplicateReport
+	err = p.S.RunInTransaction(p.User, func(l storage.Ledger) error {
+		var err error
+		report, err = FindDuplicates(l, splits)
+		if err != nil {
+			return err
+		}
+		if report.Skipped || (len(report.Duplicates) != 0 && !request.Confirm) {
+			return nil
+		}
+		report = nil
+
+		if err := PutTransaction(l, transactionID, splits); err != nil {
+			return err
+		}
+		if !named {
+			return nil
+		}
+		return addPayeeAlias(l, request.Payee, memo)
+	})
+	if err != nil {
+		// TODO(cjc25): This might not be a 400: if e.g. the database failed it
+		// should be a 500. Interpret err and return the right thing.
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if report != nil {
+		if !report.Skipped {
+			w.WriteHeader(http.StatusConflict)
+		}
+		e := json.NewEncoder(w)
+		if err := e.Encode(report); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+// PutTransaction validates splits as a transaction, and if it's valid,
+// commits them to their Accounts in l under transactionID. It's for callers
+// already in a transaction, so they can make other changes atomically with the
+// Splits. The transaction is also appended to the user's hash chain, and
+// taught to their Categorizer. Splits without a creation time are stamped
+// with the current time.
+//
+// l can take several PutTransactions in one transaction, so a Ledger must
+// read back the Accounts, chain head and categorizer counts it wrote, even
+// where its store doesn't let a transaction see its own writes.
+func PutTransaction(l storage.Ledger, transactionID string, splits []*transaction.Split) error {
+	if err := storage.PutTransaction(l, transactionID, splits); err != nil {
+		return err
+	}
+	if err := appendChainLink(l, transactionID, splits); err != nil {
+		return err
+	}
+	return trainCategorizer(l, splits)
+}
+
+// CommitTransaction is PutTransaction in its own transaction, so all or none
+// of splits are committed to user's Accounts in s.
+func CommitTransaction(s storage.Store, user, transactionID string, splits []*transaction.Split) error {
+	return s.RunInTransaction(user, func(l storage.Ledger) error {
+		return PutTransaction(l, transactionID, splits)
+	})
+}
+
+// reversalNamespace namespaces the ids that reversalID derives.
+var reversalNamespace = uuid.Parse("8b91ecbc-1f81-48e6-8582-804358ce747e")
+
+// Errors for transactions that reverseTransaction refuses to undo.
+var (
+	errAlreadyReversed = errors.New("Transaction was already reversed or voided")
+	errIsReversal      = errors.New("Can't undo a reversal or void")
+)
+
+// reversalID gets the id of the transaction which reverses or voids the
+// transaction with id transactionID. It's derived from the original's, so a
+// transaction can only be undone once.
+func reversalID(transactionID string) string {
+	return uuid.NewSHA1(reversalNamespace, []byte(transactionID)).String()
+}
+
+// isReversal is true if splits reverse or void another transaction.
+func isReversal(splits []*transaction.Split) bool {
+	for _, prefix := range []string{ReversalMemoPrefix, VoidMemoPrefix} {
+		if len(splits) > 0 && strings.HasPrefix(splits[0].Memo, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// reverseTransaction commits a new transaction which undoes the transaction
+// identified by the gorilla/mux vars, and prints its id as JSON. Each new
+// Split's memo is prefixed with memoPrefix, and its date is computed from the
+// original's. The original transaction is left alone, so the hash chain only
+// grows. If also isn't nil, it's called with the original's id in the same
+// transaction. It returns true if the new transaction was committed.
+//
+// A transaction that was already reversed or voided, or that reverses or
+// voids another, is a 409: undoing it again would add another offsetting
+// entry to the chain.
+func reverseTransaction(p *Params, memoPrefix string, date func(original transaction.Date) transaction.Date, also func(l storage.Ledger, transactionID string) error) bool {
+	w, v := p.W, p.V
+
+	transactionID := reversalID(v["id"])
+	err := p.S.RunInTransaction(p.User, func(l storage.Ledger) error {
+		original, err := l.TransactionSplits(v["id"])
+		if err != nil {
+			return err
+		}
+		if len(original) == 0 {
+			return storage.ErrNoSuchEntity
+		}
+		if isReversal(original) {
+			return errIsReversal
+		}
+		existing, err := l.TransactionSplits(transactionID)
+		if err != nil {
+			return err
+		}
+		if len(existing) != 0 {
+			return errAlreadyReversed
+		}
+
+		splits := make([]*transaction.Split, len(original))
+		for i, s := range original {
+			splits[i] = &transaction.Split{
+				Amount:  -s.Amount,
+				Account: s.Account,
+				Memo:    memoPrefix + s.Memo,
+				Date:    date(s.Date),
+			}
+		}
+		if err := PutTransaction(l, transactionID, splits); err != nil {
+			return err
+		}
+		if also == nil {
+			return nil
+		}
+		return also(l, v["id"])
+	})
+	if err == storage.ErrNoSuchEntity {
+		w.WriteHeader(http.StatusNotFound)
+		return false
+	}
+	if err == errAlreadyReversed || err == errIsReversal {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+
+	e := json.NewEncoder(w)
+	if err := e.Encode(map[string]string{"id": transactionID}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+	return true
+}
+
+// ReverseTransaction undoes a transaction with a new one dated today, for
+// mistakes that are discovered after the fact. Today is the user's, in their
+// time zone. The id of the new transaction is printed as JSON.
+func ReverseTransaction(p *Params, today transaction.Date) {
+	reverseTransaction(p, ReversalMemoPrefix, func(transaction.Date) transaction.Date {
+		return today
+	}, nil)
+}
+
+// VoidTransaction undoes a transaction with a new one on the same date, as if
+// the original never happened. The id of the new transaction is printed as
+// JSON. If also isn't nil, it's called with the original's id in the same
+// transaction, to void whatever the caller keeps alongside it. It returns
+// true if the transaction was voided.
+func VoidTransaction(p *Params, also func(l storage.Ledger, transactionID string) error) bool {
+	return reverseTransaction(p, VoidMemoPrefix, func(original transaction.Date) transaction.Date {
+		return original
+	}, also)
+}
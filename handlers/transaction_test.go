@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/cjc25/ae_money/storage"
+	"github.com/cjc25/ae_money/transaction"
+)
+
+// transactionsOrDie gets testUser's Splits in s, grouped by transaction id.
+func transactionsOrDie(t *testing.T, s storage.Store) map[string][]transaction.Split {
+	ids, splits, err := s.Ledger(testUser).Splits()
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := make(map[string][]transaction.Split)
+	for i := range splits {
+		result[ids[i]] = append(result[ids[i]], splits[i])
+	}
+	return result
+}
+
+// voidTestTransaction runs VoidTransaction on the transaction with id for
+// testUser in s.
+func voidTestTransaction(s storage.Store, id string, also func(storage.Ledger, string) error) (bool, int) {
+	p, w := newTestParams(s, "", map[string]string{"id": id})
+	voided := VoidTransaction(p, also)
+	return voided, w.Code
+}
+
+func TestNewTransaction_Success(t *testing.T) {
+	s := storage.NewMemoryStore()
+	ids := addAccountsOrDie(t, s, transaction.Account{Name: "a1"}, transaction.Account{Name: "a2"})
+
+	w := newTestTransaction(t, s, &TransactionRequest{
+		Amounts:  []transaction.AmountType{-123, 123},
+		Accounts: ids,
+		Memo:     "Test",
+		Date:     "2014-11-01",
+	})
+
+	expectCode(t, http.StatusOK, w)
+	expectBody(t, "", w)
+	if got := transactionsOrDie(t, s); len(got) != 1 {
+		t.Errorf("Expected 1 transaction, got %v", got)
+	}
+}
+
+func TestNewTransaction_FailureUnbalanced(t *testing.T) {
+	s := storage.NewMemoryStore()
+	ids := addAccountsOrDie(t, s, transaction.Account{Name: "a1"}, transaction.Account{Name: "a2"})
+
+	w := newTestTransaction(t, s, &TransactionRequest{
+		Amounts:  []transaction.AmountType{-123, 124},
+		Accounts: ids,
+		Date:     "2014-11-01",
+	})
+
+	expectCode(t, http.StatusBadRequest, w)
+	if got := transactionsOrDie(t, s); len(got) != 0 {
+		t.Errorf("Expected nothing committed, got %v", got)
+	}
+}
+
+func TestCommitTransaction(t *testing.T) {
+	s := storage.NewMemoryStore()
+	ids := addAccountsOrDie(t, s, transaction.Account{Name: "a1"}, transaction.Account{Name: "a2"})
+
+	err := CommitTransaction(s, testUser, "t1", []*transaction.Split{
+		{Amount: -123, Account: ids[0]},
+		{Amount: 123, Account: ids[1]},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	head, err := s.Ledger(testUser).ChainHead()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head.Seq != 1 {
+		t.Errorf("Expected the transaction to be chained, got head %+v", head)
+	}
+}
+
+func TestReverseTransaction(t *testing.T) {
+	s := storage.NewMemoryStore()
+	ids := addAccountsOrDie(t, s, transaction.Account{Name: "a1"}, transaction.Account{Name: "a2"})
+	if err := CommitTransaction(s, testUser, "t1", []*transaction.Split{
+		{Amount: -123, Account: ids[0], Memo: "Test", Date: transaction.Date{Year: 2014, Month: 11, Day: 1}},
+		{Amount: 123, Account: ids[1], Memo: "Test", Date: transaction.Date{Year: 2014, Month: 11, Day: 1}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	today := transaction.Date{Year: 2014, Month: 12, Day: 25}
+	p, w := newTestParams(s, "", map[string]string{"id": "t1"})
+	ReverseTransaction(p, today)
+
+	expectCode(t, http.StatusOK, w)
+	var result map[string]string
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	reversal := transactionsOrDie(t, s)[result["id"]]
+	if len(reversal) != 2 {
+		t.Fatalf("Expected a 2 split reversal, got %v", reversal)
+	}
+	for _, x := range reversal {
+		if x.Date != today || !strings.HasPrefix(x.Memo, ReversalMemoPrefix) {
+			t.Errorf("Expected a reversal dated %v, got %+v", today, x)
+		}
+	}
+}
+
+func TestVoidTransaction_CallsAlso(t *testing.T) {
+	s := storage.NewMemoryStore()
+	ids := addAccountsOrDie(t, s, transaction.Account{Name: "a1"}, transaction.Account{Name: "a2"})
+	if err := CommitTransaction(s, testUser, "t1", []*transaction.Split{
+		{Amount: -123, Account: ids[0]},
+		{Amount: 123, Account: ids[1]},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var alsoID string
+	voided, code := voidTestTransaction(s, "t1", func(l storage.Ledger, id string) error {
+		alsoID = id
+		return nil
+	})
+	if !voided || code != http.StatusOK {
+		t.Errorf("Expected t1 to be voided, got %v with code %v", voided, code)
+	}
+	if alsoID != "t1" {
+		t.Errorf("Expected also to be called with t1, got %q", alsoID)
+	}
+	if got := transactionsOrDie(t, s); len(got) != 2 {
+		t.Errorf("Expected t1 and its void, got %v", got)
+	}
+}
+
+func TestVoidTransaction_FailureAlso(t *testing.T) {
+	s := storage.NewMemoryStore()
+	ids := addAccountsOrDie(t, s, transaction.Account{Name: "a1"}, transaction.Account{Name: "a2"})
+	if err := CommitTransaction(s, testUser, "t1", []*transaction.Split{
+		{Amount: -123, Account: ids[0]},
+		{Amount: 123, Account: ids[1]},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	voided, code := voidTestTransaction(s, "t1", func(storage.Ledger, string) error {
+		return errors.New("also failed")
+	})
+	if voided || code == http.StatusOK {
+		t.Errorf("Expected t1 not to be voided, got %v with code %v", voided, code)
+	}
+	if got := transactionsOrDie(t, s); len(got) != 1 {
+		t.Errorf("Expected just t1, got %v", got)
+	}
+}
+
+func TestVoidTransaction_FailureNoSuchTransaction(t *testing.T) {
+	s := storage.NewMemoryStore()
+
+	voided, code := voidTestTransaction(s, "t1", nil)
+	if voided || code != http.StatusNotFound {
+		t.Errorf("Expected a 404, got %v with code %v", voided, code)
+	}
+}
+
+func TestReverseTransaction_FailureUndoneTwice(t *testing.T) {
+	s := storage.NewMemoryStore()
+	ids := addAccountsOrDie(t, s, transaction.Account{Name: "a1"}, transaction.Account{Name: "a2"})
+	if err := CommitTransaction(s, testUser, "t1", []*transaction.Split{
+		{Amount: -123, Account: ids[0], Memo: "Test"},
+		{Amount: 123, Account: ids[1], Memo: "Test"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if voided, code := voidTestTransaction(s, "t1", nil); !voided || code != http.StatusOK {
+		t.Fatalf("Expected t1 to be voided, got %v with code %v", voided, code)
+	}
+	if voided, code := voidTestTransaction(s, "t1", nil); voided || code != http.StatusConflict {
+		t.Errorf("Expected voiding t1 again to be a 409, got %v with code %v", voided, code)
+	}
+	p, w := newTestParams(s, "", map[string]string{"id": "t1"})
+	ReverseTransaction(p, transaction.Date{Year: 2014, Month: 12, Day: 25})
+	expectCode(t, http.StatusConflict, w)
+
+	if voided, code := voidTestTransaction(s, reversalID("t1"), nil); voided || code != http.StatusConflict {
+		t.Errorf("Expected voiding the void to be a 409, got %v with code %v", voided, code)
+	}
+	if got := transactionsOrDie(t, s); len(got) != 2 {
+		t.Errorf("Expected just t1 and its void, got %v", got)
+	}
+}
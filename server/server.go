@@ -0,0 +1,115 @@
+// Package server serves the core ae_money API with plain net/http, for
+// running outside of App Engine. Ledgers are kept in any storage.Store, and
+// users are identified by an Authenticator instead of App Engine's login.
+//
+// The handlers are package handlers', shared with App Engine, so transactions
+// get the same payees, rules, duplicate checks, hash chain and categorizer
+// training there as here. Only the API that storage covers is served though:
+// Accounts and their Splits, committing, reversing and voiding transactions,
+// and verifying the hash chain. Managing payees and rules, reports and
+// everything else still need App Engine, and are a 404 here.
+//
+// The web app isn't served, since most of what it does needs that API. Use
+// the core ledger API directly, or the App Engine app.
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/cjc25/ae_money/handlers"
+	"github.com/cjc25/ae_money/storage"
+	"github.com/cjc25/ae_money/transaction"
+)
+
+// An Authenticator identifies the user making a request, or returns "" if
+// they aren't logged in.
+type Authenticator func(r *http.Request) string
+
+// SingleUser is an Authenticator for a server with one user, who is always
+// logged in. Only use it if nobody else can reach the server.
+func SingleUser(user string) Authenticator {
+	return func(*http.Request) string {
+		return user
+	}
+}
+
+// HeaderUser is an Authenticator for a server behind a proxy that logs users
+// in, and passes their name in header. The proxy must strip header from
+// every request it doesn't log in itself, or anyone could claim to be anyone.
+func HeaderUser(header string) Authenticator {
+	return func(r *http.Request) string {
+		return r.Header.Get(header)
+	}
+}
+
+// DeleteAccount deletes an Account owned by the logged in user, if it has no
+// Splits. The Account to delete is extracted from the gorilla/mux vars.
+func DeleteAccount(p *handlers.Params) {
+	handlers.DeleteAccount(p, nil)
+}
+
+// ReverseTransaction undoes a transaction with a new one dated today, for
+// mistakes noticed after the original was reconciled. Without App Engine's
+// settings, today is in the server's time zone.
+func ReverseTransaction(p *handlers.Params) {
+	handlers.ReverseTransaction(p, transaction.DateOf(time.Now()))
+}
+
+// VoidTransaction undoes a transaction as if it never happened, with a new
+// one dated like the original.
+func VoidTransaction(p *handlers.Params) {
+	handlers.VoidTransaction(p, nil)
+}
+
+// server holds what every handler needs.
+type server struct {
+	s    storage.Store
+	auth Authenticator
+}
+
+// loginWrapper converts f into a normal http handler function, which enforces
+// that the request is from a logged in user.
+func (s *server) loginWrapper(f func(*handlers.Params)) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := s.auth(r)
+		if user == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		f(&handlers.Params{W: w, R: r, V: mux.Vars(r), S: s.s, User: user})
+	}
+}
+
+// NewHandler serves the API with ledgers in store, for users identified by
+// auth.
+func NewHandler(store storage.Store, auth Authenticator) http.Handler {
+	s := &server{store, auth}
+	r := mux.NewRouter()
+
+	api := r.PathPrefix("/api/v{version:[0-9]+}").Subrouter()
+
+	api.HandleFunc("/accounts/new", s.loginWrapper(handlers.NewAccount)).
+		Methods("POST")
+	api.HandleFunc("/accounts/{key:[0-9]+}", s.loginWrapper(handlers.ShowAccount)).
+		Methods("GET")
+	api.HandleFunc("/accounts/{key:[0-9]+}", s.loginWrapper(DeleteAccount)).
+		Methods("DELETE")
+	api.HandleFunc("/accounts", s.loginWrapper(handlers.ListAccounts)).
+		Methods("GET")
+
+	api.HandleFunc("/transactions/new", s.loginWrapper(handlers.NewTransaction)).
+		Methods("POST")
+	api.HandleFunc("/transactions/{id:[0-9a-f-]+}/reverse", s.loginWrapper(ReverseTransaction)).
+		Methods("POST")
+	api.HandleFunc("/transactions/{id:[0-9a-f-]+}/void", s.loginWrapper(VoidTransaction)).
+		Methods("POST")
+
+	api.HandleFunc("/chain/verify", s.loginWrapper(handlers.VerifyChain)).
+		Methods("GET")
+
+	return r
+}
@@ -0,0 +1,364 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cjc25/ae_money/handlers"
+	"github.com/cjc25/ae_money/storage"
+	"github.com/cjc25/ae_money/transaction"
+)
+
+const testUser = "test@example.com"
+
+// serveOrDie makes a request to h as user, or as nobody if user is "", and
+// returns the response.
+func serveOrDie(t *testing.T, h http.Handler, user, method, url string, body io.Reader) *httptest.ResponseRecorder {
+	r, err := http.NewRequest(method, url, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user != "" {
+		r.Header.Set("X-Test-User", user)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+// newTestHandler serves an empty MemoryStore, with users logged in by the
+// X-Test-User header.
+func newTestHandler() (http.Handler, storage.Store) {
+	s := storage.NewMemoryStore()
+	return NewHandler(s, HeaderUser("X-Test-User")), s
+}
+
+// Expectation function for HTTP response codes.
+func expectCode(t *testing.T, expected int, w *httptest.ResponseRecorder) {
+	if expected != w.Code {
+		t.Errorf("Expected code %v, got %v: %v", expected, w.Code, w.Body.String())
+	}
+}
+
+// Expectation function for HTTP response bodies.
+func expectBody(t *testing.T, expected string, w *httptest.ResponseRecorder) {
+	got := strings.TrimSpace(w.Body.String())
+	if expected != got {
+		t.Errorf("Expected body \"%v\", got \"%v\"", expected, got)
+	}
+}
+
+func TestSingleUser(t *testing.T) {
+	if got := SingleUser("me")(&http.Request{}); got != "me" {
+		t.Errorf("Expected me, got %q", got)
+	}
+}
+
+func TestNewHandler_FailureNotLoggedIn(t *testing.T) {
+	h, _ := newTestHandler()
+
+	w := serveOrDie(t, h, "", "GET", "/api/v0/accounts", nil)
+	expectCode(t, http.StatusUnauthorized, w)
+}
+
+func TestNewHandler_FailureOnlyOnAppEngine(t *testing.T) {
+	h, _ := newTestHandler()
+
+	w := serveOrDie(t, h, testUser, "GET", "/api/v0/payees", nil)
+	expectCode(t, http.StatusNotFound, w)
+}
+
+func TestNewHandler_NoWebApp(t *testing.T) {
+	h, _ := newTestHandler()
+
+	for _, url := range []string{"/", "/javascript/aemoney.js", "/stylesheets/aemoney.css"} {
+		w := serveOrDie(t, h, testUser, "GET", url, nil)
+		expectCode(t, http.StatusNotFound, w)
+	}
+}
+
+// addAccountsOrDie adds accounts to user's Ledger in s, and returns their ids.
+func addAccountsOrDie(t *testing.T, s storage.Store, user string, accounts ...transaction.Account) []int64 {
+	ids := make([]int64, len(accounts))
+	for i := range accounts {
+		id, err := s.Ledger(user).AddAccount(&accounts[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[i] = id
+	}
+	return ids
+}
+
+func TestListAccounts_Empty(t *testing.T) {
+	h, _ := newTestHandler()
+
+	w := serveOrDie(t, h, testUser, "GET", "/api/v0/accounts", nil)
+	expectCode(t, http.StatusOK, w)
+	expectBody(t, "[]", w)
+}
+
+func TestListAccounts_MultipleUsers(t *testing.T) {
+	h, s := newTestHandler()
+	ids := addAccountsOrDie(t, s, testUser, transaction.Account{Name: "b"}, transaction.Account{Name: "a"})
+	addAccountsOrDie(t, s, "other@example.com", transaction.Account{Name: "c"})
+
+	w := serveOrDie(t, h, testUser, "GET", "/api/v0/accounts", nil)
+	expectCode(t, http.StatusOK, w)
+	expectBody(t, fmt.Sprintf(`[{"account":{"name":"a","total":0},"key":%v},{"account":{"name":"b","total":0},"key":%v}]`, ids[1], ids[0]), w)
+}
+
+func TestShowAccount_Success(t *testing.T) {
+	h, s := newTestHandler()
+	ids := addAccountsOrDie(t, s, testUser, transaction.Account{Name: "a1"}, transaction.Account{Name: "a2"})
+	err := storage.CommitTransaction(s, testUser, "x1", []*transaction.Split{
+		{Amount: 123, Account: ids[0], Date: transaction.Date{Year: 2014, Month: 11, Day: 1}},
+		{Amount: -123, Account: ids[1], Date: transaction.Date{Year: 2014, Month: 11, Day: 1}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := serveOrDie(t, h, testUser, "GET", fmt.Sprintf("/api/v0/accounts/%v", ids[0]), nil)
+	expectCode(t, http.StatusOK, w)
+
+	var result handlers.AccountAndSplits
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	if result.IntID != ids[0] || result.Account.Account.Name != "a1" {
+		t.Errorf("Expected account a1, got %+v", result)
+	}
+	if len(result.Splits) != 1 || result.Splits[0].Amount != 123 || result.Splits[0].Date.String() != "2014-11-01" {
+		t.Errorf("Expected one split of 123, got %+v", result.Splits)
+	}
+}
+
+func TestShowAccount_FailureOtherUsersAccount(t *testing.T) {
+	h, s := newTestHandler()
+	ids := addAccountsOrDie(t, s, "other@example.com", transaction.Account{Name: "a1"})
+
+	w := serveOrDie(t, h, testUser, "GET", fmt.Sprintf("/api/v0/accounts/%v", ids[0]), nil)
+	expectCode(t, http.StatusNotFound, w)
+}
+
+func TestNewAccount_Success(t *testing.T) {
+	h, s := newTestHandler()
+
+	w := serveOrDie(t, h, testUser, "POST", "/api/v0/accounts/new", bytes.NewBufferString(`{"name":"a1","type":"asset"}`))
+	expectCode(t, http.StatusOK, w)
+
+	var result handlers.Account
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	a, err := s.Ledger(testUser).Account(result.IntID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Name != "a1" || a.Type != transaction.Asset {
+		t.Errorf("Expected a1, got %+v", a)
+	}
+}
+
+func TestNewAccount_FailureParentOtherType(t *testing.T) {
+	h, s := newTestHandler()
+	ids := addAccountsOrDie(t, s, testUser, transaction.Account{Name: "a1", Type: transaction.Expense})
+
+	body := fmt.Sprintf(`{"name":"a2","type":"asset","parent":%v}`, ids[0])
+	w := serveOrDie(t, h, testUser, "POST", "/api/v0/accounts/new", bytes.NewBufferString(body))
+	expectCode(t, http.StatusBadRequest, w)
+
+	if gotIDs, _, err := s.Ledger(testUser).Accounts(); err != nil || len(gotIDs) != 1 {
+		t.Errorf("Expected no new account, got %v, %v", gotIDs, err)
+	}
+}
+
+func TestNewAccount_FailureNoAccountName(t *testing.T) {
+	h, _ := newTestHandler()
+
+	w := serveOrDie(t, h, testUser, "POST", "/api/v0/accounts/new", bytes.NewBufferString(`{"name":" "}`))
+	expectCode(t, http.StatusBadRequest, w)
+}
+
+func TestDeleteAccount_Success(t *testing.T) {
+	h, s := newTestHandler()
+	ids := addAccountsOrDie(t, s, testUser, transaction.Account{Name: "a1"})
+
+	w := serveOrDie(t, h, testUser, "DELETE", fmt.Sprintf("/api/v0/accounts/%v", ids[0]), nil)
+	expectCode(t, http.StatusOK, w)
+
+	if _, err := s.Ledger(testUser).Account(ids[0]); err != storage.ErrNoSuchEntity {
+		t.Errorf("Expected the account to be deleted, got %v", err)
+	}
+}
+
+func TestDeleteAccount_FailureSplitsInAccount(t *testing.T) {
+	h, s := newTestHandler()
+	ids := addAccountsOrDie(t, s, testUser, transaction.Account{Name: "a1"}, transaction.Account{Name: "a2"})
+	err := storage.CommitTransaction(s, testUser, "x1", []*transaction.Split{
+		{Amount: 123, Account: ids[0]},
+		{Amount: -123, Account: ids[1]},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := serveOrDie(t, h, testUser, "DELETE", fmt.Sprintf("/api/v0/accounts/%v", ids[0]), nil)
+	expectCode(t, http.StatusBadRequest, w)
+
+	if _, err := s.Ledger(testUser).Account(ids[0]); err != nil {
+		t.Errorf("Expected the account to remain, got %v", err)
+	}
+}
+
+// expectTotals checks the totals of user's Accounts with ids in s.
+func expectTotals(t *testing.T, s storage.Store, user string, ids []int64, expected ...transaction.AmountType) {
+	for i, id := range ids {
+		a, err := s.Ledger(user).Account(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a.Total() != expected[i] {
+			t.Errorf("Expected account %v total %v, got %v", id, expected[i], a.Total())
+		}
+	}
+}
+
+func TestNewTransaction_Success(t *testing.T) {
+	h, s := newTestHandler()
+	ids := addAccountsOrDie(t, s, testUser, transaction.Account{Name: "a1"}, transaction.Account{Name: "a2"})
+
+	body := fmt.Sprintf(`{"amounts":[-100,100],"accounts":[%v,%v],"memo":"Test","date":"2014-11-01","tags":["x"]}`, ids[0], ids[1])
+	w := serveOrDie(t, h, testUser, "POST", "/api/v0/transactions/new", bytes.NewBufferString(body))
+	expectCode(t, http.StatusOK, w)
+
+	expectTotals(t, s, testUser, ids, -100, 100)
+	_, splits, err := s.Ledger(testUser).AccountSplits(ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(splits) != 1 || splits[0].Memo != "Test" || splits[0].Date.String() != "2014-11-01" || len(splits[0].Tags) != 1 {
+		t.Errorf("Expected the new split, got %+v", splits)
+	}
+}
+
+func TestNewTransaction_SuccessWeights(t *testing.T) {
+	h, s := newTestHandler()
+	ids := addAccountsOrDie(t, s, testUser, transaction.Account{Name: "a1"}, transaction.Account{Name: "a2"}, transaction.Account{Name: "a3"})
+
+	body := fmt.Sprintf(`{"amounts":[-100,0,0],"accounts":[%v,%v,%v],"weights":[0,1,3],"date":"2014-11-01"}`, ids[0], ids[1], ids[2])
+	w := serveOrDie(t, h, testUser, "POST", "/api/v0/transactions/new", bytes.NewBufferString(body))
+	expectCode(t, http.StatusOK, w)
+
+	expectTotals(t, s, testUser, ids, -100, 25, 75)
+}
+
+func TestNewTransaction_FailureLikelyDuplicate(t *testing.T) {
+	h, s := newTestHandler()
+	ids := addAccountsOrDie(t, s, testUser, transaction.Account{Name: "a1"}, transaction.Account{Name: "a2"})
+
+	body := fmt.Sprintf(`{"amounts":[-100,100],"accounts":[%v,%v],"memo":"Test","date":"2014-11-01"}`, ids[0], ids[1])
+	w := serveOrDie(t, h, testUser, "POST", "/api/v0/transactions/new", bytes.NewBufferString(body))
+	expectCode(t, http.StatusOK, w)
+	w = serveOrDie(t, h, testUser, "POST", "/api/v0/transactions/new", bytes.NewBufferString(body))
+	expectCode(t, http.StatusConflict, w)
+
+	expectTotals(t, s, testUser, ids, -100, 100)
+}
+
+func TestVerifyChain(t *testing.T) {
+	h, s := newTestHandler()
+	ids := addAccountsOrDie(t, s, testUser, transaction.Account{Name: "a1"}, transaction.Account{Name: "a2"})
+
+	body := fmt.Sprintf(`{"amounts":[-100,100],"accounts":[%v,%v],"date":"2014-11-01"}`, ids[0], ids[1])
+	w := serveOrDie(t, h, testUser, "POST", "/api/v0/transactions/new", bytes.NewBufferString(body))
+	expectCode(t, http.StatusOK, w)
+
+	w = serveOrDie(t, h, testUser, "GET", "/api/v0/chain/verify", nil)
+	expectCode(t, http.StatusOK, w)
+	var report transaction.ChainReport
+	if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Length != 1 || report.Break != nil {
+		t.Errorf("Expected an unbroken chain of 1, got %+v", report)
+	}
+}
+
+func TestNewTransaction_FailureUnbalanced(t *testing.T) {
+	h, s := newTestHandler()
+	ids := addAccountsOrDie(t, s, testUser, transaction.Account{Name: "a1"}, transaction.Account{Name: "a2"})
+
+	body := fmt.Sprintf(`{"amounts":[-100,101],"accounts":[%v,%v],"date":"2014-11-01"}`, ids[0], ids[1])
+	w := serveOrDie(t, h, testUser, "POST", "/api/v0/transactions/new", bytes.NewBufferString(body))
+	expectCode(t, http.StatusBadRequest, w)
+
+	expectTotals(t, s, testUser, ids, 0, 0)
+}
+
+func TestNewTransaction_FailureNoAccounts(t *testing.T) {
+	h, _ := newTestHandler()
+
+	w := serveOrDie(t, h, testUser, "POST", "/api/v0/transactions/new", bytes.NewBufferString(`{"date":"2014-11-01"}`))
+	expectCode(t, http.StatusBadRequest, w)
+}
+
+func TestReverseAndVoidTransaction(t *testing.T) {
+	h, s := newTestHandler()
+	ids := addAccountsOrDie(t, s, testUser, transaction.Account{Name: "a1"}, transaction.Account{Name: "a2"})
+	original := transaction.Date{Year: 2014, Month: 11, Day: 1}
+	for _, id := range []string{"0a", "0b"} {
+		err := storage.CommitTransaction(s, testUser, id, []*transaction.Split{
+			{Amount: -100, Account: ids[0], Memo: "Test", Date: original},
+			{Amount: 100, Account: ids[1], Memo: "Test", Date: original},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, x := range []struct {
+		id, action, memo string
+		date             transaction.Date
+	}{
+		{"0a", "reverse", "Reversal: Test", transaction.DateOf(time.Now())},
+		{"0b", "void", "Void: Test", original},
+	} {
+		w := serveOrDie(t, h, testUser, "POST", fmt.Sprintf("/api/v0/transactions/%v/%v", x.id, x.action), nil)
+		expectCode(t, http.StatusOK, w)
+
+		var result map[string]string
+		if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+			t.Fatal(err)
+		}
+		splits, err := s.Ledger(testUser).TransactionSplits(result["id"])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(splits) != 2 {
+			t.Fatalf("Expected 2 splits, got %+v", splits)
+		}
+		for _, split := range splits {
+			if split.Memo != x.memo || split.Date != x.date {
+				t.Errorf("Expected %q on %v, got %+v", x.memo, x.date, split)
+			}
+		}
+	}
+
+	expectTotals(t, s, testUser, ids, 0, 0)
+}
+
+func TestReverseTransaction_FailureNoSuchTransaction(t *testing.T) {
+	h, _ := newTestHandler()
+
+	w := serveOrDie(t, h, testUser, "POST", "/api/v0/transactions/0a/reverse", nil)
+	expectCode(t, http.StatusNotFound, w)
+}
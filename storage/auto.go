@@ -0,0 +1,183 @@
+package storage
+
+import (
+	"github.com/cjc25/ae_money/transaction"
+)
+
+// AutoLedger is user's Ledger in s outside of any transaction, which runs each
+// call in a transaction of its own. It's for Stores that only change Ledgers
+// in transactions, to implement Store.Ledger.
+func AutoLedger(s Store, user string) Ledger {
+	return &autoLedger{s, user}
+}
+
+// autoLedger is a Ledger outside of any transaction, which runs each call in
+// a transaction of its own.
+type autoLedger struct {
+	store Store
+	user  string
+}
+
+func (l *autoLedger) Account(id int64) (a *transaction.Account, err error) {
+	err = l.store.RunInTransaction(l.user, func(t Ledger) error {
+		a, err = t.Account(id)
+		return err
+	})
+	return
+}
+
+func (l *autoLedger) Accounts() (ids []int64, accounts []transaction.Account, err error) {
+	err = l.store.RunInTransaction(l.user, func(t Ledger) error {
+		ids, accounts, err = t.Accounts()
+		return err
+	})
+	return
+}
+
+func (l *autoLedger) AddAccount(a *transaction.Account) (id int64, err error) {
+	err = l.store.RunInTransaction(l.user, func(t Ledger) error {
+		id, err = t.AddAccount(a)
+		return err
+	})
+	return
+}
+
+func (l *autoLedger) PutAccounts(ids []int64, accounts []*transaction.Account) error {
+	return l.store.RunInTransaction(l.user, func(t Ledger) error {
+		return t.PutAccounts(ids, accounts)
+	})
+}
+
+func (l *autoLedger) DeleteAccount(id int64) error {
+	return l.store.RunInTransaction(l.user, func(t Ledger) error {
+		return t.DeleteAccount(id)
+	})
+}
+
+func (l *autoLedger) AccountSplits(id int64) (ids []string, splits []transaction.Split, err error) {
+	err = l.store.RunInTransaction(l.user, func(t Ledger) error {
+		ids, splits, err = t.AccountSplits(id)
+		return err
+	})
+	return
+}
+
+func (l *autoLedger) AccountSplitsBetween(id int64, from, through transaction.Date) (ids []string, splits []transaction.Split, err error) {
+	err = l.store.RunInTransaction(l.user, func(t Ledger) error {
+		ids, splits, err = t.AccountSplitsBetween(id, from, through)
+		return err
+	})
+	return
+}
+
+func (l *autoLedger) Splits() (ids []string, splits []transaction.Split, err error) {
+	err = l.store.RunInTransaction(l.user, func(t Ledger) error {
+		ids, splits, err = t.Splits()
+		return err
+	})
+	return
+}
+
+func (l *autoLedger) TransactionSplits(transactionID string) (splits []*transaction.Split, err error) {
+	err = l.store.RunInTransaction(l.user, func(t Ledger) error {
+		splits, err = t.TransactionSplits(transactionID)
+		return err
+	})
+	return
+}
+
+func (l *autoLedger) PutSplits(transactionID string, splits []*transaction.Split) error {
+	return l.store.RunInTransaction(l.user, func(t Ledger) error {
+		return t.PutSplits(transactionID, splits)
+	})
+}
+
+func (l *autoLedger) AccountSplitsWithExternalID(id int64, externalID string) (ids []string, splits []transaction.Split, err error) {
+	err = l.store.RunInTransaction(l.user, func(t Ledger) error {
+		ids, splits, err = t.AccountSplitsWithExternalID(id, externalID)
+		return err
+	})
+	return
+}
+
+func (l *autoLedger) Payee(id int64) (p *transaction.Payee, err error) {
+	err = l.store.RunInTransaction(l.user, func(t Ledger) error {
+		p, err = t.Payee(id)
+		return err
+	})
+	return
+}
+
+func (l *autoLedger) Payees() (ids []int64, payees []transaction.Payee, err error) {
+	err = l.store.RunInTransaction(l.user, func(t Ledger) error {
+		ids, payees, err = t.Payees()
+		return err
+	})
+	return
+}
+
+func (l *autoLedger) AddPayee(p *transaction.Payee) (id int64, err error) {
+	err = l.store.RunInTransaction(l.user, func(t Ledger) error {
+		id, err = t.AddPayee(p)
+		return err
+	})
+	return
+}
+
+func (l *autoLedger) PutPayee(id int64, p *transaction.Payee) error {
+	return l.store.RunInTransaction(l.user, func(t Ledger) error {
+		return t.PutPayee(id, p)
+	})
+}
+
+func (l *autoLedger) Rules() (ids []int64, rules []transaction.Rule, err error) {
+	err = l.store.RunInTransaction(l.user, func(t Ledger) error {
+		ids, rules, err = t.Rules()
+		return err
+	})
+	return
+}
+
+func (l *autoLedger) AddRule(r *transaction.Rule) (id int64, err error) {
+	err = l.store.RunInTransaction(l.user, func(t Ledger) error {
+		id, err = t.AddRule(r)
+		return err
+	})
+	return
+}
+
+func (l *autoLedger) ChainHead() (head *transaction.ChainHead, err error) {
+	err = l.store.RunInTransaction(l.user, func(t Ledger) error {
+		head, err = t.ChainHead()
+		return err
+	})
+	return
+}
+
+func (l *autoLedger) ChainLinks() (links []transaction.ChainLink, err error) {
+	err = l.store.RunInTransaction(l.user, func(t Ledger) error {
+		links, err = t.ChainLinks()
+		return err
+	})
+	return
+}
+
+func (l *autoLedger) PutChainLink(head *transaction.ChainHead, link *transaction.ChainLink) error {
+	return l.store.RunInTransaction(l.user, func(t Ledger) error {
+		return t.PutChainLink(head, link)
+	})
+}
+
+func (l *autoLedger) CategorizerCounts(counters []int64) (counts []transaction.CategorizerCounts, err error) {
+	err = l.store.RunInTransaction(l.user, func(t Ledger) error {
+		counts, err = t.CategorizerCounts(counters)
+		return err
+	})
+	return
+}
+
+func (l *autoLedger) PutCategorizerCounts(counters []int64, counts []*transaction.CategorizerCounts) error {
+	return l.store.RunInTransaction(l.user, func(t Ledger) error {
+		return t.PutCategorizerCounts(counters, counts)
+	})
+}
@@ -0,0 +1,385 @@
+package storage
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/cjc25/ae_money/transaction"
+)
+
+// A MemoryStore keeps ledgers in memory, for tests and trying things out
+// locally. Transactions are serialized, and each works on its own copy of the
+// ledger, which replaces the original only if it succeeds.
+type MemoryStore struct {
+	mu      sync.Mutex
+	ledgers map[string]*memoryLedger
+	lastID  int64
+}
+
+// NewMemoryStore makes an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{ledgers: make(map[string]*memoryLedger)}
+}
+
+// memoryLedger is one user's ledger in a MemoryStore. Splits are kept by
+// Account, then by transaction id, and CategorizerCounts by counter account.
+type memoryLedger struct {
+	store      *MemoryStore
+	accounts   map[int64]transaction.Account
+	splits     map[int64]map[string]transaction.Split
+	payees     map[int64]transaction.Payee
+	rules      map[int64]transaction.Rule
+	chainHead  transaction.ChainHead
+	chainLinks []transaction.ChainLink
+	counts     map[int64]transaction.CategorizerCounts
+}
+
+// copySplit copies s, so that changing its Tags doesn't change the original.
+func copySplit(s *transaction.Split) transaction.Split {
+	result := *s
+	if s.Tags != nil {
+		result.Tags = append([]string(nil), s.Tags...)
+	}
+	return result
+}
+
+// copyPayee copies p, so that changing its Aliases doesn't change the
+// original.
+func copyPayee(p *transaction.Payee) transaction.Payee {
+	result := *p
+	if p.Aliases != nil {
+		result.Aliases = append([]string(nil), p.Aliases...)
+	}
+	return result
+}
+
+// copyRule copies r, so that changing its Tags doesn't change the original.
+func copyRule(r *transaction.Rule) transaction.Rule {
+	result := *r
+	if r.Tags != nil {
+		result.Tags = append([]string(nil), r.Tags...)
+	}
+	return result
+}
+
+// copyCounts copies c, so that changing its Features doesn't change the
+// original.
+func copyCounts(c *transaction.CategorizerCounts) transaction.CategorizerCounts {
+	result := *c
+	result.Features = make(map[string]int64)
+	for f, n := range c.Features {
+		result.Features[f] = n
+	}
+	return result
+}
+
+// copy is a deep copy of l, for a transaction to change. Chain hashes are
+// never changed in place, so they're shared.
+func (l *memoryLedger) copy() *memoryLedger {
+	result := &memoryLedger{
+		store:      l.store,
+		accounts:   make(map[int64]transaction.Account),
+		splits:     make(map[int64]map[string]transaction.Split),
+		payees:     make(map[int64]transaction.Payee),
+		rules:      make(map[int64]transaction.Rule),
+		chainHead:  l.chainHead,
+		chainLinks: append([]transaction.ChainLink(nil), l.chainLinks...),
+		counts:     make(map[int64]transaction.CategorizerCounts),
+	}
+	for id, a := range l.accounts {
+		result.accounts[id] = a
+	}
+	for id, splits := range l.splits {
+		result.splits[id] = make(map[string]transaction.Split)
+		for transactionID, s := range splits {
+			result.splits[id][transactionID] = copySplit(&s)
+		}
+	}
+	for id, p := range l.payees {
+		result.payees[id] = copyPayee(&p)
+	}
+	for id, r := range l.rules {
+		result.rules[id] = copyRule(&r)
+	}
+	for counter, c := range l.counts {
+		result.counts[counter] = copyCounts(&c)
+	}
+	return result
+}
+
+// RunInTransaction implements Store. f can't use s, since s is locked while f
+// runs.
+func (s *MemoryStore) RunInTransaction(user string, f func(l Ledger) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l, ok := s.ledgers[user]
+	if !ok {
+		l = &memoryLedger{store: s}
+	}
+	working := l.copy()
+	if err := f(working); err != nil {
+		return err
+	}
+	s.ledgers[user] = working
+	return nil
+}
+
+// Ledger implements Store.
+func (s *MemoryStore) Ledger(user string) Ledger {
+	return AutoLedger(s, user)
+}
+
+func (l *memoryLedger) Account(id int64) (*transaction.Account, error) {
+	a, ok := l.accounts[id]
+	if !ok {
+		return nil, ErrNoSuchEntity
+	}
+	return &a, nil
+}
+
+func (l *memoryLedger) Accounts() ([]int64, []transaction.Account, error) {
+	ids := make([]int64, 0, len(l.accounts))
+	for id := range l.accounts {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		a, b := l.accounts[ids[i]], l.accounts[ids[j]]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return ids[i] < ids[j]
+	})
+
+	accounts := make([]transaction.Account, len(ids))
+	for i, id := range ids {
+		accounts[i] = l.accounts[id]
+	}
+	return ids, accounts, nil
+}
+
+func (l *memoryLedger) AddAccount(a *transaction.Account) (int64, error) {
+	// IDs are unique in the whole store, like datastore's.
+	l.store.lastID++
+	l.accounts[l.store.lastID] = *a
+	return l.store.lastID, nil
+}
+
+func (l *memoryLedger) PutAccounts(ids []int64, accounts []*transaction.Account) error {
+	for i, id := range ids {
+		l.accounts[id] = *accounts[i]
+	}
+	return nil
+}
+
+func (l *memoryLedger) DeleteAccount(id int64) error {
+	if len(l.splits[id]) != 0 {
+		return ErrAccountHasSplits
+	}
+	delete(l.accounts, id)
+	return nil
+}
+
+func (l *memoryLedger) AccountSplits(id int64) ([]string, []transaction.Split, error) {
+	ids := make([]string, 0, len(l.splits[id]))
+	for transactionID := range l.splits[id] {
+		ids = append(ids, transactionID)
+	}
+	splits := l.splits[id]
+	sort.Slice(ids, func(i, j int) bool {
+		a, b := splits[ids[i]], splits[ids[j]]
+		if a.Date != b.Date {
+			return a.Date.Before(b.Date)
+		}
+		if a.Amount != b.Amount {
+			return a.Amount > b.Amount
+		}
+		return ids[i] < ids[j]
+	})
+
+	result := make([]transaction.Split, len(ids))
+	for i, transactionID := range ids {
+		s := splits[transactionID]
+		result[i] = copySplit(&s)
+	}
+	return ids, result, nil
+}
+
+func (l *memoryLedger) AccountSplitsBetween(id int64, from, through transaction.Date) ([]string, []transaction.Split, error) {
+	ids, splits, err := l.AccountSplits(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	resultIDs := make([]string, 0)
+	result := make([]transaction.Split, 0)
+	for i := range splits {
+		if !splits[i].Date.Before(from) && !splits[i].Date.After(through) {
+			resultIDs = append(resultIDs, ids[i])
+			result = append(result, splits[i])
+		}
+	}
+	return resultIDs, result, nil
+}
+
+func (l *memoryLedger) Splits() ([]string, []transaction.Split, error) {
+	ids := make([]string, 0)
+	result := make([]transaction.Split, 0)
+	for _, splits := range l.splits {
+		for transactionID, s := range splits {
+			ids = append(ids, transactionID)
+			result = append(result, copySplit(&s))
+		}
+	}
+	return ids, result, nil
+}
+
+func (l *memoryLedger) TransactionSplits(transactionID string) ([]*transaction.Split, error) {
+	accounts := make([]int64, 0)
+	for account, splits := range l.splits {
+		if _, ok := splits[transactionID]; ok {
+			accounts = append(accounts, account)
+		}
+	}
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i] < accounts[j] })
+
+	result := make([]*transaction.Split, len(accounts))
+	for i, account := range accounts {
+		s := l.splits[account][transactionID]
+		copied := copySplit(&s)
+		result[i] = &copied
+	}
+	return result, nil
+}
+
+func (l *memoryLedger) PutSplits(transactionID string, splits []*transaction.Split) error {
+	for _, s := range splits {
+		if _, ok := l.accounts[s.Account]; !ok {
+			return ErrNoSuchEntity
+		}
+	}
+	for _, s := range splits {
+		if l.splits[s.Account] == nil {
+			l.splits[s.Account] = make(map[string]transaction.Split)
+		}
+		l.splits[s.Account][transactionID] = copySplit(s)
+	}
+	return nil
+}
+
+func (l *memoryLedger) AccountSplitsWithExternalID(id int64, externalID string) ([]string, []transaction.Split, error) {
+	ids, splits, err := l.AccountSplits(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	resultIDs := make([]string, 0)
+	result := make([]transaction.Split, 0)
+	for i := range splits {
+		if splits[i].ExternalID == externalID {
+			resultIDs = append(resultIDs, ids[i])
+			result = append(result, splits[i])
+		}
+	}
+	return resultIDs, result, nil
+}
+
+func (l *memoryLedger) Payee(id int64) (*transaction.Payee, error) {
+	p, ok := l.payees[id]
+	if !ok {
+		return nil, ErrNoSuchEntity
+	}
+	result := copyPayee(&p)
+	return &result, nil
+}
+
+func (l *memoryLedger) Payees() ([]int64, []transaction.Payee, error) {
+	ids := make([]int64, 0, len(l.payees))
+	for id := range l.payees {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		a, b := l.payees[ids[i]], l.payees[ids[j]]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return ids[i] < ids[j]
+	})
+
+	payees := make([]transaction.Payee, len(ids))
+	for i, id := range ids {
+		p := l.payees[id]
+		payees[i] = copyPayee(&p)
+	}
+	return ids, payees, nil
+}
+
+func (l *memoryLedger) AddPayee(p *transaction.Payee) (int64, error) {
+	l.store.lastID++
+	l.payees[l.store.lastID] = copyPayee(p)
+	return l.store.lastID, nil
+}
+
+func (l *memoryLedger) PutPayee(id int64, p *transaction.Payee) error {
+	l.payees[id] = copyPayee(p)
+	return nil
+}
+
+func (l *memoryLedger) Rules() ([]int64, []transaction.Rule, error) {
+	ids := make([]int64, 0, len(l.rules))
+	for id := range l.rules {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		a, b := l.rules[ids[i]], l.rules[ids[j]]
+		if a.Priority != b.Priority {
+			return a.Priority < b.Priority
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return ids[i] < ids[j]
+	})
+
+	rules := make([]transaction.Rule, len(ids))
+	for i, id := range ids {
+		r := l.rules[id]
+		rules[i] = copyRule(&r)
+	}
+	return ids, rules, nil
+}
+
+func (l *memoryLedger) AddRule(r *transaction.Rule) (int64, error) {
+	l.store.lastID++
+	l.rules[l.store.lastID] = copyRule(r)
+	return l.store.lastID, nil
+}
+
+func (l *memoryLedger) ChainHead() (*transaction.ChainHead, error) {
+	head := l.chainHead
+	return &head, nil
+}
+
+func (l *memoryLedger) ChainLinks() ([]transaction.ChainLink, error) {
+	return append(make([]transaction.ChainLink, 0, len(l.chainLinks)), l.chainLinks...), nil
+}
+
+func (l *memoryLedger) PutChainLink(head *transaction.ChainHead, link *transaction.ChainLink) error {
+	l.chainLinks = append(l.chainLinks, *link)
+	l.chainHead = *head
+	return nil
+}
+
+func (l *memoryLedger) CategorizerCounts(counters []int64) ([]transaction.CategorizerCounts, error) {
+	result := make([]transaction.CategorizerCounts, len(counters))
+	for i, counter := range counters {
+		c := l.counts[counter]
+		result[i] = copyCounts(&c)
+	}
+	return result, nil
+}
+
+func (l *memoryLedger) PutCategorizerCounts(counters []int64, counts []*transaction.CategorizerCounts) error {
+	for i, counter := range counters {
+		l.counts[counter] = copyCounts(counts[i])
+	}
+	return nil
+}
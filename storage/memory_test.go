@@ -0,0 +1,36 @@
+package storage_test
+
+import (
+	"testing"
+
+	"github.com/cjc25/ae_money/storage"
+	"github.com/cjc25/ae_money/storage/storagetest"
+	"github.com/cjc25/ae_money/transaction"
+)
+
+func TestMemoryStore(t *testing.T) {
+	storagetest.TestStore(t, storage.NewMemoryStore())
+}
+
+func TestMemoryStore_CopiesSplits(t *testing.T) {
+	s := storage.NewMemoryStore()
+	l := s.Ledger("test@example.com")
+	id, err := l.AddAccount(&transaction.Account{Name: "a1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	split := &transaction.Split{Amount: 100, Account: id, Tags: []string{"food"}}
+	if err := l.PutSplits("x1", []*transaction.Split{split}); err != nil {
+		t.Fatal(err)
+	}
+	split.Tags[0] = "changed"
+
+	got, err := l.TransactionSplits("x1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Tags[0] != "food" {
+		t.Errorf("Expected the stored split not to change, got %+v", got)
+	}
+}
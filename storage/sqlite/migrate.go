@@ -0,0 +1,167 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// migrations upgrade the schema one version at a time: migrations[i] upgrades
+// a database at version i to version i+1. The version is kept in SQLite's
+// user_version, which is 0 in a new database. Never change a migration once
+// it's released; append a new one instead.
+var migrations = []string{
+	// 1: Users, their Accounts, and the Splits of their transactions.
+	`
+CREATE TABLE users (
+	id INTEGER PRIMARY KEY,
+	name TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE accounts (
+	id INTEGER PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users (id),
+	name TEXT NOT NULL,
+	type TEXT NOT NULL DEFAULT '',
+	parent INTEGER NOT NULL DEFAULT 0,
+	total INTEGER NOT NULL DEFAULT 0
+);
+-- ListAccounts lists a user's Accounts by name.
+CREATE INDEX accounts_by_user_name ON accounts (user_id, name);
+
+CREATE TABLE transactions (
+	user_id INTEGER NOT NULL REFERENCES users (id),
+	id TEXT NOT NULL,
+	PRIMARY KEY (user_id, id)
+) WITHOUT ROWID;
+
+-- A transaction has at most one Split per Account. Dates are "2006-01-02", or
+-- "" if they're zero, so they sort in date order.
+CREATE TABLE splits (
+	account_id INTEGER NOT NULL REFERENCES accounts (id) ON DELETE CASCADE,
+	transaction_id TEXT NOT NULL,
+	user_id INTEGER NOT NULL,
+	amount INTEGER NOT NULL,
+	memo TEXT NOT NULL DEFAULT '',
+	date TEXT NOT NULL DEFAULT '',
+	created TEXT NOT NULL DEFAULT '',
+	payee INTEGER NOT NULL DEFAULT 0,
+	reclassified TEXT NOT NULL DEFAULT '',
+	external_id TEXT NOT NULL DEFAULT '',
+	PRIMARY KEY (account_id, transaction_id),
+	FOREIGN KEY (user_id, transaction_id) REFERENCES transactions (user_id, id)
+) WITHOUT ROWID;
+-- ShowAccount lists an Account's Splits by date, then largest amount first.
+CREATE INDEX splits_by_account_date ON splits (account_id, date, amount DESC);
+-- Reversing or voiding a transaction gets all of its Splits.
+CREATE INDEX splits_by_transaction ON splits (user_id, transaction_id);
+
+CREATE TABLE split_tags (
+	account_id INTEGER NOT NULL,
+	transaction_id TEXT NOT NULL,
+	position INTEGER NOT NULL,
+	tag TEXT NOT NULL,
+	PRIMARY KEY (account_id, transaction_id, position),
+	FOREIGN KEY (account_id, transaction_id) REFERENCES splits (account_id, transaction_id) ON DELETE CASCADE
+) WITHOUT ROWID;
+`,
+	// 2: What's kept alongside a user's transactions: their Payees and Rules,
+	// hash chain, and Categorizer.
+	`
+-- A Payee's aliases, and a Rule's tags, are JSON arrays.
+CREATE TABLE payees (
+	id INTEGER PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users (id),
+	name TEXT NOT NULL,
+	default_account INTEGER NOT NULL DEFAULT 0,
+	default_memo TEXT NOT NULL DEFAULT '',
+	aliases TEXT NOT NULL DEFAULT '[]'
+);
+CREATE INDEX payees_by_user_name ON payees (user_id, name);
+
+CREATE TABLE rules (
+	id INTEGER PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users (id),
+	name TEXT NOT NULL,
+	priority INTEGER NOT NULL DEFAULT 0,
+	memo TEXT NOT NULL DEFAULT '',
+	min_amount INTEGER NOT NULL DEFAULT 0,
+	max_amount INTEGER NOT NULL DEFAULT 0,
+	account INTEGER NOT NULL DEFAULT 0,
+	counter_account INTEGER NOT NULL DEFAULT 0,
+	tags TEXT NOT NULL DEFAULT '[]',
+	payee INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX rules_by_user_priority ON rules (user_id, priority, name);
+
+CREATE TABLE chain_heads (
+	user_id INTEGER PRIMARY KEY REFERENCES users (id),
+	seq INTEGER NOT NULL,
+	hash BLOB NOT NULL
+);
+
+CREATE TABLE chain_links (
+	user_id INTEGER NOT NULL REFERENCES users (id),
+	seq INTEGER NOT NULL,
+	transaction_id TEXT NOT NULL,
+	hash BLOB NOT NULL,
+	PRIMARY KEY (user_id, seq)
+) WITHOUT ROWID;
+
+-- Features is a JSON object of each feature's count.
+CREATE TABLE categorizer_counts (
+	user_id INTEGER NOT NULL REFERENCES users (id),
+	counter_account INTEGER NOT NULL,
+	examples INTEGER NOT NULL,
+	features TEXT NOT NULL,
+	feature_total INTEGER NOT NULL,
+	PRIMARY KEY (user_id, counter_account)
+) WITHOUT ROWID;
+
+-- Duplicate detection looks up Splits by their bank's id.
+CREATE INDEX splits_by_account_external_id ON splits (account_id, external_id);
+`,
+}
+
+// schemaVersion gets the version of the schema tx sees.
+func schemaVersion(tx *sql.Tx) (int, error) {
+	var version int
+	err := tx.QueryRow("PRAGMA user_version").Scan(&version)
+	return version, err
+}
+
+// migrate upgrades db's schema to the latest version in place, applying each
+// migration it's missing in a transaction of its own, so a failed upgrade
+// leaves the database at the last version that succeeded.
+func migrate(db *sql.DB) error {
+	for {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		version, err := schemaVersion(tx)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if version > len(migrations) {
+			tx.Rollback()
+			return fmt.Errorf("sqlite: database schema version %v is newer than the latest known, %v", version, len(migrations))
+		}
+		if version == len(migrations) {
+			return tx.Rollback()
+		}
+
+		if _, err := tx.Exec(migrations[version]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("sqlite: migrating to schema version %v: %v", version+1, err)
+		}
+		// PRAGMA doesn't take parameters, but version is our own int.
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,528 @@
+// Package sqlite is a storage.Store in a SQLite database, for running outside
+// of App Engine, such as on a small server of your own.
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/cjc25/ae_money/storage"
+	"github.com/cjc25/ae_money/transaction"
+)
+
+// A Store keeps ledgers in a SQLite database. Each transaction holds the
+// database's write lock from the start, so they never interleave, and
+// concurrent ones wait for each other rather than failing.
+type Store struct {
+	db *sql.DB
+}
+
+// Open opens the database at path, creating it if it doesn't exist, and
+// upgrades its schema to the latest version.
+func Open(path string) (*Store, error) {
+	db, err := sql.Open("sqlite3", "file:"+path+"?_foreign_keys=on&_busy_timeout=10000&_txlock=immediate")
+	if err != nil {
+		return nil, err
+	}
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Store{db}, nil
+}
+
+// Close closes the database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Ledger implements storage.Store.
+func (s *Store) Ledger(user string) storage.Ledger {
+	return storage.AutoLedger(s, user)
+}
+
+// RunInTransaction implements storage.Store.
+func (s *Store) RunInTransaction(user string, f func(l storage.Ledger) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	l, err := newLedger(tx, user)
+	if err == nil {
+		err = f(l)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// ledger is one user's storage.Ledger in a SQL transaction.
+type ledger struct {
+	tx     *sql.Tx
+	userID int64
+}
+
+// newLedger gets user's ledger in tx, adding them if they're new.
+func newLedger(tx *sql.Tx, user string) (*ledger, error) {
+	if _, err := tx.Exec("INSERT OR IGNORE INTO users (name) VALUES (?)", user); err != nil {
+		return nil, err
+	}
+	l := &ledger{tx: tx}
+	if err := tx.QueryRow("SELECT id FROM users WHERE name = ?", user).Scan(&l.userID); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *ledger) Account(id int64) (*transaction.Account, error) {
+	var a transaction.Account
+	var total int64
+	err := l.tx.QueryRow("SELECT name, type, parent, total FROM accounts WHERE id = ? AND user_id = ?", id, l.userID).
+		Scan(&a.Name, &a.Type, &a.Parent, &total)
+	if err == sql.ErrNoRows {
+		return nil, storage.ErrNoSuchEntity
+	}
+	if err != nil {
+		return nil, err
+	}
+	a.RestoreTotal(transaction.AmountType(total))
+	return &a, nil
+}
+
+func (l *ledger) Accounts() ([]int64, []transaction.Account, error) {
+	rows, err := l.tx.Query("SELECT id, name, type, parent, total FROM accounts WHERE user_id = ? ORDER BY name, id", l.userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]int64, 0)
+	accounts := make([]transaction.Account, 0)
+	for rows.Next() {
+		var id, total int64
+		var a transaction.Account
+		if err := rows.Scan(&id, &a.Name, &a.Type, &a.Parent, &total); err != nil {
+			return nil, nil, err
+		}
+		a.RestoreTotal(transaction.AmountType(total))
+		ids = append(ids, id)
+		accounts = append(accounts, a)
+	}
+	return ids, accounts, rows.Err()
+}
+
+func (l *ledger) AddAccount(a *transaction.Account) (int64, error) {
+	result, err := l.tx.Exec("INSERT INTO accounts (user_id, name, type, parent, total) VALUES (?, ?, ?, ?, ?)",
+		l.userID, a.Name, string(a.Type), a.Parent, int64(a.Total()))
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func (l *ledger) PutAccounts(ids []int64, accounts []*transaction.Account) error {
+	for i, a := range accounts {
+		result, err := l.tx.Exec("UPDATE accounts SET name = ?, type = ?, parent = ?, total = ? WHERE id = ? AND user_id = ?",
+			a.Name, string(a.Type), a.Parent, int64(a.Total()), ids[i], l.userID)
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return storage.ErrNoSuchEntity
+		}
+	}
+	return nil
+}
+
+func (l *ledger) DeleteAccount(id int64) error {
+	var splits int
+	if err := l.tx.QueryRow("SELECT COUNT(*) FROM splits WHERE account_id = ? AND user_id = ?", id, l.userID).Scan(&splits); err != nil {
+		return err
+	}
+	if splits != 0 {
+		return storage.ErrAccountHasSplits
+	}
+	_, err := l.tx.Exec("DELETE FROM accounts WHERE id = ? AND user_id = ?", id, l.userID)
+	return err
+}
+
+// splitColumns are the columns scanSplit reads, after the transaction id.
+const splitColumns = "account_id, amount, memo, date, created, payee, reclassified, external_id"
+
+// scanSplit reads a row of splitColumns into s.
+func scanSplit(rows *sql.Rows, transactionID *string, s *transaction.Split) error {
+	var amount int64
+	var date, created string
+	if err := rows.Scan(transactionID, &s.Account, &amount, &s.Memo, &date, &created, &s.Payee, &s.Reclassified, &s.ExternalID); err != nil {
+		return err
+	}
+	s.Amount = transaction.AmountType(amount)
+
+	if date != "" {
+		d, err := transaction.ParseDate(date)
+		if err != nil {
+			return err
+		}
+		s.Date = d
+	}
+	if created != "" {
+		t, err := time.Parse(time.RFC3339Nano, created)
+		if err != nil {
+			return err
+		}
+		s.Created = t
+	}
+	return nil
+}
+
+// loadTags gets the tags of the Split of transactionID in the Account with id.
+func (l *ledger) loadTags(id int64, transactionID string) ([]string, error) {
+	rows, err := l.tx.Query("SELECT tag FROM split_tags WHERE account_id = ? AND transaction_id = ? ORDER BY position", id, transactionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []string
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+// querySplits gets the Splits that query finds, along with their tags and
+// their transactions' ids. query must select the transaction id and then
+// splitColumns.
+func (l *ledger) querySplits(query string, args ...interface{}) ([]string, []transaction.Split, error) {
+	rows, err := l.tx.Query(query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]string, 0)
+	// We make an empty slice so callers can print [] if there are no splits.
+	splits := make([]transaction.Split, 0)
+	for rows.Next() {
+		var transactionID string
+		var s transaction.Split
+		if err := scanSplit(rows, &transactionID, &s); err != nil {
+			return nil, nil, err
+		}
+		ids = append(ids, transactionID)
+		splits = append(splits, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	rows.Close()
+
+	for i := range splits {
+		if splits[i].Tags, err = l.loadTags(splits[i].Account, ids[i]); err != nil {
+			return nil, nil, err
+		}
+	}
+	return ids, splits, nil
+}
+
+// sqlDate is how d is stored in the splits table.
+func sqlDate(d transaction.Date) string {
+	if d.IsZero() {
+		return ""
+	}
+	return d.String()
+}
+
+func (l *ledger) AccountSplits(id int64) ([]string, []transaction.Split, error) {
+	return l.querySplits("SELECT transaction_id, "+splitColumns+" FROM splits WHERE account_id = ? AND user_id = ? ORDER BY date, amount DESC, transaction_id", id, l.userID)
+}
+
+func (l *ledger) AccountSplitsBetween(id int64, from, through transaction.Date) ([]string, []transaction.Split, error) {
+	return l.querySplits("SELECT transaction_id, "+splitColumns+" FROM splits WHERE account_id = ? AND user_id = ? AND date >= ? AND date <= ? ORDER BY date, amount DESC, transaction_id",
+		id, l.userID, sqlDate(from), sqlDate(through))
+}
+
+func (l *ledger) Splits() ([]string, []transaction.Split, error) {
+	return l.querySplits("SELECT transaction_id, "+splitColumns+" FROM splits WHERE user_id = ?", l.userID)
+}
+
+func (l *ledger) TransactionSplits(transactionID string) ([]*transaction.Split, error) {
+	rows, err := l.tx.Query("SELECT transaction_id, "+splitColumns+" FROM splits WHERE user_id = ? AND transaction_id = ? ORDER BY account_id", l.userID, transactionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	splits := make([]*transaction.Split, 0)
+	for rows.Next() {
+		var s transaction.Split
+		if err := scanSplit(rows, &transactionID, &s); err != nil {
+			return nil, err
+		}
+		splits = append(splits, &s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for _, s := range splits {
+		if s.Tags, err = l.loadTags(s.Account, transactionID); err != nil {
+			return nil, err
+		}
+	}
+	return splits, nil
+}
+
+func (l *ledger) PutSplits(transactionID string, splits []*transaction.Split) error {
+	if _, err := l.tx.Exec("INSERT OR IGNORE INTO transactions (user_id, id) VALUES (?, ?)", l.userID, transactionID); err != nil {
+		return err
+	}
+
+	for _, s := range splits {
+		if _, err := l.Account(s.Account); err != nil {
+			return err
+		}
+
+		// Replacing a Split deletes its old tags along with it.
+		if _, err := l.tx.Exec("DELETE FROM splits WHERE account_id = ? AND transaction_id = ?", s.Account, transactionID); err != nil {
+			return err
+		}
+		date, created := sqlDate(s.Date), ""
+		if !s.Created.IsZero() {
+			created = s.Created.UTC().Format(time.RFC3339Nano)
+		}
+		_, err := l.tx.Exec("INSERT INTO splits (transaction_id, user_id, "+splitColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			transactionID, l.userID, s.Account, int64(s.Amount), s.Memo, date, created, s.Payee, s.Reclassified, s.ExternalID)
+		if err != nil {
+			return err
+		}
+
+		for i, tag := range s.Tags {
+			_, err := l.tx.Exec("INSERT INTO split_tags (account_id, transaction_id, position, tag) VALUES (?, ?, ?, ?)",
+				s.Account, transactionID, i, tag)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (l *ledger) AccountSplitsWithExternalID(id int64, externalID string) ([]string, []transaction.Split, error) {
+	return l.querySplits("SELECT transaction_id, "+splitColumns+" FROM splits WHERE account_id = ? AND user_id = ? AND external_id = ? ORDER BY date, amount DESC, transaction_id",
+		id, l.userID, externalID)
+}
+
+// payeeColumns are the columns scanPayee reads, after the id.
+const payeeColumns = "name, default_account, default_memo, aliases"
+
+// scanPayee reads a row of the id and payeeColumns into id and p.
+func scanPayee(row interface {
+	Scan(dest ...interface{}) error
+}, id *int64, p *transaction.Payee) error {
+	var aliases string
+	if err := row.Scan(id, &p.Name, &p.DefaultAccount, &p.DefaultMemo, &aliases); err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(aliases), &p.Aliases)
+}
+
+func (l *ledger) Payee(id int64) (*transaction.Payee, error) {
+	var p transaction.Payee
+	err := scanPayee(l.tx.QueryRow("SELECT id, "+payeeColumns+" FROM payees WHERE id = ? AND user_id = ?", id, l.userID), &id, &p)
+	if err == sql.ErrNoRows {
+		return nil, storage.ErrNoSuchEntity
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (l *ledger) Payees() ([]int64, []transaction.Payee, error) {
+	rows, err := l.tx.Query("SELECT id, "+payeeColumns+" FROM payees WHERE user_id = ? ORDER BY name, id", l.userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]int64, 0)
+	payees := make([]transaction.Payee, 0)
+	for rows.Next() {
+		var id int64
+		var p transaction.Payee
+		if err := scanPayee(rows, &id, &p); err != nil {
+			return nil, nil, err
+		}
+		ids = append(ids, id)
+		payees = append(payees, p)
+	}
+	return ids, payees, rows.Err()
+}
+
+// jsonArray encodes a, which is nil or a slice, as a JSON array.
+func jsonArray(a []string) (string, error) {
+	if a == nil {
+		a = []string{}
+	}
+	b, err := json.Marshal(a)
+	return string(b), err
+}
+
+func (l *ledger) AddPayee(p *transaction.Payee) (int64, error) {
+	aliases, err := jsonArray(p.Aliases)
+	if err != nil {
+		return 0, err
+	}
+	result, err := l.tx.Exec("INSERT INTO payees (user_id, "+payeeColumns+") VALUES (?, ?, ?, ?, ?)",
+		l.userID, p.Name, p.DefaultAccount, p.DefaultMemo, aliases)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func (l *ledger) PutPayee(id int64, p *transaction.Payee) error {
+	aliases, err := jsonArray(p.Aliases)
+	if err != nil {
+		return err
+	}
+	result, err := l.tx.Exec("UPDATE payees SET name = ?, default_account = ?, default_memo = ?, aliases = ? WHERE id = ? AND user_id = ?",
+		p.Name, p.DefaultAccount, p.DefaultMemo, aliases, id, l.userID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return storage.ErrNoSuchEntity
+	}
+	return nil
+}
+
+// ruleColumns are the columns Rules reads, after the id.
+const ruleColumns = "name, priority, memo, min_amount, max_amount, account, counter_account, tags, payee"
+
+func (l *ledger) Rules() ([]int64, []transaction.Rule, error) {
+	rows, err := l.tx.Query("SELECT id, "+ruleColumns+" FROM rules WHERE user_id = ? ORDER BY priority, name, id", l.userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]int64, 0)
+	rules := make([]transaction.Rule, 0)
+	for rows.Next() {
+		var id, minAmount, maxAmount int64
+		var tags string
+		var r transaction.Rule
+		if err := rows.Scan(&id, &r.Name, &r.Priority, &r.Memo, &minAmount, &maxAmount, &r.Account, &r.CounterAccount, &tags, &r.Payee); err != nil {
+			return nil, nil, err
+		}
+		r.MinAmount, r.MaxAmount = transaction.AmountType(minAmount), transaction.AmountType(maxAmount)
+		if err := json.Unmarshal([]byte(tags), &r.Tags); err != nil {
+			return nil, nil, err
+		}
+		ids = append(ids, id)
+		rules = append(rules, r)
+	}
+	return ids, rules, rows.Err()
+}
+
+func (l *ledger) AddRule(r *transaction.Rule) (int64, error) {
+	tags, err := jsonArray(r.Tags)
+	if err != nil {
+		return 0, err
+	}
+	result, err := l.tx.Exec("INSERT INTO rules (user_id, "+ruleColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		l.userID, r.Name, r.Priority, r.Memo, int64(r.MinAmount), int64(r.MaxAmount), r.Account, r.CounterAccount, tags, r.Payee)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+func (l *ledger) ChainHead() (*transaction.ChainHead, error) {
+	var head transaction.ChainHead
+	err := l.tx.QueryRow("SELECT seq, hash FROM chain_heads WHERE user_id = ?", l.userID).Scan(&head.Seq, &head.Hash)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	return &head, nil
+}
+
+func (l *ledger) ChainLinks() ([]transaction.ChainLink, error) {
+	rows, err := l.tx.Query("SELECT seq, transaction_id, hash FROM chain_links WHERE user_id = ? ORDER BY seq", l.userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := make([]transaction.ChainLink, 0)
+	for rows.Next() {
+		var link transaction.ChainLink
+		if err := rows.Scan(&link.Seq, &link.Transaction, &link.Hash); err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+	return links, rows.Err()
+}
+
+func (l *ledger) PutChainLink(head *transaction.ChainHead, link *transaction.ChainLink) error {
+	_, err := l.tx.Exec("INSERT OR REPLACE INTO chain_links (user_id, seq, transaction_id, hash) VALUES (?, ?, ?, ?)",
+		l.userID, link.Seq, link.Transaction, link.Hash)
+	if err != nil {
+		return err
+	}
+	_, err = l.tx.Exec("INSERT OR REPLACE INTO chain_heads (user_id, seq, hash) VALUES (?, ?, ?)", l.userID, head.Seq, head.Hash)
+	return err
+}
+
+func (l *ledger) CategorizerCounts(counters []int64) ([]transaction.CategorizerCounts, error) {
+	result := make([]transaction.CategorizerCounts, len(counters))
+	for i, counter := range counters {
+		var features string
+		err := l.tx.QueryRow("SELECT examples, features, feature_total FROM categorizer_counts WHERE user_id = ? AND counter_account = ?", l.userID, counter).
+			Scan(&result[i].Examples, &features, &result[i].FeatureTotal)
+		if err == sql.ErrNoRows {
+			result[i].Features = make(map[string]int64)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(features), &result[i].Features); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func (l *ledger) PutCategorizerCounts(counters []int64, counts []*transaction.CategorizerCounts) error {
+	for i, counter := range counters {
+		features, err := json.Marshal(counts[i].Features)
+		if err != nil {
+			return err
+		}
+		_, err = l.tx.Exec("INSERT OR REPLACE INTO categorizer_counts (user_id, counter_account, examples, features, feature_total) VALUES (?, ?, ?, ?, ?)",
+			l.userID, counter, counts[i].Examples, string(features), counts[i].FeatureTotal)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package sqlite
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cjc25/ae_money/storage"
+	"github.com/cjc25/ae_money/storage/storagetest"
+	"github.com/cjc25/ae_money/transaction"
+)
+
+// openTestStore opens a Store in a new temporary directory. The returned
+// function closes it and removes the directory.
+func openTestStore(t *testing.T) (*Store, string, func()) {
+	dir, err := ioutil.TempDir("", "sqlite_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "ledger.db")
+	s, err := Open(path)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return s, path, func() {
+		s.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestStore(t *testing.T) {
+	s, _, cleanup := openTestStore(t)
+	defer cleanup()
+
+	storagetest.TestStore(t, s)
+}
+
+func TestStore_PersistsAcrossOpens(t *testing.T) {
+	s, path, cleanup := openTestStore(t)
+	defer cleanup()
+
+	id, err := s.Ledger("test@example.com").AddAccount(&transaction.Account{Name: "a1", Type: transaction.Asset})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	a, err := reopened.Ledger("test@example.com").Account(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Name != "a1" || a.Type != transaction.Asset {
+		t.Errorf("Expected a1, got %+v", a)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	s, path, cleanup := openTestStore(t)
+	defer cleanup()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	version, err := schemaVersion(tx)
+	tx.Rollback()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != len(migrations) {
+		t.Errorf("Expected schema version %v, got %v", len(migrations), version)
+	}
+
+	// Migrating an up to date database does nothing.
+	if err := migrate(s.db); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := s.db.Exec("PRAGMA user_version = 1000"); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	if newer, err := Open(path); err == nil {
+		newer.Close()
+		t.Error("Expected a database from a newer version not to open")
+	}
+}
+
+func TestDeleteAccount_KeepsSplitsAndTags(t *testing.T) {
+	s, _, cleanup := openTestStore(t)
+	defer cleanup()
+
+	const user = "test@example.com"
+	l := s.Ledger(user)
+	ids := make([]int64, 2)
+	for i := range ids {
+		id, err := l.AddAccount(&transaction.Account{Name: "a"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[i] = id
+	}
+	err := storage.CommitTransaction(s, user, "x1", []*transaction.Split{
+		{Amount: -1, Account: ids[0], Tags: []string{"t1", "t2"}},
+		{Amount: 1, Account: ids[1], Tags: []string{"t3"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := l.DeleteAccount(ids[0]); err != storage.ErrAccountHasSplits {
+		t.Fatalf("Expected an account with splits not to be deleted, got %v", err)
+	}
+	for table, expected := range map[string]int{"accounts": 2, "splits": 2, "split_tags": 3} {
+		var count int
+		if err := s.db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&count); err != nil {
+			t.Fatal(err)
+		}
+		if count != expected {
+			t.Errorf("Expected %v rows in %v, got %v", expected, table, count)
+		}
+	}
+}
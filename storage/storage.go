@@ -0,0 +1,148 @@
+// Package storage is the interface between users' ledgers and wherever
+// they're kept, so ledger logic doesn't depend on any one database.
+package storage
+
+import (
+	"errors"
+	"time"
+
+	"github.com/cjc25/ae_money/transaction"
+)
+
+// ErrNoSuchEntity is returned when an Account or Payee doesn't exist.
+var ErrNoSuchEntity = errors.New("storage: no such entity")
+
+// ErrAccountHasSplits is returned when deleting an Account that still has
+// Splits, which would unbalance their transactions.
+var ErrAccountHasSplits = errors.New("storage: can't delete an account which still has splits")
+
+// A Ledger is one user's Accounts, and the Splits of their transactions,
+// along with the Payees, Rules, hash chain and Categorizer that go with them.
+//
+// Splits are identified by their transaction's id and their Account, since a
+// transaction has at most one Split per Account.
+type Ledger interface {
+	// Account gets the Account with id, or ErrNoSuchEntity.
+	Account(id int64) (*transaction.Account, error)
+	// Accounts gets every Account in Name order, along with their ids.
+	Accounts() ([]int64, []transaction.Account, error)
+	// AddAccount stores a new Account, and returns its id, which is never 0.
+	AddAccount(a *transaction.Account) (int64, error)
+	// PutAccounts replaces the Accounts with ids, such as to update their
+	// totals.
+	PutAccounts(ids []int64, accounts []*transaction.Account) error
+	// DeleteAccount deletes the Account with id, or returns
+	// ErrAccountHasSplits if it has any Splits. Deleting an Account that
+	// doesn't exist does nothing.
+	DeleteAccount(id int64) error
+
+	// AccountSplits gets the Splits in the Account with id in Date order, with
+	// the largest Amount first on each day, along with their transactions' ids.
+	AccountSplits(id int64) ([]string, []transaction.Split, error)
+	// AccountSplitsBetween is AccountSplits for just the Splits dated from
+	// from through through.
+	AccountSplitsBetween(id int64, from, through transaction.Date) ([]string, []transaction.Split, error)
+	// Splits gets the Splits in every Account, in no particular order, along
+	// with their transactions' ids.
+	Splits() ([]string, []transaction.Split, error)
+	// TransactionSplits gets the Splits of the transaction with transactionID,
+	// or none if it doesn't exist.
+	TransactionSplits(transactionID string) ([]*transaction.Split, error)
+	// PutSplits stores splits as part of the transaction with transactionID,
+	// replacing any Splits of it in the same Accounts.
+	PutSplits(transactionID string, splits []*transaction.Split) error
+	// AccountSplitsWithExternalID gets the Splits in the Account with id which
+	// have externalID, along with their transactions' ids.
+	AccountSplitsWithExternalID(id int64, externalID string) ([]string, []transaction.Split, error)
+
+	// Payee gets the Payee with id, or ErrNoSuchEntity.
+	Payee(id int64) (*transaction.Payee, error)
+	// Payees gets every Payee in Name order, along with their ids.
+	Payees() ([]int64, []transaction.Payee, error)
+	// AddPayee stores a new Payee, and returns its id, which is never 0.
+	AddPayee(p *transaction.Payee) (int64, error)
+	// PutPayee replaces the Payee with id, such as to add an alias.
+	PutPayee(id int64, p *transaction.Payee) error
+
+	// Rules gets every Rule in the order they're applied, by Priority and then
+	// Name, along with their ids.
+	Rules() ([]int64, []transaction.Rule, error)
+	// AddRule stores a new Rule, and returns its id, which is never 0.
+	AddRule(r *transaction.Rule) (int64, error)
+
+	// ChainHead gets the head of the hash chain of transactions, which is zero
+	// if the chain is empty.
+	ChainHead() (*transaction.ChainHead, error)
+	// ChainLinks gets every link in the hash chain, in Seq order.
+	ChainLinks() ([]transaction.ChainLink, error)
+	// PutChainLink appends link to the hash chain, and makes head its head.
+	PutChainLink(head *transaction.ChainHead, link *transaction.ChainLink) error
+
+	// CategorizerCounts gets what the Categorizer has learned about each of
+	// the counter accounts, which is zero for those it hasn't learned about.
+	CategorizerCounts(counters []int64) ([]transaction.CategorizerCounts, error)
+	// PutCategorizerCounts replaces what the Categorizer has learned about
+	// each of the counter accounts.
+	PutCategorizerCounts(counters []int64, counts []*transaction.CategorizerCounts) error
+}
+
+// A Store keeps every user's Ledger. Users are identified by a string, like
+// their email address.
+type Store interface {
+	// Ledger is user's Ledger outside of any transaction, so each change to it
+	// is atomic on its own.
+	Ledger(user string) Ledger
+
+	// RunInTransaction calls f with user's Ledger in a transaction. If f
+	// returns nil, all of its changes are committed together, and otherwise
+	// none of them are and f's error is returned. Changes made by others while
+	// f runs never interleave with f's. f must not use the Store itself, and
+	// might be called more than once if the Store retries after contention.
+	RunInTransaction(user string, f func(l Ledger) error) error
+}
+
+// PutTransaction validates splits as a transaction, and if it's valid, adds
+// them to their Accounts' totals and stores them in l with transactionID. It's
+// for callers already in a transaction, so they can make other changes
+// atomically with the Splits. Splits without a creation time are stamped with
+// the current time.
+func PutTransaction(l Ledger, transactionID string, splits []*transaction.Split) error {
+	x := transaction.NewTransaction()
+	x.AddSplits(splits)
+	if err := x.ValidateAmount(); err != nil {
+		return err
+	}
+
+	ids := make([]int64, len(splits))
+	accounts := make([]*transaction.Account, len(splits))
+	for i, s := range splits {
+		a, err := l.Account(s.Account)
+		if err != nil {
+			return err
+		}
+		ids[i], accounts[i] = s.Account, a
+		x.AddAccount(a, s.Account)
+	}
+	if err := x.Commit(); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, s := range splits {
+		if s.Created.IsZero() {
+			s.Created = now
+		}
+	}
+	if err := l.PutAccounts(ids, accounts); err != nil {
+		return err
+	}
+	return l.PutSplits(transactionID, splits)
+}
+
+// CommitTransaction is PutTransaction in its own transaction, so all or none
+// of splits are committed to user's Accounts.
+func CommitTransaction(s Store, user, transactionID string, splits []*transaction.Split) error {
+	return s.RunInTransaction(user, func(l Ledger) error {
+		return PutTransaction(l, transactionID, splits)
+	})
+}
@@ -0,0 +1,494 @@
+// Package storagetest checks that a storage.Store behaves like the others, so
+// each implementation can be tested the same way.
+package storagetest
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cjc25/ae_money/storage"
+	"github.com/cjc25/ae_money/transaction"
+)
+
+// TestStore runs every check against s, which must be empty. Each check uses
+// its own user, so they don't interfere.
+func TestStore(t *testing.T, s storage.Store) {
+	testAccounts(t, s)
+	testCommitTransaction(t, s)
+	testInvalidTransaction(t, s)
+	testRollback(t, s)
+	testAccountSplits(t, s)
+	testAccountSplitsBetween(t, s)
+	testSplits(t, s)
+	testDeleteAccount(t, s)
+	testAccountSplitsWithExternalID(t, s)
+	testPayees(t, s)
+	testRules(t, s)
+	testChain(t, s)
+	testCategorizerCounts(t, s)
+	testUsersAreSeparate(t, s)
+}
+
+func testDate(y int, m time.Month, d int) transaction.Date {
+	return transaction.Date{Year: y, Month: m, Day: d}
+}
+
+// addAccountsOrDie adds accounts to user's Ledger, and returns their ids.
+func addAccountsOrDie(t *testing.T, s storage.Store, user string, accounts ...transaction.Account) []int64 {
+	ids := make([]int64, len(accounts))
+	for i := range accounts {
+		id, err := s.Ledger(user).AddAccount(&accounts[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id == 0 {
+			t.Fatalf("Expected a nonzero id for %+v", accounts[i])
+		}
+		ids[i] = id
+	}
+	return ids
+}
+
+func testAccounts(t *testing.T, s storage.Store) {
+	const user = "accounts@example.com"
+	ids := addAccountsOrDie(t, s, user,
+		transaction.Account{Name: "Savings", Type: transaction.Asset},
+		transaction.Account{Name: "Checking", Type: transaction.Asset})
+	if ids[0] == ids[1] {
+		t.Errorf("Expected different ids, got %v", ids)
+	}
+
+	l := s.Ledger(user)
+	a, err := l.Account(ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Name != "Savings" || a.Type != transaction.Asset {
+		t.Errorf("Expected Savings, got %+v", a)
+	}
+	if _, err := l.Account(ids[0] + ids[1]); err != storage.ErrNoSuchEntity {
+		t.Errorf("Expected no such account, got %v", err)
+	}
+
+	gotIDs, accounts, err := l.Accounts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []int64{ids[1], ids[0]}; !reflect.DeepEqual(gotIDs, expected) || len(accounts) != 2 || accounts[0].Name != "Checking" {
+		t.Errorf("Expected accounts %v in name order, got %v: %+v", expected, gotIDs, accounts)
+	}
+}
+
+func testCommitTransaction(t *testing.T, s storage.Store) {
+	const user = "commit@example.com"
+	ids := addAccountsOrDie(t, s, user, transaction.Account{Name: "a1"}, transaction.Account{Name: "a2"})
+
+	splits := []*transaction.Split{
+		{Amount: -123, Account: ids[0], Memo: "Test", Date: testDate(2014, 11, 1), Tags: []string{"x"}},
+		{Amount: 123, Account: ids[1], Memo: "Test", Date: testDate(2014, 11, 1)},
+	}
+	if err := storage.CommitTransaction(s, user, "x1", splits); err != nil {
+		t.Fatal(err)
+	}
+
+	l := s.Ledger(user)
+	for i, expected := range []transaction.AmountType{-123, 123} {
+		a, err := l.Account(ids[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a.Total() != expected {
+			t.Errorf("Expected account %v total %v, got %v", i, expected, a.Total())
+		}
+	}
+
+	got, err := l.TransactionSplits("x1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("Expected 2 splits, got %+v", got)
+	}
+	for _, split := range got {
+		expected := splits[0]
+		if split.Account == ids[1] {
+			expected = splits[1]
+		}
+		if split.Amount != expected.Amount || split.Memo != "Test" || split.Date != testDate(2014, 11, 1) ||
+			!reflect.DeepEqual(split.Tags, expected.Tags) {
+			t.Errorf("Expected split %+v, got %+v", expected, split)
+		}
+		if split.Created.IsZero() {
+			t.Errorf("Expected split %+v to have a creation time", split)
+		}
+	}
+
+	if got, err := l.TransactionSplits("nothing"); err != nil || len(got) != 0 {
+		t.Errorf("Expected no splits for an unknown transaction, got %+v, %v", got, err)
+	}
+}
+
+func testInvalidTransaction(t *testing.T, s storage.Store) {
+	const user = "invalid@example.com"
+	ids := addAccountsOrDie(t, s, user, transaction.Account{Name: "a1"}, transaction.Account{Name: "a2"})
+
+	for _, splits := range [][]*transaction.Split{
+		{{Amount: -123, Account: ids[0]}, {Amount: 124, Account: ids[1]}},
+		{{Amount: -123, Account: ids[0]}, {Amount: 123, Account: ids[0]}},
+		{{Amount: -123, Account: ids[0]}, {Amount: 123, Account: ids[0] + ids[1]}},
+	} {
+		if err := storage.CommitTransaction(s, user, "x1", splits); err == nil {
+			t.Errorf("Expected %+v not to commit", splits)
+		}
+	}
+
+	l := s.Ledger(user)
+	if got, err := l.TransactionSplits("x1"); err != nil || len(got) != 0 {
+		t.Errorf("Expected no splits, got %+v, %v", got, err)
+	}
+	if a, err := l.Account(ids[0]); err != nil || a.Total() != 0 {
+		t.Errorf("Expected no total, got %+v, %v", a, err)
+	}
+}
+
+func testRollback(t *testing.T, s storage.Store) {
+	const user = "rollback@example.com"
+	ids := addAccountsOrDie(t, s, user, transaction.Account{Name: "a1"}, transaction.Account{Name: "a2"})
+
+	failure := errors.New("failure")
+	err := s.RunInTransaction(user, func(l storage.Ledger) error {
+		splits := []*transaction.Split{
+			{Amount: -123, Account: ids[0], Date: testDate(2014, 11, 1)},
+			{Amount: 123, Account: ids[1], Date: testDate(2014, 11, 1)},
+		}
+		if err := storage.PutTransaction(l, "x1", splits); err != nil {
+			return err
+		}
+		if _, err := l.AddAccount(&transaction.Account{Name: "a3"}); err != nil {
+			return err
+		}
+		return failure
+	})
+	if err != failure {
+		t.Errorf("Expected the transaction's error, got %v", err)
+	}
+
+	l := s.Ledger(user)
+	if got, err := l.TransactionSplits("x1"); err != nil || len(got) != 0 {
+		t.Errorf("Expected no splits after rollback, got %+v, %v", got, err)
+	}
+	if a, err := l.Account(ids[0]); err != nil || a.Total() != 0 {
+		t.Errorf("Expected no total after rollback, got %+v, %v", a, err)
+	}
+	if gotIDs, _, err := l.Accounts(); err != nil || len(gotIDs) != 2 {
+		t.Errorf("Expected no new account after rollback, got %v, %v", gotIDs, err)
+	}
+}
+
+func testAccountSplits(t *testing.T, s storage.Store) {
+	const user = "splits@example.com"
+	ids := addAccountsOrDie(t, s, user, transaction.Account{Name: "a1"}, transaction.Account{Name: "a2"})
+
+	for _, x := range []struct {
+		id     string
+		amount transaction.AmountType
+		date   transaction.Date
+	}{
+		{"x1", 100, testDate(2014, 11, 5)},
+		{"x2", 300, testDate(2014, 11, 1)},
+		{"x3", 200, testDate(2014, 11, 5)},
+	} {
+		err := storage.CommitTransaction(s, user, x.id, []*transaction.Split{
+			{Amount: x.amount, Account: ids[0], Date: x.date},
+			{Amount: -x.amount, Account: ids[1], Date: x.date},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	transactionIDs, splits, err := s.Ledger(user).AccountSplits(ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"x2", "x3", "x1"}; !reflect.DeepEqual(transactionIDs, expected) {
+		t.Errorf("Expected transactions %v, got %v", expected, transactionIDs)
+	}
+	if len(splits) != 3 || splits[0].Amount != 300 || splits[1].Amount != 200 || splits[2].Amount != 100 {
+		t.Errorf("Expected splits by date then largest amount, got %+v", splits)
+	}
+}
+
+// commitTestTransactionsOrDie commits a transaction for each of dates, moving
+// amounts[i] from the second of ids to the first.
+func commitTestTransactionsOrDie(t *testing.T, s storage.Store, user string, ids []int64, transactionIDs []string, amounts []transaction.AmountType, dates []transaction.Date) {
+	for i := range transactionIDs {
+		err := storage.CommitTransaction(s, user, transactionIDs[i], []*transaction.Split{
+			{Amount: amounts[i], Account: ids[0], Date: dates[i]},
+			{Amount: -amounts[i], Account: ids[1], Date: dates[i]},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func testAccountSplitsBetween(t *testing.T, s storage.Store) {
+	const user = "between@example.com"
+	ids := addAccountsOrDie(t, s, user, transaction.Account{Name: "a1"}, transaction.Account{Name: "a2"})
+	commitTestTransactionsOrDie(t, s, user, ids,
+		[]string{"x1", "x2", "x3", "x4"},
+		[]transaction.AmountType{100, 200, 300, 400},
+		[]transaction.Date{testDate(2014, 10, 31), testDate(2014, 11, 1), testDate(2014, 11, 30), testDate(2014, 12, 1)})
+
+	transactionIDs, splits, err := s.Ledger(user).AccountSplitsBetween(ids[0], testDate(2014, 11, 1), testDate(2014, 11, 30))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"x2", "x3"}; !reflect.DeepEqual(transactionIDs, expected) {
+		t.Errorf("Expected transactions %v, got %v", expected, transactionIDs)
+	}
+	if len(splits) != 2 || splits[0].Amount != 200 || splits[1].Amount != 300 {
+		t.Errorf("Expected splits from both ends of the range, got %+v", splits)
+	}
+}
+
+func testSplits(t *testing.T, s storage.Store) {
+	const user = "allsplits@example.com"
+	ids := addAccountsOrDie(t, s, user, transaction.Account{Name: "a1"}, transaction.Account{Name: "a2"})
+	commitTestTransactionsOrDie(t, s, user, ids,
+		[]string{"x1", "x2"},
+		[]transaction.AmountType{100, 200},
+		[]transaction.Date{testDate(2014, 11, 1), testDate(2014, 11, 2)})
+
+	transactionIDs, splits, err := s.Ledger(user).Splits()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]transaction.AmountType)
+	for i := range splits {
+		got[fmt.Sprint(transactionIDs[i], " ", splits[i].Account)] = splits[i].Amount
+	}
+	expected := map[string]transaction.AmountType{
+		fmt.Sprint("x1 ", ids[0]): 100, fmt.Sprint("x1 ", ids[1]): -100,
+		fmt.Sprint("x2 ", ids[0]): 200, fmt.Sprint("x2 ", ids[1]): -200,
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected splits %v, got %v", expected, got)
+	}
+}
+
+func testDeleteAccount(t *testing.T, s storage.Store) {
+	const user = "delete@example.com"
+	ids := addAccountsOrDie(t, s, user,
+		transaction.Account{Name: "a1"}, transaction.Account{Name: "a2"}, transaction.Account{Name: "a3"})
+	commitTestTransactionsOrDie(t, s, user, ids[1:],
+		[]string{"x1"}, []transaction.AmountType{100}, []transaction.Date{testDate(2014, 11, 1)})
+
+	l := s.Ledger(user)
+	if err := l.DeleteAccount(ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Account(ids[0]); err != storage.ErrNoSuchEntity {
+		t.Errorf("Expected deleted account to be gone, got %v", err)
+	}
+	if gotIDs, _, err := l.Accounts(); err != nil || !reflect.DeepEqual(gotIDs, ids[1:]) {
+		t.Errorf("Expected only %v left, got %v, %v", ids[1:], gotIDs, err)
+	}
+
+	// An account with splits can't be deleted, since its transactions would
+	// no longer balance.
+	if err := l.DeleteAccount(ids[1]); err != storage.ErrAccountHasSplits {
+		t.Errorf("Expected an account with splits not to be deleted, got %v", err)
+	}
+	if _, splits, err := l.AccountSplits(ids[1]); err != nil || len(splits) != 1 {
+		t.Errorf("Expected the account's split to be kept, got %+v, %v", splits, err)
+	}
+
+	// Deleting an account that doesn't exist does nothing.
+	if err := l.DeleteAccount(ids[0]); err != nil {
+		t.Errorf("Expected deleting a missing account to do nothing, got %v", err)
+	}
+}
+
+func testAccountSplitsWithExternalID(t *testing.T, s storage.Store) {
+	const user = "externalid@example.com"
+	ids := addAccountsOrDie(t, s, user, transaction.Account{Name: "a1"}, transaction.Account{Name: "a2"})
+	for i, externalID := range []string{"bank-1", "bank-2", ""} {
+		err := storage.CommitTransaction(s, user, fmt.Sprint("x", i), []*transaction.Split{
+			{Amount: 100, Account: ids[0], Date: testDate(2014, 11, 1), ExternalID: externalID},
+			{Amount: -100, Account: ids[1], Date: testDate(2014, 11, 1)},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	l := s.Ledger(user)
+	transactionIDs, splits, err := l.AccountSplitsWithExternalID(ids[0], "bank-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(transactionIDs, []string{"x1"}) || len(splits) != 1 || splits[0].ExternalID != "bank-2" {
+		t.Errorf("Expected just x1, got %v: %+v", transactionIDs, splits)
+	}
+	if transactionIDs, _, err := l.AccountSplitsWithExternalID(ids[1], "bank-2"); err != nil || len(transactionIDs) != 0 {
+		t.Errorf("Expected no splits in the other account, got %v, %v", transactionIDs, err)
+	}
+}
+
+func testPayees(t *testing.T, s storage.Store) {
+	const user = "payees@example.com"
+	l := s.Ledger(user)
+	var ids []int64
+	for _, p := range []transaction.Payee{{Name: "Trader Joe's", DefaultMemo: "Groceries"}, {Name: "Landlord"}} {
+		id, err := l.AddPayee(&p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id == 0 {
+			t.Fatalf("Expected a nonzero id for %+v", p)
+		}
+		ids = append(ids, id)
+	}
+
+	p, err := l.Payee(ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "Trader Joe's" || p.DefaultMemo != "Groceries" || len(p.Aliases) != 0 {
+		t.Errorf("Expected Trader Joe's, got %+v", p)
+	}
+	if _, err := l.Payee(ids[0] + ids[1]); err != storage.ErrNoSuchEntity {
+		t.Errorf("Expected no such payee, got %v", err)
+	}
+
+	p.Aliases = []string{"TRADER JOE'S #123"}
+	if err := l.PutPayee(ids[0], p); err != nil {
+		t.Fatal(err)
+	}
+	gotIDs, payees, err := l.Payees()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []int64{ids[1], ids[0]}; !reflect.DeepEqual(gotIDs, expected) || len(payees) != 2 {
+		t.Fatalf("Expected payees %v in name order, got %v: %+v", expected, gotIDs, payees)
+	}
+	if !reflect.DeepEqual(payees[1].Aliases, p.Aliases) {
+		t.Errorf("Expected aliases %v, got %+v", p.Aliases, payees[1])
+	}
+}
+
+func testRules(t *testing.T, s storage.Store) {
+	const user = "rules@example.com"
+	l := s.Ledger(user)
+	var ids []int64
+	for _, r := range []transaction.Rule{
+		{Name: "b", Priority: 2, Memo: "rent", MinAmount: -200000, MaxAmount: -100000, Account: 1, CounterAccount: 2, Tags: []string{"home"}, Payee: 3},
+		{Name: "c", Priority: 1},
+		{Name: "a", Priority: 2},
+	} {
+		id, err := l.AddRule(&r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id == 0 {
+			t.Fatalf("Expected a nonzero id for %+v", r)
+		}
+		ids = append(ids, id)
+	}
+
+	gotIDs, rules, err := l.Rules()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []int64{ids[1], ids[2], ids[0]}; !reflect.DeepEqual(gotIDs, expected) || len(rules) != 3 {
+		t.Fatalf("Expected rules %v in priority and name order, got %v: %+v", expected, gotIDs, rules)
+	}
+	r := rules[2]
+	if r.Memo != "rent" || r.MinAmount != -200000 || r.MaxAmount != -100000 || r.Account != 1 ||
+		r.CounterAccount != 2 || !reflect.DeepEqual(r.Tags, []string{"home"}) || r.Payee != 3 {
+		t.Errorf("Expected the rule as added, got %+v", r)
+	}
+}
+
+func testChain(t *testing.T, s storage.Store) {
+	const user = "chain@example.com"
+	l := s.Ledger(user)
+	head, err := l.ChainHead()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head.Seq != 0 || len(head.Hash) != 0 {
+		t.Errorf("Expected an empty chain, got %+v", head)
+	}
+
+	var links []transaction.ChainLink
+	for _, transactionID := range []string{"x1", "x2"} {
+		link := head.Next(transactionID, nil)
+		if err := l.PutChainLink(head, link); err != nil {
+			t.Fatal(err)
+		}
+		links = append(links, *link)
+	}
+
+	got, err := l.ChainHead()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, head) {
+		t.Errorf("Expected head %+v, got %+v", head, got)
+	}
+	gotLinks, err := l.ChainLinks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotLinks, links) {
+		t.Errorf("Expected links %+v, got %+v", links, gotLinks)
+	}
+}
+
+func testCategorizerCounts(t *testing.T, s storage.Store) {
+	const user = "categorizer@example.com"
+	l := s.Ledger(user)
+	counts := &transaction.CategorizerCounts{Examples: 2, Features: map[string]int64{"trader": 2, "joe's": 1}, FeatureTotal: 3}
+	if err := l.PutCategorizerCounts([]int64{1}, []*transaction.CategorizerCounts{counts}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := l.CategorizerCounts([]int64{1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("Expected counts for both accounts, got %+v", got)
+	}
+	if !reflect.DeepEqual(got[0], *counts) {
+		t.Errorf("Expected %+v, got %+v", *counts, got[0])
+	}
+	if got[1].Examples != 0 || len(got[1].Features) != 0 || got[1].FeatureTotal != 0 {
+		t.Errorf("Expected nothing learned about an unknown account, got %+v", got[1])
+	}
+}
+
+func testUsersAreSeparate(t *testing.T, s storage.Store) {
+	ids := addAccountsOrDie(t, s, "one@example.com", transaction.Account{Name: "a1"})
+
+	l := s.Ledger("two@example.com")
+	if _, err := l.Account(ids[0]); err != storage.ErrNoSuchEntity {
+		t.Errorf("Expected another user's account to be hidden, got %v", err)
+	}
+	if gotIDs, _, err := l.Accounts(); err != nil || len(gotIDs) != 0 {
+		t.Errorf("Expected no accounts, got %v, %v", gotIDs, err)
+	}
+
+	if _, err := s.Ledger("one@example.com").AddPayee(&transaction.Payee{Name: "p1"}); err != nil {
+		t.Fatal(err)
+	}
+	if gotIDs, _, err := l.Payees(); err != nil || len(gotIDs) != 0 {
+		t.Errorf("Expected no payees, got %v, %v", gotIDs, err)
+	}
+}
@@ -3,17 +3,36 @@ package transaction
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"strings"
 )
 
+// An AccountType classifies an Account for reports and for features that only
+// make sense for some kinds of Account, like loans.
+type AccountType string
+
+const (
+	Asset     AccountType = "asset"
+	Liability AccountType = "liability"
+	Equity    AccountType = "equity"
+	Income    AccountType = "income"
+	Expense   AccountType = "expense"
+)
+
 // An Account can receive Splits in a Transaction.
 //
 // Note that Accounts are more general than something like a real-life account
 // at a bank. They can represent any category of income or expense, like
 // "Salary" or "Rent."
+//
+// Parent optionally nests the Account under another of the same Type, so
+// reports can group and subtotal them, like "Groceries" under "Food".
 type Account struct {
-	total AmountType
-	Name  string `json:"name"`
+	total   AmountType
+	unknown *unknownProperties
+	Name    string      `json:"name"`
+	Type    AccountType `json:"type"`
+	Parent  int64       `json:"parent,omitempty"`
 }
 
 // Make sure an Account has valid fields. Useful if it was created with
@@ -24,14 +43,38 @@ func (a *Account) Validate() error {
 	if a.Name == "" {
 		return errors.New("Empty account name.")
 	}
+
+	// Accounts created before types existed have none, so it's still allowed.
+	switch a.Type {
+	case "", Asset, Liability, Equity, Income, Expense:
+	default:
+		return fmt.Errorf("Unknown account type %q", a.Type)
+	}
 	return nil
 }
 
+// Total is the sum of every Split committed to the Account.
+func (a *Account) Total() AmountType {
+	return a.total
+}
+
+// RestoreTotal sets the total of an Account loaded from storage, which
+// couldn't set it itself. Only Commit should change the total otherwise.
+func (a *Account) RestoreTotal(total AmountType) {
+	a.total = total
+}
+
 func (a *Account) MarshalJSON() ([]byte, error) {
 	representation := map[string]interface{}{
 		"name":  a.Name,
 		"total": a.total,
 	}
+	if a.Type != "" {
+		representation["type"] = a.Type
+	}
+	if a.Parent != 0 {
+		representation["parent"] = a.Parent
+	}
 
 	return json.Marshal(representation)
 }
@@ -3,27 +3,37 @@
 package transaction
 
 import (
-	"fmt"
-
 	"appengine/datastore"
 )
 
 // Implement PropertyLoadSaver for transaction.Account to save the hidden field
-// total.
+// total. Older Accounts are upgraded to the current schema as they're loaded.
+// Properties from newer ones are kept in the hidden field unknown and saved
+// again as they were, so adding one doesn't break code that doesn't know about
+// it yet.
 func (a *Account) Load(c <-chan datastore.Property) error {
-	err := error(nil)
+	props, version, err := upgrade(c, accountMigrations)
+	if err != nil {
+		return err
+	}
 
-	for p := range c {
+	var unknown []datastore.Property
+	for _, p := range props {
 		if p.Name == "Name" {
 			a.Name = p.Value.(string)
 		} else if p.Name == "Total" {
 			a.total = AmountType(p.Value.(int64))
+		} else if p.Name == "Type" {
+			a.Type = AccountType(p.Value.(string))
+		} else if p.Name == "Parent" {
+			a.Parent = p.Value.(int64)
 		} else {
-			err = fmt.Errorf("Unexpected property type %v", p.Name)
+			unknown = append(unknown, p)
 		}
 	}
+	a.unknown = keepUnknown(unknown, version, AccountSchemaVersion)
 
-	return err
+	return nil
 }
 
 // See Account.Load.
@@ -38,6 +48,15 @@ func (a *Account) Save(c chan<- datastore.Property) error {
 		Name:  "Total",
 		Value: int64(a.total),
 	}
+	c <- datastore.Property{
+		Name:  "Type",
+		Value: string(a.Type),
+	}
+	c <- datastore.Property{
+		Name:  "Parent",
+		Value: a.Parent,
+	}
+	saveUnknown(c, a.unknown, AccountSchemaVersion)
 
 	return nil
 }
@@ -9,7 +9,7 @@ import (
 )
 
 func TestAccountSaveAndLoad(t *testing.T) {
-	saved := &Account{Name: "myname", total: 12345}
+	saved := &Account{Name: "myname", total: 12345, Type: Liability, Parent: 42}
 
 	propChan := make(chan datastore.Property)
 	go func() {
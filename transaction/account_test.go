@@ -48,3 +48,69 @@ func TestMarshalJSON(t *testing.T) {
 		t.Errorf("Expected JSON string %v but got %v", expected, got)
 	}
 }
+
+func TestValidate_ValidType(t *testing.T) {
+	a := Account{Name: "valid", Type: Liability}
+
+	if err := a.Validate(); err != nil {
+		t.Errorf("Expected valid, got %v", err)
+	}
+}
+
+func TestValidate_InvalidType(t *testing.T) {
+	a := Account{Name: "valid", Type: "bogus"}
+
+	err := a.Validate()
+	if err == nil {
+		t.Errorf("Expected invalid, got valid.")
+	}
+}
+
+func TestMarshalJSON_Type(t *testing.T) {
+	a := Account{Name: "myname", total: 12345, Type: Asset}
+
+	json, err := a.MarshalJSON()
+	if err != nil {
+		t.Error(err)
+	}
+
+	expected := `{"name":"myname","total":12345,"type":"asset"}`
+	got := string(json)
+
+	if got != expected {
+		t.Errorf("Expected JSON string %v but got %v", expected, got)
+	}
+}
+
+func TestMarshalJSON_Parent(t *testing.T) {
+	a := Account{Name: "myname", total: 12345, Type: Expense, Parent: 42}
+
+	json, err := a.MarshalJSON()
+	if err != nil {
+		t.Error(err)
+	}
+
+	expected := `{"name":"myname","parent":42,"total":12345,"type":"expense"}`
+	got := string(json)
+
+	if got != expected {
+		t.Errorf("Expected JSON string %v but got %v", expected, got)
+	}
+}
+
+func TestTotal(t *testing.T) {
+	a := Account{Name: "myname", total: 12345}
+
+	if a.Total() != 12345 {
+		t.Errorf("Expected total 12345, got %v", a.Total())
+	}
+}
+
+func TestRestoreTotal(t *testing.T) {
+	a := Account{Name: "myname"}
+	a.RestoreTotal(12345)
+
+	if a.Total() != 12345 {
+		t.Errorf("Expected total 12345, got %v", a.Total())
+	}
+}
@@ -0,0 +1,116 @@
+package transaction
+
+import (
+	"errors"
+	"math/big"
+	"sort"
+)
+
+// Allocate divides total into amounts proportional to weights, which sum to
+// exactly total.
+//
+// Each amount is first rounded toward zero. The units left over are then
+// handed out one at a time, to the amounts with the largest discarded
+// remainders, with ties going to the earliest weight. So allocating 10001
+// with weights 1, 1, 1 gives 3334, 3334, 3333, and the result only depends on
+// the order of the weights.
+//
+// Weights can be any non-negative numbers, like percentages or shares, but at
+// least one must be positive. The arithmetic is exact, so huge totals and
+// weights neither overflow nor lose precision.
+func Allocate(total AmountType, weights []int64) ([]AmountType, error) {
+	if len(weights) == 0 {
+		return nil, errors.New("No weights to allocate between.")
+	}
+	sum := new(big.Int)
+	for _, w := range weights {
+		if w < 0 {
+			return nil, errors.New("Allocation weights can't be negative.")
+		}
+		sum.Add(sum, big.NewInt(w))
+	}
+	if sum.Sign() == 0 {
+		return nil, errors.New("Allocation weights add to 0.")
+	}
+
+	// Work with a positive total, so rounding toward zero always rounds down.
+	// Its magnitude doesn't fit an int64 if total is the most negative one.
+	sign := int64(1)
+	magnitude := big.NewInt(int64(total))
+	if total < 0 {
+		sign = -1
+		magnitude.Neg(magnitude)
+	}
+
+	amounts := make([]*big.Int, len(weights))
+	remainders := make([]*big.Int, len(weights))
+	allocated := new(big.Int)
+	for i, w := range weights {
+		amounts[i], remainders[i] = new(big.Int), new(big.Int)
+		amounts[i].QuoRem(new(big.Int).Mul(magnitude, big.NewInt(w)), sum, remainders[i])
+		allocated.Add(allocated, amounts[i])
+	}
+
+	order := make([]int, len(weights))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return remainders[order[a]].Cmp(remainders[order[b]]) > 0
+	})
+	// Each amount was rounded down by less than 1, so fewer than len(weights)
+	// units are left over.
+	one := big.NewInt(1)
+	for i := 0; i < len(order) && allocated.Cmp(magnitude) < 0; i++ {
+		amounts[order[i]].Add(amounts[order[i]], one)
+		allocated.Add(allocated, one)
+	}
+
+	result := make([]AmountType, len(amounts))
+	for i, a := range amounts {
+		// Every amount is between 0 and total, so it fits once signed again.
+		result[i] = AmountType(a.Mul(a, big.NewInt(sign)).Int64())
+	}
+	return result, nil
+}
+
+// AllocateBalance completes a transaction's amounts using weights, which
+// parallels amounts. The amounts with a positive weight must be 0, and are
+// replaced by an Allocate of the amount that makes the transaction add to 0.
+// Amounts with a zero weight are left alone.
+//
+// For example, paying 10001 from one account and splitting it 60/40 between
+// two others is the amounts -10001, 0, 0 with weights 0, 60, 40.
+func AllocateBalance(amounts []AmountType, weights []int64) ([]AmountType, error) {
+	if len(amounts) != len(weights) {
+		return nil, errors.New("Amounts and weights of different lengths")
+	}
+
+	var fixed AmountType
+	weighted := make([]int64, 0)
+	for i := range amounts {
+		if weights[i] == 0 {
+			fixed += amounts[i]
+			continue
+		}
+		if amounts[i] != 0 {
+			return nil, errors.New("Split has both an amount and a weight.")
+		}
+		weighted = append(weighted, weights[i])
+	}
+
+	allocated, err := Allocate(-fixed, weighted)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]AmountType, len(amounts))
+	for i := range amounts {
+		if weights[i] == 0 {
+			result[i] = amounts[i]
+			continue
+		}
+		result[i], allocated = allocated[0], allocated[1:]
+	}
+	return result, nil
+}
@@ -0,0 +1,121 @@
+package transaction
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+// Expectation function for allocated amounts.
+func expectAmounts(t *testing.T, expected, got []AmountType) {
+	if len(expected) != len(got) {
+		t.Fatalf("Expected amounts %v, got %v", expected, got)
+	}
+	for i := range expected {
+		if expected[i] != got[i] {
+			t.Errorf("Expected amounts %v, got %v", expected, got)
+			return
+		}
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	for _, test := range []struct {
+		total    AmountType
+		weights  []int64
+		expected []AmountType
+	}{
+		{10001, []int64{1, 1, 1}, []AmountType{3334, 3334, 3333}},
+		{-10001, []int64{1, 1, 1}, []AmountType{-3334, -3334, -3333}},
+		{10001, []int64{60, 40}, []AmountType{6001, 4000}},
+		{100, []int64{1, 0, 1}, []AmountType{50, 0, 50}},
+		{2, []int64{1, 1, 1}, []AmountType{1, 1, 0}},
+		{10, []int64{1, 2}, []AmountType{3, 7}},
+		{0, []int64{1, 1}, []AmountType{0, 0}},
+	} {
+		got, err := Allocate(test.total, test.weights)
+		if err != nil {
+			t.Errorf("Failed to allocate %v with weights %v: %v", test.total, test.weights, err)
+			continue
+		}
+		expectAmounts(t, test.expected, got)
+	}
+}
+
+func TestAllocate_AddsToTotal(t *testing.T) {
+	weights := []int64{7, 13, 29, 1, 50}
+	for total := AmountType(-1000); total <= 1000; total += 37 {
+		got, err := Allocate(total, weights)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var sum AmountType
+		for _, a := range got {
+			sum += a
+		}
+		if sum != total {
+			t.Errorf("Expected allocation of %v to add up, got %v", total, got)
+		}
+	}
+}
+
+func TestAllocate_Huge(t *testing.T) {
+	for _, test := range []struct {
+		total    AmountType
+		weights  []int64
+		expected []AmountType
+	}{
+		{1e12, []int64{3e9, 3e9 + 1}, []AmountType{499999999917, 500000000083}},
+		{-1e12, []int64{3e9, 3e9 + 1}, []AmountType{-499999999917, -500000000083}},
+		{math.MaxInt64, []int64{math.MaxInt64, math.MaxInt64}, []AmountType{math.MaxInt64/2 + 1, math.MaxInt64 / 2}},
+		{math.MinInt64, []int64{math.MaxInt64, math.MaxInt64}, []AmountType{math.MinInt64 / 2, math.MinInt64 / 2}},
+		{math.MinInt64, []int64{0, math.MaxInt64}, []AmountType{0, math.MinInt64}},
+		{math.MaxInt64, []int64{1, math.MaxInt64, 0}, []AmountType{1, math.MaxInt64 - 1, 0}},
+		{-7, []int64{0, 0, 1, 0}, []AmountType{0, 0, -7, 0}},
+	} {
+		got, err := Allocate(test.total, test.weights)
+		if err != nil {
+			t.Errorf("Failed to allocate %v with weights %v: %v", test.total, test.weights, err)
+			continue
+		}
+		expectAmounts(t, test.expected, got)
+	}
+}
+
+func TestAllocate_Invalid(t *testing.T) {
+	for _, weights := range [][]int64{nil, {0}, {0, 0}, {1, -1}, {-1, 2}, {math.MinInt64, math.MaxInt64}} {
+		for _, total := range []AmountType{100, -100} {
+			if _, err := Allocate(total, weights); err == nil {
+				t.Errorf("Expected weights %v to be invalid for %v", weights, total)
+			}
+		}
+	}
+}
+
+func TestAllocateBalance(t *testing.T) {
+	got, err := AllocateBalance([]AmountType{-10001, 0, 0}, []int64{0, 60, 40})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectAmounts(t, []AmountType{-10001, 6001, 4000}, got)
+}
+
+func TestAllocateBalance_Invalid(t *testing.T) {
+	if _, err := AllocateBalance([]AmountType{-100, 5}, []int64{0, 1}); err == nil {
+		t.Errorf("Expected split with amount and weight to be invalid")
+	}
+	if _, err := AllocateBalance([]AmountType{-100}, []int64{0, 1}); err == nil {
+		t.Errorf("Expected different lengths to be invalid")
+	}
+	if _, err := AllocateBalance([]AmountType{-100, 100}, []int64{0, 0}); err == nil {
+		t.Errorf("Expected no weights to be invalid")
+	}
+}
+
+func ExampleAllocate() {
+	amounts, _ := Allocate(10001, []int64{1, 1, 1})
+	fmt.Println(amounts)
+
+	// Output:
+	// [3334 3334 3333]
+}
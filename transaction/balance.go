@@ -0,0 +1,107 @@
+package transaction
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+)
+
+// A BalanceSheet is the balance of each Asset, Liability and Equity Account at
+// the end of Date, grouped by the Account hierarchy. Liabilities and Equity
+// are shown as positive, though they're stored as negative amounts.
+//
+// RetainedEarnings is the net income of every Income and Expense Account up to
+// Date, and is included in TotalEquity, so that TotalAssets equals
+// TotalLiabilities plus TotalEquity. Accounts created before types existed
+// can't be classified, so they're listed in Unclassified, with their balances
+// as they're stored, and TotalUnclassified is added to TotalAssets when
+// checking the sheet balances.
+type BalanceSheet struct {
+	Date              Date         `json:"date"`
+	Assets            []ReportLine `json:"assets"`
+	Liabilities       []ReportLine `json:"liabilities"`
+	Equity            []ReportLine `json:"equity"`
+	Unclassified      []ReportLine `json:"unclassified,omitempty"`
+	RetainedEarnings  AmountType   `json:"retainedEarnings"`
+	TotalAssets       AmountType   `json:"totalAssets"`
+	TotalLiabilities  AmountType   `json:"totalLiabilities"`
+	TotalEquity       AmountType   `json:"totalEquity"`
+	TotalUnclassified AmountType   `json:"totalUnclassified,omitempty"`
+}
+
+// NewBalanceSheet builds the BalanceSheet at the end of date from splits, the
+// whole Split history of accounts.
+//
+// Since every committed transaction balances, so does the sheet. If it
+// doesn't, or if a Split isn't in any of accounts, the ledger is corrupt, and
+// an error is returned instead.
+func NewBalanceSheet(accounts map[int64]Account, splits []Split, date Date) (*BalanceSheet, error) {
+	own := make(map[int64][]AmountType)
+	var earnings AmountType
+	for _, s := range splits {
+		if s.Date.After(date) {
+			continue
+		}
+		a, ok := accounts[s.Account]
+		if !ok {
+			return nil, fmt.Errorf("Split %+v is in unknown account %v", s, s.Account)
+		}
+		if a.Type == Income || a.Type == Expense {
+			earnings -= s.Amount
+			continue
+		}
+		if own[s.Account] == nil {
+			own[s.Account] = make([]AmountType, 1)
+		}
+		own[s.Account][0] += s.Amount
+	}
+
+	result := &BalanceSheet{Date: date, RetainedEarnings: earnings}
+	var total []AmountType
+	result.Assets, total = hierarchyLines(accounts, Asset, own, 1, 1)
+	result.TotalAssets = total[0]
+	result.Liabilities, total = hierarchyLines(accounts, Liability, own, 1, -1)
+	result.TotalLiabilities = total[0]
+	result.Equity, total = hierarchyLines(accounts, Equity, own, 1, -1)
+	result.TotalEquity = total[0] + earnings
+	result.Unclassified, total = hierarchyLines(accounts, "", own, 1, 1)
+	result.TotalUnclassified = total[0]
+	if len(result.Unclassified) == 0 {
+		result.Unclassified = nil
+	}
+
+	if result.TotalAssets+result.TotalUnclassified != result.TotalLiabilities+result.TotalEquity {
+		return nil, fmt.Errorf("Ledger is corrupt: assets of %v don't equal liabilities of %v plus equity of %v",
+			result.TotalAssets+result.TotalUnclassified, result.TotalLiabilities, result.TotalEquity)
+	}
+	return result, nil
+}
+
+// WriteCSV writes s to w as CSV, with a column of Account names, indented by
+// depth, and a column of balances.
+func (s *BalanceSheet) WriteCSV(w io.Writer) error {
+	c := csv.NewWriter(w)
+	if err := c.Write([]string{"Account", s.Date.String()}); err != nil {
+		return err
+	}
+	if err := writeCSVSection(c, "Assets", s.Assets, []AmountType{s.TotalAssets}); err != nil {
+		return err
+	}
+	if err := writeCSVSection(c, "Liabilities", s.Liabilities, []AmountType{s.TotalLiabilities}); err != nil {
+		return err
+	}
+	equity := append(append([]ReportLine{}, s.Equity...), ReportLine{Name: "Retained earnings", Amounts: []AmountType{s.RetainedEarnings}})
+	if err := writeCSVSection(c, "Equity", equity, []AmountType{s.TotalEquity}); err != nil {
+		return err
+	}
+	if len(s.Unclassified) > 0 {
+		if err := writeCSVSection(c, "Unclassified", s.Unclassified, []AmountType{s.TotalUnclassified}); err != nil {
+			return err
+		}
+	}
+	if err := c.Write(csvRow("Total liabilities and equity", []AmountType{s.TotalLiabilities + s.TotalEquity})); err != nil {
+		return err
+	}
+	c.Flush()
+	return c.Error()
+}
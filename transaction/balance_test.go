@@ -0,0 +1,105 @@
+package transaction
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestNewBalanceSheet(t *testing.T) {
+	accounts := map[int64]Account{
+		1: {Name: "Bank", Type: Asset},
+		2: {Name: "Checking", Type: Asset, Parent: 1},
+		3: {Name: "Credit Card", Type: Liability},
+		4: {Name: "Opening Balances", Type: Equity},
+		5: {Name: "Salary", Type: Income},
+		6: {Name: "Groceries", Type: Expense},
+		7: {Name: "Old", Type: ""},
+	}
+	splits := []Split{
+		{Amount: 100000, Account: 2, Date: testDate(2014, 10, 1)},
+		{Amount: -100000, Account: 4, Date: testDate(2014, 10, 1)},
+		{Amount: 300000, Account: 2, Date: testDate(2014, 10, 31)},
+		{Amount: -300000, Account: 5, Date: testDate(2014, 10, 31)},
+		{Amount: 40000, Account: 6, Date: testDate(2014, 11, 3)},
+		{Amount: -40000, Account: 3, Date: testDate(2014, 11, 3)},
+		{Amount: 500, Account: 7, Date: testDate(2014, 11, 4)},
+		{Amount: -500, Account: 2, Date: testDate(2014, 11, 4)},
+		{Amount: 1000, Account: 6, Date: testDate(2014, 12, 1)},
+		{Amount: -1000, Account: 3, Date: testDate(2014, 12, 1)},
+	}
+
+	got, err := NewBalanceSheet(accounts, splits, testDate(2014, 11, 30))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &BalanceSheet{
+		Date: testDate(2014, 11, 30),
+		Assets: []ReportLine{
+			{1, "Bank", 0, []AmountType{399500}},
+			{2, "Checking", 1, []AmountType{399500}},
+		},
+		Liabilities:       []ReportLine{{3, "Credit Card", 0, []AmountType{40000}}},
+		Equity:            []ReportLine{{4, "Opening Balances", 0, []AmountType{100000}}},
+		Unclassified:      []ReportLine{{7, "Old", 0, []AmountType{500}}},
+		RetainedEarnings:  260000,
+		TotalAssets:       399500,
+		TotalLiabilities:  40000,
+		TotalEquity:       360000,
+		TotalUnclassified: 500,
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, got)
+	}
+}
+
+func TestNewBalanceSheet_FailureUnbalanced(t *testing.T) {
+	accounts := map[int64]Account{1: {Name: "Checking", Type: Asset}, 2: {Name: "Salary", Type: Income}}
+
+	if _, err := NewBalanceSheet(accounts, []Split{
+		{Amount: 100, Account: 1, Date: testDate(2014, 11, 1)},
+		{Amount: -99, Account: 2, Date: testDate(2014, 11, 1)},
+	}, testDate(2014, 11, 30)); err == nil {
+		t.Error("Expected unbalanced ledger to fail")
+	}
+
+	if _, err := NewBalanceSheet(accounts, []Split{
+		{Amount: 100, Account: 1, Date: testDate(2014, 11, 1)},
+		{Amount: -100, Account: 3, Date: testDate(2014, 11, 1)},
+	}, testDate(2014, 11, 30)); err == nil {
+		t.Error("Expected split in unknown account to fail")
+	}
+}
+
+func TestBalanceSheetWriteCSV(t *testing.T) {
+	s := &BalanceSheet{
+		Date:             testDate(2014, 11, 30),
+		Assets:           []ReportLine{{1, "Checking", 0, []AmountType{100}}},
+		Liabilities:      []ReportLine{},
+		Equity:           []ReportLine{},
+		RetainedEarnings: 100,
+		TotalAssets:      100,
+		TotalEquity:      100,
+	}
+
+	var b bytes.Buffer
+	if err := s.WriteCSV(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `Account,2014-11-30
+Assets
+"  Checking",100
+Total assets,100
+Liabilities
+Total liabilities,0
+Equity
+"  Retained earnings",100
+Total equity,100
+Total liabilities and equity,100
+`
+	if b.String() != expected {
+		t.Errorf("Expected CSV\n%v\ngot\n%v", expected, b.String())
+	}
+}
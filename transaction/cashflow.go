@@ -0,0 +1,166 @@
+package transaction
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// An Activity classifies an Account for a CashFlowStatement. Cash Accounts
+// hold the cash, and money moving in or out of them is classified by the
+// Activity of the counter Account.
+type Activity string
+
+const (
+	Cash      Activity = "cash"
+	Operating Activity = "operating"
+	Investing Activity = "investing"
+	Financing Activity = "financing"
+)
+
+// Make sure an Activity is known. Useful if it was provided by a user.
+func (a Activity) Validate() error {
+	switch a {
+	case Cash, Operating, Investing, Financing:
+		return nil
+	}
+	return fmt.Errorf("Unknown cash flow activity %q", a)
+}
+
+// DefaultActivity is the Activity of Accounts of type t that haven't been
+// classified. Assets are cash, since most users' assets are bank accounts,
+// so investments need to be classified as Investing. Borrowing and owners'
+// money is Financing, and everything else is Operating.
+func DefaultActivity(t AccountType) Activity {
+	switch t {
+	case Asset:
+		return Cash
+	case Liability, Equity:
+		return Financing
+	}
+	return Operating
+}
+
+// A CashFlowStatement explains the change in the balance of Cash Accounts over
+// Period, from Opening to Closing, by the Activity of the counter Accounts
+// the cash moved to or from. Each ReportLine is a counter Account, with one
+// amount: the cash it brought in, or negative if the cash went out. Money
+// moved between Cash Accounts is left out, since it's still cash.
+type CashFlowStatement struct {
+	Period         DateRange    `json:"period"`
+	Opening        AmountType   `json:"opening"`
+	Operating      []ReportLine `json:"operating"`
+	Investing      []ReportLine `json:"investing"`
+	Financing      []ReportLine `json:"financing"`
+	TotalOperating AmountType   `json:"totalOperating"`
+	TotalInvesting AmountType   `json:"totalInvesting"`
+	TotalFinancing AmountType   `json:"totalFinancing"`
+	NetChange      AmountType   `json:"netChange"`
+	Closing        AmountType   `json:"closing"`
+}
+
+// NewCashFlowStatement builds the CashFlowStatement for period from splits, the
+// whole Split history of accounts. ids parallels splits, and holds each
+// Split's transaction id. classes holds the Activity of each Account that's
+// been classified, and the rest have their DefaultActivity.
+//
+// A transaction is in period if any of its Cash Splits are. The cash it moved
+// is attributed to its other Splits, each of which moved as much cash as it
+// took, so cash spent partly on credit is split between the credit and what
+// was bought.
+func NewCashFlowStatement(accounts map[int64]Account, classes map[int64]Activity, splits []Split, ids []string, period DateRange) *CashFlowStatement {
+	activity := func(account int64) Activity {
+		if a, ok := classes[account]; ok {
+			return a
+		}
+		return DefaultActivity(accounts[account].Type)
+	}
+
+	result := &CashFlowStatement{Period: period}
+	inPeriod := make(map[string]bool)
+	for i, s := range splits {
+		if activity(s.Account) != Cash {
+			continue
+		}
+		if s.Date.Before(period.From) {
+			result.Opening += s.Amount
+		}
+		if !s.Date.After(period.To) {
+			result.Closing += s.Amount
+		}
+		if period.Contains(s.Date) {
+			inPeriod[ids[i]] = true
+		}
+	}
+
+	flows := make(map[int64]AmountType)
+	for i, s := range splits {
+		if inPeriod[ids[i]] && activity(s.Account) != Cash {
+			flows[s.Account] -= s.Amount
+		}
+	}
+
+	counters := make([]int64, 0, len(flows))
+	for account := range flows {
+		counters = append(counters, account)
+	}
+	sort.Slice(counters, func(i, j int) bool {
+		return accounts[counters[i]].Name < accounts[counters[j]].Name
+	})
+	result.Operating = make([]ReportLine, 0)
+	result.Investing = make([]ReportLine, 0)
+	result.Financing = make([]ReportLine, 0)
+	for _, account := range counters {
+		if flows[account] == 0 {
+			continue
+		}
+		line := ReportLine{Account: account, Name: accounts[account].Name, Amounts: []AmountType{flows[account]}}
+		switch activity(account) {
+		case Investing:
+			result.Investing = append(result.Investing, line)
+			result.TotalInvesting += flows[account]
+		case Financing:
+			result.Financing = append(result.Financing, line)
+			result.TotalFinancing += flows[account]
+		default:
+			result.Operating = append(result.Operating, line)
+			result.TotalOperating += flows[account]
+		}
+	}
+	result.NetChange = result.TotalOperating + result.TotalInvesting + result.TotalFinancing
+	return result
+}
+
+// WriteCSV writes s to w as CSV, with a column of counter Account names and a
+// column of cash flows.
+func (s *CashFlowStatement) WriteCSV(w io.Writer) error {
+	c := csv.NewWriter(w)
+	if err := c.Write(csvHeader("Account", []DateRange{s.Period})); err != nil {
+		return err
+	}
+	if err := c.Write(csvRow("Opening cash", []AmountType{s.Opening})); err != nil {
+		return err
+	}
+	for _, section := range []struct {
+		title string
+		lines []ReportLine
+		total AmountType
+	}{
+		{"Operating activities", s.Operating, s.TotalOperating},
+		{"Investing activities", s.Investing, s.TotalInvesting},
+		{"Financing activities", s.Financing, s.TotalFinancing},
+	} {
+		if err := writeCSVSection(c, section.title, section.lines, []AmountType{section.total}); err != nil {
+			return err
+		}
+	}
+	if err := c.Write(csvRow("Net change in cash", []AmountType{s.NetChange})); err != nil {
+		return err
+	}
+	if err := c.Write(csvRow("Closing cash", []AmountType{s.Closing})); err != nil {
+		return err
+	}
+	c.Flush()
+	return c.Error()
+}
@@ -0,0 +1,120 @@
+package transaction
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestActivityValidate(t *testing.T) {
+	for _, a := range []Activity{Cash, Operating, Investing, Financing} {
+		if err := a.Validate(); err != nil {
+			t.Errorf("Expected %v to be valid, got %v", a, err)
+		}
+	}
+	if err := Activity("bogus").Validate(); err == nil {
+		t.Error("Expected unknown activity to be invalid")
+	}
+}
+
+func TestNewCashFlowStatement(t *testing.T) {
+	accounts := map[int64]Account{
+		1: {Name: "Checking", Type: Asset},
+		2: {Name: "Savings", Type: Asset},
+		3: {Name: "Brokerage", Type: Asset},
+		4: {Name: "Loan", Type: Liability},
+		5: {Name: "Interest", Type: Expense},
+		6: {Name: "Sales", Type: Income},
+		7: {Name: "Credit Card", Type: Liability},
+		8: {Name: "Supplies", Type: Expense},
+	}
+	classes := map[int64]Activity{3: Investing}
+	splits := []Split{
+		{Amount: 50000, Account: 1, Date: testDate(2014, 10, 15)},
+		{Amount: -50000, Account: 6, Date: testDate(2014, 10, 15)},
+		// Sales.
+		{Amount: 200000, Account: 1, Date: testDate(2014, 11, 2)},
+		{Amount: -200000, Account: 6, Date: testDate(2014, 11, 2)},
+		// A transfer between cash accounts.
+		{Amount: -10000, Account: 1, Date: testDate(2014, 11, 3)},
+		{Amount: 10000, Account: 2, Date: testDate(2014, 11, 3)},
+		// A loan payment.
+		{Amount: -9000, Account: 1, Date: testDate(2014, 11, 5)},
+		{Amount: 8000, Account: 4, Date: testDate(2014, 11, 5)},
+		{Amount: 1000, Account: 5, Date: testDate(2014, 11, 5)},
+		// An investment.
+		{Amount: -30000, Account: 2, Date: testDate(2014, 11, 9)},
+		{Amount: 30000, Account: 3, Date: testDate(2014, 11, 9)},
+		// Supplies bought partly on credit.
+		{Amount: -4000, Account: 1, Date: testDate(2014, 11, 20)},
+		{Amount: -6000, Account: 7, Date: testDate(2014, 11, 20)},
+		{Amount: 10000, Account: 8, Date: testDate(2014, 11, 20)},
+		// After the period.
+		{Amount: -500, Account: 1, Date: testDate(2014, 12, 1)},
+		{Amount: 500, Account: 8, Date: testDate(2014, 12, 1)},
+	}
+	ids := []string{"a", "a", "b", "b", "c", "c", "d", "d", "d", "e", "e", "f", "f", "f", "g", "g"}
+	period := DateRange{testDate(2014, 11, 1), testDate(2014, 11, 30)}
+
+	got := NewCashFlowStatement(accounts, classes, splits, ids, period)
+
+	expected := &CashFlowStatement{
+		Period:  period,
+		Opening: 50000,
+		Operating: []ReportLine{
+			{Account: 5, Name: "Interest", Amounts: []AmountType{-1000}},
+			{Account: 6, Name: "Sales", Amounts: []AmountType{200000}},
+			{Account: 8, Name: "Supplies", Amounts: []AmountType{-10000}},
+		},
+		Investing: []ReportLine{{Account: 3, Name: "Brokerage", Amounts: []AmountType{-30000}}},
+		Financing: []ReportLine{
+			{Account: 7, Name: "Credit Card", Amounts: []AmountType{6000}},
+			{Account: 4, Name: "Loan", Amounts: []AmountType{-8000}},
+		},
+		TotalOperating: 189000,
+		TotalInvesting: -30000,
+		TotalFinancing: -2000,
+		NetChange:      157000,
+		Closing:        207000,
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, got)
+	}
+	if got.Opening+got.NetChange != got.Closing {
+		t.Errorf("Expected opening %v plus change %v to equal closing %v", got.Opening, got.NetChange, got.Closing)
+	}
+}
+
+func TestCashFlowStatementWriteCSV(t *testing.T) {
+	s := &CashFlowStatement{
+		Period:         DateRange{testDate(2014, 11, 1), testDate(2014, 11, 30)},
+		Opening:        100,
+		Operating:      []ReportLine{{Account: 6, Name: "Sales", Amounts: []AmountType{50}}},
+		TotalOperating: 50,
+		NetChange:      50,
+		Closing:        150,
+	}
+
+	var b bytes.Buffer
+	if err := s.WriteCSV(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := strings.Join([]string{
+		"Account,2014-11-01 to 2014-11-30",
+		"Opening cash,100",
+		"Operating activities",
+		`"  Sales",50`,
+		"Total operating activities,50",
+		"Investing activities",
+		"Total investing activities,0",
+		"Financing activities",
+		"Total financing activities,0",
+		"Net change in cash,50",
+		"Closing cash,150",
+	}, "\n") + "\n"
+	if b.String() != expected {
+		t.Errorf("Expected CSV\n%v\ngot\n%v", expected, b.String())
+	}
+}
@@ -0,0 +1,195 @@
+package transaction
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// A Categorizer learns which counter account a user picks for a Split, and
+// suggests one for new Splits. It's a naive Bayes classifier over the Split's
+// memo words, the size and sign of its amount, its day of the month, and its
+// account.
+//
+// Training is incremental: each transaction just adds to the counts, so
+// there's no separate training step.
+type Categorizer struct {
+	// examples counts training Splits by counter account.
+	examples map[int64]int64
+	// features counts each feature's occurrences by counter account, and
+	// featureTotals is the sum for each counter account.
+	features      map[int64]map[string]int64
+	featureTotals map[int64]int64
+	// vocabulary is every feature seen, for smoothing.
+	vocabulary map[string]bool
+}
+
+// CategorizerCounts are what a Categorizer has learned about one counter
+// account. A Categorizer is just the sum of its counter accounts' counts, so
+// they can be kept and updated apart, without loading everything it knows.
+type CategorizerCounts struct {
+	Examples     int64
+	Features     map[string]int64
+	FeatureTotal int64
+}
+
+// A Suggestion is a counter account suggested by a Categorizer. Confidence is
+// the probability that it's right, from 0 to 1.
+type Suggestion struct {
+	Account    int64   `json:"account"`
+	Confidence float64 `json:"confidence"`
+}
+
+// Create a new Categorizer, which hasn't learned anything.
+func NewCategorizer() *Categorizer {
+	return &Categorizer{
+		examples:      make(map[int64]int64),
+		features:      make(map[int64]map[string]int64),
+		featureTotals: make(map[int64]int64),
+		vocabulary:    make(map[string]bool),
+	}
+}
+
+// categorizerFeatures extracts the features of s that a Categorizer learns
+// from.
+func categorizerFeatures(s *Split) []string {
+	features := make([]string, 0)
+	words := strings.FieldsFunc(strings.ToLower(s.Memo), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, w := range words {
+		// Store numbers and the like are too specific to generalize from.
+		if len(w) < 2 || strings.IndexFunc(w, unicode.IsLetter) < 0 {
+			continue
+		}
+		features = append(features, "word:"+w)
+	}
+
+	digits := len(fmt.Sprint(int64(math.Abs(float64(s.Amount)))))
+	if s.Amount < 0 {
+		digits = -digits
+	}
+	features = append(features, fmt.Sprintf("amount:%v", digits))
+	if !s.Date.IsZero() {
+		features = append(features, fmt.Sprintf("day:%v", s.Date.Day))
+	}
+	features = append(features, fmt.Sprintf("account:%v", s.Account))
+	return features
+}
+
+// Train teaches k that s's counter account was counter.
+func (k *Categorizer) Train(s *Split, counter int64) {
+	k.examples[counter]++
+	if k.features[counter] == nil {
+		k.features[counter] = make(map[string]int64)
+	}
+	for _, f := range categorizerFeatures(s) {
+		k.features[counter][f]++
+		k.featureTotals[counter]++
+		k.vocabulary[f] = true
+	}
+}
+
+// TrainTransaction teaches k from a committed transaction's splits. Only
+// transactions with two Splits have an obvious counter account, so others are
+// ignored. Each Split is the other's counter.
+func (k *Categorizer) TrainTransaction(splits []*Split) {
+	if len(splits) != 2 {
+		return
+	}
+	k.Train(splits[0], splits[1].Account)
+	k.Train(splits[1], splits[0].Account)
+}
+
+// Accounts gets the counter accounts k has learned about, in order.
+func (k *Categorizer) Accounts() []int64 {
+	result := make([]int64, 0, len(k.examples))
+	for account := range k.examples {
+		result = append(result, account)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+	return result
+}
+
+// Counts gets what k has learned about counter. The result is a copy, so
+// training k doesn't change it.
+func (k *Categorizer) Counts(counter int64) *CategorizerCounts {
+	result := &CategorizerCounts{
+		Examples:     k.examples[counter],
+		Features:     make(map[string]int64),
+		FeatureTotal: k.featureTotals[counter],
+	}
+	for f, n := range k.features[counter] {
+		result.Features[f] = n
+	}
+	return result
+}
+
+// AddCounts adds what another Categorizer learned about counter to k, as if
+// k had been trained on its transactions too.
+func (k *Categorizer) AddCounts(counter int64, counts *CategorizerCounts) {
+	if counts.Examples == 0 {
+		return
+	}
+	k.examples[counter] += counts.Examples
+	if k.features[counter] == nil {
+		k.features[counter] = make(map[string]int64)
+	}
+	for f, n := range counts.Features {
+		k.features[counter][f] += n
+		k.vocabulary[f] = true
+	}
+	k.featureTotals[counter] += counts.FeatureTotal
+}
+
+// Suggest returns up to n counter accounts for s, most likely first. Accounts
+// that k hasn't learned about are never suggested, and s's own account is
+// skipped.
+func (k *Categorizer) Suggest(s *Split, n int) []Suggestion {
+	var examples int64
+	for _, e := range k.examples {
+		examples += e
+	}
+	features := categorizerFeatures(s)
+	vocabulary := float64(len(k.vocabulary))
+
+	// Work with log probabilities so products of many small numbers don't
+	// underflow.
+	result := make([]Suggestion, 0)
+	logs := make([]float64, 0)
+	best := math.Inf(-1)
+	for account, e := range k.examples {
+		if account == s.Account {
+			continue
+		}
+		l := math.Log(float64(e) / float64(examples))
+		for _, f := range features {
+			l += math.Log((float64(k.features[account][f]) + 1) /
+				(float64(k.featureTotals[account]) + vocabulary))
+		}
+		result = append(result, Suggestion{Account: account})
+		logs = append(logs, l)
+		best = math.Max(best, l)
+	}
+
+	var sum float64
+	for i := range logs {
+		sum += math.Exp(logs[i] - best)
+	}
+	for i := range result {
+		result[i].Confidence = math.Exp(logs[i]-best) / sum
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Confidence != result[j].Confidence {
+			return result[i].Confidence > result[j].Confidence
+		}
+		return result[i].Account < result[j].Account
+	})
+	if len(result) > n {
+		result = result[:n]
+	}
+	return result
+}
@@ -0,0 +1,48 @@
+// +build appengine
+
+package transaction
+
+import (
+	"encoding/json"
+
+	"appengine/datastore"
+)
+
+// Implement PropertyLoadSaver for transaction.CategorizerCounts, since
+// datastore can't hold its Features map. Like Accounts, unknown properties
+// are ignored.
+func (k *CategorizerCounts) Load(c <-chan datastore.Property) error {
+	err := error(nil)
+
+	*k = CategorizerCounts{Features: make(map[string]int64)}
+	for p := range c {
+		switch p.Name {
+		case "Examples":
+			k.Examples = p.Value.(int64)
+		case "FeatureTotal":
+			k.FeatureTotal = p.Value.(int64)
+		case "Features":
+			if jsonErr := json.Unmarshal(p.Value.([]byte), &k.Features); jsonErr != nil {
+				err = jsonErr
+			}
+		}
+	}
+
+	return err
+}
+
+// See CategorizerCounts.Load.
+func (k *CategorizerCounts) Save(c chan<- datastore.Property) error {
+	defer close(c)
+
+	b, err := json.Marshal(k.Features)
+	if err != nil {
+		return err
+	}
+
+	c <- datastore.Property{Name: "Examples", Value: k.Examples, NoIndex: true}
+	c <- datastore.Property{Name: "FeatureTotal", Value: k.FeatureTotal, NoIndex: true}
+	c <- datastore.Property{Name: "Features", Value: b, NoIndex: true}
+
+	return nil
+}
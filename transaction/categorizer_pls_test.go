@@ -0,0 +1,34 @@
+// +build appengine
+
+package transaction
+
+import (
+	"reflect"
+	"testing"
+
+	"appengine/datastore"
+)
+
+func TestCategorizerCountsSaveAndLoad(t *testing.T) {
+	k := NewCategorizer()
+	k.TrainTransaction([]*Split{
+		{Amount: -5000, Account: 1, Memo: "Trader Joe's", Date: testDate(2014, 11, 5)},
+		{Amount: 5000, Account: 2, Memo: "Trader Joe's", Date: testDate(2014, 11, 5)},
+	})
+	saved := k.Counts(2)
+
+	propChan := make(chan datastore.Property)
+	go func() {
+		if err := saved.Save(propChan); err != nil {
+			t.Errorf("Failed to save %v: %v", saved, err)
+		}
+	}()
+
+	loaded := &CategorizerCounts{}
+	if err := loaded.Load(propChan); err != nil {
+		t.Errorf("Failed to load into %v: %v", loaded, err)
+	}
+	if !reflect.DeepEqual(loaded, saved) {
+		t.Errorf("Loaded value %+v was not the same as saved value %+v", loaded, saved)
+	}
+}
@@ -0,0 +1,99 @@
+package transaction
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCategorizerFeatures(t *testing.T) {
+	got := categorizerFeatures(&Split{
+		Amount: -1234, Account: 1, Memo: "TRADER JOE'S #123 Groceries", Date: testDate(2014, 11, 5),
+	})
+
+	expected := []string{"word:trader", "word:joe", "word:groceries", "amount:-4", "day:5", "account:1"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
+
+func TestCategorizerSuggest(t *testing.T) {
+	k := NewCategorizer()
+	for i := 0; i < 5; i++ {
+		k.TrainTransaction([]*Split{
+			{Amount: -5000, Account: 1, Memo: "Trader Joe's", Date: testDate(2014, 11, 5+i)},
+			{Amount: 5000, Account: 2, Memo: "Trader Joe's", Date: testDate(2014, 11, 5+i)},
+		})
+	}
+	for i := 0; i < 3; i++ {
+		k.TrainTransaction([]*Split{
+			{Amount: -150000, Account: 1, Memo: "Rent", Date: testDate(2014, time.Month(8+i), 1)},
+			{Amount: 150000, Account: 3, Memo: "Rent", Date: testDate(2014, time.Month(8+i), 1)},
+		})
+	}
+
+	got := k.Suggest(&Split{Amount: -4200, Account: 1, Memo: "TRADER JOE'S #55", Date: testDate(2014, 12, 7)}, 2)
+	if len(got) != 2 || got[0].Account != 2 || got[0].Confidence < 0.9 {
+		t.Errorf("Expected confident suggestion of 2, got %+v", got)
+	}
+	if len(got) == 2 && math.Abs(got[0].Confidence+got[1].Confidence-1) > 1e-9 {
+		t.Errorf("Expected confidences to add to 1, got %+v", got)
+	}
+
+	got = k.Suggest(&Split{Amount: -150000, Account: 1, Memo: "rent", Date: testDate(2014, 12, 1)}, 1)
+	if len(got) != 1 || got[0].Account != 3 {
+		t.Errorf("Expected suggestion of 3, got %+v", got)
+	}
+
+	// An account is never its own counter account.
+	for _, s := range k.Suggest(&Split{Amount: 5000, Account: 2, Memo: "Trader Joe's"}, 5) {
+		if s.Account == 2 {
+			t.Errorf("Expected account 2 not to be suggested, got %+v", s)
+		}
+	}
+}
+
+func TestCategorizerSuggest_Untrained(t *testing.T) {
+	if got := NewCategorizer().Suggest(&Split{Amount: -1, Account: 1}, 3); len(got) != 0 {
+		t.Errorf("Expected no suggestions, got %+v", got)
+	}
+}
+
+func TestCategorizerTrainTransaction_IgnoresMultipleSplits(t *testing.T) {
+	k := NewCategorizer()
+	k.TrainTransaction([]*Split{{Amount: -2, Account: 1}, {Amount: 1, Account: 2}, {Amount: 1, Account: 3}})
+
+	if len(k.examples) != 0 {
+		t.Errorf("Expected nothing learned, got %+v", k.examples)
+	}
+}
+
+func TestCategorizerCounts_AddUp(t *testing.T) {
+	transactions := [][]*Split{
+		{{Amount: -5000, Account: 1, Memo: "Trader Joe's"}, {Amount: 5000, Account: 2, Memo: "Trader Joe's"}},
+		{{Amount: -150000, Account: 1, Memo: "Rent"}, {Amount: 150000, Account: 3, Memo: "Rent"}},
+		{{Amount: -4000, Account: 4, Memo: "Safeway"}, {Amount: 4000, Account: 2, Memo: "Safeway"}},
+	}
+	whole := NewCategorizer()
+	for _, x := range transactions {
+		whole.TrainTransaction(x)
+	}
+
+	// Training on each transaction apart, and adding up the counts of each
+	// account, learns the same thing.
+	sum := NewCategorizer()
+	for _, x := range transactions {
+		k := NewCategorizer()
+		k.TrainTransaction(x)
+		for _, account := range k.Accounts() {
+			sum.AddCounts(account, k.Counts(account))
+		}
+	}
+	if !reflect.DeepEqual(sum, whole) {
+		t.Errorf("Expected %+v, got %+v", whole, sum)
+	}
+	if expected := []int64{1, 2, 3, 4}; !reflect.DeepEqual(whole.Accounts(), expected) {
+		t.Errorf("Expected accounts %v, got %v", expected, whole.Accounts())
+	}
+}
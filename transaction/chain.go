@@ -0,0 +1,112 @@
+package transaction
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// A ChainLink records one committed transaction in a tamper-evident chain.
+// Each link's Hash covers the transaction's Splits and the Hash of the link
+// before it, so rewriting any committed transaction breaks every later link.
+//
+// Seq numbers start at 1 and have no gaps.
+type ChainLink struct {
+	Seq         int64  `json:"seq"`
+	Transaction string `json:"transaction"`
+	Hash        []byte `json:"hash"`
+}
+
+// A ChainHead is the newest link in a chain. It's stored separately from the
+// links so that truncating the chain is detectable.
+type ChainHead struct {
+	Seq  int64  `json:"seq"`
+	Hash []byte `json:"hash"`
+}
+
+// Next creates the link that follows h for the transaction with id
+// transactionID, and advances h to it.
+func (h *ChainHead) Next(transactionID string, splits []*Split) *ChainLink {
+	l := &ChainLink{
+		Seq:         h.Seq + 1,
+		Transaction: transactionID,
+		Hash:        ChainHash(h.Hash, transactionID, splits),
+	}
+	h.Seq, h.Hash = l.Seq, l.Hash
+	return l
+}
+
+// ChainHash hashes the canonical contents of a transaction together with the
+// hash of the previous link. The canonical contents are the transaction id
+// and each Split's account, amount, memo and date, in account order.
+func ChainHash(prev []byte, transactionID string, splits []*Split) []byte {
+	sorted := make([]*Split, len(splits))
+	copy(sorted, splits)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Account < sorted[j].Account
+	})
+
+	h := sha256.New()
+	h.Write(prev)
+	fmt.Fprintf(h, "%q\n", transactionID)
+	for _, s := range sorted {
+		fmt.Fprintf(h, "%d %d %q %s\n",
+			s.Account, s.Amount, s.Memo, s.Date.In(time.UTC).Format(time.RFC3339Nano))
+	}
+	return h.Sum(nil)
+}
+
+// A ChainBreak is the first place a chain stops verifying.
+type ChainBreak struct {
+	Seq         int64  `json:"seq"`
+	Transaction string `json:"transaction"`
+	Reason      string `json:"reason"`
+}
+
+// A ChainReport is the result of VerifyChain. Break is nil if every link
+// verified. Unchained lists transactions that have Splits but no link, which
+// were either committed before chaining existed or inserted behind its back.
+type ChainReport struct {
+	Length    int64       `json:"length"`
+	Break     *ChainBreak `json:"break"`
+	Unchained []string    `json:"unchained"`
+}
+
+// VerifyChain recomputes every link's hash from splits, which maps
+// transaction ids to their stored Splits, and checks the links against each
+// other and against head. links must be in Seq order.
+func VerifyChain(head ChainHead, links []ChainLink, splits map[string][]*Split) *ChainReport {
+	r := &ChainReport{Length: int64(len(links)), Unchained: make([]string, 0)}
+
+	chained := make(map[string]bool)
+	var prev []byte
+	for i, l := range links {
+		chained[l.Transaction] = true
+		if r.Break != nil {
+			continue
+		}
+
+		if l.Seq != int64(i+1) {
+			r.Break = &ChainBreak{int64(i + 1), l.Transaction, "Missing link"}
+		} else if _, ok := splits[l.Transaction]; !ok {
+			r.Break = &ChainBreak{l.Seq, l.Transaction, "Transaction missing"}
+		} else if !bytes.Equal(ChainHash(prev, l.Transaction, splits[l.Transaction]), l.Hash) {
+			r.Break = &ChainBreak{l.Seq, l.Transaction, "Hash mismatch"}
+		}
+		prev = l.Hash
+	}
+
+	if r.Break == nil && (head.Seq != r.Length || !bytes.Equal(head.Hash, prev)) {
+		r.Break = &ChainBreak{head.Seq, "", "Chain head doesn't match last link"}
+	}
+
+	for id := range splits {
+		if !chained[id] {
+			r.Unchained = append(r.Unchained, id)
+		}
+	}
+	sort.Strings(r.Unchained)
+	return r
+}
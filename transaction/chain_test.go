@@ -0,0 +1,119 @@
+package transaction
+
+import (
+	"bytes"
+	"testing"
+)
+
+// Build a verified chain of two transactions for tests to tamper with.
+func buildTestChain() (ChainHead, []ChainLink, map[string][]*Split) {
+	date := testDate(2014, 11, 1)
+	splits := map[string][]*Split{
+		"x1": {{Amount: -100, Account: 1, Date: date}, {Amount: 100, Account: 2, Date: date}},
+		"x2": {{Amount: -50, Account: 2, Date: date}, {Amount: 50, Account: 1, Date: date}},
+	}
+
+	head := ChainHead{}
+	links := []ChainLink{*head.Next("x1", splits["x1"]), *head.Next("x2", splits["x2"])}
+	return head, links, splits
+}
+
+func TestChainHead_Next(t *testing.T) {
+	head := ChainHead{}
+	l1 := head.Next("x1", []*Split{{Amount: 1, Account: 1}})
+	l2 := head.Next("x2", []*Split{{Amount: 1, Account: 1}})
+
+	if l1.Seq != 1 || l2.Seq != 2 {
+		t.Errorf("Expected seqs 1 and 2, got %v and %v", l1.Seq, l2.Seq)
+	}
+	if bytes.Equal(l1.Hash, l2.Hash) {
+		t.Errorf("Expected different hashes, both were %x", l1.Hash)
+	}
+	if head.Seq != 2 || !bytes.Equal(head.Hash, l2.Hash) {
+		t.Errorf("Expected head to advance to %+v, got %+v", l2, head)
+	}
+}
+
+func TestChainHash_SplitOrderIrrelevant(t *testing.T) {
+	s1, s2 := &Split{Amount: -1, Account: 1}, &Split{Amount: 1, Account: 2}
+
+	h1 := ChainHash(nil, "x1", []*Split{s1, s2})
+	h2 := ChainHash(nil, "x1", []*Split{s2, s1})
+	if !bytes.Equal(h1, h2) {
+		t.Errorf("Expected hashes to match, got %x and %x", h1, h2)
+	}
+}
+
+func TestChainHash_DependsOnPrevious(t *testing.T) {
+	s := []*Split{{Amount: -1, Account: 1}, {Amount: 1, Account: 2}}
+
+	h1 := ChainHash([]byte{1}, "x1", s)
+	h2 := ChainHash([]byte{2}, "x1", s)
+	if bytes.Equal(h1, h2) {
+		t.Errorf("Expected hashes to differ, both were %x", h1)
+	}
+}
+
+func TestVerifyChain_Valid(t *testing.T) {
+	head, links, splits := buildTestChain()
+
+	r := VerifyChain(head, links, splits)
+	if r.Break != nil {
+		t.Errorf("Expected valid chain, got break %+v", r.Break)
+	}
+	if r.Length != 2 {
+		t.Errorf("Expected length 2, got %v", r.Length)
+	}
+}
+
+func TestVerifyChain_ChangedAmount(t *testing.T) {
+	head, links, splits := buildTestChain()
+	splits["x1"][0].Amount = -200
+
+	r := VerifyChain(head, links, splits)
+	if r.Break == nil || r.Break.Seq != 1 || r.Break.Transaction != "x1" {
+		t.Errorf("Expected break at x1, got %+v", r.Break)
+	}
+}
+
+func TestVerifyChain_DeletedTransaction(t *testing.T) {
+	head, links, splits := buildTestChain()
+	delete(splits, "x2")
+
+	r := VerifyChain(head, links, splits)
+	if r.Break == nil || r.Break.Seq != 2 {
+		t.Errorf("Expected break at seq 2, got %+v", r.Break)
+	}
+}
+
+func TestVerifyChain_MissingLink(t *testing.T) {
+	head, links, splits := buildTestChain()
+
+	r := VerifyChain(head, links[1:], splits)
+	if r.Break == nil || r.Break.Seq != 1 {
+		t.Errorf("Expected break at seq 1, got %+v", r.Break)
+	}
+}
+
+func TestVerifyChain_Truncated(t *testing.T) {
+	head, links, splits := buildTestChain()
+	delete(splits, "x2")
+
+	r := VerifyChain(head, links[:1], splits)
+	if r.Break == nil {
+		t.Errorf("Expected truncated chain to break")
+	}
+}
+
+func TestVerifyChain_Unchained(t *testing.T) {
+	head, links, splits := buildTestChain()
+	splits["x3"] = []*Split{{Amount: -1, Account: 1}, {Amount: 1, Account: 2}}
+
+	r := VerifyChain(head, links, splits)
+	if r.Break != nil {
+		t.Errorf("Expected valid chain, got break %+v", r.Break)
+	}
+	if len(r.Unchained) != 1 || r.Unchained[0] != "x3" {
+		t.Errorf("Expected x3 to be unchained, got %v", r.Unchained)
+	}
+}
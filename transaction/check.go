@@ -0,0 +1,144 @@
+package transaction
+
+import "sort"
+
+// An AccountDiscrepancy reports an Account whose stored total differs from the
+// sum of its Splits.
+type AccountDiscrepancy struct {
+	Account  int64      `json:"account"`
+	Stored   AmountType `json:"stored"`
+	Computed AmountType `json:"computed"`
+}
+
+// A TransactionDiscrepancy reports a transaction whose Splits can't have been
+// committed by Transaction.Commit, with every reason why.
+type TransactionDiscrepancy struct {
+	ID      string     `json:"id"`
+	Total   AmountType `json:"total"`
+	Splits  int        `json:"splits"`
+	Reasons []string   `json:"reasons"`
+}
+
+// A CheckReport lists everything a Checker found wrong. Both slices are empty
+// for a consistent ledger.
+type CheckReport struct {
+	Accounts     []AccountDiscrepancy     `json:"accounts"`
+	Transactions []TransactionDiscrepancy `json:"transactions"`
+}
+
+// Consistent is true if the report found no discrepancies.
+func (r *CheckReport) Consistent() bool {
+	return len(r.Accounts) == 0 && len(r.Transactions) == 0
+}
+
+// A Checker recomputes Account totals from stored Splits, and verifies that
+// the Splits of each transaction still follow double-entry rules.
+//
+// Account totals are denormalized by Commit, so they can drift from the Splits
+// if a write is lost or an entity is edited by hand.
+type Checker struct {
+	accountMap map[int64]*Account
+	computed   map[int64]AmountType
+	xs         map[string][]*checkedSplit
+}
+
+// checkedSplit remembers which Account a Split was stored under, which may
+// not match the Split's own Account field.
+type checkedSplit struct {
+	split  *Split
+	parent int64
+}
+
+// Create a new Checker, which tracks accounts and splits.
+func NewChecker() *Checker {
+	return &Checker{
+		accountMap: make(map[int64]*Account),
+		computed:   make(map[int64]AmountType),
+		xs:         make(map[string][]*checkedSplit),
+	}
+}
+
+// Add a stored account to the check.
+func (k *Checker) AddAccount(a *Account, id int64) {
+	k.accountMap[id] = a
+}
+
+// Add a stored split to the check. transactionID groups the Splits of one
+// transaction, and parent is the id of the account the Split was stored
+// under.
+func (k *Checker) AddSplit(transactionID string, parent int64, split *Split) {
+	k.xs[transactionID] = append(k.xs[transactionID], &checkedSplit{split, parent})
+	k.computed[parent] += split.Amount
+}
+
+// Check compares every account's stored total with its recomputed total, and
+// every transaction's splits with the rules Commit enforces.
+func (k *Checker) Check() *CheckReport {
+	r := &CheckReport{
+		Accounts:     make([]AccountDiscrepancy, 0),
+		Transactions: make([]TransactionDiscrepancy, 0),
+	}
+
+	for id, a := range k.accountMap {
+		if a.total != k.computed[id] {
+			r.Accounts = append(r.Accounts, AccountDiscrepancy{id, a.total, k.computed[id]})
+		}
+	}
+	for id := range k.computed {
+		if _, ok := k.accountMap[id]; !ok {
+			r.Accounts = append(r.Accounts, AccountDiscrepancy{id, 0, k.computed[id]})
+		}
+	}
+
+	for id, splits := range k.xs {
+		var total AmountType
+		misfiled := false
+		for _, s := range splits {
+			total += s.split.Amount
+			if s.split.Account != s.parent {
+				misfiled = true
+			}
+		}
+
+		reasons := make([]string, 0)
+		if misfiled {
+			reasons = append(reasons, "Split stored under a different account")
+		}
+		if total != 0 {
+			reasons = append(reasons, "Nonzero total")
+		}
+		if len(splits) < 2 {
+			reasons = append(reasons, "Missing splits")
+		}
+		if len(reasons) != 0 {
+			r.Transactions = append(r.Transactions, TransactionDiscrepancy{id, total, len(splits), reasons})
+		}
+	}
+
+	// Map iteration order is random, but reports should be stable.
+	sort.Slice(r.Accounts, func(i, j int) bool {
+		return r.Accounts[i].Account < r.Accounts[j].Account
+	})
+	sort.Slice(r.Transactions, func(i, j int) bool {
+		return r.Transactions[i].ID < r.Transactions[j].ID
+	})
+	return r
+}
+
+// Repair sets the total of every added account to its recomputed total, and
+// returns the ids of the accounts that changed.
+//
+// Repair can't fix transactions whose splits are wrong, since there's no way
+// to know which split is missing or mistaken.
+func (k *Checker) Repair() []int64 {
+	changed := make([]int64, 0)
+	for _, d := range k.Check().Accounts {
+		a, ok := k.accountMap[d.Account]
+		if !ok {
+			continue
+		}
+		a.total = d.Computed
+		changed = append(changed, d.Account)
+	}
+	return changed
+}
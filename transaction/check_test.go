@@ -0,0 +1,129 @@
+package transaction
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCheck_Consistent(t *testing.T) {
+	k := NewChecker()
+	k.AddAccount(&Account{Name: "a1", total: -100}, 1)
+	k.AddAccount(&Account{Name: "a2", total: 100}, 2)
+	k.AddSplit("x1", 1, &Split{Amount: -100, Account: 1})
+	k.AddSplit("x1", 2, &Split{Amount: 100, Account: 2})
+
+	r := k.Check()
+	if !r.Consistent() {
+		t.Errorf("Expected consistent ledger, got %+v", r)
+	}
+}
+
+func TestCheck_WrongTotal(t *testing.T) {
+	k := NewChecker()
+	k.AddAccount(&Account{Name: "a1", total: -50}, 1)
+	k.AddAccount(&Account{Name: "a2", total: 100}, 2)
+	k.AddSplit("x1", 1, &Split{Amount: -100, Account: 1})
+	k.AddSplit("x1", 2, &Split{Amount: 100, Account: 2})
+
+	r := k.Check()
+	if len(r.Transactions) != 0 {
+		t.Errorf("Expected no transaction discrepancies, got %+v", r.Transactions)
+	}
+	if len(r.Accounts) != 1 {
+		t.Fatalf("Expected 1 account discrepancy, got %+v", r.Accounts)
+	}
+	expected := AccountDiscrepancy{Account: 1, Stored: -50, Computed: -100}
+	if r.Accounts[0] != expected {
+		t.Errorf("Expected discrepancy %+v, got %+v", expected, r.Accounts[0])
+	}
+}
+
+func TestCheck_UnbalancedTransaction(t *testing.T) {
+	k := NewChecker()
+	k.AddAccount(&Account{Name: "a1", total: -100}, 1)
+	k.AddAccount(&Account{Name: "a2", total: 90}, 2)
+	k.AddSplit("x1", 1, &Split{Amount: -100, Account: 1})
+	k.AddSplit("x1", 2, &Split{Amount: 90, Account: 2})
+
+	r := k.Check()
+	if len(r.Transactions) != 1 {
+		t.Fatalf("Expected 1 transaction discrepancy, got %+v", r.Transactions)
+	}
+	if r.Transactions[0].ID != "x1" || r.Transactions[0].Total != -10 {
+		t.Errorf("Expected x1 to have total -10, got %+v", r.Transactions[0])
+	}
+}
+
+func TestCheck_MissingSplits(t *testing.T) {
+	k := NewChecker()
+	k.AddAccount(&Account{Name: "a1"}, 1)
+	k.AddSplit("x1", 1, &Split{Amount: 0, Account: 1})
+
+	r := k.Check()
+	if len(r.Transactions) != 1 {
+		t.Fatalf("Expected 1 transaction discrepancy, got %+v", r.Transactions)
+	}
+	if r.Transactions[0].Splits != 1 {
+		t.Errorf("Expected 1 split in discrepancy, got %+v", r.Transactions[0])
+	}
+}
+
+func TestCheck_SplitUnderWrongAccount(t *testing.T) {
+	k := NewChecker()
+	k.AddAccount(&Account{Name: "a1", total: -100}, 1)
+	k.AddAccount(&Account{Name: "a2", total: 100}, 2)
+	k.AddSplit("x1", 1, &Split{Amount: -100, Account: 1})
+	k.AddSplit("x1", 2, &Split{Amount: 100, Account: 3})
+
+	r := k.Check()
+	if len(r.Transactions) != 1 {
+		t.Errorf("Expected 1 transaction discrepancy, got %+v", r.Transactions)
+	}
+}
+
+func TestCheck_SplitsForMissingAccount(t *testing.T) {
+	k := NewChecker()
+	k.AddAccount(&Account{Name: "a1", total: -100}, 1)
+	k.AddSplit("x1", 1, &Split{Amount: -100, Account: 1})
+	k.AddSplit("x1", 2, &Split{Amount: 100, Account: 2})
+
+	r := k.Check()
+	if len(r.Accounts) != 1 || r.Accounts[0].Account != 2 {
+		t.Errorf("Expected discrepancy for account 2, got %+v", r.Accounts)
+	}
+}
+
+func TestRepair(t *testing.T) {
+	k := NewChecker()
+	a1, a2 := &Account{Name: "a1", total: 7}, &Account{Name: "a2", total: 100}
+	k.AddAccount(a1, 1)
+	k.AddAccount(a2, 2)
+	k.AddSplit("x1", 1, &Split{Amount: -100, Account: 1})
+	k.AddSplit("x1", 2, &Split{Amount: 100, Account: 2})
+
+	changed := k.Repair()
+	if len(changed) != 1 || changed[0] != 1 {
+		t.Errorf("Expected only account 1 to change, got %v", changed)
+	}
+	if a1.total != -100 {
+		t.Errorf("Expected a1 total to be -100, got %v", a1.total)
+	}
+	if !k.Check().Consistent() {
+		t.Errorf("Expected consistent ledger after repair, got %+v", k.Check())
+	}
+}
+
+func TestCheck_EveryReason(t *testing.T) {
+	k := NewChecker()
+	k.AddAccount(&Account{Name: "a1", total: -100}, 1)
+	k.AddSplit("x1", 1, &Split{Amount: -100, Account: 2})
+
+	r := k.Check()
+	if len(r.Transactions) != 1 {
+		t.Fatalf("Expected 1 transaction discrepancy, got %+v", r.Transactions)
+	}
+	expected := []string{"Split stored under a different account", "Nonzero total", "Missing splits"}
+	if !reflect.DeepEqual(r.Transactions[0].Reasons, expected) {
+		t.Errorf("Expected reasons %v, got %v", expected, r.Transactions[0].Reasons)
+	}
+}
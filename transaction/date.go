@@ -0,0 +1,118 @@
+package transaction
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// DateFormat is how a Date is written, and how users give one.
+const DateFormat = "2006-01-02"
+
+// A Date is a day on the calendar, like the date a bank posted a Split. It has
+// no time of day or time zone, so it's the same day for every user, and
+// comparing or converting it can't move it to the day before.
+//
+// The zero Date is not a real day, and means the date is missing.
+type Date struct {
+	Year  int
+	Month time.Month
+	Day   int
+}
+
+// DateOf is the day that t falls on, in t's location. To get the day in a
+// user's time zone, convert t with time.Time.In first.
+func DateOf(t time.Time) Date {
+	y, m, d := t.Date()
+	return Date{y, m, d}
+}
+
+// ParseDate parses a Date written in DateFormat.
+func ParseDate(s string) (Date, error) {
+	t, err := time.Parse(DateFormat, s)
+	if err != nil {
+		return Date{}, err
+	}
+	return DateOf(t), nil
+}
+
+// String writes d in DateFormat.
+func (d Date) String() string {
+	return fmt.Sprintf("%04d-%02d-%02d", d.Year, d.Month, d.Day)
+}
+
+// In is the time that d starts in loc.
+func (d Date) In(loc *time.Location) time.Time {
+	return time.Date(d.Year, d.Month, d.Day, 0, 0, 0, 0, loc)
+}
+
+// IsZero is true if d is the zero Date.
+func (d Date) IsZero() bool {
+	return d == Date{}
+}
+
+// Before is true if d is earlier than e.
+func (d Date) Before(e Date) bool {
+	if d.Year != e.Year {
+		return d.Year < e.Year
+	}
+	if d.Month != e.Month {
+		return d.Month < e.Month
+	}
+	return d.Day < e.Day
+}
+
+// After is true if d is later than e.
+func (d Date) After(e Date) bool {
+	return e.Before(d)
+}
+
+// AddDate is d moved by years, months and days, normalized like
+// time.Time.AddDate, so October 31 plus one month is December 1.
+func (d Date) AddDate(years, months, days int) Date {
+	return DateOf(d.In(time.UTC).AddDate(years, months, days))
+}
+
+// DaysSince is the number of days from e until d, which is negative if d is
+// before e.
+func (d Date) DaysSince(e Date) int {
+	return int(d.In(time.UTC).Sub(e.In(time.UTC)).Hours() / 24)
+}
+
+// Weekday is the day of the week d falls on.
+func (d Date) Weekday() time.Weekday {
+	return d.In(time.UTC).Weekday()
+}
+
+// MarshalJSON writes d as a string in DateFormat, or an empty string if d is
+// zero.
+func (d Date) MarshalJSON() ([]byte, error) {
+	if d.IsZero() {
+		return []byte(`""`), nil
+	}
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON reads a string in DateFormat. It also accepts an RFC 3339
+// time, as Split dates used to be written, and takes the day it falls on in
+// its own offset. An empty string is the zero Date.
+func (d *Date) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	if s == "" {
+		*d = Date{}
+		return nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		*d = DateOf(t)
+		return nil
+	}
+	result, err := ParseDate(s)
+	if err != nil {
+		return err
+	}
+	*d = result
+	return nil
+}
@@ -0,0 +1,92 @@
+package transaction
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func testDate(y int, m time.Month, d int) Date {
+	return Date{y, m, d}
+}
+
+// testTime is the time testDate(y, m, d) starts in UTC, for dates which are
+// still stored as times.
+func testTime(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestDateOf(t *testing.T) {
+	// Late evening in Los Angeles is the next day in UTC.
+	la := time.FixedZone("PST", -8*60*60)
+	instant := time.Date(2014, 11, 5, 22, 30, 0, 0, la)
+	if got, expected := DateOf(instant), testDate(2014, 11, 5); got != expected {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+	if got, expected := DateOf(instant.UTC()), testDate(2014, 11, 6); got != expected {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
+
+func TestDateArithmetic(t *testing.T) {
+	d := testDate(2014, 10, 31)
+	if got, expected := d.AddDate(0, 1, 0), testDate(2014, 12, 1); got != expected {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+	if got := testDate(2015, 3, 1).DaysSince(testDate(2015, 2, 1)); got != 28 {
+		t.Errorf("Expected 28 days, got %v", got)
+	}
+	if got := testDate(2015, 2, 1).DaysSince(testDate(2015, 3, 1)); got != -28 {
+		t.Errorf("Expected -28 days, got %v", got)
+	}
+	if !d.Before(testDate(2014, 11, 1)) || d.After(testDate(2014, 11, 1)) || d.Before(d) {
+		t.Errorf("Expected %v to be before November 1st only", d)
+	}
+	if d.Weekday() != time.Friday {
+		t.Errorf("Expected %v to be a Friday, got %v", d, d.Weekday())
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	d, err := ParseDate("2014-11-05")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := testDate(2014, 11, 5); d != expected || d.String() != "2014-11-05" {
+		t.Errorf("Expected %v, got %v", expected, d)
+	}
+	if _, err := ParseDate("11/05/2014"); err == nil {
+		t.Error("Expected a date in the wrong format not to parse")
+	}
+}
+
+func TestDateJSON(t *testing.T) {
+	b, err := json.Marshal(Split{Amount: 100, Date: testDate(2014, 11, 5)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s struct {
+		Date string `json:"date"`
+	}
+	if err := json.Unmarshal(b, &s); err != nil || s.Date != "2014-11-05" {
+		t.Errorf("Expected date 2014-11-05, got %v from %s", s.Date, b)
+	}
+
+	for text, expected := range map[string]Date{
+		`"2014-11-05"`:                testDate(2014, 11, 5),
+		`"2014-11-05T00:00:00Z"`:      testDate(2014, 11, 5),
+		`"2014-11-05T22:30:00-08:00"`: testDate(2014, 11, 5),
+		`""`:                          {},
+	} {
+		var d Date
+		if err := json.Unmarshal([]byte(text), &d); err != nil {
+			t.Errorf("Unmarshaling %v: %v", text, err)
+		} else if d != expected {
+			t.Errorf("Expected %v from %v, got %v", expected, text, d)
+		}
+	}
+	var d Date
+	if err := json.Unmarshal([]byte(`"tomorrow"`), &d); err == nil {
+		t.Error("Expected a bad date not to unmarshal")
+	}
+}
@@ -0,0 +1,113 @@
+package transaction
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// DuplicateWindow is how far apart two Splits can be dated and still be
+// duplicates, since banks and people date the same transaction differently.
+const DuplicateWindow = 3 * 24 * time.Hour
+
+// DuplicateThreshold is the DuplicateScore at which a Split is a likely
+// duplicate.
+const DuplicateThreshold = 0.6
+
+// A Duplicate is an existing Split which is likely the same as a new one.
+// Score is its DuplicateScore.
+type Duplicate struct {
+	Transaction string  `json:"transaction"`
+	Split       Split   `json:"split"`
+	Score       float64 `json:"score"`
+}
+
+// memoBigrams gets the pairs of adjacent characters in a normalized memo,
+// ignoring punctuation.
+func memoBigrams(memo string) map[string]int {
+	r := []rune(normalizePayeeName(strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return ' '
+	}, memo)))
+	bigrams := make(map[string]int)
+	for i := 0; i+1 < len(r); i++ {
+		bigrams[string(r[i:i+2])]++
+	}
+	return bigrams
+}
+
+// MemoSimilarity scores how alike two memos are, from 0 for nothing in common
+// to 1 for the same, ignoring case and spacing. It's the Dice coefficient of
+// their character bigrams, which tolerates the abbreviations and suffixes
+// banks add.
+func MemoSimilarity(a, b string) float64 {
+	if normalizePayeeName(a) == normalizePayeeName(b) {
+		return 1
+	}
+	ba, bb := memoBigrams(a), memoBigrams(b)
+	var shared, total int
+	for g, n := range ba {
+		if bb[g] < n {
+			shared += bb[g]
+		} else {
+			shared += n
+		}
+		total += n
+	}
+	for _, n := range bb {
+		total += n
+	}
+	if total == 0 {
+		return 0
+	}
+	return 2 * float64(shared) / float64(total)
+}
+
+// DuplicateScore scores how likely existing is the same as candidate, from 0
+// to 1. Splits are only duplicates if they're for the same account and amount
+// within DuplicateWindow. Half of the score is how close their dates are, and
+// half is their MemoSimilarity.
+//
+// Splits with the same ExternalID are always duplicates, and Splits with
+// different ones never are.
+func DuplicateScore(candidate, existing *Split) float64 {
+	if candidate.Account != existing.Account {
+		return 0
+	}
+	if candidate.ExternalID != "" && existing.ExternalID != "" {
+		if candidate.ExternalID == existing.ExternalID {
+			return 1
+		}
+		return 0
+	}
+	if candidate.Amount != existing.Amount {
+		return 0
+	}
+	apart := math.Abs(float64(candidate.Date.DaysSince(existing.Date))) * float64(24*time.Hour)
+	if apart > float64(DuplicateWindow) {
+		return 0
+	}
+
+	closeness := 1 - apart/float64(DuplicateWindow+24*time.Hour)
+	return closeness/2 + MemoSimilarity(candidate.Memo, existing.Memo)/2
+}
+
+// FindDuplicates finds the Splits in existing which are likely duplicates of
+// candidate, best first. ids parallels existing, and holds each Split's
+// transaction id.
+func FindDuplicates(candidate *Split, existing []Split, ids []string) []Duplicate {
+	result := make([]Duplicate, 0)
+	for i := range existing {
+		if score := DuplicateScore(candidate, &existing[i]); score >= DuplicateThreshold {
+			result = append(result, Duplicate{ids[i], existing[i], score})
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Score > result[j].Score
+	})
+	return result
+}
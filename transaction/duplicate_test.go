@@ -0,0 +1,74 @@
+package transaction
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMemoSimilarity(t *testing.T) {
+	for _, test := range []struct {
+		a, b     string
+		expected float64
+	}{
+		{"Trader Joe's", "TRADER  JOE'S", 1},
+		{"abcd", "wxyz", 0},
+		{"", "", 1},
+		{"", "abc", 0},
+		// ab, bc, cd vs ab, bc, ce.
+		{"abcd", "abce", 2.0 / 3},
+	} {
+		if got := MemoSimilarity(test.a, test.b); math.Abs(got-test.expected) > 1e-9 {
+			t.Errorf("Expected similarity of %q and %q to be %v, got %v", test.a, test.b, test.expected, got)
+		}
+	}
+
+	if MemoSimilarity("TRADER JOE'S #123", "Trader Joes") < 0.7 {
+		t.Error("Expected bank memo to be similar to typed memo")
+	}
+}
+
+func TestDuplicateScore(t *testing.T) {
+	s := &Split{Amount: -5000, Account: 1, Memo: "Trader Joe's", Date: testDate(2014, 11, 5)}
+
+	for _, test := range []struct {
+		existing  Split
+		duplicate bool
+	}{
+		{Split{Amount: -5000, Account: 1, Memo: "Trader Joe's", Date: testDate(2014, 11, 5)}, true},
+		{Split{Amount: -5000, Account: 1, Memo: "TRADER JOE'S #123", Date: testDate(2014, 11, 7)}, true},
+		{Split{Amount: -5000, Account: 1, Memo: "Safeway", Date: testDate(2014, 11, 5)}, false},
+		{Split{Amount: -5000, Account: 1, Memo: "Trader Joe's", Date: testDate(2014, 11, 9)}, false},
+		{Split{Amount: -5001, Account: 1, Memo: "Trader Joe's", Date: testDate(2014, 11, 5)}, false},
+		{Split{Amount: -5000, Account: 2, Memo: "Trader Joe's", Date: testDate(2014, 11, 5)}, false},
+	} {
+		score := DuplicateScore(s, &test.existing)
+		if (score >= DuplicateThreshold) != test.duplicate {
+			t.Errorf("Expected %+v duplicate: %v, got score %v", test.existing, test.duplicate, score)
+		}
+	}
+}
+
+func TestDuplicateScore_ExternalID(t *testing.T) {
+	s := &Split{Amount: -5000, Account: 1, ExternalID: "abc"}
+
+	if got := DuplicateScore(s, &Split{Amount: 1, Account: 1, ExternalID: "abc"}); got != 1 {
+		t.Errorf("Expected same external id to be a duplicate, got %v", got)
+	}
+	if got := DuplicateScore(s, &Split{Amount: -5000, Account: 1, ExternalID: "def"}); got != 0 {
+		t.Errorf("Expected different external ids not to be duplicates, got %v", got)
+	}
+}
+
+func TestFindDuplicates(t *testing.T) {
+	s := &Split{Amount: -5000, Account: 1, Memo: "Trader Joe's", Date: testDate(2014, 11, 5)}
+	existing := []Split{
+		{Amount: -5000, Account: 1, Memo: "TRADER JOE'S #123", Date: testDate(2014, 11, 6)},
+		{Amount: -5000, Account: 1, Memo: "Safeway", Date: testDate(2014, 11, 5)},
+		{Amount: -5000, Account: 1, Memo: "Trader Joe's", Date: testDate(2014, 11, 5)},
+	}
+
+	got := FindDuplicates(s, existing, []string{"x1", "x2", "x3"})
+	if len(got) != 2 || got[0].Transaction != "x3" || got[1].Transaction != "x1" {
+		t.Errorf("Expected duplicates x3 and x1, got %+v", got)
+	}
+}
@@ -0,0 +1,132 @@
+package transaction
+
+import (
+	"errors"
+	"sort"
+)
+
+// A ForecastBalance is an Account's projected balance at the end of Date.
+type ForecastBalance struct {
+	Date    Date       `json:"date"`
+	Balance AmountType `json:"balance"`
+}
+
+// A Forecast projects an Account's daily balance forward from Start, its
+// balance before the first day. Low is the lowest projected end of day
+// balance, first reached on LowDate.
+type Forecast struct {
+	Account  int64             `json:"account"`
+	Start    AmountType        `json:"start"`
+	Low      AmountType        `json:"low"`
+	LowDate  Date              `json:"lowDate"`
+	Balances []ForecastBalance `json:"balances"`
+}
+
+// A Recurrence is a Split that repeats, like a paycheck or a bill. It's first
+// due on Split.Date, and then every Months months and Days days after that.
+type Recurrence struct {
+	Split  Split
+	Months int
+	Days   int
+}
+
+// Validate checks that r moves forward in time, so it has a next occurrence.
+func (r *Recurrence) Validate() error {
+	if r.Months < 0 || r.Days < 0 || r.Months+r.Days == 0 {
+		return errors.New("Recurrences must repeat after a positive number of months or days.")
+	}
+	return nil
+}
+
+// Occurrences gets the Splits r is due to be committed as, dated from
+// through through. Each is counted from the first, so a monthly Recurrence
+// from January 31 is back on the 31st in March, rather than drifting.
+func (r *Recurrence) Occurrences(from, through Date) []Split {
+	result := make([]Split, 0)
+	for n := 0; ; n++ {
+		date := r.Split.Date.AddDate(0, n*r.Months, n*r.Days)
+		if date.After(through) {
+			break
+		}
+		if date.Before(from) {
+			continue
+		}
+		s := r.Split
+		s.Date = date
+		result = append(result, s)
+	}
+	return result
+}
+
+// A Budget is spending planned for Account that isn't scheduled as any
+// particular Split. Amount is the change to Account's balance each month, so
+// spending from an Asset is negative, and it's spread evenly over the month's
+// days.
+type Budget struct {
+	Account int64
+	Amount  AmountType
+	Memo    string
+}
+
+// Splits gets b's share of each day from through through. The days of a whole
+// month add up to exactly Amount, and days without a share are left out.
+func (b *Budget) Splits(from, through Date) []Split {
+	result := make([]Split, 0)
+	for month := (Date{from.Year, from.Month, 1}); !month.After(through); month = month.AddDate(0, 1, 0) {
+		days := month.AddDate(0, 1, 0).DaysSince(month)
+		weights := make([]int64, days)
+		for i := range weights {
+			weights[i] = 1
+		}
+		// The weights are all positive, so Allocate can't fail.
+		shares, _ := Allocate(b.Amount, weights)
+		for i, share := range shares {
+			date := month.AddDate(0, 0, i)
+			if share == 0 || date.Before(from) || date.After(through) {
+				continue
+			}
+			result = append(result, Split{Amount: share, Account: b.Account, Memo: b.Memo, Date: date})
+		}
+	}
+	return result
+}
+
+// ProjectBalances forecasts the end of day balance of each Account in start,
+// which maps Accounts to their balance before from, for days days beginning
+// with from. scheduled holds the Splits expected to be committed in that time.
+// Any dated before from are overdue, and are applied on the first day, and any
+// for Accounts not in start are ignored.
+//
+// Forecasts are sorted by Account.
+func ProjectBalances(start map[int64]AmountType, scheduled []Split, from Date, days int) []Forecast {
+	sorted := make([]Split, len(scheduled))
+	copy(sorted, scheduled)
+	sort.SliceStable(sorted, func(a, b int) bool {
+		return sorted[a].Date.Before(sorted[b].Date)
+	})
+
+	result := make([]Forecast, 0, len(start))
+	for account, balance := range start {
+		f := Forecast{Account: account, Start: balance, Balances: make([]ForecastBalance, 0, days)}
+
+		next := 0
+		for d := 0; d < days; d++ {
+			date := from.AddDate(0, 0, d)
+			for ; next < len(sorted) && !sorted[next].Date.After(date); next++ {
+				if sorted[next].Account == account {
+					balance += sorted[next].Amount
+				}
+			}
+			f.Balances = append(f.Balances, ForecastBalance{date, balance})
+			if d == 0 || balance < f.Low {
+				f.Low, f.LowDate = balance, date
+			}
+		}
+		result = append(result, f)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Account < result[j].Account
+	})
+	return result
+}
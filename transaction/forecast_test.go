@@ -0,0 +1,95 @@
+package transaction
+
+import "testing"
+
+func TestProjectBalances(t *testing.T) {
+	from := testDate(2014, 11, 5)
+	start := map[int64]AmountType{2: 100000, 1: 20000}
+	scheduled := []Split{
+		{Amount: 150000, Account: 1, Date: testDate(2014, 11, 8)},
+		{Amount: -30000, Account: 1, Date: testDate(2014, 11, 6)},
+		{Amount: -5000, Account: 1, Date: testDate(2014, 11, 1)},
+		{Amount: -1000, Account: 3, Date: testDate(2014, 11, 6)},
+		{Amount: -1000, Account: 2, Date: testDate(2014, 11, 20)},
+	}
+
+	got := ProjectBalances(start, scheduled, from, 5)
+
+	if len(got) != 2 || got[0].Account != 1 || got[1].Account != 2 {
+		t.Fatalf("Expected forecasts for accounts 1 and 2, got %+v", got)
+	}
+
+	expected := []AmountType{15000, -15000, -15000, 135000, 135000}
+	if len(got[0].Balances) != len(expected) {
+		t.Fatalf("Expected %v days, got %+v", len(expected), got[0].Balances)
+	}
+	for i, b := range got[0].Balances {
+		if b.Balance != expected[i] || b.Date != from.AddDate(0, 0, i) {
+			t.Errorf("Day %v: expected %v on %v, got %+v", i, expected[i], from.AddDate(0, 0, i), b)
+		}
+	}
+	if got[0].Start != 20000 || got[0].Low != -15000 || got[0].LowDate != testDate(2014, 11, 6) {
+		t.Errorf("Expected low -15000 on 2014-11-06, got %+v", got[0])
+	}
+
+	if got[1].Low != 100000 || got[1].LowDate != from {
+		t.Errorf("Expected unchanged account to stay at its start, got %+v", got[1])
+	}
+}
+
+func TestRecurrence_Occurrences(t *testing.T) {
+	r := &Recurrence{Split: Split{Amount: -1000, Account: 1, Date: testDate(2014, 1, 31)}, Months: 1}
+	if err := r.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := r.Occurrences(testDate(2014, 2, 1), testDate(2014, 5, 30))
+
+	expected := []Date{testDate(2014, 3, 3), testDate(2014, 3, 31), testDate(2014, 5, 1)}
+	if len(got) != len(expected) {
+		t.Fatalf("Expected %v occurrences, got %+v", len(expected), got)
+	}
+	for i, s := range got {
+		if s.Date != expected[i] || s.Amount != -1000 || s.Account != 1 {
+			t.Errorf("Occurrence %v: expected -1000 on %v, got %+v", i, expected[i], s)
+		}
+	}
+}
+
+func TestRecurrence_Invalid(t *testing.T) {
+	for _, r := range []Recurrence{{}, {Months: -1, Days: 2}} {
+		if err := r.Validate(); err == nil {
+			t.Errorf("Expected error for %+v", r)
+		}
+	}
+}
+
+func TestBudget_Splits(t *testing.T) {
+	b := &Budget{Account: 1, Amount: -3001}
+
+	got := b.Splits(testDate(2014, 11, 29), testDate(2014, 12, 1))
+
+	// November's 30 days share -3001, with the extra unit on the first day, and
+	// December's 31 share it with 25 extra units on its first days.
+	expected := []Split{
+		{Amount: -100, Account: 1, Date: testDate(2014, 11, 29)},
+		{Amount: -100, Account: 1, Date: testDate(2014, 11, 30)},
+		{Amount: -97, Account: 1, Date: testDate(2014, 12, 1)},
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("Expected %v splits, got %+v", len(expected), got)
+	}
+	for i := range got {
+		if got[i].Amount != expected[i].Amount || got[i].Date != expected[i].Date {
+			t.Errorf("Split %v: expected %+v, got %+v", i, expected[i], got[i])
+		}
+	}
+
+	var total AmountType
+	for _, s := range b.Splits(testDate(2014, 2, 1), testDate(2014, 2, 28)) {
+		total += s.Amount
+	}
+	if total != -3001 {
+		t.Errorf("Expected a whole month to total -3001, got %v", total)
+	}
+}
@@ -0,0 +1,66 @@
+package transaction
+
+import (
+	"encoding/csv"
+	"io"
+)
+
+// An IncomeStatement sums the activity of Income and Expense Accounts over
+// each of its Columns, grouped by the Account hierarchy. Income is shown as
+// positive, though it's stored as negative amounts, so NetIncome is
+// TotalIncome less TotalExpenses.
+type IncomeStatement struct {
+	Columns       []DateRange  `json:"columns"`
+	Income        []ReportLine `json:"income"`
+	Expenses      []ReportLine `json:"expenses"`
+	TotalIncome   []AmountType `json:"totalIncome"`
+	TotalExpenses []AmountType `json:"totalExpenses"`
+	NetIncome     []AmountType `json:"netIncome"`
+}
+
+// NewIncomeStatement builds an IncomeStatement for each of columns from
+// splits, the Splits in accounts. Splits in other Accounts are ignored.
+func NewIncomeStatement(accounts map[int64]Account, splits []Split, columns []DateRange) *IncomeStatement {
+	own := make(map[int64][]AmountType)
+	for _, s := range splits {
+		if _, ok := accounts[s.Account]; !ok {
+			continue
+		}
+		for i, r := range columns {
+			if r.Contains(s.Date) {
+				if own[s.Account] == nil {
+					own[s.Account] = make([]AmountType, len(columns))
+				}
+				own[s.Account][i] += s.Amount
+			}
+		}
+	}
+
+	result := &IncomeStatement{Columns: columns, NetIncome: make([]AmountType, len(columns))}
+	result.Income, result.TotalIncome = hierarchyLines(accounts, Income, own, len(columns), -1)
+	result.Expenses, result.TotalExpenses = hierarchyLines(accounts, Expense, own, len(columns), 1)
+	for i := range columns {
+		result.NetIncome[i] = result.TotalIncome[i] - result.TotalExpenses[i]
+	}
+	return result
+}
+
+// WriteCSV writes s to w as CSV, with a column of Account names, indented by
+// depth, and a column of amounts for each of s.Columns.
+func (s *IncomeStatement) WriteCSV(w io.Writer) error {
+	c := csv.NewWriter(w)
+	if err := c.Write(csvHeader("Account", s.Columns)); err != nil {
+		return err
+	}
+	if err := writeCSVSection(c, "Income", s.Income, s.TotalIncome); err != nil {
+		return err
+	}
+	if err := writeCSVSection(c, "Expenses", s.Expenses, s.TotalExpenses); err != nil {
+		return err
+	}
+	if err := c.Write(csvRow("Net income", s.NetIncome)); err != nil {
+		return err
+	}
+	c.Flush()
+	return c.Error()
+}
@@ -0,0 +1,84 @@
+package transaction
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// testReportAccounts is a small Account hierarchy for reports.
+var testReportAccounts = map[int64]Account{
+	1: {Name: "Checking", Type: Asset},
+	2: {Name: "Salary", Type: Income},
+	3: {Name: "Food", Type: Expense},
+	4: {Name: "Groceries", Type: Expense, Parent: 3},
+	5: {Name: "Restaurants", Type: Expense, Parent: 3},
+	6: {Name: "Rent", Type: Expense},
+	7: {Name: "Orphan", Type: Expense, Parent: 1},
+}
+
+func TestNewIncomeStatement(t *testing.T) {
+	splits := []Split{
+		{Amount: -300000, Account: 2, Date: testDate(2014, 11, 1)},
+		{Amount: 20000, Account: 4, Date: testDate(2014, 11, 3)},
+		{Amount: 5000, Account: 5, Date: testDate(2014, 11, 8)},
+		{Amount: 1000, Account: 3, Date: testDate(2014, 11, 9)},
+		{Amount: 150000, Account: 6, Date: testDate(2014, 10, 1)},
+		{Amount: 2500, Account: 7, Date: testDate(2014, 11, 9)},
+		{Amount: 999, Account: 8, Date: testDate(2014, 11, 9)},
+	}
+	columns := []DateRange{
+		{testDate(2014, 11, 1), testDate(2014, 11, 30)},
+		{testDate(2014, 10, 1), testDate(2014, 10, 31)},
+	}
+
+	got := NewIncomeStatement(testReportAccounts, splits, columns)
+
+	expected := &IncomeStatement{
+		Columns: columns,
+		Income:  []ReportLine{{2, "Salary", 0, []AmountType{300000, 0}}},
+		Expenses: []ReportLine{
+			{3, "Food", 0, []AmountType{26000, 0}},
+			{4, "Groceries", 1, []AmountType{20000, 0}},
+			{5, "Restaurants", 1, []AmountType{5000, 0}},
+			{7, "Orphan", 0, []AmountType{2500, 0}},
+			{6, "Rent", 0, []AmountType{0, 150000}},
+		},
+		TotalIncome:   []AmountType{300000, 0},
+		TotalExpenses: []AmountType{28500, 150000},
+		NetIncome:     []AmountType{271500, -150000},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, got)
+	}
+}
+
+func TestIncomeStatementWriteCSV(t *testing.T) {
+	s := &IncomeStatement{
+		Columns:       []DateRange{{testDate(2014, 11, 1), testDate(2014, 11, 30)}},
+		Income:        []ReportLine{{2, "Salary", 0, []AmountType{300000}}},
+		Expenses:      []ReportLine{{3, "Food", 0, []AmountType{25000}}, {4, "Groceries, etc", 1, []AmountType{25000}}},
+		TotalIncome:   []AmountType{300000},
+		TotalExpenses: []AmountType{25000},
+		NetIncome:     []AmountType{275000},
+	}
+
+	var b bytes.Buffer
+	if err := s.WriteCSV(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `Account,2014-11-01 to 2014-11-30
+Income
+"  Salary",300000
+Total income,300000
+Expenses
+"  Food",25000
+"    Groceries, etc",25000
+Total expenses,25000
+Net income,275000
+`
+	if b.String() != expected {
+		t.Errorf("Expected CSV\n%v\ngot\n%v", expected, b.String())
+	}
+}
@@ -0,0 +1,212 @@
+package transaction
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// A RateType says how an Interest rate is quoted.
+type RateType string
+
+const (
+	// APR is a nominal annual rate, which is divided evenly between compounding
+	// periods.
+	APR RateType = "apr"
+	// APY is an effective annual yield, which already includes compounding.
+	APY RateType = "apy"
+)
+
+// A Compounding is how often accrued interest is posted to an Account, after
+// which it earns interest itself.
+type Compounding string
+
+const (
+	Daily     Compounding = "daily"
+	Monthly   Compounding = "monthly"
+	Quarterly Compounding = "quarterly"
+	Annually  Compounding = "annually"
+)
+
+// A DayCount is the convention used to turn a number of days into a fraction
+// of a year.
+type DayCount string
+
+const (
+	Actual365 DayCount = "actual/365"
+	Actual360 DayCount = "actual/360"
+	Thirty360 DayCount = "30/360"
+)
+
+// Interest accrues on the daily balance of an Account, and is posted once per
+// compounding period against Account, usually an Income account for savings
+// or an Expense account for credit.
+//
+// Interest has been posted for every day from Since until, but not including,
+// Through. Posted is the total posted so far. Since each posting is computed
+// from the Account's whole Split history and then reduced by Posted, Splits
+// that are back-dated into an already posted period are corrected for in the
+// next posting.
+type Interest struct {
+	Rate        float64     `json:"rate"`
+	RateType    RateType    `json:"rateType"`
+	Compounding Compounding `json:"compounding"`
+	DayCount    DayCount    `json:"dayCount"`
+	Account     int64       `json:"account"`
+
+	Since   Date       `json:"since"`
+	Through Date       `json:"through"`
+	Posted  AmountType `json:"posted"`
+}
+
+// An InterestPosting is the interest due for the period ending on Date, which
+// is also the date it should be posted.
+type InterestPosting struct {
+	From   Date       `json:"from"`
+	Date   Date       `json:"date"`
+	Amount AmountType `json:"amount"`
+}
+
+// Make sure an Interest configuration is valid. Useful if it was created with
+// user-provided data.
+func (i *Interest) Validate() error {
+	if i.Rate < 0 || i.Rate >= 1 {
+		return fmt.Errorf("Interest rate %v is not a fraction.", i.Rate)
+	}
+	switch i.RateType {
+	case APR, APY:
+	default:
+		return fmt.Errorf("Unknown rate type %q", i.RateType)
+	}
+	if i.periodsPerYear() == 0 {
+		return fmt.Errorf("Unknown compounding %q", i.Compounding)
+	}
+	switch i.DayCount {
+	case Actual365, Actual360, Thirty360:
+	default:
+		return fmt.Errorf("Unknown day count %q", i.DayCount)
+	}
+	if i.Account == 0 {
+		return errors.New("Interest needs an account to post against.")
+	}
+	if i.Since.IsZero() {
+		return errors.New("Interest has no start date.")
+	}
+	return nil
+}
+
+func (i *Interest) periodsPerYear() float64 {
+	switch i.Compounding {
+	case Daily:
+		return 365
+	case Monthly:
+		return 12
+	case Quarterly:
+		return 4
+	case Annually:
+		return 1
+	}
+	return 0
+}
+
+// nominalRate is the annual rate which, divided between compounding periods,
+// gives the periodic rate.
+func (i *Interest) nominalRate() float64 {
+	if i.RateType == APY {
+		n := i.periodsPerYear()
+		return n * (math.Pow(1+i.Rate, 1/n) - 1)
+	}
+	return i.Rate
+}
+
+// yearFraction is the fraction of a year between from and to under the
+// day count convention.
+func (i *Interest) yearFraction(from, to Date) float64 {
+	switch i.DayCount {
+	case Actual360:
+		return float64(to.DaysSince(from)) / 360
+	case Thirty360:
+		y1, m1, d1 := from.Year, from.Month, from.Day
+		y2, m2, d2 := to.Year, to.Month, to.Day
+		if d1 == 31 {
+			d1 = 30
+		}
+		if d2 == 31 && d1 == 30 {
+			d2 = 30
+		}
+		days := 360*(y2-y1) + 30*(int(m2)-int(m1)) + (d2 - d1)
+		return float64(days) / 360
+	}
+	return float64(to.DaysSince(from)) / 365
+}
+
+// NextPeriodEnd is the date that the compounding period containing Through
+// ends, and so the date of the next posting.
+func (i *Interest) NextPeriodEnd() Date {
+	y, m := i.Through.Year, i.Through.Month
+	switch i.Compounding {
+	case Daily:
+		return i.Through.AddDate(0, 0, 1)
+	case Monthly:
+		return Date{y, m, 1}.AddDate(0, 1, 0)
+	case Quarterly:
+		return Date{y, m - (m-1)%3, 1}.AddDate(0, 3, 0)
+	}
+	return Date{y + 1, 1, 1}
+}
+
+// Accrue computes the unrounded interest earned from the start of from until
+// the start of to, using the end of day balance from splits, the Account's
+// whole Split history.
+func (i *Interest) Accrue(splits []Split, from, to Date) float64 {
+	sorted := make([]Split, len(splits))
+	copy(sorted, splits)
+	sort.SliceStable(sorted, func(a, b int) bool {
+		return sorted[a].Date.Before(sorted[b].Date)
+	})
+
+	// The balance of each segment is constant, and is the balance at the end of
+	// the segment's first day.
+	rate := i.nominalRate()
+	var balance AmountType
+	var accrued float64
+	start := from
+	for _, s := range sorted {
+		if date := s.Date; date.After(start) {
+			if !date.Before(to) {
+				break
+			}
+			accrued += float64(balance) * rate * i.yearFraction(start, date)
+			start = date
+		}
+		balance += s.Amount
+	}
+	if to.After(start) {
+		accrued += float64(balance) * rate * i.yearFraction(start, to)
+	}
+	return accrued
+}
+
+// Next computes the next posting from splits, the Account's whole Split
+// history. The amount includes any correction for back-dated Splits.
+func (i *Interest) Next(splits []Split) *InterestPosting {
+	end := i.NextPeriodEnd()
+	total := AmountType(math.Floor(i.Accrue(splits, i.Since, end) + 0.5))
+	return &InterestPosting{From: i.Through, Date: end, Amount: total - i.Posted}
+}
+
+// Post records that p was posted.
+func (i *Interest) Post(p *InterestPosting) {
+	i.Through = p.Date
+	i.Posted += p.Amount
+}
+
+// Splits builds the Splits that post p: the interest is added to account, and
+// taken from the Interest's Account.
+func (p *InterestPosting) Splits(account, interestAccount int64, memo string) []*Split {
+	return []*Split{
+		{Amount: p.Amount, Account: account, Memo: memo, Date: p.Date},
+		{Amount: -p.Amount, Account: interestAccount, Memo: memo, Date: p.Date},
+	}
+}
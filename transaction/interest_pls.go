@@ -0,0 +1,53 @@
+// +build appengine
+
+package transaction
+
+import (
+	"time"
+
+	"appengine/datastore"
+)
+
+// Implement PropertyLoadSaver for transaction.Interest, since datastore can't
+// hold a Date. Since and Through are stored like a Split's Date, see
+// SplitDateQueryValue. Unknown properties are ignored.
+func (i *Interest) Load(c <-chan datastore.Property) error {
+	for p := range c {
+		switch p.Name {
+		case "Rate":
+			i.Rate = p.Value.(float64)
+		case "RateType":
+			i.RateType = RateType(p.Value.(string))
+		case "Compounding":
+			i.Compounding = Compounding(p.Value.(string))
+		case "DayCount":
+			i.DayCount = DayCount(p.Value.(string))
+		case "Account":
+			i.Account = p.Value.(int64)
+		case "Since":
+			i.Since = storedDate(p.Value.(time.Time))
+		case "Through":
+			i.Through = storedDate(p.Value.(time.Time))
+		case "Posted":
+			i.Posted = AmountType(p.Value.(int64))
+		}
+	}
+
+	return nil
+}
+
+// See Interest.Load.
+func (i *Interest) Save(c chan<- datastore.Property) error {
+	defer close(c)
+
+	c <- datastore.Property{Name: "Rate", Value: i.Rate}
+	c <- datastore.Property{Name: "RateType", Value: string(i.RateType)}
+	c <- datastore.Property{Name: "Compounding", Value: string(i.Compounding)}
+	c <- datastore.Property{Name: "DayCount", Value: string(i.DayCount)}
+	c <- datastore.Property{Name: "Account", Value: i.Account}
+	c <- datastore.Property{Name: "Since", Value: SplitDateQueryValue(i.Since)}
+	c <- datastore.Property{Name: "Through", Value: SplitDateQueryValue(i.Through)}
+	c <- datastore.Property{Name: "Posted", Value: int64(i.Posted)}
+
+	return nil
+}
@@ -0,0 +1,29 @@
+// +build appengine
+
+package transaction
+
+import (
+	"testing"
+
+	"appengine/datastore"
+)
+
+func TestInterestSaveAndLoad(t *testing.T) {
+	saved := newTestInterest()
+	saved.Through, saved.Posted = testDate(2014, 12, 1), 300
+
+	propChan := make(chan datastore.Property)
+	go func() {
+		if err := saved.Save(propChan); err != nil {
+			t.Errorf("Failed to save %v: %v", saved, err)
+		}
+	}()
+
+	loaded := &Interest{}
+	if err := loaded.Load(propChan); err != nil {
+		t.Errorf("Failed to load into %v: %v", loaded, err)
+	}
+	if *loaded != *saved {
+		t.Errorf("Loaded value %+v was not the same as saved value %+v", loaded, saved)
+	}
+}
@@ -0,0 +1,145 @@
+package transaction
+
+import (
+	"math"
+	"testing"
+)
+
+func newTestInterest() *Interest {
+	return &Interest{
+		Rate:        0.0365,
+		RateType:    APR,
+		Compounding: Monthly,
+		DayCount:    Actual365,
+		Account:     2,
+		Since:       testDate(2014, 11, 1),
+		Through:     testDate(2014, 11, 1),
+	}
+}
+
+func TestInterestValidate(t *testing.T) {
+	if err := newTestInterest().Validate(); err != nil {
+		t.Errorf("Expected valid, got %v", err)
+	}
+
+	for _, change := range []func(i *Interest){
+		func(i *Interest) { i.Rate = 3.65 },
+		func(i *Interest) { i.RateType = "bogus" },
+		func(i *Interest) { i.Compounding = "hourly" },
+		func(i *Interest) { i.DayCount = "bogus" },
+		func(i *Interest) { i.Account = 0 },
+		func(i *Interest) { i.Since = Date{} },
+	} {
+		i := newTestInterest()
+		change(i)
+		if err := i.Validate(); err == nil {
+			t.Errorf("Expected interest %+v to be invalid", i)
+		}
+	}
+}
+
+func TestInterestNextPeriodEnd(t *testing.T) {
+	for _, test := range []struct {
+		c        Compounding
+		through  Date
+		expected Date
+	}{
+		{Daily, testDate(2014, 12, 31), testDate(2015, 1, 1)},
+		{Monthly, testDate(2014, 11, 1), testDate(2014, 12, 1)},
+		{Monthly, testDate(2014, 12, 15), testDate(2015, 1, 1)},
+		{Quarterly, testDate(2014, 11, 1), testDate(2015, 1, 1)},
+		{Quarterly, testDate(2014, 4, 1), testDate(2014, 7, 1)},
+		{Annually, testDate(2014, 4, 1), testDate(2015, 1, 1)},
+	} {
+		i := &Interest{Compounding: test.c, Through: test.through}
+		if got := i.NextPeriodEnd(); got != test.expected {
+			t.Errorf("Expected %v period after %v to end %v, got %v",
+				test.c, test.through, test.expected, got)
+		}
+	}
+}
+
+func TestInterestAccrue(t *testing.T) {
+	i := newTestInterest()
+	splits := []Split{
+		{Amount: 100000, Date: testDate(2014, 10, 1)},
+		{Amount: 100000, Date: testDate(2014, 11, 11)},
+		{Amount: -100000, Date: testDate(2014, 12, 5)},
+	}
+
+	// 10 days at 100000 and 10 days at 200000, each day earning 0.01%.
+	got := i.Accrue(splits, testDate(2014, 11, 1), testDate(2014, 11, 21))
+	if math.Abs(got-300) > 1e-6 {
+		t.Errorf("Expected 300 accrued, got %v", got)
+	}
+}
+
+func TestInterestAccrue_DayCounts(t *testing.T) {
+	splits := []Split{{Amount: 360000, Date: testDate(2014, 1, 1)}}
+	from, to := testDate(2014, 1, 31), testDate(2014, 3, 1)
+
+	i := &Interest{Rate: 0.1, RateType: APR, DayCount: Actual360}
+	if got := i.Accrue(splits, from, to); math.Abs(got-2900) > 1e-6 {
+		t.Errorf("Expected actual/360 accrual 2900, got %v", got)
+	}
+
+	i.DayCount = Thirty360
+	if got := i.Accrue(splits, from, to); math.Abs(got-3100) > 1e-6 {
+		t.Errorf("Expected 30/360 accrual 3100, got %v", got)
+	}
+}
+
+func TestInterestAPY(t *testing.T) {
+	i := &Interest{Rate: 0.12, RateType: APY, Compounding: Monthly}
+
+	// Compounding the periodic rate for a year gives back the APY.
+	periodic := i.nominalRate() / 12
+	if got := math.Pow(1+periodic, 12) - 1; math.Abs(got-0.12) > 1e-9 {
+		t.Errorf("Expected 12%% yield, got %v", got)
+	}
+}
+
+func TestInterestNextAndPost(t *testing.T) {
+	i := newTestInterest()
+	splits := []Split{{Amount: 100000, Date: testDate(2014, 10, 1)}}
+
+	p := i.Next(splits)
+	if p.Date != testDate(2014, 12, 1) || p.Amount != 300 {
+		t.Errorf("Expected posting of 300 on 2014-12-01, got %+v", p)
+	}
+
+	i.Post(p)
+	if i.Through != p.Date || i.Posted != 300 {
+		t.Errorf("Expected interest posted through %v, got %+v", p.Date, i)
+	}
+}
+
+func TestInterestNext_BackDatedSplit(t *testing.T) {
+	i := newTestInterest()
+	splits := []Split{{Amount: 100000, Date: testDate(2014, 10, 1)}}
+	p := i.Next(splits)
+	i.Post(p)
+	splits = append(splits, *p.Splits(1, 2, "Interest")[0])
+
+	// A deposit dated in November, after November's interest was posted, earns
+	// its missed interest in December's posting.
+	splits = append(splits, Split{Amount: 100000, Date: testDate(2014, 11, 21)})
+	p = i.Next(splits)
+
+	november := 100000 * 0.0001 * 10
+	december := 200300 * 0.0001 * 31
+	expected := AmountType(math.Floor(november + december + 0.5))
+	if p.Amount != expected {
+		t.Errorf("Expected posting of %v, got %v", expected, p.Amount)
+	}
+}
+
+func TestInterestPostingSplits(t *testing.T) {
+	p := &InterestPosting{Date: testDate(2014, 12, 1), Amount: -250}
+
+	x := NewTransaction()
+	x.AddSplits(p.Splits(1, 2, "Interest"))
+	if err := x.ValidateAmount(); err != nil {
+		t.Errorf("Expected valid posting splits, got %v", err)
+	}
+}
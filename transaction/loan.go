@@ -0,0 +1,168 @@
+package transaction
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// A Loan amortizes the balance of a Liability Account with fixed monthly
+// payments. Each payment pays the month's interest into InterestAccount, and
+// the rest of it pays down the principal, both funded from PaymentAccount.
+//
+// Payment, Balance and Paid track the loan's progress, and are set by
+// Amortize and Pay rather than by users. Start, and every payment's due date,
+// is a calendar date like a Split's, so it's the same in every time zone.
+type Loan struct {
+	Principal       AmountType `json:"principal"`
+	Rate            float64    `json:"rate"`
+	Term            int64      `json:"term"`
+	Start           Date       `json:"start"`
+	InterestAccount int64      `json:"interestAccount"`
+	PaymentAccount  int64      `json:"paymentAccount"`
+
+	Payment AmountType `json:"payment"`
+	Balance AmountType `json:"balance"`
+	Paid    int64      `json:"paid"`
+}
+
+// A LoanPayment is one row of an amortization table, or one posted payment.
+// Number is 0 for a payment of extra principal only.
+type LoanPayment struct {
+	Number    int64      `json:"number"`
+	Date      Date       `json:"date"`
+	Payment   AmountType `json:"payment"`
+	Principal AmountType `json:"principal"`
+	Interest  AmountType `json:"interest"`
+	Balance   AmountType `json:"balance"`
+}
+
+// Make sure a Loan has valid terms. Useful if it was created with
+// user-provided data.
+//
+// Rate is the nominal annual rate as a fraction, so 4.5% is 0.045. Term is a
+// number of months, and Start is the date of the first payment.
+func (l *Loan) Validate() error {
+	if l.Principal <= 0 {
+		return errors.New("Loan principal must be positive.")
+	}
+	if l.Rate < 0 || l.Rate >= 1 {
+		return fmt.Errorf("Loan rate %v is not a fraction.", l.Rate)
+	}
+	if l.Term <= 0 {
+		return errors.New("Loan term must be positive.")
+	}
+	if l.Start.IsZero() {
+		return errors.New("Loan has no start date.")
+	}
+	if l.InterestAccount == 0 || l.PaymentAccount == 0 {
+		return errors.New("Loan needs interest and payment accounts.")
+	}
+	return nil
+}
+
+// Amortize computes the fixed monthly payment that pays off the loan over its
+// term, and resets the loan to its first payment.
+func (l *Loan) Amortize() {
+	l.Balance = l.Principal
+	l.Paid = 0
+
+	r := l.monthlyRate()
+	if r == 0 {
+		l.Payment = AmountType(math.Ceil(float64(l.Principal) / float64(l.Term)))
+		return
+	}
+	p := float64(l.Principal) * r / (1 - math.Pow(1+r, -float64(l.Term)))
+	l.Payment = AmountType(math.Ceil(p))
+}
+
+func (l *Loan) monthlyRate() float64 {
+	return l.Rate / 12
+}
+
+// interest is the interest owed for one month on the current balance, rounded
+// to the nearest unit.
+func (l *Loan) interest() AmountType {
+	return AmountType(math.Floor(float64(l.Balance)*l.monthlyRate() + 0.5))
+}
+
+// dueDate is the date scheduled payment number n is due.
+func (l *Loan) dueDate(n int64) Date {
+	return l.Start.AddDate(0, int(n-1), 0)
+}
+
+// Pay applies the next payment to the loan and returns its breakdown. If
+// scheduled is false, only extra principal is paid, otherwise extra is added
+// to the next scheduled payment.
+//
+// Since the monthly payment doesn't change, paying extra principal shortens
+// the rest of the schedule.
+func (l *Loan) Pay(extra AmountType, scheduled bool) (*LoanPayment, error) {
+	if l.Balance <= 0 {
+		return nil, errors.New("Loan is already paid off.")
+	}
+	if extra < 0 {
+		return nil, errors.New("Extra principal can't be negative.")
+	}
+	if !scheduled && extra == 0 {
+		return nil, errors.New("No payment amount.")
+	}
+
+	p := &LoanPayment{}
+	if scheduled {
+		p.Number = l.Paid + 1
+		p.Date = l.dueDate(p.Number)
+		p.Interest = l.interest()
+		p.Principal = l.Payment - p.Interest
+		if p.Principal > l.Balance {
+			p.Principal = l.Balance
+		}
+	}
+
+	if p.Principal+extra > l.Balance {
+		return nil, fmt.Errorf("Payment of %v principal exceeds balance %v.",
+			p.Principal+extra, l.Balance)
+	}
+	p.Principal += extra
+	p.Payment = p.Principal + p.Interest
+
+	if scheduled {
+		l.Paid++
+	}
+	l.Balance -= p.Principal
+	p.Balance = l.Balance
+	return p, nil
+}
+
+// Schedule computes the remaining amortization table from the loan's current
+// balance, without changing the loan.
+func (l *Loan) Schedule() []LoanPayment {
+	result := make([]LoanPayment, 0)
+
+	// Pay a copy of the loan to completion. Each payment reduces the balance,
+	// unless the payment doesn't even cover the interest.
+	remaining := *l
+	for remaining.Balance > 0 {
+		p, err := remaining.Pay(0, true)
+		if err != nil || p.Principal <= 0 {
+			break
+		}
+		result = append(result, *p)
+	}
+	return result
+}
+
+// Splits builds the Splits that post p: the payment leaves paymentAccount,
+// the principal pays down loanAccount, and the interest is charged to
+// interestAccount. Zero amounts are left out, since a Transaction can't
+// contain them.
+func (p *LoanPayment) Splits(loanAccount, paymentAccount, interestAccount int64, memo string, date Date) []*Split {
+	splits := []*Split{{Amount: -p.Payment, Account: paymentAccount, Memo: memo, Date: date}}
+	if p.Principal != 0 {
+		splits = append(splits, &Split{Amount: p.Principal, Account: loanAccount, Memo: memo, Date: date})
+	}
+	if p.Interest != 0 {
+		splits = append(splits, &Split{Amount: p.Interest, Account: interestAccount, Memo: memo, Date: date})
+	}
+	return splits
+}
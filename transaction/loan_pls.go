@@ -0,0 +1,56 @@
+// +build appengine
+
+package transaction
+
+import (
+	"time"
+
+	"appengine/datastore"
+)
+
+// Implement PropertyLoadSaver for transaction.Loan, since datastore can't hold
+// a Date. Start is stored like a Split's Date, see SplitDateQueryValue.
+// Unknown properties are ignored.
+func (l *Loan) Load(c <-chan datastore.Property) error {
+	for p := range c {
+		switch p.Name {
+		case "Principal":
+			l.Principal = AmountType(p.Value.(int64))
+		case "Rate":
+			l.Rate = p.Value.(float64)
+		case "Term":
+			l.Term = p.Value.(int64)
+		case "Start":
+			l.Start = storedDate(p.Value.(time.Time))
+		case "InterestAccount":
+			l.InterestAccount = p.Value.(int64)
+		case "PaymentAccount":
+			l.PaymentAccount = p.Value.(int64)
+		case "Payment":
+			l.Payment = AmountType(p.Value.(int64))
+		case "Balance":
+			l.Balance = AmountType(p.Value.(int64))
+		case "Paid":
+			l.Paid = p.Value.(int64)
+		}
+	}
+
+	return nil
+}
+
+// See Loan.Load.
+func (l *Loan) Save(c chan<- datastore.Property) error {
+	defer close(c)
+
+	c <- datastore.Property{Name: "Principal", Value: int64(l.Principal)}
+	c <- datastore.Property{Name: "Rate", Value: l.Rate}
+	c <- datastore.Property{Name: "Term", Value: l.Term}
+	c <- datastore.Property{Name: "Start", Value: SplitDateQueryValue(l.Start)}
+	c <- datastore.Property{Name: "InterestAccount", Value: l.InterestAccount}
+	c <- datastore.Property{Name: "PaymentAccount", Value: l.PaymentAccount}
+	c <- datastore.Property{Name: "Payment", Value: int64(l.Payment)}
+	c <- datastore.Property{Name: "Balance", Value: int64(l.Balance)}
+	c <- datastore.Property{Name: "Paid", Value: l.Paid}
+
+	return nil
+}
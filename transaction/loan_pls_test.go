@@ -0,0 +1,29 @@
+// +build appengine
+
+package transaction
+
+import (
+	"testing"
+
+	"appengine/datastore"
+)
+
+func TestLoanSaveAndLoad(t *testing.T) {
+	saved := newTestLoan()
+	saved.Paid, saved.Balance = 2, 80000
+
+	propChan := make(chan datastore.Property)
+	go func() {
+		if err := saved.Save(propChan); err != nil {
+			t.Errorf("Failed to save %v: %v", saved, err)
+		}
+	}()
+
+	loaded := &Loan{}
+	if err := loaded.Load(propChan); err != nil {
+		t.Errorf("Failed to load into %v: %v", loaded, err)
+	}
+	if *loaded != *saved {
+		t.Errorf("Loaded value %+v was not the same as saved value %+v", loaded, saved)
+	}
+}
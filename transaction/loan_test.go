@@ -0,0 +1,156 @@
+package transaction
+
+import "testing"
+
+func newTestLoan() *Loan {
+	l := &Loan{
+		Principal:       100000,
+		Rate:            0.12,
+		Term:            12,
+		Start:           testDate(2014, 11, 1),
+		InterestAccount: 2,
+		PaymentAccount:  3,
+	}
+	l.Amortize()
+	return l
+}
+
+func TestLoanValidate(t *testing.T) {
+	if err := newTestLoan().Validate(); err != nil {
+		t.Errorf("Expected valid, got %v", err)
+	}
+
+	for _, l := range []Loan{
+		{Principal: 0, Rate: 0.1, Term: 12, Start: testDate(2014, 11, 1), InterestAccount: 1, PaymentAccount: 2},
+		{Principal: 100, Rate: 4.5, Term: 12, Start: testDate(2014, 11, 1), InterestAccount: 1, PaymentAccount: 2},
+		{Principal: 100, Rate: 0.1, Term: 0, Start: testDate(2014, 11, 1), InterestAccount: 1, PaymentAccount: 2},
+		{Principal: 100, Rate: 0.1, Term: 12, InterestAccount: 1, PaymentAccount: 2},
+		{Principal: 100, Rate: 0.1, Term: 12, Start: testDate(2014, 11, 1), PaymentAccount: 2},
+	} {
+		if err := l.Validate(); err == nil {
+			t.Errorf("Expected loan %+v to be invalid", l)
+		}
+	}
+}
+
+func TestLoanAmortize(t *testing.T) {
+	l := newTestLoan()
+
+	if l.Payment != 8885 {
+		t.Errorf("Expected payment 8885, got %v", l.Payment)
+	}
+	if l.Balance != l.Principal {
+		t.Errorf("Expected balance %v, got %v", l.Principal, l.Balance)
+	}
+}
+
+func TestLoanAmortize_ZeroRate(t *testing.T) {
+	l := &Loan{Principal: 1200, Term: 12}
+	l.Amortize()
+
+	if l.Payment != 100 {
+		t.Errorf("Expected payment 100, got %v", l.Payment)
+	}
+}
+
+func TestLoanSchedule(t *testing.T) {
+	l := newTestLoan()
+	s := l.Schedule()
+
+	if len(s) != 12 {
+		t.Fatalf("Expected 12 payments, got %v", len(s))
+	}
+	var principal AmountType
+	for _, p := range s {
+		principal += p.Principal
+		if p.Principal+p.Interest != p.Payment {
+			t.Errorf("Payment %+v doesn't add up", p)
+		}
+	}
+	if principal != l.Principal {
+		t.Errorf("Expected schedule to repay %v, got %v", l.Principal, principal)
+	}
+	if s[0].Interest != 1000 {
+		t.Errorf("Expected first interest 1000, got %v", s[0].Interest)
+	}
+	if s[11].Date != testDate(2015, 10, 1) {
+		t.Errorf("Expected last payment on 2015-10-01, got %v", s[11].Date)
+	}
+	if s[11].Balance != 0 {
+		t.Errorf("Expected final balance 0, got %v", s[11].Balance)
+	}
+	if l.Paid != 0 || l.Balance != l.Principal {
+		t.Errorf("Expected Schedule not to change the loan, got %+v", l)
+	}
+}
+
+func TestLoanPay_Scheduled(t *testing.T) {
+	l := newTestLoan()
+
+	p, err := l.Pay(0, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Number != 1 || p.Interest != 1000 || p.Principal != 7885 {
+		t.Errorf("Unexpected first payment %+v", p)
+	}
+	if l.Paid != 1 || l.Balance != 100000-7885 {
+		t.Errorf("Unexpected loan after payment %+v", l)
+	}
+}
+
+func TestLoanPay_ExtraShortensSchedule(t *testing.T) {
+	l := newTestLoan()
+
+	p, err := l.Pay(30000, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Number != 0 || p.Interest != 0 || p.Principal != 30000 {
+		t.Errorf("Unexpected extra payment %+v", p)
+	}
+	if s := l.Schedule(); len(s) >= 12 {
+		t.Errorf("Expected extra principal to shorten the schedule, got %v payments", len(s))
+	}
+}
+
+func TestLoanPay_TooMuch(t *testing.T) {
+	l := newTestLoan()
+
+	if _, err := l.Pay(l.Balance, true); err == nil {
+		t.Errorf("Expected overpayment to fail")
+	}
+	if l.Paid != 0 || l.Balance != l.Principal {
+		t.Errorf("Expected failed payment not to change the loan, got %+v", l)
+	}
+}
+
+func TestLoanPay_PaidOff(t *testing.T) {
+	l := newTestLoan()
+	if _, err := l.Pay(l.Balance, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := l.Pay(0, true); err == nil {
+		t.Errorf("Expected payment on paid off loan to fail")
+	}
+}
+
+func TestLoanPaymentSplits(t *testing.T) {
+	l := newTestLoan()
+	p, err := l.Pay(0, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	x := NewTransaction()
+	x.AddSplits(p.Splits(1, l.PaymentAccount, l.InterestAccount, "Payment", p.Date))
+	if err := x.ValidateAmount(); err != nil {
+		t.Errorf("Expected valid payment splits, got %v", err)
+	}
+
+	extra := &LoanPayment{Payment: 100, Principal: 100}
+	if splits := extra.Splits(1, 3, 2, "Extra", p.Date); len(splits) != 2 {
+		t.Errorf("Expected no interest split, got %v splits", len(splits))
+	}
+}
@@ -0,0 +1,61 @@
+package transaction
+
+import (
+	"sort"
+)
+
+// A NetWorth is the total of a user's Asset and Liability Accounts at the end
+// of Date. Liabilities is what's owed, so it's positive when the Liability
+// Accounts' balances are negative, and NetWorth is Assets less Liabilities.
+//
+// Accounts optionally breaks the totals down by Account, with each balance as
+// it's stored.
+type NetWorth struct {
+	Date        Date                 `json:"date"`
+	Assets      AmountType           `json:"assets"`
+	Liabilities AmountType           `json:"liabilities"`
+	NetWorth    AmountType           `json:"netWorth"`
+	Accounts    map[int64]AmountType `json:"accounts,omitempty"`
+}
+
+// NetWorthReport computes a NetWorth for each date in ends from splits, the
+// whole Split history of accounts. Splits for other Accounts, or in Accounts
+// that are neither Assets nor Liabilities, are ignored. If breakdown is set,
+// each NetWorth includes its Accounts' balances.
+func NetWorthReport(accounts map[int64]Account, splits []Split, ends []Date, breakdown bool) []NetWorth {
+	sorted := make([]Split, len(splits))
+	copy(sorted, splits)
+	sort.SliceStable(sorted, func(a, b int) bool {
+		return sorted[a].Date.Before(sorted[b].Date)
+	})
+
+	balances := make(map[int64]AmountType)
+	result := make([]NetWorth, len(ends))
+	next := 0
+	for i, end := range ends {
+		for ; next < len(sorted) && !sorted[next].Date.After(end); next++ {
+			balances[sorted[next].Account] += sorted[next].Amount
+		}
+
+		n := &result[i]
+		n.Date = end
+		if breakdown {
+			n.Accounts = make(map[int64]AmountType)
+		}
+		for account, balance := range balances {
+			switch accounts[account].Type {
+			case Asset:
+				n.Assets += balance
+			case Liability:
+				n.Liabilities -= balance
+			default:
+				continue
+			}
+			if breakdown {
+				n.Accounts[account] = balance
+			}
+		}
+		n.NetWorth = n.Assets - n.Liabilities
+	}
+	return result
+}
@@ -0,0 +1,36 @@
+package transaction
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNetWorthReport(t *testing.T) {
+	accounts := map[int64]Account{1: {Type: Asset}, 2: {Type: Liability}, 3: {Type: Expense}}
+	splits := []Split{
+		{Amount: 100000, Account: 1, Date: testDate(2014, 10, 1)},
+		{Amount: -40000, Account: 2, Date: testDate(2014, 11, 15)},
+		{Amount: 40000, Account: 3, Date: testDate(2014, 11, 15)},
+		{Amount: -10000, Account: 1, Date: testDate(2014, 12, 2)},
+		{Amount: 10000, Account: 2, Date: testDate(2014, 12, 2)},
+		{Amount: 5000, Account: 4, Date: testDate(2014, 12, 2)},
+	}
+	ends := []Date{testDate(2014, 9, 30), testDate(2014, 11, 30), testDate(2014, 12, 31)}
+
+	got := NetWorthReport(accounts, splits, ends, true)
+
+	expected := []NetWorth{
+		{Date: ends[0], Accounts: map[int64]AmountType{}},
+		{Date: ends[1], Assets: 100000, Liabilities: 40000, NetWorth: 60000,
+			Accounts: map[int64]AmountType{1: 100000, 2: -40000}},
+		{Date: ends[2], Assets: 90000, Liabilities: 30000, NetWorth: 60000,
+			Accounts: map[int64]AmountType{1: 90000, 2: -30000}},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, got)
+	}
+
+	if got := NetWorthReport(accounts, splits, ends[1:2], false); got[0].Accounts != nil || got[0].NetWorth != 60000 {
+		t.Errorf("Expected net worth 60000 without breakdown, got %+v", got)
+	}
+}
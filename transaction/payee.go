@@ -0,0 +1,88 @@
+package transaction
+
+import (
+	"errors"
+	"strings"
+)
+
+// A Payee is someone a user pays or is paid by, like a store. Transactions
+// for a Payee usually go to DefaultAccount with DefaultMemo, so they can be
+// filled in from the Payee.
+//
+// Aliases are other memos which name the Payee, like "TRADER JOE'S #123" for
+// "Trader Joe's". They're collected from the memos of the Payee's
+// transactions.
+type Payee struct {
+	Name           string   `json:"name"`
+	DefaultAccount int64    `json:"defaultAccount"`
+	DefaultMemo    string   `json:"defaultMemo"`
+	Aliases        []string `json:"aliases"`
+}
+
+// normalizePayeeName makes names which differ only in case or spacing equal.
+func normalizePayeeName(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// Make sure a Payee has a name. Useful if it was created with user-provided
+// data.
+func (p *Payee) Validate() error {
+	if normalizePayeeName(p.Name) == "" {
+		return errors.New("Payee has no name.")
+	}
+	return nil
+}
+
+// Matches is true if memo is p's name or one of its aliases, ignoring case
+// and spacing.
+func (p *Payee) Matches(memo string) bool {
+	memo = normalizePayeeName(memo)
+	if memo == "" {
+		return false
+	}
+	if memo == normalizePayeeName(p.Name) {
+		return true
+	}
+	for _, a := range p.Aliases {
+		if memo == normalizePayeeName(a) {
+			return true
+		}
+	}
+	return false
+}
+
+// AddAlias adds memo to p's aliases, unless p already matches it. It returns
+// whether p changed.
+func (p *Payee) AddAlias(memo string) bool {
+	if normalizePayeeName(memo) == "" || p.Matches(memo) {
+		return false
+	}
+	p.Aliases = append(p.Aliases, strings.TrimSpace(memo))
+	return true
+}
+
+// Merge folds other into p, for when two Payees turn out to be the same. p
+// gains other's name and aliases as aliases, and any defaults p doesn't have.
+func (p *Payee) Merge(other *Payee) {
+	p.AddAlias(other.Name)
+	for _, a := range other.Aliases {
+		p.AddAlias(a)
+	}
+	if p.DefaultAccount == 0 {
+		p.DefaultAccount = other.DefaultAccount
+	}
+	if p.DefaultMemo == "" {
+		p.DefaultMemo = other.DefaultMemo
+	}
+}
+
+// MatchPayee finds the first of payees which matches memo, and returns its
+// index, or -1 if there isn't one.
+func MatchPayee(payees []Payee, memo string) int {
+	for i := range payees {
+		if payees[i].Matches(memo) {
+			return i
+		}
+	}
+	return -1
+}
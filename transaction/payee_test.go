@@ -0,0 +1,77 @@
+package transaction
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPayeeValidate(t *testing.T) {
+	if err := (&Payee{Name: "Trader Joe's"}).Validate(); err != nil {
+		t.Errorf("Expected valid, got %v", err)
+	}
+	if err := (&Payee{Name: "  "}).Validate(); err == nil {
+		t.Error("Expected blank name to be invalid")
+	}
+}
+
+func TestPayeeMatches(t *testing.T) {
+	p := &Payee{Name: "Trader Joe's", Aliases: []string{"TRADER JOE'S #123"}}
+
+	for _, memo := range []string{"Trader Joe's", "trader  joe's ", "Trader Joe's #123"} {
+		if !p.Matches(memo) {
+			t.Errorf("Expected %q to match", memo)
+		}
+	}
+	for _, memo := range []string{"Trader", "", "Whole Foods"} {
+		if p.Matches(memo) {
+			t.Errorf("Expected %q not to match", memo)
+		}
+	}
+}
+
+func TestPayeeAddAlias(t *testing.T) {
+	p := &Payee{Name: "Trader Joe's"}
+
+	if !p.AddAlias(" TJ's #123 ") {
+		t.Error("Expected new alias to be added")
+	}
+	if p.AddAlias("tj's #123") || p.AddAlias("TRADER JOE'S") || p.AddAlias("") {
+		t.Error("Expected matching aliases not to be added")
+	}
+	if !reflect.DeepEqual(p.Aliases, []string{"TJ's #123"}) {
+		t.Errorf("Unexpected aliases %v", p.Aliases)
+	}
+}
+
+func TestPayeeMerge(t *testing.T) {
+	p := &Payee{Name: "Trader Joe's", DefaultMemo: "Groceries"}
+	other := &Payee{
+		Name:           "TJ's",
+		DefaultAccount: 3,
+		DefaultMemo:    "Food",
+		Aliases:        []string{"TRADER JOE'S", "TJ #123"},
+	}
+
+	p.Merge(other)
+
+	expected := &Payee{
+		Name:           "Trader Joe's",
+		DefaultAccount: 3,
+		DefaultMemo:    "Groceries",
+		Aliases:        []string{"TJ's", "TJ #123"},
+	}
+	if !reflect.DeepEqual(p, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, p)
+	}
+}
+
+func TestMatchPayee(t *testing.T) {
+	payees := []Payee{{Name: "Whole Foods"}, {Name: "Trader Joe's", Aliases: []string{"TJ's"}}}
+
+	if i := MatchPayee(payees, "tj's"); i != 1 {
+		t.Errorf("Expected match 1, got %v", i)
+	}
+	if i := MatchPayee(payees, "Safeway"); i != -1 {
+		t.Errorf("Expected no match, got %v", i)
+	}
+}
@@ -0,0 +1,192 @@
+package transaction
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// A Period is the length of each step of a report over a date range, and of
+// the ranges a Calendar resolves.
+type Period string
+
+const (
+	Day     Period = "day"
+	Week    Period = "week"
+	Month   Period = "month"
+	Quarter Period = "quarter"
+	Year    Period = "year"
+)
+
+// Make sure a Period is known. Useful if it was provided by a user.
+func (p Period) Validate() error {
+	switch p {
+	case Day, Week, Month, Quarter, Year:
+		return nil
+	}
+	return fmt.Errorf("Unknown period %q", p)
+}
+
+// A Calendar says where Periods start. Quarters and Years are fiscal, and
+// start in FiscalYearStart, and Weeks start on WeekStart. Get one from
+// Settings.Calendar, rather than the zero value, which has Sunday weeks.
+type Calendar struct {
+	FiscalYearStart time.Month
+	WeekStart       time.Weekday
+}
+
+// monthEnd is the last day of the month containing date.
+func monthEnd(date Date) Date {
+	return Date{date.Year, date.Month, 1}.AddDate(0, 1, -1)
+}
+
+// fiscalMonth is how many months into the fiscal year m is, from 0 to 11.
+func (c Calendar) fiscalMonth(m time.Month) int {
+	start := c.FiscalYearStart
+	if start == 0 {
+		start = time.January
+	}
+	return (int(m) - int(start) + 12) % 12
+}
+
+// Start is the first day of the Period containing date.
+func (c Calendar) Start(p Period, date Date) Date {
+	switch p {
+	case Week:
+		return date.AddDate(0, 0, -(int(date.Weekday())-int(c.WeekStart)+7)%7)
+	case Month:
+		return Date{date.Year, date.Month, 1}
+	case Quarter:
+		return Date{date.Year, date.Month, 1}.AddDate(0, -(c.fiscalMonth(date.Month) % 3), 0)
+	case Year:
+		return Date{date.Year, date.Month, 1}.AddDate(0, -c.fiscalMonth(date.Month), 0)
+	}
+	return date
+}
+
+// End is the last day of the Period containing date.
+func (c Calendar) End(p Period, date Date) Date {
+	switch p {
+	case Week:
+		return date.AddDate(0, 0, (int(c.WeekStart)-int(date.Weekday())+6)%7)
+	case Month:
+		return monthEnd(date)
+	case Quarter:
+		return monthEnd(Date{date.Year, date.Month, 1}.AddDate(0, 2-c.fiscalMonth(date.Month)%3, 0))
+	case Year:
+		return monthEnd(Date{date.Year, date.Month, 1}.AddDate(0, 11-c.fiscalMonth(date.Month), 0))
+	}
+	return date
+}
+
+// PeriodEnds is the last day of each Period from from through to. The last
+// Period is cut off at to, so reports over a range that ends mid-Period still
+// cover it.
+func (c Calendar) PeriodEnds(p Period, from, to Date) []Date {
+	result := make([]Date, 0)
+	for date := from; !date.After(to); {
+		end := c.End(p, date)
+		if end.After(to) {
+			end = to
+		}
+		result = append(result, end)
+		date = end.AddDate(0, 0, 1)
+	}
+	return result
+}
+
+// PeriodRanges is each Period from from through to, as DateRanges. The first
+// and last are cut off at from and to.
+func (c Calendar) PeriodRanges(p Period, from, to Date) []DateRange {
+	ends := c.PeriodEnds(p, from, to)
+	result := make([]DateRange, len(ends))
+	for i, end := range ends {
+		result[i] = DateRange{from, end}
+		from = end.AddDate(0, 0, 1)
+	}
+	return result
+}
+
+// resolvablePeriods are the Periods Calendar.Resolve understands, by name.
+// Years are calendar years, and fiscal-years are fiscal.
+var resolvablePeriods = map[string]Period{
+	"week":        Week,
+	"month":       Month,
+	"quarter":     Quarter,
+	"year":        Year,
+	"fiscal-year": Year,
+}
+
+// Resolve finds the DateRange a user means by name, relative to today. It's
+// "this-" or "last-" followed by "week", "month", "quarter", "year" or
+// "fiscal-year", or "ytd" or "fiscal-ytd" for the year through today.
+// Quarters are quarters of the fiscal year.
+func (c Calendar) Resolve(name string, today Date) (DateRange, error) {
+	calendarYears := Calendar{FiscalYearStart: time.January, WeekStart: c.WeekStart}
+	switch name {
+	case "ytd":
+		return DateRange{calendarYears.Start(Year, today), today}, nil
+	case "fiscal-ytd":
+		return DateRange{c.Start(Year, today), today}, nil
+	}
+
+	parts := strings.SplitN(name, "-", 2)
+	if len(parts) != 2 {
+		return DateRange{}, fmt.Errorf("Unknown date range %q", name)
+	}
+	p, ok := resolvablePeriods[parts[1]]
+	if !ok {
+		return DateRange{}, fmt.Errorf("Unknown date range %q", name)
+	}
+	if parts[1] == "year" {
+		c = calendarYears
+	}
+
+	switch parts[0] {
+	case "this":
+		return DateRange{c.Start(p, today), c.End(p, today)}, nil
+	case "last":
+		end := c.Start(p, today).AddDate(0, 0, -1)
+		return DateRange{c.Start(p, end), end}, nil
+	}
+	return DateRange{}, fmt.Errorf("Unknown date range %q", name)
+}
+
+// A DateRange is the days from From through To, inclusive.
+type DateRange struct {
+	From Date `json:"from"`
+	To   Date `json:"to"`
+}
+
+// Contains is true if date is in r.
+func (r DateRange) Contains(date Date) bool {
+	return !date.Before(r.From) && !date.After(r.To)
+}
+
+// months is the number of calendar months r spans, if it's whole months.
+func (r DateRange) months() (int, bool) {
+	if r.From.Day != 1 || monthEnd(r.To) != r.To {
+		return 0, false
+	}
+	return 12*(r.To.Year-r.From.Year) + int(r.To.Month-r.From.Month) + 1, true
+}
+
+// Previous is the range of the same length that ends the day before r starts.
+// If r is whole months, so is Previous.
+func (r DateRange) Previous() DateRange {
+	to := r.From.AddDate(0, 0, -1)
+	if n, ok := r.months(); ok {
+		return DateRange{r.From.AddDate(0, -n, 0), to}
+	}
+	days := r.To.DaysSince(r.From) + 1
+	return DateRange{r.From.AddDate(0, 0, -days), to}
+}
+
+// LastYear is r a year earlier. If r is whole months, so is LastYear, so
+// February ends on the 28th or 29th as it should.
+func (r DateRange) LastYear() DateRange {
+	if _, ok := r.months(); ok {
+		return DateRange{r.From.AddDate(-1, 0, 0), monthEnd(Date{r.To.Year - 1, r.To.Month, 1})}
+	}
+	return DateRange{r.From.AddDate(-1, 0, 0), r.To.AddDate(-1, 0, 0)}
+}
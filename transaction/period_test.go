@@ -0,0 +1,163 @@
+package transaction
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPeriodValidate(t *testing.T) {
+	for _, p := range []Period{Day, Week, Month, Quarter, Year} {
+		if err := p.Validate(); err != nil {
+			t.Errorf("Expected %v to be valid, got %v", p, err)
+		}
+	}
+	if err := Period("fortnight").Validate(); err == nil {
+		t.Error("Expected unknown period to be invalid")
+	}
+}
+
+var mondayWeeks = Calendar{FiscalYearStart: time.January, WeekStart: time.Monday}
+
+func TestPeriodEnds(t *testing.T) {
+	for _, tc := range []struct {
+		p        Period
+		from, to Date
+		expected []Date
+	}{
+		{Day, testDate(2014, 11, 5), testDate(2014, 11, 7),
+			[]Date{testDate(2014, 11, 5), testDate(2014, 11, 6), testDate(2014, 11, 7)}},
+		// 2014-11-05 is a Wednesday.
+		{Week, testDate(2014, 11, 5), testDate(2014, 11, 18),
+			[]Date{testDate(2014, 11, 9), testDate(2014, 11, 16), testDate(2014, 11, 18)}},
+		{Week, testDate(2014, 11, 9), testDate(2014, 11, 9), []Date{testDate(2014, 11, 9)}},
+		{Month, testDate(2014, 11, 15), testDate(2015, 2, 28),
+			[]Date{testDate(2014, 11, 30), testDate(2014, 12, 31), testDate(2015, 1, 31), testDate(2015, 2, 28)}},
+		{Month, testDate(2014, 11, 15), testDate(2014, 11, 1), []Date{}},
+	} {
+		if got := mondayWeeks.PeriodEnds(tc.p, tc.from, tc.to); !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("%v from %v to %v: expected %v, got %v", tc.p, tc.from, tc.to, tc.expected, got)
+		}
+	}
+}
+
+func TestCalendarStartEnd(t *testing.T) {
+	july := Calendar{FiscalYearStart: time.July, WeekStart: time.Sunday}
+	for _, tc := range []struct {
+		cal        Calendar
+		p          Period
+		date       Date
+		start, end Date
+	}{
+		// 2014-11-05 is a Wednesday.
+		{mondayWeeks, Week, testDate(2014, 11, 5), testDate(2014, 11, 3), testDate(2014, 11, 9)},
+		{july, Week, testDate(2014, 11, 5), testDate(2014, 11, 2), testDate(2014, 11, 8)},
+		{july, Week, testDate(2014, 11, 2), testDate(2014, 11, 2), testDate(2014, 11, 8)},
+		{july, Week, testDate(2014, 11, 8), testDate(2014, 11, 2), testDate(2014, 11, 8)},
+		{mondayWeeks, Quarter, testDate(2014, 11, 5), testDate(2014, 10, 1), testDate(2014, 12, 31)},
+		{july, Quarter, testDate(2014, 11, 5), testDate(2014, 10, 1), testDate(2014, 12, 31)},
+		{Calendar{FiscalYearStart: time.February}, Quarter, testDate(2015, 1, 5), testDate(2014, 11, 1), testDate(2015, 1, 31)},
+		{mondayWeeks, Year, testDate(2014, 11, 5), testDate(2014, 1, 1), testDate(2014, 12, 31)},
+		{july, Year, testDate(2014, 11, 5), testDate(2014, 7, 1), testDate(2015, 6, 30)},
+		{july, Year, testDate(2014, 6, 30), testDate(2013, 7, 1), testDate(2014, 6, 30)},
+	} {
+		if got := tc.cal.Start(tc.p, tc.date); got != tc.start {
+			t.Errorf("%+v %v containing %v: expected start %v, got %v", tc.cal, tc.p, tc.date, tc.start, got)
+		}
+		if got := tc.cal.End(tc.p, tc.date); got != tc.end {
+			t.Errorf("%+v %v containing %v: expected end %v, got %v", tc.cal, tc.p, tc.date, tc.end, got)
+		}
+	}
+}
+
+func TestCalendarResolve(t *testing.T) {
+	july := Calendar{FiscalYearStart: time.July, WeekStart: time.Sunday}
+	today := testDate(2014, 11, 5)
+	for _, tc := range []struct {
+		cal      Calendar
+		name     string
+		expected DateRange
+	}{
+		{mondayWeeks, "this-week", DateRange{testDate(2014, 11, 3), testDate(2014, 11, 9)}},
+		{july, "last-week", DateRange{testDate(2014, 10, 26), testDate(2014, 11, 1)}},
+		{july, "this-month", DateRange{testDate(2014, 11, 1), testDate(2014, 11, 30)}},
+		{july, "last-month", DateRange{testDate(2014, 10, 1), testDate(2014, 10, 31)}},
+		{july, "last-quarter", DateRange{testDate(2014, 7, 1), testDate(2014, 9, 30)}},
+		{july, "this-year", DateRange{testDate(2014, 1, 1), testDate(2014, 12, 31)}},
+		{july, "last-year", DateRange{testDate(2013, 1, 1), testDate(2013, 12, 31)}},
+		{july, "this-fiscal-year", DateRange{testDate(2014, 7, 1), testDate(2015, 6, 30)}},
+		{july, "last-fiscal-year", DateRange{testDate(2013, 7, 1), testDate(2014, 6, 30)}},
+		{july, "ytd", DateRange{testDate(2014, 1, 1), today}},
+		{july, "fiscal-ytd", DateRange{testDate(2014, 7, 1), today}},
+		{mondayWeeks, "fiscal-ytd", DateRange{testDate(2014, 1, 1), today}},
+	} {
+		got, err := tc.cal.Resolve(tc.name, today)
+		if err != nil {
+			t.Errorf("Resolving %v: %v", tc.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("Resolving %v with %+v: expected %v, got %v", tc.name, tc.cal, tc.expected, got)
+		}
+	}
+
+	for _, name := range []string{"", "month", "next-month", "this-day", "this-fortnight"} {
+		if _, err := july.Resolve(name, today); err == nil {
+			t.Errorf("Expected %q not to resolve", name)
+		}
+	}
+}
+
+func TestDateRangePrevious(t *testing.T) {
+	for _, tc := range []struct {
+		r, expected DateRange
+	}{
+		{DateRange{testDate(2014, 11, 1), testDate(2014, 11, 30)}, DateRange{testDate(2014, 10, 1), testDate(2014, 10, 31)}},
+		{DateRange{testDate(2014, 1, 1), testDate(2014, 3, 31)}, DateRange{testDate(2013, 10, 1), testDate(2013, 12, 31)}},
+		{DateRange{testDate(2014, 11, 5), testDate(2014, 11, 11)}, DateRange{testDate(2014, 10, 29), testDate(2014, 11, 4)}},
+	} {
+		if got := tc.r.Previous(); !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("Previous of %v: expected %v, got %v", tc.r, tc.expected, got)
+		}
+	}
+}
+
+func TestDateRangeLastYear(t *testing.T) {
+	for _, tc := range []struct {
+		r, expected DateRange
+	}{
+		{DateRange{testDate(2016, 2, 1), testDate(2016, 2, 29)}, DateRange{testDate(2015, 2, 1), testDate(2015, 2, 28)}},
+		{DateRange{testDate(2014, 11, 5), testDate(2014, 11, 11)}, DateRange{testDate(2013, 11, 5), testDate(2013, 11, 11)}},
+	} {
+		if got := tc.r.LastYear(); !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("LastYear of %v: expected %v, got %v", tc.r, tc.expected, got)
+		}
+	}
+}
+
+func TestDateRangeContains(t *testing.T) {
+	r := DateRange{testDate(2014, 11, 1), testDate(2014, 11, 30)}
+	for date, expected := range map[Date]bool{
+		testDate(2014, 10, 31): false,
+		testDate(2014, 11, 1):  true,
+		testDate(2014, 11, 30): true,
+		testDate(2014, 12, 1):  false,
+	} {
+		if got := r.Contains(date); got != expected {
+			t.Errorf("Expected Contains(%v) %v, got %v", date, expected, got)
+		}
+	}
+}
+
+func TestPeriodRanges(t *testing.T) {
+	got := mondayWeeks.PeriodRanges(Month, testDate(2014, 11, 15), testDate(2015, 1, 10))
+
+	expected := []DateRange{
+		{testDate(2014, 11, 15), testDate(2014, 11, 30)},
+		{testDate(2014, 12, 1), testDate(2014, 12, 31)},
+		{testDate(2015, 1, 1), testDate(2015, 1, 10)},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
@@ -0,0 +1,128 @@
+package transaction
+
+import (
+	"encoding/csv"
+	"io"
+	"math"
+	"sort"
+)
+
+// A PivotRow is one Expense Account's spending in each column of a
+// SpendingPivot. Average is the mean of Amounts, and Changes holds the
+// percentage change of each column from the one before it, so it's one
+// shorter than Amounts. A change from nothing is nil, since it's undefined.
+type PivotRow struct {
+	Account int64        `json:"account"`
+	Name    string       `json:"name"`
+	Amounts []AmountType `json:"amounts"`
+	Total   AmountType   `json:"total"`
+	Average AmountType   `json:"average"`
+	Changes []*float64   `json:"changes"`
+}
+
+// A SpendingPivot is a matrix of spending in Expense Accounts, with a row for
+// each Account and a column for each of Columns, usually months. Totals is
+// the total of each column.
+type SpendingPivot struct {
+	Columns []DateRange  `json:"columns"`
+	Rows    []PivotRow   `json:"rows"`
+	Totals  []AmountType `json:"totals"`
+	Total   AmountType   `json:"total"`
+	Average AmountType   `json:"average"`
+}
+
+// hasAnyTag is true if s is tagged with any of tags.
+func hasAnyTag(s *Split, tags []string) bool {
+	for _, t := range s.Tags {
+		for _, want := range tags {
+			if t == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// average is the mean of total over n, rounded to the nearest unit.
+func average(total AmountType, n int) AmountType {
+	if n == 0 {
+		return 0
+	}
+	return AmountType(math.Floor(float64(total)/float64(n) + 0.5))
+}
+
+// percentChange is the percentage change from before to after, or nil if
+// before is zero.
+func percentChange(before, after AmountType) *float64 {
+	if before == 0 {
+		return nil
+	}
+	change := 100 * float64(after-before) / math.Abs(float64(before))
+	return &change
+}
+
+// NewSpendingPivot builds a SpendingPivot over columns from splits in the
+// Expense Accounts of accounts. If tags isn't empty, only Splits tagged with
+// at least one of them are included. Accounts with no spending in any column
+// are left out, and the rest are in Name order.
+func NewSpendingPivot(accounts map[int64]Account, splits []Split, columns []DateRange, tags []string) *SpendingPivot {
+	amounts := make(map[int64][]AmountType)
+	for i := range splits {
+		s := &splits[i]
+		if accounts[s.Account].Type != Expense || (len(tags) > 0 && !hasAnyTag(s, tags)) {
+			continue
+		}
+		for c, r := range columns {
+			if r.Contains(s.Date) {
+				if amounts[s.Account] == nil {
+					amounts[s.Account] = make([]AmountType, len(columns))
+				}
+				amounts[s.Account][c] += s.Amount
+			}
+		}
+	}
+
+	result := &SpendingPivot{Columns: columns, Rows: make([]PivotRow, 0), Totals: make([]AmountType, len(columns))}
+	for account, a := range amounts {
+		row := PivotRow{Account: account, Name: accounts[account].Name, Amounts: a, Changes: make([]*float64, 0)}
+		for c := range a {
+			row.Total += a[c]
+			result.Totals[c] += a[c]
+			if c > 0 {
+				row.Changes = append(row.Changes, percentChange(a[c-1], a[c]))
+			}
+		}
+		if row.Total == 0 {
+			continue
+		}
+		row.Average = average(row.Total, len(columns))
+		result.Rows = append(result.Rows, row)
+		result.Total += row.Total
+	}
+	sort.Slice(result.Rows, func(i, j int) bool {
+		return result.Rows[i].Name < result.Rows[j].Name
+	})
+	result.Average = average(result.Total, len(columns))
+	return result
+}
+
+// WriteCSV writes p to w as CSV, with a row for each Account and a column for
+// each of p.Columns, followed by the Total and Average columns and a row of
+// column totals. Percentage changes are left out, since they're easy to
+// compute from the amounts in a spreadsheet.
+func (p *SpendingPivot) WriteCSV(w io.Writer) error {
+	c := csv.NewWriter(w)
+	if err := c.Write(append(csvHeader("Account", p.Columns), "Total", "Average")); err != nil {
+		return err
+	}
+	for _, row := range p.Rows {
+		if err := c.Write(csvRow(row.Name, append(append([]AmountType{}, row.Amounts...), row.Total, row.Average))); err != nil {
+			return err
+		}
+	}
+	if err := c.Write(csvRow("Total", append(append([]AmountType{}, p.Totals...), p.Total, p.Average))); err != nil {
+		return err
+	}
+	c.Flush()
+	return c.Error()
+}
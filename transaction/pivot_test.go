@@ -0,0 +1,70 @@
+package transaction
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestNewSpendingPivot(t *testing.T) {
+	accounts := map[int64]Account{
+		1: {Name: "Checking", Type: Asset},
+		2: {Name: "Rent", Type: Expense},
+		3: {Name: "Groceries", Type: Expense},
+		4: {Name: "Travel", Type: Expense},
+	}
+	splits := []Split{
+		{Amount: 100000, Account: 2, Date: testDate(2014, 10, 1)},
+		{Amount: 100000, Account: 2, Date: testDate(2014, 11, 1)},
+		{Amount: 110000, Account: 2, Date: testDate(2014, 12, 1)},
+		{Amount: 20000, Account: 3, Date: testDate(2014, 11, 3), Tags: []string{"food"}},
+		{Amount: 30000, Account: 3, Date: testDate(2014, 12, 3), Tags: []string{"food", "holiday"}},
+		{Amount: -1000, Account: 3, Date: testDate(2014, 12, 4), Tags: []string{"food"}},
+		{Amount: -240000, Account: 1, Date: testDate(2014, 12, 4)},
+		{Amount: 5000, Account: 4, Date: testDate(2015, 1, 4)},
+	}
+	columns := Calendar{}.PeriodRanges(Month, testDate(2014, 11, 1), testDate(2014, 12, 31))
+
+	got := NewSpendingPivot(accounts, splits, columns, nil)
+
+	if len(got.Rows) != 2 || got.Rows[0].Name != "Groceries" || got.Rows[1].Name != "Rent" {
+		t.Fatalf("Expected Groceries and Rent rows, got %+v", got.Rows)
+	}
+	groceries, rent := got.Rows[0], got.Rows[1]
+	if groceries.Total != 49000 || groceries.Average != 24500 || *groceries.Changes[0] != 45 {
+		t.Errorf("Unexpected groceries row %+v", groceries)
+	}
+	if rent.Amounts[0] != 100000 || rent.Amounts[1] != 110000 || *rent.Changes[0] != 10 {
+		t.Errorf("Unexpected rent row %+v", rent)
+	}
+	if got.Totals[0] != 120000 || got.Totals[1] != 139000 || got.Total != 259000 || got.Average != 129500 {
+		t.Errorf("Unexpected totals %+v", got)
+	}
+
+	tagged := NewSpendingPivot(accounts, splits, columns, []string{"holiday"})
+	if len(tagged.Rows) != 1 || tagged.Total != 30000 || tagged.Rows[0].Changes[0] != nil {
+		t.Errorf("Expected only holiday groceries, got %+v", tagged.Rows)
+	}
+}
+
+func TestSpendingPivotWriteCSV(t *testing.T) {
+	p := &SpendingPivot{
+		Columns: Calendar{}.PeriodRanges(Month, testDate(2014, 11, 1), testDate(2014, 12, 31)),
+		Rows:    []PivotRow{{Account: 2, Name: "Rent", Amounts: []AmountType{100, 110}, Total: 210, Average: 105}},
+		Totals:  []AmountType{100, 110},
+		Total:   210,
+		Average: 105,
+	}
+
+	var b bytes.Buffer
+	if err := p.WriteCSV(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `Account,2014-11-01 to 2014-11-30,2014-12-01 to 2014-12-31,Total,Average
+Rent,100,110,210,105
+Total,100,110,210,105
+`
+	if b.String() != expected {
+		t.Errorf("Expected CSV\n%v\ngot\n%v", expected, b.String())
+	}
+}
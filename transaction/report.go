@@ -0,0 +1,124 @@
+package transaction
+
+import (
+	"encoding/csv"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// A ReportLine is one Account's row in a report grouped by the Account
+// hierarchy. Depth is how far the Account is nested under its Parents, and
+// Amounts, one per report column, include all of its sub-Accounts.
+type ReportLine struct {
+	Account int64        `json:"account"`
+	Name    string       `json:"name"`
+	Depth   int          `json:"depth"`
+	Amounts []AmountType `json:"amounts"`
+}
+
+// reportParent is a's Parent if it can group a in a report: only if the
+// Parent is known and of the same Type.
+func reportParent(accounts map[int64]Account, a Account) int64 {
+	if p, ok := accounts[a.Parent]; ok && p.Type == a.Type {
+		return a.Parent
+	}
+	return 0
+}
+
+// hierarchyLines groups the Accounts of type t by hierarchy, depth first,
+// with siblings in Name order. own holds each Account's amounts without its
+// sub-Accounts, and every amount is multiplied by sign. A line is left out
+// unless it or one of its sub-Accounts has a nonzero amount of its own, so a
+// parent whose children offset each other is still shown with them. It
+// returns the lines and the sum of the top-level lines, both with columns
+// amounts.
+func hierarchyLines(accounts map[int64]Account, t AccountType, own map[int64][]AmountType, columns int, sign AmountType) ([]ReportLine, []AmountType) {
+	children := make(map[int64][]int64)
+	totals := make(map[int64][]AmountType)
+	active := make(map[int64]bool)
+	for id, a := range accounts {
+		if a.Type != t {
+			continue
+		}
+		parent := reportParent(accounts, a)
+		children[parent] = append(children[parent], id)
+		nonzero := false
+		for _, amount := range own[id] {
+			nonzero = nonzero || amount != 0
+		}
+
+		// Add the Account's own amounts to it and each of its ancestors. Parents
+		// are checked on creation, but stop after visiting every Account in case
+		// of a loop.
+		for n, at := 0, id; at != 0 && n <= len(accounts); n, at = n+1, reportParent(accounts, accounts[at]) {
+			if totals[at] == nil {
+				totals[at] = make([]AmountType, columns)
+			}
+			for i, amount := range own[id] {
+				totals[at][i] += sign * amount
+			}
+			active[at] = active[at] || nonzero
+		}
+	}
+
+	lines := make([]ReportLine, 0)
+	var visit func(parent int64, depth int)
+	visit = func(parent int64, depth int) {
+		ids := children[parent]
+		sort.Slice(ids, func(i, j int) bool {
+			return accounts[ids[i]].Name < accounts[ids[j]].Name
+		})
+		for _, id := range ids {
+			if !active[id] {
+				continue
+			}
+			lines = append(lines, ReportLine{id, accounts[id].Name, depth, totals[id]})
+			if depth < len(accounts) {
+				visit(id, depth+1)
+			}
+		}
+	}
+	visit(0, 0)
+
+	sum := make([]AmountType, columns)
+	for _, id := range children[0] {
+		for i, amount := range totals[id] {
+			sum[i] += amount
+		}
+	}
+	return lines, sum
+}
+
+// csvRow formats a report row with a label and amounts.
+func csvRow(label string, amounts []AmountType) []string {
+	row := []string{label}
+	for _, amount := range amounts {
+		row = append(row, fmt.Sprint(amount))
+	}
+	return row
+}
+
+// writeCSVSection writes a titled section of report lines to w, with each
+// Account name indented by its depth, followed by its total.
+func writeCSVSection(w *csv.Writer, title string, lines []ReportLine, total []AmountType) error {
+	if err := w.Write([]string{title}); err != nil {
+		return err
+	}
+	for _, l := range lines {
+		if err := w.Write(csvRow(strings.Repeat("  ", l.Depth+1)+l.Name, l.Amounts)); err != nil {
+			return err
+		}
+	}
+	return w.Write(csvRow("Total "+strings.ToLower(title), total))
+}
+
+// csvHeader is the header row for a report with columns, which are labeled
+// by their date ranges.
+func csvHeader(first string, columns []DateRange) []string {
+	row := []string{first}
+	for _, r := range columns {
+		row = append(row, r.From.String()+" to "+r.To.String())
+	}
+	return row
+}
@@ -0,0 +1,33 @@
+package transaction
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHierarchyLines_OffsettingChildren(t *testing.T) {
+	accounts := map[int64]Account{
+		1: {Name: "Food", Type: Expense},
+		2: {Name: "Groceries", Type: Expense, Parent: 1},
+		3: {Name: "Refunds", Type: Expense, Parent: 1},
+		4: {Name: "Rent", Type: Expense},
+		5: {Name: "Salary", Type: Income},
+	}
+	own := map[int64][]AmountType{2: {100}, 3: {-100}, 4: {0}, 5: {-500}}
+
+	lines, sum := hierarchyLines(accounts, Expense, own, 1, 1)
+
+	// Food nets to zero, but its children don't, so all three are shown. Rent
+	// has nothing of its own, so it isn't.
+	expected := []ReportLine{
+		{1, "Food", 0, []AmountType{0}},
+		{2, "Groceries", 1, []AmountType{100}},
+		{3, "Refunds", 1, []AmountType{-100}},
+	}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, lines)
+	}
+	if !reflect.DeepEqual(sum, []AmountType{0}) {
+		t.Errorf("Expected sum 0, got %v", sum)
+	}
+}
@@ -0,0 +1,126 @@
+package transaction
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// A Rule categorizes Splits automatically. If a Split matches all of a Rule's
+// conditions, its transaction's counter-split goes to CounterAccount, and it
+// gets Tags and Payee.
+//
+// The conditions are:
+//   - Memo, a regular expression matched case insensitively against the memo.
+//   - MinAmount and MaxAmount, an inclusive range for the amount. If both are
+//     0, any amount matches.
+//   - Account, the account id of the Split.
+//
+// Empty conditions match any Split, and empty actions change nothing. Rules
+// are applied in order of increasing Priority.
+type Rule struct {
+	Name      string     `json:"name"`
+	Priority  int64      `json:"priority"`
+	Memo      string     `json:"memo"`
+	MinAmount AmountType `json:"minAmount"`
+	MaxAmount AmountType `json:"maxAmount"`
+	Account   int64      `json:"account"`
+
+	CounterAccount int64    `json:"counterAccount"`
+	Tags           []string `json:"tags"`
+	Payee          int64    `json:"payee"`
+
+	memo *regexp.Regexp
+}
+
+// A RuleResult is what applying Rules to a Split changes. Zero fields are left
+// alone.
+type RuleResult struct {
+	CounterAccount int64    `json:"counterAccount,omitempty"`
+	Tags           []string `json:"tags,omitempty"`
+	Payee          int64    `json:"payee,omitempty"`
+}
+
+// Make sure a Rule has a usable pattern, amount range, and at least one action.
+// Useful if it was created with user-provided data.
+func (r *Rule) Validate() error {
+	if r.Name == "" {
+		return errors.New("Rule has no name.")
+	}
+	if _, err := regexp.Compile("(?i)" + r.Memo); err != nil {
+		return fmt.Errorf("Rule memo pattern is invalid: %v", err)
+	}
+	if r.MinAmount > r.MaxAmount {
+		return errors.New("Rule amount range is empty.")
+	}
+	if r.CounterAccount == 0 && len(r.Tags) == 0 && r.Payee == 0 {
+		return errors.New("Rule doesn't do anything.")
+	}
+	return nil
+}
+
+// Matches is true if s meets all of r's conditions. r must be valid.
+func (r *Rule) Matches(s *Split) bool {
+	if r.Account != 0 && s.Account != r.Account {
+		return false
+	}
+	if (r.MinAmount != 0 || r.MaxAmount != 0) && (s.Amount < r.MinAmount || s.Amount > r.MaxAmount) {
+		return false
+	}
+	if r.memo == nil {
+		r.memo = regexp.MustCompile("(?i)" + r.Memo)
+	}
+	return r.memo.MatchString(s.Memo)
+}
+
+// SortRules puts rules in the order they're applied: by Priority, then by
+// Name.
+func SortRules(rules []Rule) {
+	sort.SliceStable(rules, func(i, j int) bool {
+		if rules[i].Priority != rules[j].Priority {
+			return rules[i].Priority < rules[j].Priority
+		}
+		return rules[i].Name < rules[j].Name
+	})
+}
+
+// ApplyRules applies rules, which must be sorted, to s. For CounterAccount and
+// Payee, the first matching Rule that sets them wins. Tags are collected from
+// every matching Rule. It returns nil if no Rule matches.
+func ApplyRules(rules []Rule, s *Split) *RuleResult {
+	var result *RuleResult
+	for i := range rules {
+		if !rules[i].Matches(s) {
+			continue
+		}
+		if result == nil {
+			result = &RuleResult{}
+		}
+		if result.CounterAccount == 0 {
+			result.CounterAccount = rules[i].CounterAccount
+		}
+		if result.Payee == 0 {
+			result.Payee = rules[i].Payee
+		}
+		result.Tags = MergeTags(result.Tags, rules[i].Tags)
+	}
+	return result
+}
+
+// MergeTags adds the tags in add to tags, skipping any it already has.
+func MergeTags(tags, add []string) []string {
+	for _, a := range add {
+		found := false
+		for _, t := range tags {
+			if t == a {
+				found = true
+				break
+			}
+		}
+		if !found {
+			tags = append(tags, a)
+		}
+	}
+	return tags
+}
@@ -0,0 +1,75 @@
+package transaction
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRuleValidate(t *testing.T) {
+	valid := Rule{Name: "Groceries", Memo: "trader joe", CounterAccount: 2}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Expected valid, got %v", err)
+	}
+
+	for _, change := range []func(r *Rule){
+		func(r *Rule) { r.Name = "" },
+		func(r *Rule) { r.Memo = "(" },
+		func(r *Rule) { r.MinAmount, r.MaxAmount = 10, -10 },
+		func(r *Rule) { r.CounterAccount = 0 },
+	} {
+		r := valid
+		change(&r)
+		if err := r.Validate(); err == nil {
+			t.Errorf("Expected rule %+v to be invalid", r)
+		}
+	}
+}
+
+func TestRuleMatches(t *testing.T) {
+	r := &Rule{Memo: "^trader joe", MinAmount: -10000, MaxAmount: -1, Account: 1}
+
+	if !r.Matches(&Split{Amount: -500, Account: 1, Memo: "TRADER JOE'S #123"}) {
+		t.Error("Expected split to match")
+	}
+	for _, s := range []*Split{
+		{Amount: -500, Account: 2, Memo: "Trader Joe's"},
+		{Amount: 500, Account: 1, Memo: "Trader Joe's"},
+		{Amount: -500, Account: 1, Memo: "Not Trader Joe's"},
+	} {
+		if r.Matches(s) {
+			t.Errorf("Expected split %+v not to match", s)
+		}
+	}
+
+	if !(&Rule{}).Matches(&Split{Amount: 123, Account: 5}) {
+		t.Error("Expected empty conditions to match anything")
+	}
+}
+
+func TestSortRules(t *testing.T) {
+	rules := []Rule{{Name: "c", Priority: 2}, {Name: "b", Priority: 1}, {Name: "a", Priority: 2}}
+	SortRules(rules)
+
+	got := []string{rules[0].Name, rules[1].Name, rules[2].Name}
+	if !reflect.DeepEqual(got, []string{"b", "a", "c"}) {
+		t.Errorf("Unexpected order %v", got)
+	}
+}
+
+func TestApplyRules(t *testing.T) {
+	rules := []Rule{
+		{Name: "tj", Memo: "trader joe", Tags: []string{"food"}, Payee: 7},
+		{Name: "small", MaxAmount: 0, MinAmount: -1000, CounterAccount: 3, Tags: []string{"food", "small"}},
+		{Name: "any", CounterAccount: 4, Payee: 8},
+	}
+
+	got := ApplyRules(rules, &Split{Amount: -500, Memo: "Trader Joe's"})
+	expected := &RuleResult{CounterAccount: 3, Tags: []string{"food", "small"}, Payee: 7}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, got)
+	}
+
+	if got := ApplyRules(rules[:1], &Split{Memo: "Safeway"}); got != nil {
+		t.Errorf("Expected no match, got %+v", got)
+	}
+}
@@ -0,0 +1,27 @@
+package transaction
+
+// Schema versions of stored Accounts and Splits. Entities saved before they
+// were versioned are version 0. Bump a version whenever the way its entity is
+// stored changes, along with a migration that upgrades the previous version.
+const (
+	AccountSchemaVersion = 1
+	SplitSchemaVersion   = 1
+)
+
+// unknownProperties are what Load didn't know of a stored entity, like the
+// properties of a newer schema version saved before a rollback. Save writes
+// them back unchanged, with version if it's newer than the current schema's,
+// so the newer code finds the entity as it left it. Each of props mirrors a
+// datastore.Property, which only exists on App Engine.
+type unknownProperties struct {
+	version int64
+	props   []unknownProperty
+}
+
+// An unknownProperty is one of unknownProperties.
+type unknownProperty struct {
+	name     string
+	value    interface{}
+	noIndex  bool
+	multiple bool
+}
@@ -0,0 +1,108 @@
+// +build appengine
+
+package transaction
+
+import (
+	"fmt"
+
+	"appengine/datastore"
+)
+
+// SchemaVersionProperty is the property an entity's schema version is stored
+// in.
+const SchemaVersionProperty = "SchemaVersion"
+
+// A migration upgrades an entity's properties from one schema version to the
+// next. It can add, remove, rename or convert properties.
+type migration func(props []datastore.Property) ([]datastore.Property, error)
+
+// noMigration is the migration for a version whose properties are unchanged.
+func noMigration(props []datastore.Property) ([]datastore.Property, error) {
+	return props, nil
+}
+
+// accountMigrations[i] upgrades an Account from schema version i to i+1.
+var accountMigrations = []migration{
+	// 1: Accounts are versioned. Nothing else changed.
+	noMigration,
+}
+
+// splitMigrations[i] upgrades a Split from schema version i to i+1.
+var splitMigrations = []migration{
+	// 1: Splits are versioned. Nothing else changed.
+	noMigration,
+}
+
+// StoredSchemaVersion is the schema version of an entity with props.
+func StoredSchemaVersion(props []datastore.Property) int64 {
+	for _, p := range props {
+		if p.Name == SchemaVersionProperty {
+			if v, ok := p.Value.(int64); ok {
+				return v
+			}
+		}
+	}
+	return 0
+}
+
+// upgrade reads an entity's properties from c, and applies whichever of
+// migrations it's missing, so Load only ever sees the current schema. The
+// upgrade is stored the next time the entity is saved. The schema version
+// itself isn't among the properties, but is returned as stored.
+//
+// Entities from a newer schema, like those saved before a rollback, are left
+// alone, and Load keeps the properties it doesn't know with keepUnknown.
+func upgrade(c <-chan datastore.Property, migrations []migration) ([]datastore.Property, int64, error) {
+	var all []datastore.Property
+	for p := range c {
+		all = append(all, p)
+	}
+	version := StoredSchemaVersion(all)
+	if version < 0 {
+		return nil, 0, fmt.Errorf("Bad schema version %v", version)
+	}
+
+	props := make([]datastore.Property, 0, len(all))
+	for _, p := range all {
+		if p.Name != SchemaVersionProperty {
+			props = append(props, p)
+		}
+	}
+	for v := version; v < int64(len(migrations)); v++ {
+		var err error
+		if props, err = migrations[v](props); err != nil {
+			return nil, 0, fmt.Errorf("Migrating to schema version %v: %v", v+1, err)
+		}
+	}
+	return props, version, nil
+}
+
+// keepUnknown gets the unknownProperties of an entity stored with version, if
+// Load didn't know some of its properties, unknown, or version is newer than
+// current. Otherwise there's nothing to keep, and it returns nil.
+func keepUnknown(unknown []datastore.Property, version, current int64) *unknownProperties {
+	if len(unknown) == 0 && version <= current {
+		return nil
+	}
+
+	u := &unknownProperties{version: version}
+	for _, p := range unknown {
+		u.props = append(u.props, unknownProperty{p.Name, p.Value, p.NoIndex, p.Multiple})
+	}
+	return u
+}
+
+// saveUnknown sends the properties in u, which may be nil, on c, followed by
+// the schema version to store: u's if it's newer than current.
+func saveUnknown(c chan<- datastore.Property, u *unknownProperties, current int64) {
+	version := current
+	if u != nil {
+		for _, p := range u.props {
+			c <- datastore.Property{Name: p.name, Value: p.value, NoIndex: p.noIndex, Multiple: p.multiple}
+		}
+		if u.version > version {
+			version = u.version
+		}
+	}
+	c <- datastore.Property{Name: SchemaVersionProperty, Value: version}
+}
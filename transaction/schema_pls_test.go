@@ -0,0 +1,266 @@
+// +build appengine
+
+package transaction
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"appengine/datastore"
+)
+
+// propertyChan sends props on a closed channel, for Load.
+func propertyChan(props ...datastore.Property) <-chan datastore.Property {
+	c := make(chan datastore.Property, len(props))
+	for _, p := range props {
+		c <- p
+	}
+	close(c)
+	return c
+}
+
+func TestMigrationsMatchSchemaVersions(t *testing.T) {
+	if len(accountMigrations) != AccountSchemaVersion {
+		t.Errorf("Expected %v Account migrations, got %v", AccountSchemaVersion, len(accountMigrations))
+	}
+	if len(splitMigrations) != SplitSchemaVersion {
+		t.Errorf("Expected %v Split migrations, got %v", SplitSchemaVersion, len(splitMigrations))
+	}
+}
+
+func TestStoredSchemaVersion(t *testing.T) {
+	if v := StoredSchemaVersion([]datastore.Property{{Name: "Name", Value: "a"}}); v != 0 {
+		t.Errorf("Expected unversioned properties to be version 0, got %v", v)
+	}
+	if v := StoredSchemaVersion([]datastore.Property{{Name: SchemaVersionProperty, Value: int64(3)}}); v != 3 {
+		t.Errorf("Expected version 3, got %v", v)
+	}
+}
+
+func TestUpgrade(t *testing.T) {
+	rename := func(props []datastore.Property) ([]datastore.Property, error) {
+		for i := range props {
+			if props[i].Name == "Old" {
+				props[i].Name = "New"
+			}
+		}
+		return props, nil
+	}
+	double := func(props []datastore.Property) ([]datastore.Property, error) {
+		for i := range props {
+			if props[i].Name == "New" {
+				props[i].Value = props[i].Value.(int64) * 2
+			}
+		}
+		return props, nil
+	}
+	migrations := []migration{noMigration, rename, double}
+
+	for _, x := range []struct {
+		version  int64
+		props    []datastore.Property
+		expected []datastore.Property
+	}{
+		// Unversioned entities get every migration.
+		{-1, []datastore.Property{{Name: "Old", Value: int64(2)}}, []datastore.Property{{Name: "New", Value: int64(4)}}},
+		{1, []datastore.Property{{Name: "Old", Value: int64(2)}}, []datastore.Property{{Name: "New", Value: int64(4)}}},
+		{2, []datastore.Property{{Name: "New", Value: int64(2)}}, []datastore.Property{{Name: "New", Value: int64(4)}}},
+		{3, []datastore.Property{{Name: "New", Value: int64(2)}}, []datastore.Property{{Name: "New", Value: int64(2)}}},
+		// Newer entities are left alone.
+		{4, []datastore.Property{{Name: "Newer", Value: int64(2)}}, []datastore.Property{{Name: "Newer", Value: int64(2)}}},
+	} {
+		props := x.props
+		if x.version >= 0 {
+			props = append(props, datastore.Property{Name: SchemaVersionProperty, Value: x.version})
+		}
+		got, version, err := upgrade(propertyChan(props...), migrations)
+		if err != nil {
+			t.Errorf("Version %v: %v", x.version, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, x.expected) {
+			t.Errorf("Version %v: expected %v, got %v", x.version, x.expected, got)
+		}
+		if expected := x.version; version != expected && !(expected < 0 && version == 0) {
+			t.Errorf("Version %v: got stored version %v", x.version, version)
+		}
+	}
+}
+
+func TestUpgrade_FailureMigration(t *testing.T) {
+	failure := func([]datastore.Property) ([]datastore.Property, error) {
+		return nil, errors.New("failure")
+	}
+
+	if _, _, err := upgrade(propertyChan(datastore.Property{Name: "Name", Value: "a"}), []migration{failure}); err == nil {
+		t.Error("Expected a failed migration to fail the upgrade")
+	}
+}
+
+func TestAccountSave_SchemaVersion(t *testing.T) {
+	propChan := make(chan datastore.Property)
+	go func() {
+		if err := (&Account{Name: "a"}).Save(propChan); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	var props []datastore.Property
+	for p := range propChan {
+		props = append(props, p)
+	}
+	if v := StoredSchemaVersion(props); v != AccountSchemaVersion {
+		t.Errorf("Expected schema version %v, got %v", AccountSchemaVersion, v)
+	}
+}
+
+func TestAccountLoad_Unversioned(t *testing.T) {
+	loaded := &Account{}
+	err := loaded.Load(propertyChan(
+		datastore.Property{Name: "Name", Value: "a"},
+		datastore.Property{Name: "Total", Value: int64(100)}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Name != "a" || loaded.Total() != 100 {
+		t.Errorf("Expected a with total 100, got %+v", loaded)
+	}
+}
+
+// saveProperties saves e, and gets the properties it saved.
+func saveProperties(t *testing.T, e datastore.PropertyLoadSaver) []datastore.Property {
+	propChan := make(chan datastore.Property)
+	go func() {
+		if err := e.Save(propChan); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	var props []datastore.Property
+	for p := range propChan {
+		props = append(props, p)
+	}
+	return props
+}
+
+// expectProperty checks that props has a property name with value.
+func expectProperty(t *testing.T, props []datastore.Property, name string, value interface{}) {
+	for _, p := range props {
+		if p.Name == name {
+			if p.Value != value {
+				t.Errorf("Expected %v to be %v, got %v", name, value, p.Value)
+			}
+			return
+		}
+	}
+	t.Errorf("Expected a %v property in %v", name, props)
+}
+
+func TestAccountSaveAndLoad_KeepsUnknownProperties(t *testing.T) {
+	newer := int64(AccountSchemaVersion + 1)
+	loaded := &Account{}
+	err := loaded.Load(propertyChan(
+		datastore.Property{Name: "Name", Value: "a"},
+		datastore.Property{Name: "Currency", Value: "USD", NoIndex: true},
+		datastore.Property{Name: SchemaVersionProperty, Value: newer}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Name != "a" {
+		t.Errorf("Expected a, got %+v", loaded)
+	}
+
+	loaded.Name = "b"
+	props := saveProperties(t, loaded)
+	expectProperty(t, props, "Name", "b")
+	expectProperty(t, props, "Currency", "USD")
+	expectProperty(t, props, SchemaVersionProperty, newer)
+	for _, p := range props {
+		if p.Name == "Currency" && !p.NoIndex {
+			t.Errorf("Expected Currency to stay unindexed, got %+v", p)
+		}
+	}
+
+	reloaded := &Account{}
+	if err := reloaded.Load(propertyChan(props...)); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(reloaded, loaded) {
+		t.Errorf("Expected %+v to round trip, got %+v", loaded, reloaded)
+	}
+}
+
+func TestAccountSaveAndLoad_CurrentSchemaKeepsNothing(t *testing.T) {
+	loaded := &Account{}
+	if err := loaded.Load(propertyChan(saveProperties(t, &Account{Name: "a"})...)); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.unknown != nil {
+		t.Errorf("Expected nothing unknown, got %+v", loaded.unknown)
+	}
+}
+
+func TestSplitSave_SchemaVersion(t *testing.T) {
+	propChan := make(chan datastore.Property)
+	go func() {
+		if err := (&Split{Amount: 100}).Save(propChan); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	var props []datastore.Property
+	for p := range propChan {
+		props = append(props, p)
+	}
+	if v := StoredSchemaVersion(props); v != SplitSchemaVersion {
+		t.Errorf("Expected schema version %v, got %v", SplitSchemaVersion, v)
+	}
+}
+
+func TestSplitSaveAndLoad_KeepsUnknownProperties(t *testing.T) {
+	newer := int64(SplitSchemaVersion + 1)
+	loaded := &Split{}
+	err := loaded.Load(propertyChan(
+		datastore.Property{Name: "Amount", Value: int64(100)},
+		datastore.Property{Name: "Cleared", Value: true},
+		datastore.Property{Name: "Labels", Value: "a", Multiple: true},
+		datastore.Property{Name: "Labels", Value: "b", Multiple: true},
+		datastore.Property{Name: SchemaVersionProperty, Value: newer}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Amount != 100 {
+		t.Errorf("Expected 100, got %+v", loaded)
+	}
+
+	loaded.Payee = 3
+	props := saveProperties(t, loaded)
+	expectProperty(t, props, "Payee", int64(3))
+	expectProperty(t, props, "Cleared", true)
+	expectProperty(t, props, SchemaVersionProperty, newer)
+	labels := 0
+	for _, p := range props {
+		if p.Name == "Labels" && p.Multiple {
+			labels++
+		}
+	}
+	if labels != 2 {
+		t.Errorf("Expected both Labels to be saved, got %v", props)
+	}
+
+	reloaded := &Split{}
+	if err := reloaded.Load(propertyChan(props...)); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(reloaded, loaded) {
+		t.Errorf("Expected %+v to round trip, got %+v", loaded, reloaded)
+	}
+}
+
+func TestCategorizerCountsLoad_IgnoresUnknownProperties(t *testing.T) {
+	loaded := &CategorizerCounts{}
+	if err := loaded.Load(propertyChan(datastore.Property{Name: "Unknown", Value: "x"})); err != nil {
+		t.Error(err)
+	}
+}
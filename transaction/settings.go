@@ -0,0 +1,115 @@
+package transaction
+
+import (
+	"fmt"
+	"time"
+)
+
+// Settings are a user's preferences for reports. The zero value is calendar
+// years.
+//
+// TaxYearStartMonth and TaxYearStartDay are when each tax year starts, like
+// April 6 in the UK. Zero means January and the 1st.
+//
+// FiscalYearStartMonth is the month each fiscal year starts, for reports on
+// fiscal quarters and years. Zero means January. WeekStart is the lowercase
+// name of the day weeks start, and empty means Monday.
+//
+// TimeZone is the IANA name of the user's time zone, like
+// "America/Los_Angeles", and decides what day it is for them. Empty means
+// UTC.
+type Settings struct {
+	TaxYearStartMonth    time.Month `json:"taxYearStartMonth,omitempty"`
+	TaxYearStartDay      int        `json:"taxYearStartDay,omitempty"`
+	FiscalYearStartMonth time.Month `json:"fiscalYearStartMonth,omitempty"`
+	WeekStart            string     `json:"weekStart,omitempty"`
+	TimeZone             string     `json:"timeZone,omitempty"`
+}
+
+// weekdays maps the names of days allowed in Settings.WeekStart to the days.
+var weekdays = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+// validYearStart makes sure a month and day, where zero means January and the
+// 1st, can start a year every year. That rules out February 29th.
+func validYearStart(name string, m time.Month, d int) error {
+	if m < 0 || m > time.December {
+		return fmt.Errorf("%v start month %v is not a month.", name, int(m))
+	}
+	if m == 0 {
+		m = time.January
+	}
+	if d < 0 || d > time.Date(2001, m+1, 0, 0, 0, 0, 0, time.UTC).Day() {
+		return fmt.Errorf("%v start day %v is not in %v.", name, d, m)
+	}
+	return nil
+}
+
+// Make sure Settings are valid. Useful if they were provided by a user.
+func (s *Settings) Validate() error {
+	if err := validYearStart("Tax year", s.TaxYearStartMonth, s.TaxYearStartDay); err != nil {
+		return err
+	}
+	if err := validYearStart("Fiscal year", s.FiscalYearStartMonth, 0); err != nil {
+		return err
+	}
+	if _, ok := weekdays[s.WeekStart]; s.WeekStart != "" && !ok {
+		return fmt.Errorf("Week start %q is not a day.", s.WeekStart)
+	}
+	if _, err := time.LoadLocation(s.TimeZone); err != nil {
+		return fmt.Errorf("Unknown time zone %q", s.TimeZone)
+	}
+	return nil
+}
+
+// Location is the user's time zone. If TimeZone can't be loaded, which
+// Validate prevents, it's UTC.
+func (s *Settings) Location() *time.Location {
+	loc, err := time.LoadLocation(s.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// Today is the day it is for the user at now.
+func (s *Settings) Today(now time.Time) Date {
+	return DateOf(now.In(s.Location()))
+}
+
+// Calendar is the Calendar reports use for s.
+func (s *Settings) Calendar() Calendar {
+	c := Calendar{FiscalYearStart: s.FiscalYearStartMonth, WeekStart: time.Monday}
+	if c.FiscalYearStart == 0 {
+		c.FiscalYearStart = time.January
+	}
+	if d, ok := weekdays[s.WeekStart]; ok {
+		c.WeekStart = d
+	}
+	return c
+}
+
+// yearStarting is the year that starts on month m and day d of year, where
+// zero means January and the 1st.
+func yearStarting(year int, m time.Month, d int) DateRange {
+	if m == 0 {
+		m = time.January
+	}
+	if d == 0 {
+		d = 1
+	}
+	from := Date{year, m, d}
+	return DateRange{from, from.AddDate(1, 0, -1)}
+}
+
+// TaxYear is the tax year that starts in year.
+func (s *Settings) TaxYear(year int) DateRange {
+	return yearStarting(year, s.TaxYearStartMonth, s.TaxYearStartDay)
+}
@@ -0,0 +1,70 @@
+package transaction
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSettingsValidate(t *testing.T) {
+	for _, s := range []Settings{
+		{},
+		{TaxYearStartMonth: time.April, TaxYearStartDay: 6},
+		{TaxYearStartMonth: time.December, TaxYearStartDay: 31},
+		{FiscalYearStartMonth: time.July, WeekStart: "sunday"},
+		{TimeZone: "America/Los_Angeles"},
+	} {
+		if err := s.Validate(); err != nil {
+			t.Errorf("Expected %+v to be valid, got %v", s, err)
+		}
+	}
+	for _, s := range []Settings{
+		{TaxYearStartMonth: 13},
+		{TaxYearStartMonth: time.April, TaxYearStartDay: 31},
+		{TaxYearStartMonth: time.February, TaxYearStartDay: 29},
+		{TaxYearStartDay: -1},
+		{FiscalYearStartMonth: 13},
+		{WeekStart: "Sunday"},
+		{TimeZone: "Mars/Olympus_Mons"},
+	} {
+		if err := s.Validate(); err == nil {
+			t.Errorf("Expected %+v to be invalid", s)
+		}
+	}
+}
+
+func TestSettingsTaxYear(t *testing.T) {
+	calendar := &Settings{}
+	if got, expected := calendar.TaxYear(2014), (DateRange{testDate(2014, 1, 1), testDate(2014, 12, 31)}); got != expected {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+
+	uk := &Settings{TaxYearStartMonth: time.April, TaxYearStartDay: 6}
+	if got, expected := uk.TaxYear(2014), (DateRange{testDate(2014, 4, 6), testDate(2015, 4, 5)}); got != expected {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
+
+func TestSettingsCalendar(t *testing.T) {
+	if got := (&Settings{}).Calendar(); got != (Calendar{time.January, time.Monday}) {
+		t.Errorf("Expected calendar years and Monday weeks, got %+v", got)
+	}
+	s := &Settings{FiscalYearStartMonth: time.July, WeekStart: "sunday"}
+	if got := s.Calendar(); got != (Calendar{time.July, time.Sunday}) {
+		t.Errorf("Expected July fiscal years and Sunday weeks, got %+v", got)
+	}
+}
+
+func TestSettingsToday(t *testing.T) {
+	now := time.Date(2014, 11, 6, 6, 30, 0, 0, time.UTC)
+	if got, expected := (&Settings{}).Today(now), testDate(2014, 11, 6); got != expected {
+		t.Errorf("Expected %v in UTC, got %v", expected, got)
+	}
+	// It's still the evening before in Los Angeles.
+	la := &Settings{TimeZone: "America/Los_Angeles"}
+	if got, expected := la.Today(now), testDate(2014, 11, 5); got != expected {
+		t.Errorf("Expected %v in Los Angeles, got %v", expected, got)
+	}
+	if got := (&Settings{TimeZone: "Mars/Olympus_Mons"}).Location(); got != time.UTC {
+		t.Errorf("Expected an unknown time zone to be UTC, got %v", got)
+	}
+}
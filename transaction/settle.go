@@ -0,0 +1,128 @@
+package transaction
+
+import (
+	"errors"
+	"sort"
+)
+
+// A Settlement is a payment of Amount from the member at index From to the
+// member at index To, in the balances passed to Settle.
+type Settlement struct {
+	From   int        `json:"from"`
+	To     int        `json:"to"`
+	Amount AmountType `json:"amount"`
+}
+
+// MaxSettleMembers is the most balances Settle will handle. Its running time
+// grows exponentially with the number of balances.
+const MaxSettleMembers = 16
+
+// Settle finds the fewest payments that bring every balance to 0. A positive
+// balance is owed to its member, and a negative one is owed by its member, so
+// balances must add to 0.
+//
+// Members whose balances add to 0 among themselves can settle up without
+// anyone else, in one fewer payment than there are members. So the fewest
+// payments come from partitioning the members into as many zero-sum subsets as
+// possible, which is found by dynamic programming over subsets of members.
+func Settle(balances []AmountType) ([]Settlement, error) {
+	n := len(balances)
+	if n > MaxSettleMembers {
+		return nil, errors.New("Too many members to settle up.")
+	}
+
+	sums := make([]AmountType, 1<<uint(n))
+	best := make([]int, 1<<uint(n))
+	for mask := 1; mask < len(sums); mask++ {
+		for i := 0; i < n; i++ {
+			bit := 1 << uint(i)
+			if mask&bit == 0 {
+				continue
+			}
+			sums[mask] = sums[mask^bit] + balances[i]
+			if best[mask^bit] > best[mask] {
+				best[mask] = best[mask^bit]
+			}
+		}
+		if sums[mask] == 0 {
+			best[mask]++
+		}
+	}
+	full := len(sums) - 1
+	if sums[full] != 0 {
+		return nil, errors.New("Balances don't add to 0.")
+	}
+
+	// Walk back down from the full set, removing one member at a time while
+	// keeping the most zero-sum subsets. The differences between the zero-sum
+	// sets on the way down are the partition.
+	result := make([]Settlement, 0)
+	mask, group := full, full
+	for mask != 0 {
+		next := -1
+		for i := 0; i < n && next < 0; i++ {
+			bit := 1 << uint(i)
+			if mask&bit == 0 {
+				continue
+			}
+			expected := best[mask]
+			if sums[mask] == 0 {
+				expected--
+			}
+			if best[mask^bit] == expected {
+				next = mask ^ bit
+			}
+		}
+		mask = next
+		if sums[mask] == 0 {
+			result = append(result, settleGroup(balances, group^mask)...)
+			group = mask
+		}
+	}
+	return result, nil
+}
+
+// settleGroup settles the balances of the members in mask, which add to 0,
+// by repeatedly paying the largest creditor from the largest debtor. Each
+// payment clears at least one member, so there's one fewer payment than
+// members.
+func settleGroup(balances []AmountType, mask int) []Settlement {
+	remaining := make(map[int]AmountType)
+	for i := range balances {
+		if mask&(1<<uint(i)) != 0 && balances[i] != 0 {
+			remaining[i] = balances[i]
+		}
+	}
+
+	result := make([]Settlement, 0)
+	for len(remaining) > 0 {
+		members := make([]int, 0, len(remaining))
+		for i := range remaining {
+			members = append(members, i)
+		}
+		// Sort by balance, breaking ties by index so results are deterministic.
+		sort.Slice(members, func(a, b int) bool {
+			if remaining[members[a]] != remaining[members[b]] {
+				return remaining[members[a]] < remaining[members[b]]
+			}
+			return members[a] < members[b]
+		})
+
+		debtor, creditor := members[0], members[len(members)-1]
+		amount := -remaining[debtor]
+		if remaining[creditor] < amount {
+			amount = remaining[creditor]
+		}
+		result = append(result, Settlement{From: debtor, To: creditor, Amount: amount})
+
+		remaining[debtor] += amount
+		remaining[creditor] -= amount
+		if remaining[debtor] == 0 {
+			delete(remaining, debtor)
+		}
+		if remaining[creditor] == 0 {
+			delete(remaining, creditor)
+		}
+	}
+	return result
+}
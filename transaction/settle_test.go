@@ -0,0 +1,61 @@
+package transaction
+
+import "testing"
+
+// Expectation function that applies settlements to balances, and checks that
+// they clear every balance in the expected number of payments.
+func expectSettled(t *testing.T, balances []AmountType, settlements []Settlement, payments int) {
+	remaining := make([]AmountType, len(balances))
+	copy(remaining, balances)
+	for _, s := range settlements {
+		if s.Amount <= 0 {
+			t.Errorf("Expected positive settlement, got %+v", s)
+		}
+		remaining[s.From] += s.Amount
+		remaining[s.To] -= s.Amount
+	}
+	for i := range remaining {
+		if remaining[i] != 0 {
+			t.Errorf("Expected settlements %+v to clear %v, but %v remains for %v",
+				settlements, balances, remaining[i], i)
+		}
+	}
+	if len(settlements) != payments {
+		t.Errorf("Expected %v payments to settle %v, got %+v", payments, balances, settlements)
+	}
+}
+
+func TestSettle(t *testing.T) {
+	for _, test := range []struct {
+		balances []AmountType
+		payments int
+	}{
+		{[]AmountType{}, 0},
+		{[]AmountType{0, 0}, 0},
+		{[]AmountType{60, -30, -30}, 2},
+		{[]AmountType{-10, 10}, 1},
+		// Greedily paying the largest creditor first takes 4 payments here, but
+		// {5, -5} and {7, -3, -4} can settle separately in 3.
+		{[]AmountType{5, 7, -5, -3, -4}, 3},
+		{[]AmountType{1, 2, 3, -6, 0}, 3},
+	} {
+		s, err := Settle(test.balances)
+		if err != nil {
+			t.Errorf("Failed to settle %v: %v", test.balances, err)
+			continue
+		}
+		expectSettled(t, test.balances, s, test.payments)
+	}
+}
+
+func TestSettle_Unbalanced(t *testing.T) {
+	if _, err := Settle([]AmountType{10, -5}); err == nil {
+		t.Errorf("Expected unbalanced balances to fail")
+	}
+}
+
+func TestSettle_TooMany(t *testing.T) {
+	if _, err := Settle(make([]AmountType, MaxSettleMembers+1)); err == nil {
+		t.Errorf("Expected too many balances to fail")
+	}
+}
@@ -0,0 +1,89 @@
+// +build appengine
+
+package transaction
+
+import (
+	"time"
+
+	"appengine/datastore"
+)
+
+// Implement PropertyLoadSaver for transaction.Split to store its Date as the
+// time it starts in UTC, or the zero time if it's zero. That's how Split dates
+// were stored before they were Dates, so older Splits load unchanged, and
+// queries can filter on Date with the same times.
+//
+// Like Accounts, older Splits are upgraded to the current schema as they're
+// loaded, and properties from newer ones are kept in the hidden field unknown.
+func (s *Split) Load(c <-chan datastore.Property) error {
+	props, version, err := upgrade(c, splitMigrations)
+	if err != nil {
+		return err
+	}
+
+	var unknown []datastore.Property
+	for _, p := range props {
+		switch p.Name {
+		case "Amount":
+			s.Amount = AmountType(p.Value.(int64))
+		case "Account":
+			s.Account = p.Value.(int64)
+		case "Memo":
+			s.Memo = p.Value.(string)
+		case "Date":
+			s.Date = storedDate(p.Value.(time.Time))
+		case "Created":
+			s.Created = p.Value.(time.Time)
+		case "Payee":
+			s.Payee = p.Value.(int64)
+		case "Tags":
+			s.Tags = append(s.Tags, p.Value.(string))
+		case "Reclassified":
+			s.Reclassified = p.Value.(string)
+		case "ExternalID":
+			s.ExternalID = p.Value.(string)
+		default:
+			unknown = append(unknown, p)
+		}
+	}
+	s.unknown = keepUnknown(unknown, version, SplitSchemaVersion)
+
+	return nil
+}
+
+// See Split.Load.
+func (s *Split) Save(c chan<- datastore.Property) error {
+	defer close(c)
+
+	c <- datastore.Property{Name: "Amount", Value: int64(s.Amount)}
+	c <- datastore.Property{Name: "Account", Value: s.Account}
+	c <- datastore.Property{Name: "Memo", Value: s.Memo}
+	c <- datastore.Property{Name: "Date", Value: SplitDateQueryValue(s.Date)}
+	c <- datastore.Property{Name: "Created", Value: s.Created}
+	c <- datastore.Property{Name: "Payee", Value: s.Payee}
+	for _, tag := range s.Tags {
+		c <- datastore.Property{Name: "Tags", Value: tag, Multiple: true}
+	}
+	c <- datastore.Property{Name: "Reclassified", Value: s.Reclassified}
+	c <- datastore.Property{Name: "ExternalID", Value: s.ExternalID}
+	saveUnknown(c, s.unknown, SplitSchemaVersion)
+
+	return nil
+}
+
+// SplitDateQueryValue is d as a Split's Date is stored, to compare with it in
+// a datastore query filter.
+func SplitDateQueryValue(d Date) time.Time {
+	if d.IsZero() {
+		return time.Time{}
+	}
+	return d.In(time.UTC)
+}
+
+// storedDate is the Date stored as t, undoing SplitDateQueryValue.
+func storedDate(t time.Time) Date {
+	if t.IsZero() {
+		return Date{}
+	}
+	return DateOf(t.UTC())
+}
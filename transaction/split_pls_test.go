@@ -0,0 +1,77 @@
+// +build appengine
+
+package transaction
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"appengine/datastore"
+)
+
+func TestSplitSaveAndLoad(t *testing.T) {
+	saved := &Split{
+		Amount:       -12345,
+		Account:      7,
+		Memo:         "Groceries",
+		Date:         testDate(2014, 11, 5),
+		Created:      time.Date(2014, 11, 6, 6, 30, 0, 0, time.UTC),
+		Payee:        3,
+		Tags:         []string{"food", "tax:medical"},
+		Reclassified: "x2",
+		ExternalID:   "bank-1",
+	}
+
+	propChan := make(chan datastore.Property)
+	go func() {
+		err := saved.Save(propChan)
+		if err != nil {
+			t.Errorf("Failed to save %v: %v", saved, err)
+		}
+	}()
+
+	loaded := &Split{}
+	err := loaded.Load(propChan)
+	if err != nil {
+		t.Errorf("Failed to load into %v: %v", loaded, err)
+	}
+
+	if !reflect.DeepEqual(loaded, saved) {
+		t.Errorf("Loaded value %v was not the same as saved value %v", loaded, saved)
+	}
+}
+
+func TestSplitLoad_DateStoredAsTime(t *testing.T) {
+	propChan := make(chan datastore.Property, 2)
+	propChan <- datastore.Property{Name: "Amount", Value: int64(100)}
+	propChan <- datastore.Property{Name: "Date", Value: testTime(2014, 11, 5)}
+	close(propChan)
+
+	loaded := &Split{}
+	if err := loaded.Load(propChan); err != nil {
+		t.Fatal(err)
+	}
+	if expected := testDate(2014, 11, 5); loaded.Date != expected || !loaded.Created.IsZero() {
+		t.Errorf("Expected a Split on %v with no creation time, got %+v", expected, loaded)
+	}
+}
+
+func TestSplitSaveAndLoad_NoDate(t *testing.T) {
+	saved := &Split{Amount: 100}
+
+	propChan := make(chan datastore.Property)
+	go func() {
+		if err := saved.Save(propChan); err != nil {
+			t.Errorf("Failed to save %v: %v", saved, err)
+		}
+	}()
+
+	loaded := &Split{}
+	if err := loaded.Load(propChan); err != nil {
+		t.Errorf("Failed to load into %v: %v", loaded, err)
+	}
+	if !loaded.Date.IsZero() {
+		t.Errorf("Expected no date, got %v", loaded.Date)
+	}
+}
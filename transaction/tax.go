@@ -0,0 +1,135 @@
+package transaction
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// TaxTagPrefix marks a Split's tag as a tax category, so "tax:medical" puts
+// the Split in the "medical" category regardless of its Account's.
+const TaxTagPrefix = "tax:"
+
+// A TaxItem is a Split in a tax category. Amount is positive for both
+// deductible spending and taxable income. Attachments link to the
+// transaction's receipts, and are filled in by callers that know where
+// they're served.
+type TaxItem struct {
+	Category    string     `json:"category"`
+	Transaction string     `json:"transaction"`
+	Account     int64      `json:"account"`
+	AccountName string     `json:"accountName"`
+	Date        Date       `json:"date"`
+	Memo        string     `json:"memo"`
+	Amount      AmountType `json:"amount"`
+	Attachments []string   `json:"attachments,omitempty"`
+}
+
+// A TaxCategoryTotal is the sum of the TaxItems in Category.
+type TaxCategoryTotal struct {
+	Category string     `json:"category"`
+	Total    AmountType `json:"total"`
+}
+
+// A TaxReport collects the TaxItems in Year, with a total per category.
+type TaxReport struct {
+	Year   DateRange          `json:"year"`
+	Totals []TaxCategoryTotal `json:"totals"`
+	Items  []TaxItem          `json:"items"`
+}
+
+// NormalizeTaxCategory makes tax categories compare equal regardless of case
+// and spacing.
+func NormalizeTaxCategory(category string) string {
+	return normalizePayeeName(category)
+}
+
+// taxCategory is the tax category of s: from its first tax tag if it has one,
+// otherwise from categories, which maps Accounts to their tax categories.
+func taxCategory(s *Split, categories map[int64]string) string {
+	for _, t := range s.Tags {
+		if strings.HasPrefix(t, TaxTagPrefix) {
+			if c := NormalizeTaxCategory(strings.TrimPrefix(t, TaxTagPrefix)); c != "" {
+				return c
+			}
+		}
+	}
+	return categories[s.Account]
+}
+
+// NewTaxReport builds the TaxReport for year from splits, the Splits in
+// accounts. ids parallels splits, and holds each Split's transaction id.
+//
+// Only Splits in Income and Expense Accounts are items, since tags are set on
+// every Split in a transaction, and the other side of a deductible expense is
+// just how it was paid.
+func NewTaxReport(accounts map[int64]Account, categories map[int64]string, splits []Split, ids []string, year DateRange) *TaxReport {
+	result := &TaxReport{Year: year, Totals: make([]TaxCategoryTotal, 0), Items: make([]TaxItem, 0)}
+	totals := make(map[string]AmountType)
+	for i := range splits {
+		s := &splits[i]
+		a, ok := accounts[s.Account]
+		if !ok || (a.Type != Income && a.Type != Expense) || !year.Contains(s.Date) {
+			continue
+		}
+		category := taxCategory(s, categories)
+		if category == "" {
+			continue
+		}
+
+		amount := s.Amount
+		if a.Type == Income {
+			amount = -amount
+		}
+		result.Items = append(result.Items, TaxItem{
+			Category:    category,
+			Transaction: ids[i],
+			Account:     s.Account,
+			AccountName: a.Name,
+			Date:        s.Date,
+			Memo:        s.Memo,
+			Amount:      amount,
+		})
+		totals[category] += amount
+	}
+
+	sort.SliceStable(result.Items, func(i, j int) bool {
+		a, b := &result.Items[i], &result.Items[j]
+		if a.Category != b.Category {
+			return a.Category < b.Category
+		}
+		return a.Date.Before(b.Date)
+	})
+	for category, total := range totals {
+		result.Totals = append(result.Totals, TaxCategoryTotal{category, total})
+	}
+	sort.Slice(result.Totals, func(i, j int) bool {
+		return result.Totals[i].Category < result.Totals[j].Category
+	})
+	return result
+}
+
+// WriteCSV writes r to w as CSV: the itemized list, one TaxItem per row with
+// its attachment links separated by spaces, then the total of each category.
+func (r *TaxReport) WriteCSV(w io.Writer) error {
+	c := csv.NewWriter(w)
+	if err := c.Write([]string{"Category", "Date", "Account", "Memo", "Amount", "Attachments"}); err != nil {
+		return err
+	}
+	for _, item := range r.Items {
+		row := []string{item.Category, item.Date.String(), item.AccountName, item.Memo,
+			fmt.Sprint(item.Amount), strings.Join(item.Attachments, " ")}
+		if err := c.Write(row); err != nil {
+			return err
+		}
+	}
+	for _, total := range r.Totals {
+		if err := c.Write(csvRow("Total "+total.Category, []AmountType{total.Total})); err != nil {
+			return err
+		}
+	}
+	c.Flush()
+	return c.Error()
+}
@@ -0,0 +1,68 @@
+package transaction
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestNewTaxReport(t *testing.T) {
+	accounts := map[int64]Account{
+		1: {Name: "Checking", Type: Asset},
+		2: {Name: "Doctor", Type: Expense},
+		3: {Name: "Donations", Type: Expense},
+		4: {Name: "Consulting", Type: Income},
+		5: {Name: "Groceries", Type: Expense},
+	}
+	categories := map[int64]string{2: "medical", 3: "charitable", 4: "business income"}
+	splits := []Split{
+		{Amount: 5000, Account: 2, Date: testDate(2014, 3, 1), Memo: "Checkup"},
+		{Amount: -5000, Account: 1, Date: testDate(2014, 3, 1), Memo: "Checkup"},
+		{Amount: 10000, Account: 3, Date: testDate(2014, 12, 20), Memo: "Food bank"},
+		{Amount: -10000, Account: 1, Date: testDate(2014, 12, 20), Memo: "Food bank"},
+		{Amount: -80000, Account: 4, Date: testDate(2014, 6, 1), Memo: "Invoice 7"},
+		{Amount: 80000, Account: 1, Date: testDate(2014, 6, 1), Memo: "Invoice 7"},
+		{Amount: 2000, Account: 5, Date: testDate(2014, 5, 5), Memo: "Pharmacy", Tags: []string{"tax:Medical"}},
+		{Amount: -2000, Account: 1, Date: testDate(2014, 5, 5), Memo: "Pharmacy", Tags: []string{"tax:Medical"}},
+		{Amount: 3000, Account: 5, Date: testDate(2014, 5, 6), Memo: "Bread"},
+		{Amount: 7000, Account: 2, Date: testDate(2015, 1, 2), Memo: "Next year"},
+	}
+	ids := []string{"a", "a", "b", "b", "c", "c", "d", "d", "e", "f"}
+
+	got := NewTaxReport(accounts, categories, splits, ids, DateRange{testDate(2014, 1, 1), testDate(2014, 12, 31)})
+
+	expectedTotals := []TaxCategoryTotal{{"business income", 80000}, {"charitable", 10000}, {"medical", 7000}}
+	if !reflect.DeepEqual(got.Totals, expectedTotals) {
+		t.Errorf("Expected totals %+v, got %+v", expectedTotals, got.Totals)
+	}
+	expectedItems := []TaxItem{
+		{Category: "business income", Transaction: "c", Account: 4, AccountName: "Consulting", Date: testDate(2014, 6, 1), Memo: "Invoice 7", Amount: 80000},
+		{Category: "charitable", Transaction: "b", Account: 3, AccountName: "Donations", Date: testDate(2014, 12, 20), Memo: "Food bank", Amount: 10000},
+		{Category: "medical", Transaction: "a", Account: 2, AccountName: "Doctor", Date: testDate(2014, 3, 1), Memo: "Checkup", Amount: 5000},
+		{Category: "medical", Transaction: "d", Account: 5, AccountName: "Groceries", Date: testDate(2014, 5, 5), Memo: "Pharmacy", Amount: 2000},
+	}
+	if !reflect.DeepEqual(got.Items, expectedItems) {
+		t.Errorf("Expected items %+v, got %+v", expectedItems, got.Items)
+	}
+}
+
+func TestTaxReportWriteCSV(t *testing.T) {
+	r := &TaxReport{
+		Totals: []TaxCategoryTotal{{"medical", 5000}},
+		Items: []TaxItem{{Category: "medical", Transaction: "a", AccountName: "Doctor", Date: testDate(2014, 3, 1),
+			Memo: "Checkup, annual", Amount: 5000, Attachments: []string{"/a/1", "/a/2"}}},
+	}
+
+	var b bytes.Buffer
+	if err := r.WriteCSV(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `Category,Date,Account,Memo,Amount,Attachments
+medical,2014-03-01,Doctor,"Checkup, annual",5000,/a/1 /a/2
+Total medical,5000
+`
+	if b.String() != expected {
+		t.Errorf("Expected CSV\n%v\ngot\n%v", expected, b.String())
+	}
+}
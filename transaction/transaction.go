@@ -13,12 +13,28 @@ type AmountType int64
 // A Split is the addition or subtraction of an amount from a single account,
 // as part of a transaction.
 //
-// Account is an account id as used in AddAccount.
+// Account is an account id as used in AddAccount. Payee and Tags categorize
+// the Split, and aren't part of its transaction's value, so they can change
+// after it's committed. So can Reclassified, the id of a later transaction
+// which moved the Split's transaction to a different counter account.
+//
+// ExternalID is the id a bank gave the Split, if it was imported.
+//
+// Date is the day the Split happened, as the user or bank gave it, with no
+// time zone. Created is the instant it was committed, which is zero for
+// Splits committed before it was tracked.
 type Split struct {
-	Amount  AmountType `json:"amount"`
-	Account int64      `json:"account"`
-	Memo    string     `json:"memo"`
-	Date    time.Time  `json:"date"`
+	Amount       AmountType `json:"amount"`
+	Account      int64      `json:"account"`
+	Memo         string     `json:"memo"`
+	Date         Date       `json:"date"`
+	Created      time.Time  `json:"created"`
+	Payee        int64      `json:"payee,omitempty"`
+	Tags         []string   `json:"tags,omitempty"`
+	Reclassified string     `json:"reclassified,omitempty"`
+	ExternalID   string     `json:"externalId,omitempty"`
+
+	unknown *unknownProperties
 }
 
 // A Transaction is a series of splits that conform to double-entry accounting
@@ -0,0 +1,79 @@
+package transaction
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// TransferWindow is how far apart the two halves of a transfer can be dated,
+// since each bank posts it on its own schedule.
+const TransferWindow = 4 * 24 * time.Hour
+
+// A TransferHalf is one side of a transfer between two of a user's Asset or
+// Liability Accounts, as imported from one bank. It can't be committed alone,
+// since it doesn't balance, so it waits to be matched with the other side.
+type TransferHalf struct {
+	Account    int64      `json:"account"`
+	Amount     AmountType `json:"amount"`
+	Date       Date       `json:"date"`
+	Memo       string     `json:"memo"`
+	ExternalID string     `json:"externalId"`
+}
+
+// Make sure a TransferHalf moves some money on some date. Useful if it was
+// created with user-provided data.
+func (h *TransferHalf) Validate() error {
+	if h.Account == 0 {
+		return errors.New("Transfer has no account.")
+	}
+	if h.Amount == 0 {
+		return errors.New("Transfer has no amount.")
+	}
+	if h.Date.IsZero() {
+		return errors.New("Transfer has no date.")
+	}
+	return nil
+}
+
+// Split is h as a Split in its Account.
+func (h *TransferHalf) Split() *Split {
+	return &Split{
+		Amount:     h.Amount,
+		Account:    h.Account,
+		Memo:       h.Memo,
+		Date:       h.Date,
+		ExternalID: h.ExternalID,
+	}
+}
+
+// MatchTransfer finds the other half of h's transfer in candidates: an equal
+// and opposite amount in a different Account, within TransferWindow. If more
+// than one matches, the closest in date wins, then the earliest in
+// candidates. It returns the index of the match, or -1 if there isn't one.
+func MatchTransfer(h *TransferHalf, candidates []TransferHalf) int {
+	best, bestApart := -1, math.Inf(1)
+	for i := range candidates {
+		c := &candidates[i]
+		if c.Account == h.Account || c.Amount != -h.Amount {
+			continue
+		}
+		apart := math.Abs(float64(c.Date.DaysSince(h.Date))) * float64(24*time.Hour)
+		if apart <= float64(TransferWindow) && apart < bestApart {
+			best, bestApart = i, apart
+		}
+	}
+	return best
+}
+
+// MergeTransfer makes one balanced transaction from the two halves of a
+// transfer. Each Split keeps its own bank's ExternalID, but they share the
+// memo and date of the outflow, which is when the money left.
+func MergeTransfer(a, b *TransferHalf) []*Split {
+	from, to := a.Split(), b.Split()
+	if from.Amount > 0 {
+		from, to = to, from
+	}
+	to.Memo, to.Date = from.Memo, from.Date
+	return []*Split{from, to}
+}
@@ -0,0 +1,45 @@
+// +build appengine
+
+package transaction
+
+import (
+	"time"
+
+	"appengine/datastore"
+)
+
+// Implement PropertyLoadSaver for transaction.TransferHalf, since datastore
+// can't hold a Date. Date is stored like a Split's Date, see
+// SplitDateQueryValue, so the transfer queue can be ordered by it. Unknown
+// properties are ignored.
+func (h *TransferHalf) Load(c <-chan datastore.Property) error {
+	for p := range c {
+		switch p.Name {
+		case "Account":
+			h.Account = p.Value.(int64)
+		case "Amount":
+			h.Amount = AmountType(p.Value.(int64))
+		case "Date":
+			h.Date = storedDate(p.Value.(time.Time))
+		case "Memo":
+			h.Memo = p.Value.(string)
+		case "ExternalID":
+			h.ExternalID = p.Value.(string)
+		}
+	}
+
+	return nil
+}
+
+// See TransferHalf.Load.
+func (h *TransferHalf) Save(c chan<- datastore.Property) error {
+	defer close(c)
+
+	c <- datastore.Property{Name: "Account", Value: h.Account}
+	c <- datastore.Property{Name: "Amount", Value: int64(h.Amount)}
+	c <- datastore.Property{Name: "Date", Value: SplitDateQueryValue(h.Date)}
+	c <- datastore.Property{Name: "Memo", Value: h.Memo}
+	c <- datastore.Property{Name: "ExternalID", Value: h.ExternalID}
+
+	return nil
+}
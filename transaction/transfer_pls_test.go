@@ -0,0 +1,28 @@
+// +build appengine
+
+package transaction
+
+import (
+	"testing"
+
+	"appengine/datastore"
+)
+
+func TestTransferHalfSaveAndLoad(t *testing.T) {
+	saved := &TransferHalf{Account: 1, Amount: -500, Date: testDate(2014, 11, 5), Memo: "CARD PAYMENT", ExternalID: "bank-1"}
+
+	propChan := make(chan datastore.Property)
+	go func() {
+		if err := saved.Save(propChan); err != nil {
+			t.Errorf("Failed to save %v: %v", saved, err)
+		}
+	}()
+
+	loaded := &TransferHalf{}
+	if err := loaded.Load(propChan); err != nil {
+		t.Errorf("Failed to load into %v: %v", loaded, err)
+	}
+	if *loaded != *saved {
+		t.Errorf("Loaded value %+v was not the same as saved value %+v", loaded, saved)
+	}
+}
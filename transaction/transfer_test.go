@@ -0,0 +1,65 @@
+package transaction
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTransferHalfValidate(t *testing.T) {
+	valid := TransferHalf{Account: 1, Amount: -500, Date: testDate(2014, 11, 5)}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Expected valid, got %v", err)
+	}
+
+	for _, change := range []func(h *TransferHalf){
+		func(h *TransferHalf) { h.Account = 0 },
+		func(h *TransferHalf) { h.Amount = 0 },
+		func(h *TransferHalf) { h.Date = Date{} },
+	} {
+		h := valid
+		change(&h)
+		if err := h.Validate(); err == nil {
+			t.Errorf("Expected transfer %+v to be invalid", h)
+		}
+	}
+}
+
+func TestMatchTransfer(t *testing.T) {
+	h := &TransferHalf{Account: 1, Amount: -500, Date: testDate(2014, 11, 5)}
+	candidates := []TransferHalf{
+		{Account: 1, Amount: 500, Date: testDate(2014, 11, 5)},
+		{Account: 2, Amount: 500, Date: testDate(2014, 11, 10)},
+		{Account: 2, Amount: -500, Date: testDate(2014, 11, 5)},
+		{Account: 2, Amount: 500, Date: testDate(2014, 11, 8)},
+		{Account: 3, Amount: 500, Date: testDate(2014, 11, 6)},
+		{Account: 2, Amount: 501, Date: testDate(2014, 11, 5)},
+	}
+
+	if i := MatchTransfer(h, candidates); i != 4 {
+		t.Errorf("Expected closest match 4, got %v", i)
+	}
+	if i := MatchTransfer(h, candidates[:3]); i != -1 {
+		t.Errorf("Expected no match, got %v", i)
+	}
+}
+
+func TestMergeTransfer(t *testing.T) {
+	in := &TransferHalf{Account: 2, Amount: 500, Date: testDate(2014, 11, 7), Memo: "PAYMENT THANK YOU", ExternalID: "card-1"}
+	out := &TransferHalf{Account: 1, Amount: -500, Date: testDate(2014, 11, 5), Memo: "CARD PAYMENT", ExternalID: "bank-1"}
+
+	got := MergeTransfer(in, out)
+
+	expected := []*Split{
+		{Amount: -500, Account: 1, Memo: "CARD PAYMENT", Date: testDate(2014, 11, 5), ExternalID: "bank-1"},
+		{Amount: 500, Account: 2, Memo: "CARD PAYMENT", Date: testDate(2014, 11, 5), ExternalID: "card-1"},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, got)
+	}
+
+	x := NewTransaction()
+	x.AddSplits(got)
+	if err := x.ValidateAmount(); err != nil {
+		t.Errorf("Expected merged transfer to balance, got %v", err)
+	}
+}